@@ -0,0 +1,67 @@
+package acceptor
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/rain/internal/utp"
+)
+
+// Listen opens a TCP listener for accepting peer connections.
+// SO_REUSEADDR is set on the socket, so the same port can be bound again right after the listener is closed,
+// even if there are connections still in TIME_WAIT state.
+// The listen backlog is not configurable from Go and is determined by the operating system (e.g. net.core.somaxconn on Linux).
+// If ip is an IPv6 address, the listener accepts IPv6 connections. The unspecified IPv6 address "::" accepts both IPv4 and IPv6 connections.
+func Listen(ip net.IP, port int) (*net.TCPListener, error) {
+	return listen(ip, port, setReuseAddr)
+}
+
+// ListenReusePort is like Listen but also sets SO_REUSEPORT on the socket,
+// so outgoing connections can be bound to the same port with a dialer returned from ReusePortDialer.
+// It returns an error on platforms that do not support SO_REUSEPORT.
+func ListenReusePort(ip net.IP, port int) (*net.TCPListener, error) {
+	return listen(ip, port, setReusePort)
+}
+
+// ReusePortDialer returns a dialer for connections bound to the port of a listener opened with ListenReusePort.
+// Connecting to the same address twice from the same port fails until the previous connection leaves TIME_WAIT state.
+func ReusePortDialer(ip net.IP, port int, timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   timeout,
+		LocalAddr: &net.TCPAddr{IP: ip, Port: port},
+		Control:   setReusePort,
+	}
+}
+
+func listen(ip net.IP, port int, control func(network, address string, c syscall.RawConn) error) (*net.TCPListener, error) {
+	lc := net.ListenConfig{Control: control}
+	network := "tcp4"
+	host := ""
+	if ip != nil {
+		host = ip.String()
+		if ip.To4() == nil {
+			network = "tcp"
+		}
+	}
+	l, err := lc.Listen(context.Background(), network, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return l.(*net.TCPListener), nil
+}
+
+// ListenUTP opens a UDP socket for accepting uTP peer connections. The network is selected by ip in the same way as Listen.
+func ListenUTP(ip net.IP, port int) (*utp.Socket, error) {
+	network := "udp4"
+	host := ""
+	if ip != nil {
+		host = ip.String()
+		if ip.To4() == nil {
+			network = "udp"
+		}
+	}
+	return utp.Listen(network, net.JoinHostPort(host, strconv.Itoa(port)))
+}
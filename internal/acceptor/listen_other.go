@@ -0,0 +1,10 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package acceptor
+
+import "syscall"
+
+// On Windows SO_REUSEADDR allows binding to a port that is in use by another socket, so it is not set.
+func setReuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
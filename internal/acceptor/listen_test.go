@@ -0,0 +1,40 @@
+package acceptor
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestListenReuseAddr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEADDR is not set on windows")
+	}
+	ip := net.IPv4(127, 0, 0, 1)
+	l, err := Listen(ip, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	// Close the accepted connection from listener side, so the port is left in TIME_WAIT state.
+	c, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Close()
+	_, _ = io.Copy(io.Discard, c)
+	c.Close()
+	l.Close()
+
+	l, err = Listen(ip, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/google/btree"
 )
 
+// Delay between retries of an address is not increased above this value.
+const maxRetryBackoff = time.Hour
+
 // AddrList contains peer addresses that are ready to be connected.
 type AddrList struct {
 	peerByTime     []*peerAddr
@@ -23,10 +26,31 @@ type AddrList struct {
 	blocklist  *blocklist.Blocklist
 
 	countBySource map[peersource.Source]int
+
+	// Addresses that have failed to connect, keyed by address.
+	// Includes the addresses that are being retried at the moment.
+	// Number of entries is limited by maxItems.
+	retries map[string]*retryAddr
+	// Addresses waiting for the next retry, sorted by retry time.
+	retryQueue   []*retryAddr
+	maxRetries   int
+	retryBackoff time.Duration
+	now          func() time.Time
+}
+
+type retryAddr struct {
+	addr     *net.TCPAddr
+	source   peersource.Source
+	failures int
+	nextTry  time.Time
+	queued   bool
 }
 
 // New returns a new AddrList.
-func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP *net.IP) *AddrList {
+// Addresses that fail to connect are retried up to maxRetries times.
+// Delay before the first retry is retryBackoff and it is doubled after each failure, up to an hour.
+// At most maxItems addresses are kept for retrying.
+func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP *net.IP, maxRetries int, retryBackoff time.Duration) *AddrList {
 	return &AddrList{
 		peerByPriority: btree.New(2),
 
@@ -35,6 +59,10 @@ func New(maxItems int, blocklist *blocklist.Blocklist, listenPort int, clientIP
 		clientIP:      clientIP,
 		blocklist:     blocklist,
 		countBySource: make(map[peersource.Source]int),
+		retries:       make(map[string]*retryAddr),
+		maxRetries:    maxRetries,
+		retryBackoff:  retryBackoff,
+		now:           time.Now,
 	}
 }
 
@@ -43,6 +71,8 @@ func (d *AddrList) Reset() {
 	d.peerByTime = nil
 	d.peerByPriority.Clear(false)
 	d.countBySource = make(map[peersource.Source]int)
+	d.retries = make(map[string]*retryAddr)
+	d.retryQueue = nil
 }
 
 // Len returns the number of addresses in the list.
@@ -55,11 +85,31 @@ func (d *AddrList) LenSource(s peersource.Source) int {
 	return d.countBySource[s]
 }
 
+// LenRetry returns the number of addresses waiting to be retried.
+func (d *AddrList) LenRetry() int {
+	return len(d.retryQueue)
+}
+
+// NextRetry returns the time of the earliest retry. Returns false if there is no address waiting to be retried.
+func (d *AddrList) NextRetry() (time.Time, bool) {
+	if len(d.retryQueue) == 0 {
+		return time.Time{}, false
+	}
+	return d.retryQueue[0].nextTry, true
+}
+
 // Pop returns the next address. The returned address is removed from the list.
+// Addresses that are never tried are returned before the ones that are due for a retry.
 func (d *AddrList) Pop() (*net.TCPAddr, peersource.Source) {
 	item := d.peerByPriority.DeleteMax()
 	if item == nil {
-		return nil, 0
+		if len(d.retryQueue) == 0 || d.retryQueue[0].nextTry.After(d.now()) {
+			return nil, 0
+		}
+		r := d.retryQueue[0]
+		d.retryQueue = d.retryQueue[1:]
+		r.queued = false
+		return r.addr, r.source
 	}
 	p := item.(*peerAddr)
 	d.peerByTime[p.index] = nil
@@ -88,6 +138,10 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 		if d.blocklist != nil && d.blocklist.Blocked(ad.IP) {
 			continue
 		}
+		// Failed addresses are only connected again by retries.
+		if _, ok := d.retries[ad.String()]; ok {
+			continue
+		}
 		p := &peerAddr{
 			addr:      ad,
 			timestamp: now,
@@ -121,6 +175,66 @@ func (d *AddrList) Push(addrs []*net.TCPAddr, source peersource.Source) {
 	}
 }
 
+// Failed must be called when the connection to an address has failed.
+// The address is scheduled for a retry unless it has failed too many times or too many addresses are waiting for retry.
+// Returns the delay until the retry and false if the address is dropped.
+func (d *AddrList) Failed(addr *net.TCPAddr, source peersource.Source) (time.Duration, bool) {
+	key := addr.String()
+	r, ok := d.retries[key]
+	if !ok {
+		if len(d.retries) >= d.maxItems {
+			return 0, false
+		}
+		r = &retryAddr{addr: addr, source: source}
+		d.retries[key] = r
+	} else if r.queued {
+		d.removeRetry(r)
+	}
+	r.failures++
+	if r.failures > d.maxRetries {
+		delete(d.retries, key)
+		return 0, false
+	}
+	delay := d.retryBackoff
+	for i := 1; i < r.failures && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	r.nextTry = d.now().Add(delay)
+	i := sort.Search(len(d.retryQueue), func(i int) bool { return d.retryQueue[i].nextTry.After(r.nextTry) })
+	d.retryQueue = append(d.retryQueue, nil)
+	copy(d.retryQueue[i+1:], d.retryQueue[i:])
+	d.retryQueue[i] = r
+	r.queued = true
+	return delay, true
+}
+
+// Connected must be called when the connection to an address has succeeded.
+// Failure count of the address is reset.
+func (d *AddrList) Connected(addr *net.TCPAddr) {
+	key := addr.String()
+	r, ok := d.retries[key]
+	if !ok {
+		return
+	}
+	if r.queued {
+		d.removeRetry(r)
+	}
+	delete(d.retries, key)
+}
+
+func (d *AddrList) removeRetry(r *retryAddr) {
+	for i, x := range d.retryQueue {
+		if x == r {
+			d.retryQueue = append(d.retryQueue[:i], d.retryQueue[i+1:]...)
+			break
+		}
+	}
+	r.queued = false
+}
+
 func (d *AddrList) filterNils() {
 	b := d.peerByTime[:0]
 	for _, x := range d.peerByTime {
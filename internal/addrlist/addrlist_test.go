@@ -3,6 +3,7 @@ package addrlist
 import (
 	"net"
 	"testing"
+	"time"
 
 	"github.com/cenkalti/rain/internal/peersource"
 	"github.com/stretchr/testify/assert"
@@ -10,7 +11,7 @@ import (
 
 func TestAddrList(t *testing.T) {
 	clientIP := net.IPv4(1, 2, 3, 4)
-	al := New(2, nil, 5000, &clientIP)
+	al := New(2, nil, 5000, &clientIP, 0, 0)
 
 	// Push 1st addr
 	al.Push([]*net.TCPAddr{newAddr("1.1.1.1")}, peersource.Tracker)
@@ -53,6 +54,111 @@ func TestAddrList(t *testing.T) {
 	assert.Equal(t, al.peerByTime[1].index, 1)
 }
 
+func TestAddrListRetry(t *testing.T) {
+	clientIP := net.IPv4(1, 2, 3, 4)
+	al := New(10, nil, 5000, &clientIP, 2, time.Second)
+	now := time.Now()
+	al.now = func() time.Time { return now }
+
+	failing := newAddr("1.1.1.1")
+	al.Push([]*net.TCPAddr{failing}, peersource.Tracker)
+	addr, _ := al.Pop()
+	assert.Equal(t, failing, addr)
+
+	delay, ok := al.Failed(failing, peersource.Tracker)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay)
+	assert.Equal(t, 1, al.LenRetry())
+
+	// Failed address is not added again while waiting for retry.
+	al.Push([]*net.TCPAddr{failing}, peersource.Tracker)
+	assert.Equal(t, 0, al.Len())
+
+	// Not due yet.
+	addr, _ = al.Pop()
+	assert.Nil(t, addr)
+
+	// New addresses are preferred over retries.
+	now = now.Add(time.Second)
+	al.Push([]*net.TCPAddr{newAddr("2.2.2.2")}, peersource.Tracker)
+	addr, _ = al.Pop()
+	assert.Equal(t, newAddr("2.2.2.2"), addr)
+	addr, src := al.Pop()
+	assert.Equal(t, failing, addr)
+	assert.Equal(t, peersource.Tracker, src)
+
+	// Delay is doubled after each failure.
+	delay, ok = al.Failed(failing, peersource.Tracker)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, delay)
+	now = now.Add(time.Second)
+	addr, _ = al.Pop()
+	assert.Nil(t, addr)
+	now = now.Add(time.Second)
+	addr, _ = al.Pop()
+	assert.Equal(t, failing, addr)
+
+	// Address is dropped after max retries.
+	_, ok = al.Failed(failing, peersource.Tracker)
+	assert.False(t, ok)
+	assert.Equal(t, 0, al.LenRetry())
+	now = now.Add(time.Hour)
+	addr, _ = al.Pop()
+	assert.Nil(t, addr)
+
+	// Dropped address can be added again.
+	al.Push([]*net.TCPAddr{failing}, peersource.Tracker)
+	assert.Equal(t, 1, al.Len())
+}
+
+func TestAddrListRetryConnected(t *testing.T) {
+	clientIP := net.IPv4(1, 2, 3, 4)
+	al := New(10, nil, 5000, &clientIP, 2, time.Second)
+	addr := newAddr("1.1.1.1")
+	al.Failed(addr, peersource.Manual)
+	assert.Equal(t, 1, al.LenRetry())
+	al.Connected(addr)
+	assert.Equal(t, 0, al.LenRetry())
+	al.Push([]*net.TCPAddr{addr}, peersource.Tracker)
+	assert.Equal(t, 1, al.Len())
+}
+
+func TestAddrListRetryLimit(t *testing.T) {
+	clientIP := net.IPv4(1, 2, 3, 4)
+	al := New(2, nil, 5000, &clientIP, 2, time.Second)
+	now := time.Now()
+	al.now = func() time.Time { return now }
+	_, ok := al.Failed(newAddr("1.1.1.1"), peersource.Tracker)
+	assert.True(t, ok)
+	now = now.Add(-time.Millisecond)
+	_, ok = al.Failed(newAddr("2.2.2.2"), peersource.Tracker)
+	assert.True(t, ok)
+	_, ok = al.Failed(newAddr("3.3.3.3"), peersource.Tracker)
+	assert.False(t, ok)
+	assert.Equal(t, 2, al.LenRetry())
+	next, ok := al.NextRetry()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Second), next)
+}
+
+func TestAddrListRetryMaxBackoff(t *testing.T) {
+	clientIP := net.IPv4(1, 2, 3, 4)
+	al := New(10, nil, 5000, &clientIP, 100, 30*time.Second)
+	addr := newAddr("1.1.1.1")
+	var delay time.Duration
+	for i := 0; i < 100; i++ {
+		var ok bool
+		delay, ok = al.Failed(addr, peersource.Tracker)
+		if !ok {
+			t.Fatalf("address is dropped after %d failures", i+1)
+		}
+		if delay <= 0 || delay > maxRetryBackoff {
+			t.Fatalf("invalid delay after %d failures: %s", i+1, delay)
+		}
+	}
+	assert.Equal(t, maxRetryBackoff, delay)
+}
+
 func newAddr(ip string) *net.TCPAddr {
 	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1}
 }
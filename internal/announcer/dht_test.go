@@ -0,0 +1,44 @@
+package announcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+func TestDHTAnnouncer(t *testing.T) {
+	const interval = time.Hour
+	const minInterval = 10 * time.Millisecond
+	announceC := make(chan struct{}, 10)
+	a := NewDHTAnnouncer()
+	go a.Run(func() { announceC <- struct{}{} }, interval, minInterval, logger.New("test"))
+	defer a.Close()
+
+	// First announce is done immediately, then repeated with minInterval while more peers are needed.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-announceC:
+		case <-time.After(time.Second):
+			t.Fatal("announce not called")
+		}
+	}
+
+	// Must wait for interval when enough peers are present.
+	a.NeedMorePeers(false)
+	for len(announceC) > 0 {
+		<-announceC
+	}
+	select {
+	case <-announceC:
+		t.Fatal("unexpected announce")
+	case <-time.After(10 * minInterval):
+	}
+
+	a.NeedMorePeers(true)
+	select {
+	case <-announceC:
+	case <-time.After(time.Second):
+		t.Fatal("announce not called")
+	}
+}
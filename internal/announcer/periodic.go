@@ -3,6 +3,7 @@ package announcer
 import (
 	"context"
 	"math"
+	"math/rand"
 	"net"
 	"net/url"
 	"reflect"
@@ -32,6 +33,10 @@ const (
 	NotWorking
 )
 
+// Announce intervals returned from trackers are randomized by this factor,
+// so clients that are started at the same time do not announce at the same time.
+const intervalJitter = 0.1
+
 // PeriodicalAnnouncer announces the Torrent to the Tracker periodically.
 type PeriodicalAnnouncer struct {
 	Tracker       tracker.Tracker
@@ -42,6 +47,7 @@ type PeriodicalAnnouncer struct {
 	minInterval   time.Duration
 	seeders       int
 	leechers      int
+	peers         int
 	warningMsg    string
 	lastError     *AnnounceError
 	log           logger.Logger
@@ -60,6 +66,13 @@ type PeriodicalAnnouncer struct {
 	needMorePeers  bool
 	mNeedMorePeers sync.RWMutex
 	needMorePeersC chan struct{}
+
+	// Number of peers requested in announces. Can be lowered with SetNumWant.
+	maxNumWant int
+	mNumWant   sync.Mutex
+
+	// Configured min interval. Tracker can only increase it.
+	defaultMinInterval time.Duration
 }
 
 // NewPeriodicalAnnouncer returns a new PeriodicalAnnouncer.
@@ -69,6 +82,7 @@ func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.D
 		status:         NotContactedYet,
 		statsCommandC:  make(chan statsRequest),
 		numWant:        numWant,
+		maxNumWant:     numWant,
 		minInterval:    minInterval,
 		log:            l,
 		completedC:     completedC,
@@ -87,6 +101,7 @@ func NewPeriodicalAnnouncer(trk tracker.Tracker, numWant int, minInterval time.D
 			MaxElapsedTime:      0, // never stop
 			Clock:               backoff.SystemClock,
 		},
+		defaultMinInterval: minInterval,
 	}
 }
 
@@ -127,6 +142,26 @@ func (a *PeriodicalAnnouncer) NeedMorePeers(val bool) {
 	}
 }
 
+// SetNumWant sets the number of peers requested in next announces.
+// The value is capped by the numWant given in constructor.
+func (a *PeriodicalAnnouncer) SetNumWant(n int) {
+	if n < 0 {
+		n = 0
+	}
+	a.mNumWant.Lock()
+	if n > a.maxNumWant {
+		n = a.maxNumWant
+	}
+	a.numWant = n
+	a.mNumWant.Unlock()
+}
+
+func (a *PeriodicalAnnouncer) getNumWant() int {
+	a.mNumWant.Lock()
+	defer a.mNumWant.Unlock()
+	return a.numWant
+}
+
 // Run the announcer goroutine. Invoke with go statement.
 func (a *PeriodicalAnnouncer) Run() {
 	defer close(a.doneC)
@@ -153,24 +188,26 @@ func (a *PeriodicalAnnouncer) Run() {
 	default:
 	}
 
-	a.doAnnounce(ctx, tracker.EventStarted, a.numWant)
+	a.doAnnounce(ctx, tracker.EventStarted, a.getNumWant())
 	for {
 		select {
 		case <-timer.C:
 			if a.status == Contacting {
 				break
 			}
-			a.doAnnounce(ctx, tracker.EventNone, a.numWant)
+			a.doAnnounce(ctx, tracker.EventNone, a.getNumWant())
 		case resp := <-a.responseC:
 			a.status = Working
 			a.seeders = int(resp.Seeders)
 			a.leechers = int(resp.Leechers)
+			a.peers = len(resp.Peers)
 			a.warningMsg = resp.WarningMessage
 			if a.warningMsg != "" {
 				a.log.Debugln("announce warning:", a.warningMsg)
 			}
-			a.interval = resp.Interval
-			if resp.MinInterval > 0 {
+			a.interval = jitter(resp.Interval)
+			a.minInterval = a.defaultMinInterval
+			if resp.MinInterval > a.minInterval {
 				a.minInterval = resp.MinInterval
 			}
 			a.HasAnnounced = true
@@ -221,12 +258,16 @@ func (a *PeriodicalAnnouncer) getNextInterval() time.Duration {
 	a.mNeedMorePeers.RLock()
 	need := a.needMorePeers
 	a.mNeedMorePeers.RUnlock()
-	if need {
+	if need || a.interval < a.minInterval {
 		return a.minInterval
 	}
 	return a.interval
 }
 
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*intervalJitter*float64(d)) // nolint: gosec
+}
+
 func (a *PeriodicalAnnouncer) getNextIntervalFromError(err *AnnounceError) time.Duration {
 	if terr, ok := err.Err.(*tracker.Error); ok && terr.RetryIn > 0 {
 		return terr.RetryIn
@@ -251,6 +292,7 @@ type Stats struct {
 	Warning      string
 	Seeders      int
 	Leechers     int
+	Peers        int // Number of peer addresses in the last announce response
 	LastAnnounce time.Time
 	NextAnnounce time.Time
 }
@@ -262,6 +304,7 @@ func (a *PeriodicalAnnouncer) stats() Stats {
 		Warning:      a.warningMsg,
 		Seeders:      a.seeders,
 		Leechers:     a.leechers,
+		Peers:        a.peers,
 		LastAnnounce: a.lastAnnounce,
 		NextAnnounce: a.nextAnnounce,
 	}
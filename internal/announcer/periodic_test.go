@@ -0,0 +1,120 @@
+package announcer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+type testTracker struct {
+	resp *tracker.AnnounceResponse
+}
+
+func (t *testTracker) Announce(ctx context.Context, req tracker.AnnounceRequest) (*tracker.AnnounceResponse, error) {
+	return t.resp, nil
+}
+
+func (t *testTracker) URL() string { return "http://tracker.example.com/announce" }
+
+func runAnnouncer(t *testing.T, resp *tracker.AnnounceResponse, minInterval time.Duration, needMorePeers bool) Stats {
+	trk := &testTracker{resp: resp}
+	getTorrent := func() tracker.Torrent { return tracker.Torrent{} }
+	a := NewPeriodicalAnnouncer(trk, 50, minInterval, getTorrent, make(chan struct{}), make(chan []*net.TCPAddr, 1), logger.New("test"))
+	a.NeedMorePeers(needMorePeers)
+	go a.Run()
+	defer a.Close()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		st := a.Stats()
+		if st.Status == Working {
+			return st
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("tracker is not announced")
+	return Stats{}
+}
+
+func TestMinInterval(t *testing.T) {
+	cases := []struct {
+		name          string
+		resp          tracker.AnnounceResponse
+		minInterval   time.Duration
+		needMorePeers bool
+		expected      time.Duration
+	}{
+		{"interval shorter than min interval", tracker.AnnounceResponse{Interval: time.Minute, MinInterval: time.Hour}, time.Second, false, time.Hour},
+		{"need more peers", tracker.AnnounceResponse{Interval: 2 * time.Hour, MinInterval: time.Hour}, time.Second, true, time.Hour},
+		{"configured min interval", tracker.AnnounceResponse{Interval: 2 * time.Hour, MinInterval: time.Second}, time.Hour, true, time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := tc.resp
+			st := runAnnouncer(t, &resp, tc.minInterval, tc.needMorePeers)
+			if next := st.NextAnnounce.Sub(st.LastAnnounce); next < tc.expected {
+				t.Fatalf("next announce is scheduled after %s", next)
+			}
+		})
+	}
+}
+
+func TestIntervalJitter(t *testing.T) {
+	const interval = time.Hour
+	resp := &tracker.AnnounceResponse{Interval: interval}
+	st := runAnnouncer(t, resp, time.Second, false)
+	next := st.NextAnnounce.Sub(st.LastAnnounce)
+	if next < interval*9/10 || next > interval*11/10+time.Second {
+		t.Fatalf("next announce is scheduled after %s", next)
+	}
+}
+
+type recordingTracker struct {
+	testTracker
+	reqC chan tracker.AnnounceRequest
+}
+
+func (t *recordingTracker) Announce(ctx context.Context, req tracker.AnnounceRequest) (*tracker.AnnounceResponse, error) {
+	t.reqC <- req
+	return t.resp, nil
+}
+
+func TestSetNumWant(t *testing.T) {
+	// Next announce is made only when more peers are needed.
+	trk := &recordingTracker{testTracker: testTracker{resp: &tracker.AnnounceResponse{Interval: time.Hour}}, reqC: make(chan tracker.AnnounceRequest, 1)}
+	getTorrent := func() tracker.Torrent { return tracker.Torrent{} }
+	a := NewPeriodicalAnnouncer(trk, 50, time.Millisecond, getTorrent, make(chan struct{}), make(chan []*net.TCPAddr, 10), logger.New("test"))
+	a.SetNumWant(100) // capped by the value in constructor
+	go a.Run()
+	defer a.Close()
+	expect := func(numWant int) {
+		select {
+		case req := <-trk.reqC:
+			if req.NumWant != numWant {
+				t.Fatalf("unexpected numwant: %d", req.NumWant)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("tracker is not announced")
+		}
+	}
+	expect(50)
+	a.SetNumWant(10)
+	a.NeedMorePeers(true)
+	expect(10)
+}
+
+func TestStopAnnouncerNumWant(t *testing.T) {
+	trk := &recordingTracker{testTracker: testTracker{resp: &tracker.AnnounceResponse{}}, reqC: make(chan tracker.AnnounceRequest, 1)}
+	resultC := make(chan struct{}, 1)
+	a := NewStopAnnouncer([]tracker.Tracker{trk}, tracker.Torrent{}, time.Second, resultC, logger.New("test"))
+	go a.Run()
+	defer a.Close()
+	req := <-trk.reqC
+	if req.Event != tracker.EventStopped || req.NumWant != 0 {
+		t.Fatalf("unexpected request: event=%s numwant=%d", req.Event, req.NumWant)
+	}
+	<-resultC
+}
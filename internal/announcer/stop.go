@@ -57,6 +57,7 @@ func (a *StopAnnouncer) Run() {
 			req := tracker.AnnounceRequest{
 				Torrent: a.torrent,
 				Event:   tracker.EventStopped,
+				NumWant: 0, // no peers are needed after stop
 			}
 			_, _ = trk.Announce(ctx, req)
 			doneC <- struct{}{}
@@ -0,0 +1,74 @@
+// Package banlist provides a list of temporarily banned IP addresses.
+package banlist
+
+import "time"
+
+// Banlist keeps IP addresses with the time their ban expires.
+// The ban duration is doubled each time the same IP is banned again, up to a maximum.
+// Offenses are forgotten after the IP stays unbanned for the maximum duration.
+// Banlist is not safe for concurrent use.
+type Banlist struct {
+	duration    time.Duration
+	maxDuration time.Duration
+	entries     map[string]*entry
+
+	now func() time.Time
+}
+
+type entry struct {
+	until    time.Time
+	duration time.Duration
+}
+
+// New returns a new Banlist. First ban of an IP lasts for duration.
+func New(duration, maxDuration time.Duration) *Banlist {
+	if maxDuration < duration {
+		maxDuration = duration
+	}
+	return &Banlist{
+		duration:    duration,
+		maxDuration: maxDuration,
+		entries:     make(map[string]*entry),
+		now:         time.Now,
+	}
+}
+
+// Ban the IP and return the duration of the ban.
+func (b *Banlist) Ban(ip string) time.Duration {
+	now := b.now()
+	b.removeExpired(now)
+	e, ok := b.entries[ip]
+	if !ok {
+		e = &entry{duration: b.duration}
+		b.entries[ip] = e
+	} else if now.Before(e.until) {
+		// Already banned. Offense is counted once until the ban expires.
+		return e.duration
+	} else {
+		e.duration *= 2
+		if e.duration > b.maxDuration {
+			e.duration = b.maxDuration
+		}
+	}
+	e.until = now.Add(e.duration)
+	return e.duration
+}
+
+// Banned returns true if the ban of the IP has not expired yet.
+func (b *Banlist) Banned(ip string) bool {
+	e, ok := b.entries[ip]
+	return ok && b.now().Before(e.until)
+}
+
+// Len returns the number of IPs that are tracked, including the ones whose ban has expired but not forgotten yet.
+func (b *Banlist) Len() int {
+	return len(b.entries)
+}
+
+func (b *Banlist) removeExpired(now time.Time) {
+	for ip, e := range b.entries {
+		if now.Sub(e.until) >= b.maxDuration {
+			delete(b.entries, ip)
+		}
+	}
+}
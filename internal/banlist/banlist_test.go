@@ -0,0 +1,49 @@
+package banlist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBanlist(t *testing.T) {
+	now := time.Now()
+	b := New(time.Minute, 5*time.Minute)
+	b.now = func() time.Time { return now }
+
+	if b.Banned("1.2.3.4") {
+		t.Fatal("ip is banned")
+	}
+	if d := b.Ban("1.2.3.4"); d != time.Minute {
+		t.Fatalf("unexpected duration: %s", d)
+	}
+	if !b.Banned("1.2.3.4") {
+		t.Fatal("ip is not banned")
+	}
+	if b.Banned("5.6.7.8") {
+		t.Fatal("other ip is banned")
+	}
+	// Banning again during the ban does not extend it.
+	if d := b.Ban("1.2.3.4"); d != time.Minute {
+		t.Fatalf("unexpected duration: %s", d)
+	}
+
+	// Repeated offenses double the duration up to the max.
+	for _, expected := range []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		now = now.Add(b.entries["1.2.3.4"].duration)
+		if b.Banned("1.2.3.4") {
+			t.Fatal("ban is not expired")
+		}
+		if d := b.Ban("1.2.3.4"); d != expected {
+			t.Fatalf("unexpected duration: %s, expected: %s", d, expected)
+		}
+	}
+
+	// Offense is forgotten after staying unbanned for max duration.
+	now = now.Add(10 * time.Minute)
+	if d := b.Ban("5.6.7.8"); d != time.Minute {
+		t.Fatalf("unexpected duration: %s", d)
+	}
+	if b.Len() != 1 {
+		t.Fatalf("expired entry is not removed: %d", b.Len())
+	}
+}
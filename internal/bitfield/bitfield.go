@@ -2,8 +2,10 @@
 package bitfield
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
+	"math/bits"
 )
 
 // NumBytes calculates the number of bytes required to represent a bitfield of `length` bits.
@@ -122,6 +124,121 @@ func (b *Bitfield) All() bool {
 	return b.Count() == b.length
 }
 
+// SetRange sets the bits in range [start, end). Panics if end > b.Len() or start > end.
+func (b *Bitfield) SetRange(start, end uint32) {
+	b.forRange(start, end, func(i uint32, mask byte) { b.bytes[i] |= mask })
+}
+
+// ClearRange clears the bits in range [start, end). Panics if end > b.Len() or start > end.
+func (b *Bitfield) ClearRange(start, end uint32) {
+	b.forRange(start, end, func(i uint32, mask byte) { b.bytes[i] &^= mask })
+}
+
+// CountRange returns the count of set bits in range [start, end). Panics if end > b.Len() or start > end.
+func (b *Bitfield) CountRange(start, end uint32) uint32 {
+	var total uint32
+	b.forRange(start, end, func(i uint32, mask byte) { total += uint32(countCache[b.bytes[i]&mask]) })
+	return total
+}
+
+// forRange calls f for each byte that contains bits in range [start, end) with a mask of those bits.
+func (b *Bitfield) forRange(start, end uint32, f func(i uint32, mask byte)) {
+	if start > end || end > b.length {
+		panic("invalid range")
+	}
+	if start == end {
+		return
+	}
+	firstDiv, firstMod := divMod32(start)
+	lastDiv, lastMod := divMod32(end - 1)
+	for i := firstDiv; i <= lastDiv; i++ {
+		mask := byte(0xff)
+		if i == firstDiv {
+			mask &= 0xff >> firstMod
+		}
+		if i == lastDiv {
+			mask &= 0xff << (7 - lastMod)
+		}
+		f(i, mask)
+	}
+}
+
+// NextSet returns the index of the first set bit at or after i. Returns false if there is no such bit.
+// Bytes with no bits set are skipped as a whole.
+func (b *Bitfield) NextSet(i uint32) (uint32, bool) {
+	return b.next(i, 0)
+}
+
+// NextClear returns the index of the first clear bit at or after i. Returns false if there is no such bit.
+// Bytes with all bits set are skipped as a whole.
+func (b *Bitfield) NextClear(i uint32) (uint32, bool) {
+	return b.next(i, 0xff)
+}
+
+// next returns the first bit that is different than the bits in flip.
+func (b *Bitfield) next(i uint32, flip byte) (uint32, bool) {
+	if i >= b.length {
+		return 0, false
+	}
+	div, mod := divMod32(i)
+	// Ignore the bits before i in the first byte.
+	v := (b.bytes[div] ^ flip) & (0xff >> mod)
+	for v == 0 {
+		div++
+		if div >= uint32(len(b.bytes)) {
+			return 0, false
+		}
+		v = b.bytes[div] ^ flip
+	}
+	i = div*8 + uint32(bits.LeadingZeros8(v))
+	// Unused bits in the last byte are clear.
+	if i >= b.length {
+		return 0, false
+	}
+	return i, true
+}
+
+// And returns a new Bitfield containing the bits set in both b and other. Panics if lengths are different.
+func (b *Bitfield) And(other *Bitfield) *Bitfield {
+	b.checkLength(other)
+	b2 := New(b.length)
+	for i := range b.bytes {
+		b2.bytes[i] = b.bytes[i] & other.bytes[i]
+	}
+	return b2
+}
+
+// Or returns a new Bitfield containing the bits set in either b or other. Panics if lengths are different.
+func (b *Bitfield) Or(other *Bitfield) *Bitfield {
+	b.checkLength(other)
+	b2 := New(b.length)
+	for i := range b.bytes {
+		b2.bytes[i] = b.bytes[i] | other.bytes[i]
+	}
+	return b2
+}
+
+// AndNot returns a new Bitfield containing the bits set in b but not in other. Panics if lengths are different.
+func (b *Bitfield) AndNot(other *Bitfield) *Bitfield {
+	b.checkLength(other)
+	b2 := New(b.length)
+	for i := range b.bytes {
+		b2.bytes[i] = b.bytes[i] &^ other.bytes[i]
+	}
+	return b2
+}
+
+// Equal returns true if b and other have the same length and the same bits set.
+func (b *Bitfield) Equal(other *Bitfield) bool {
+	return b.length == other.length && bytes.Equal(b.bytes, other.bytes)
+}
+
+func (b *Bitfield) checkLength(other *Bitfield) {
+	if b.length != other.length {
+		panic("bitfield lengths are different")
+	}
+}
+
 func (b *Bitfield) checkIndex(i uint32) {
 	if i >= b.Len() {
 		panic("index out of bound")
@@ -1,6 +1,10 @@
 package bitfield
 
-import "testing"
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
 
 func TestNew(t *testing.T) {
 	var (
@@ -67,3 +71,143 @@ func TestClear(t *testing.T) {
 		t.Errorf("test is not correct: %s", v.Hex())
 	}
 }
+
+func newHex(t *testing.T, s string, length uint32) *Bitfield {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewBytes(b, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSetOperations(t *testing.T) {
+	a := newHex(t, "f0c0", 10)
+	b := newHex(t, "3c40", 10)
+	if v := a.And(b); v.Hex() != "3040" {
+		t.Errorf("invalid and: %s", v.Hex())
+	}
+	if v := a.Or(b); v.Hex() != "fcc0" {
+		t.Errorf("invalid or: %s", v.Hex())
+	}
+	if v := a.AndNot(b); v.Hex() != "c080" {
+		t.Errorf("invalid and not: %s", v.Hex())
+	}
+	if a.Hex() != "f0c0" || b.Hex() != "3c40" {
+		t.Errorf("operands are modified: %s %s", a.Hex(), b.Hex())
+	}
+	if !a.Equal(a.Copy()) {
+		t.Error("copy is not equal")
+	}
+	if a.Equal(b) {
+		t.Error("different bitfields are equal")
+	}
+}
+
+func TestSetOperationsLengthMismatch(t *testing.T) {
+	a := New(10)
+	b := New(11)
+	if a.Equal(b) {
+		t.Error("bitfields with different lengths are equal")
+	}
+	for name, op := range map[string]func(*Bitfield) *Bitfield{"and": a.And, "or": a.Or, "andnot": a.AndNot} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("expected panic for %s but not found", name)
+				}
+			}()
+			op(b)
+		}()
+	}
+}
+
+func collect(next func(uint32) (uint32, bool)) []uint32 {
+	var ret []uint32
+	for i, ok := next(0); ok; i, ok = next(i + 1) {
+		ret = append(ret, i)
+	}
+	return ret
+}
+
+func TestNextSet(t *testing.T) {
+	v := newHex(t, "8000000140", 34)
+	got := collect(v.NextSet)
+	if fmt.Sprint(got) != "[0 31 33]" {
+		t.Errorf("invalid set bits: %v", got)
+	}
+	if _, ok := v.NextSet(34); ok {
+		t.Error("found bit past the end")
+	}
+	if _, ok := New(20).NextSet(0); ok {
+		t.Error("found bit in empty bitfield")
+	}
+}
+
+func TestNextClear(t *testing.T) {
+	v := newHex(t, "7ffffffe80", 34)
+	got := collect(v.NextClear)
+	if fmt.Sprint(got) != "[0 31 33]" {
+		t.Errorf("invalid clear bits: %v", got)
+	}
+	// Unused bits in the last byte must not be returned.
+	v = newHex(t, "ffc0", 10)
+	if i, ok := v.NextClear(0); ok {
+		t.Errorf("found clear bit at %d in full bitfield", i)
+	}
+	v.Clear(9)
+	if i, ok := v.NextClear(3); !ok || i != 9 {
+		t.Errorf("invalid clear bit: %d %v", i, ok)
+	}
+}
+
+func TestRange(t *testing.T) {
+	v := New(30)
+	v.SetRange(3, 21)
+	if v.Hex() != "1ffff800" {
+		t.Errorf("invalid value: %s", v.Hex())
+	}
+	if n := v.CountRange(0, 30); n != 18 {
+		t.Errorf("invalid count: %d", n)
+	}
+	if n := v.CountRange(5, 6); n != 1 {
+		t.Errorf("invalid count: %d", n)
+	}
+	if n := v.CountRange(20, 22); n != 1 {
+		t.Errorf("invalid count: %d", n)
+	}
+	v.ClearRange(5, 18)
+	if v.Hex() != "18003800" {
+		t.Errorf("invalid value: %s", v.Hex())
+	}
+	v.ClearRange(4, 4)
+	if v.Hex() != "18003800" {
+		t.Errorf("empty range modified the value: %s", v.Hex())
+	}
+}
+
+func TestFullRange(t *testing.T) {
+	v := New(10)
+	v.SetRange(0, v.Len())
+	if v.Hex() != "ffc0" || !v.All() {
+		t.Errorf("invalid value: %s", v.Hex())
+	}
+	if n := v.CountRange(0, v.Len()); n != 10 {
+		t.Errorf("invalid count: %d", n)
+	}
+	v.ClearRange(0, v.Len())
+	if v.Hex() != "0000" {
+		t.Errorf("invalid value: %s", v.Hex())
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected panic but not found")
+			}
+		}()
+		v.SetRange(0, 11)
+	}()
+}
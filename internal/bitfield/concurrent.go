@@ -0,0 +1,60 @@
+package bitfield
+
+import "sync"
+
+// Concurrent is a Bitfield that is safe for concurrent use by multiple goroutines.
+type Concurrent struct {
+	m sync.RWMutex
+	b *Bitfield
+}
+
+// NewConcurrent creates a new Concurrent bitfield of length bits.
+func NewConcurrent(length uint32) *Concurrent {
+	return &Concurrent{b: New(length)}
+}
+
+// Len returns the number of bits as given to NewConcurrent.
+func (c *Concurrent) Len() uint32 { return c.b.Len() }
+
+// Set bit i. Panics if i >= c.Len().
+func (c *Concurrent) Set(i uint32) {
+	c.m.Lock()
+	c.b.Set(i)
+	c.m.Unlock()
+}
+
+// Clear bit i. Panics if i >= c.Len().
+func (c *Concurrent) Clear(i uint32) {
+	c.m.Lock()
+	c.b.Clear(i)
+	c.m.Unlock()
+}
+
+// Test bit i. Panics if i >= c.Len().
+func (c *Concurrent) Test(i uint32) bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.b.Test(i)
+}
+
+// Count returns the count of set bits.
+func (c *Concurrent) Count() uint32 {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.b.Count()
+}
+
+// All returns true if all bits are set, false otherwise.
+func (c *Concurrent) All() bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.b.All()
+}
+
+// Snapshot returns a copy of bits as a plain Bitfield.
+// Returned value is not modified by later calls, so it can be iterated without holding a lock.
+func (c *Concurrent) Snapshot() *Bitfield {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.b.Copy()
+}
@@ -0,0 +1,43 @@
+package bitfield
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrent(t *testing.T) {
+	const length = 1000
+	c := NewConcurrent(length)
+	var wg sync.WaitGroup
+	for w := uint32(0); w < 4; w++ {
+		wg.Add(2)
+		go func(w uint32) {
+			defer wg.Done()
+			for i := w; i < length; i += 4 {
+				c.Set(i)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := uint32(0); i < length; i++ {
+				c.Test(i)
+				s := c.Snapshot()
+				if s.Count() > length {
+					t.Errorf("invalid count: %d", s.Count())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if !c.All() || c.Count() != length {
+		t.Fatalf("not all bits are set: %d", c.Count())
+	}
+	s := c.Snapshot()
+	c.Clear(5)
+	if !s.Test(5) {
+		t.Error("snapshot is modified")
+	}
+	if c.Test(5) {
+		t.Error("bit is not cleared")
+	}
+}
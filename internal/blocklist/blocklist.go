@@ -85,7 +85,7 @@ func load(r io.Reader, logger Logger) (*stree.Stree, int, error) {
 		if l[0] == '#' {
 			continue
 		}
-		r, err := parseCIDR(l)
+		r, err := parseLine(l)
 		if err != nil {
 			hasError = true
 			if logger != nil {
@@ -112,6 +112,53 @@ type ipRange struct {
 	first, last uint32
 }
 
+// parseLine parses a rule in one of the following formats:
+//
+//	1.2.3.0/24                          (CIDR)
+//	1.2.3.0-1.2.3.255                   (range)
+//	Some description:1.2.3.0-1.2.3.255  (PeerGuardian p2p format)
+func parseLine(b []byte) (ipRange, error) {
+	if bytes.IndexByte(b, '-') < 0 {
+		return parseCIDR(b)
+	}
+	if i := bytes.LastIndexByte(b, ':'); i >= 0 {
+		b = b[i+1:]
+	}
+	return parseRange(b)
+}
+
+func parseRange(b []byte) (r ipRange, err error) {
+	i := bytes.IndexByte(b, '-')
+	if i < 0 {
+		err = errors.New("invalid range")
+		return
+	}
+	r.first, err = parseIPv4(bytes.TrimSpace(b[:i]))
+	if err != nil {
+		return
+	}
+	r.last, err = parseIPv4(bytes.TrimSpace(b[i+1:]))
+	if err != nil {
+		return
+	}
+	if r.first > r.last {
+		err = errors.New("invalid range")
+	}
+	return
+}
+
+func parseIPv4(b []byte) (uint32, error) {
+	ip := net.ParseIP(string(b))
+	if ip == nil {
+		return 0, errors.New("invalid ip address")
+	}
+	ip = ip.To4()
+	if ip == nil {
+		return 0, errNotIPv4Address
+	}
+	return binary.BigEndian.Uint32(ip), nil
+}
+
 func parseCIDR(b []byte) (r ipRange, err error) {
 	_, ipnet, err := net.ParseCIDR(string(b))
 	if err != nil {
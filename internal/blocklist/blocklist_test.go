@@ -20,6 +20,50 @@ func TestParseCIDR(t *testing.T) {
 	assert.Equal(t, uint32(511), r.last)
 }
 
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line        string
+		first, last uint32
+	}{
+		{"0.0.1.1/24", 256, 511},
+		{"0.0.1.0-0.0.1.10", 256, 266},
+		{"Bad peers, inc.:0.0.1.0-0.0.2.0", 256, 512},
+		{"a:b:0.0.0.1 - 0.0.0.1", 1, 1},
+	}
+	for _, c := range cases {
+		r, err := parseLine([]byte(c.line))
+		if err != nil {
+			t.Fatal(c.line, err)
+		}
+		assert.Equal(t, ipRange{c.first, c.last}, r, c.line)
+	}
+	for _, l := range []string{"0.0.1.10-0.0.1.0", "x:0.0.1.0-", "::1-::2", "0.0.1.0"} {
+		_, err := parseLine([]byte(l))
+		assert.Error(t, err, l)
+	}
+}
+
+func TestBlockedBoundaries(t *testing.T) {
+	rules := "# comment\n" +
+		"10.0.0.0/8\n" +
+		"Some bad range:192.168.1.10-192.168.1.20\n" +
+		"172.16.0.5-172.16.0.5\n"
+	b := New()
+	n, err := b.Reload(bytes.NewReader([]byte(rules)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, n)
+	blocked := []string{"10.0.0.0", "10.255.255.255", "192.168.1.10", "192.168.1.15", "192.168.1.20", "172.16.0.5"}
+	allowed := []string{"9.255.255.255", "11.0.0.0", "192.168.1.9", "192.168.1.21", "172.16.0.4", "172.16.0.6", "::1"}
+	for _, s := range blocked {
+		assert.True(t, b.Blocked(net.ParseIP(s)), s)
+	}
+	for _, s := range allowed {
+		assert.False(t, b.Blocked(net.ParseIP(s)), s)
+	}
+}
+
 func TestContains(t *testing.T) {
 	p := filepath.Join("testdata", "blocklist.cidr")
 	f, err := os.Open(p)
@@ -11,6 +11,7 @@ import (
 )
 
 // Accept BitTorrent handshake from the connection. Handles encryption.
+// ourID is called with the info hash sent by the peer to get the peer ID sent in the reply.
 // Returns a new connection that is ready for sending/receiving BitTorrent protocol messages.
 func Accept(
 	conn net.Conn,
@@ -18,7 +19,7 @@ func Accept(
 	getSKey func(sKeyHash [20]byte) (sKey []byte),
 	forceEncryption bool,
 	hasInfoHash func([20]byte) bool,
-	ourExtensions [8]byte, ourID [20]byte) (
+	ourExtensions [8]byte, ourID func(infoHash [20]byte) [20]byte) (
 	encConn net.Conn, cipher mse.CryptoMethod, peerExtensions [8]byte, peerID [20]byte, infoHash [20]byte, err error) {
 	log := logger.New("conn <- " + conn.RemoteAddr().String())
 
@@ -76,7 +77,8 @@ func Accept(
 		err = errInvalidInfoHash
 		return
 	}
-	err = writeHandshake(conn, infoHash, ourID, ourExtensions)
+	id := ourID(infoHash)
+	err = writeHandshake(conn, infoHash, id, ourExtensions)
 	if err != nil {
 		return
 	}
@@ -84,7 +86,7 @@ func Accept(
 	if err != nil {
 		return
 	}
-	if peerID == ourID {
+	if peerID == id {
 		err = errOwnConnection
 		return
 	}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package btconn
+
+import (
+	"net"
+	"testing"
+)
+
+// newBlackHole returns an address in TEST-NET-1 block. Connections to it are expected to hang until timeout.
+func newBlackHole(t *testing.T) net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 6881}
+}
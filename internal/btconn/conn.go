@@ -18,3 +18,17 @@ type rwConn struct {
 
 func (c *rwConn) Read(p []byte) (n int, err error)  { return c.rw.Read(p) }
 func (c *rwConn) Write(p []byte) (n int, err error) { return c.rw.Write(p) }
+
+// NetConn returns the wrapped connection.
+func (c *rwConn) NetConn() net.Conn { return c.Conn }
+
+// proxyConn reports the address of the peer as remote address instead of the address of the proxy server.
+type proxyConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr { return c.addr }
+
+// NetConn returns the wrapped connection.
+func (c *proxyConn) NetConn() net.Conn { return c.Conn }
@@ -1,11 +1,13 @@
 package btconn
 
 import (
+	"fmt"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/rain/internal/mse"
+	"github.com/cenkalti/rain/internal/utp"
 )
 
 var (
@@ -28,7 +30,7 @@ func TestUnencrypted(t *testing.T) {
 	var gerr error
 	go func() {
 		defer close(done)
-		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, false, false, ext1, infoHash, id1, nil)
+		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, &net.Dialer{Timeout: 10 * time.Second}, 10*time.Second, false, false, ext1, infoHash, id1, nil)
 		if err2 != nil {
 			gerr = err2
 			return
@@ -50,7 +52,7 @@ func TestUnencrypted(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, id2)
+	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, func([20]byte) [20]byte { return id2 })
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,7 +85,7 @@ func TestEncrypted(t *testing.T) {
 	var gerr error
 	go func() {
 		defer close(done)
-		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, 10*time.Second, 10*time.Second, true, true, ext1, infoHash, id1, nil)
+		conn, cipher, ext, id, err2 := Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, &net.Dialer{Timeout: 10 * time.Second}, 10*time.Second, true, true, ext1, infoHash, id1, nil)
 		if err2 != nil {
 			gerr = err2
 			return
@@ -131,7 +133,7 @@ func TestEncrypted(t *testing.T) {
 		},
 		false,
 		func(ih [20]byte) bool { return ih == infoHash },
-		ext2, id2)
+		ext2, func([20]byte) [20]byte { return id2 })
 	if err != nil {
 		conn.Close()
 		<-done
@@ -169,3 +171,181 @@ func TestEncrypted(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDialTimeout(t *testing.T) {
+	const timeout = 500 * time.Millisecond
+	blackHole := newBlackHole(t)
+	start := time.Now()
+	_, _, _, _, err := Dial(blackHole, &net.Dialer{Timeout: timeout}, 10*time.Second, false, false, ext1, infoHash, id1, nil)
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("connected to black-holed address")
+	}
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Skipf("network does not black-hole %s: %s", blackHole, err)
+	}
+	if elapsed > timeout+time.Second {
+		t.Fatalf("dial took %s", elapsed)
+	}
+}
+
+func TestDialStop(t *testing.T) {
+	blackHole := newBlackHole(t)
+	stopC := make(chan struct{})
+	time.AfterFunc(200*time.Millisecond, func() { close(stopC) })
+	start := time.Now()
+	_, _, _, _, err := Dial(blackHole, &net.Dialer{Timeout: time.Minute}, 10*time.Second, false, false, ext1, infoHash, id1, stopC)
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("connected to black-holed address")
+	}
+	if elapsed < 200*time.Millisecond {
+		t.Skipf("network does not black-hole %s: %s", blackHole, err)
+	}
+	if elapsed > 2*time.Second {
+		t.Fatalf("dial is not cancelled, took %s", elapsed)
+	}
+}
+
+func TestDialLocalAddr(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err2 := l.Accept()
+		if err2 != nil {
+			t.Error(err2)
+			return
+		}
+		defer conn.Close()
+		if ip := conn.RemoteAddr().(*net.TCPAddr).IP; !ip.Equal(local.IP) {
+			t.Errorf("connection is not dialed from local address: %s", ip)
+		}
+	}()
+	stopC := make(chan struct{})
+	time.AfterFunc(time.Second, func() { close(stopC) })
+	// Handshake does not complete because the other side does not respond. Only the source address is checked.
+	_, _, _, _, _ = Dial(l.Addr(), &net.Dialer{Timeout: time.Second, LocalAddr: local}, time.Second, false, false, ext1, infoHash, id1, stopC)
+	<-done
+}
+
+func TestDialPlaintextFallbackLocalPort(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	pl, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := pl.Addr().(*net.TCPAddr)
+	pl.Close()
+	errC := make(chan error, 1)
+	go func() {
+		_, _, _, _, err2 := Dial(l.Addr(), &net.Dialer{Timeout: time.Second, LocalAddr: local}, 10*time.Second, true, false, ext1, infoHash, id1, nil)
+		errC <- err2
+	}()
+	// Encryption handshake fails because the first connection is closed.
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := conn.RemoteAddr().(*net.TCPAddr).Port; port != local.Port {
+		t.Fatalf("first connection is not dialed from local port: %d", port)
+	}
+	conn.Close()
+	conn, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if port := conn.RemoteAddr().(*net.TCPAddr).Port; port == local.Port {
+		t.Fatal("plaintext connection is dialed from the same local port")
+	}
+	_, _, _, _, _, err = Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, func([20]byte) [20]byte { return id2 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialFallback(t *testing.T) {
+	// Peer is reachable over uTP only.
+	l, err := utp.Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	socket, err := utp.Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: l.Addr().(*net.UDPAddr).Port}
+	dialer := FallbackDialer{Primary: &net.Dialer{Timeout: time.Second}, Fallback: socket}
+	errC := make(chan error, 1)
+	go func() {
+		conn, _, _, _, err2 := Dial(addr, dialer, 10*time.Second, true, false, ext1, infoHash, id1, nil)
+		if err2 == nil {
+			if _, ok := conn.RemoteAddr().(*net.UDPAddr); !ok {
+				err2 = fmt.Errorf("connection is not made over utp: %s", conn.RemoteAddr())
+			}
+			conn.Close()
+		}
+		errC <- err2
+	}()
+	// Encryption is not supported, so the peer connects again without encryption over uTP.
+	for i := 0; i < 2; i++ {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, _, _, err = Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, func([20]byte) [20]byte { return id2 })
+		if err == nil {
+			defer conn.Close()
+			break
+		}
+		conn.Close()
+		if i == 1 {
+			t.Fatal(err)
+		}
+	}
+	if err = <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcceptHandshakeTimeout(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// Peer connects but never sends the handshake.
+	silent, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	_, _, _, _, _, err = Accept(conn, 100*time.Millisecond, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, func([20]byte) [20]byte { return id2 })
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("handshake is aborted after %s", elapsed)
+	}
+}
@@ -10,12 +10,37 @@ import (
 	"github.com/cenkalti/rain/internal/mse"
 )
 
+// Dialer opens the underlying connection to the peer.
+// It is implemented by *net.Dialer and the SOCKS5 dialer in golang.org/x/net/proxy package.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// FallbackDialer opens the connection with Fallback if it cannot be opened with Primary.
+// It is used for connecting to peers over uTP when they are not reachable over TCP.
+type FallbackDialer struct {
+	Primary  Dialer
+	Fallback Dialer
+}
+
+// DialContext connects to the address with Primary first.
+// Fallback is not tried if ctx is cancelled.
+func (d FallbackDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Primary.DialContext(ctx, network, address)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	return d.Fallback.DialContext(ctx, network, address)
+}
+
 // Dial new connection to the address. Does the BitTorrent protocol handshake.
 // Handles encryption. May try to connect again if encryption does not match with given setting.
 // Returns a net.Conn that is ready for sending/receiving BitTorrent peer protocol messages.
+// Connect timeout and local address are taken from the dialer. Dialing is cancelled when stopC is closed.
 func Dial(
 	addr net.Addr,
-	dialTimeout, handshakeTimeout time.Duration,
+	dialer Dialer,
+	handshakeTimeout time.Duration,
 	enableEncryption,
 	forceEncryption bool,
 	ourExtensions [8]byte,
@@ -38,8 +63,7 @@ func Dial(
 
 	// First connection
 	log.Debug("Connecting to peer...")
-	dialer := net.Dialer{Timeout: dialTimeout}
-	conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
+	conn, err = dial(ctx, dialer, addr)
 	if err != nil {
 		return
 	}
@@ -97,7 +121,7 @@ func Dial(
 			// Close current connection and try again without encryption
 			conn.Close()
 			log.Debug("Connecting again without encryption...")
-			conn, err = dialer.DialContext(ctx, addr.Network(), addr.String())
+			conn, err = dial(ctx, redialer(dialer, conn), addr)
 			if err != nil {
 				return
 			}
@@ -155,3 +179,40 @@ func Dial(
 	}
 	return
 }
+
+func dial(ctx context.Context, dialer Dialer, addr net.Addr) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, addr.Network(), addr.String())
+	if err != nil {
+		return nil, err
+	}
+	if conn.RemoteAddr().String() != addr.String() {
+		// Connection is made through a proxy server.
+		conn = &proxyConn{Conn: conn, addr: addr}
+	}
+	return conn, nil
+}
+
+// redialer returns the dialer for connecting again without encryption.
+// If the dialer binds to a fixed local port, the port is selected by the system instead,
+// because the connection to the same address from the same port may not be closed completely yet.
+// If the previous connection is made by the fallback of a FallbackDialer, the fallback is used directly.
+func redialer(dialer Dialer, prev net.Conn) Dialer {
+	if fd, ok := dialer.(FallbackDialer); ok {
+		if _, ok := prev.RemoteAddr().(*net.UDPAddr); ok {
+			return fd.Fallback
+		}
+		return redialer(fd.Primary, prev)
+	}
+	d, ok := dialer.(*net.Dialer)
+	if !ok {
+		return dialer
+	}
+	laddr, ok := d.LocalAddr.(*net.TCPAddr)
+	if !ok || laddr.Port == 0 {
+		return dialer
+	}
+	d2 := *d
+	d2.LocalAddr = &net.TCPAddr{IP: laddr.IP, Zone: laddr.Zone}
+	d2.Control = nil
+	return &d2
+}
@@ -25,6 +25,12 @@ func New(pi *piece.Piece, cache *piececache.Cache, readSize int64, peerID [20]by
 	}
 }
 
+// Invalidate removes the cached blocks of all pieces that are created with the peerID.
+// Must be called when the data of the pieces may change, e.g. after the files are closed.
+func Invalidate(cache *piececache.Cache, peerID [20]byte) {
+	cache.RemovePrefix(string(peerID[:]))
+}
+
 // ReadAt implements the io.ReaderAt interface.
 func (c *CachedPiece) ReadAt(p []byte, off int64) (n int, err error) {
 	blk := uint32(off / c.readSize)
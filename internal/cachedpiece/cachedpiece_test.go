@@ -0,0 +1,85 @@
+package cachedpiece
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/piececache"
+)
+
+type countingFile struct {
+	data  []byte
+	reads int
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	f.reads++
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *countingFile) WriteAt(p []byte, off int64) (int, error) {
+	return copy(f.data[off:], p), nil
+}
+
+func TestReadFromCache(t *testing.T) {
+	f := &countingFile{data: []byte("0123456789")}
+	pi := &piece.Piece{
+		Index:  1,
+		Length: 10,
+		Data:   filesection.Piece{{File: f, Offset: 0, Length: 10}},
+	}
+	cache := piececache.New(100, time.Minute, 1)
+	defer cache.Close()
+	var peerID [20]byte
+	peerID[0] = 1
+	cp := New(pi, cache, 4, peerID)
+
+	read := func(off int64, expected string) {
+		t.Helper()
+		b := make([]byte, len(expected))
+		n, err := cp.ReadAt(b, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b[:n], []byte(expected)) {
+			t.Fatalf("read %q, want %q", b[:n], expected)
+		}
+	}
+
+	read(4, "4567")
+	if f.reads != 1 {
+		t.Fatalf("reads: %d", f.reads)
+	}
+	// Second read of the same block is served from cache.
+	read(4, "4567")
+	read(5, "567")
+	if f.reads != 1 {
+		t.Fatalf("reads: %d", f.reads)
+	}
+	// Last block is shorter than read size.
+	read(8, "89")
+	if f.reads != 2 {
+		t.Fatalf("reads: %d", f.reads)
+	}
+
+	// Blocks of other torrents are not invalidated.
+	var otherPeerID [20]byte
+	Invalidate(cache, otherPeerID)
+	read(4, "4567")
+	if f.reads != 2 {
+		t.Fatalf("reads: %d", f.reads)
+	}
+
+	copy(f.data, "abcdefghij")
+	Invalidate(cache, peerID)
+	if cache.Len() != 0 {
+		t.Fatalf("cache len: %d", cache.Len())
+	}
+	read(4, "efgh")
+	if f.reads != 3 {
+		t.Fatalf("reads: %d", f.reads)
+	}
+}
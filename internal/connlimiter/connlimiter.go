@@ -0,0 +1,86 @@
+// Package connlimiter limits the number of connections shared by multiple torrents.
+package connlimiter
+
+import "sync"
+
+// ConnLimiter keeps count of open connections and rejects new connections when the limit is reached.
+// Callers that are rejected may wait in a bounded queue to be notified when a connection slot is freed.
+type ConnLimiter struct {
+	max      int
+	maxQueue int
+
+	m       sync.Mutex
+	count   int
+	waiters []chan struct{}
+}
+
+// New returns a new ConnLimiter that allows max connections. Zero or negative max means no limit.
+// At most maxQueue waiters are kept in the queue.
+func New(max, maxQueue int) *ConnLimiter {
+	return &ConnLimiter{
+		max:      max,
+		maxQueue: maxQueue,
+	}
+}
+
+// Len returns the number of acquired slots.
+func (l *ConnLimiter) Len() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.count
+}
+
+// Acquire a connection slot. Returns false if there are no free slots.
+// If notifyC is not nil and there are no free slots, notifyC is put into the waiting queue.
+// A value is sent into notifyC without blocking when a slot is released, so it should be a buffered channel.
+func (l *ConnLimiter) Acquire(notifyC chan struct{}) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.max <= 0 || l.count < l.max {
+		l.count++
+		return true
+	}
+	if notifyC != nil && len(l.waiters) < l.maxQueue && !l.waiting(notifyC) {
+		l.waiters = append(l.waiters, notifyC)
+	}
+	return false
+}
+
+// Release a slot that is acquired previously. First waiter in the queue is notified.
+func (l *ConnLimiter) Release() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.count == 0 {
+		panic("release without acquire")
+	}
+	l.count--
+	if len(l.waiters) > 0 {
+		notifyC := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		select {
+		case notifyC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Remove the channel from waiting queue.
+func (l *ConnLimiter) Remove(notifyC chan struct{}) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for i, c := range l.waiters {
+		if c == notifyC {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (l *ConnLimiter) waiting(notifyC chan struct{}) bool {
+	for _, c := range l.waiters {
+		if c == notifyC {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package connlimiter
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnLimiterQueue(t *testing.T) {
+	l := New(2, 1)
+	assert.True(t, l.Acquire(nil))
+	assert.True(t, l.Acquire(nil))
+
+	c1 := make(chan struct{}, 1)
+	c2 := make(chan struct{}, 1)
+	assert.False(t, l.Acquire(c1))
+	assert.False(t, l.Acquire(c2)) // queue is full, not added
+
+	l.Release()
+	select {
+	case <-c1:
+	default:
+		t.Fatal("waiter is not notified")
+	}
+	assert.Len(t, c2, 0)
+	assert.True(t, l.Acquire(c1))
+	assert.False(t, l.Acquire(c1))
+	l.Remove(c1)
+	l.Release()
+	assert.Len(t, c1, 0)
+}
+
+func TestConnLimiterUnlimited(t *testing.T) {
+	l := New(0, 0)
+	for i := 0; i < 1000; i++ {
+		assert.True(t, l.Acquire(nil))
+	}
+	assert.Equal(t, 1000, l.Len())
+}
+
+func TestConnLimiterChurn(t *testing.T) {
+	const max = 20
+	l := New(max, 5)
+	var connected, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			notifyC := make(chan struct{}, 1)
+			for j := 0; j < 200; j++ {
+				if !l.Acquire(notifyC) {
+					select {
+					case <-notifyC:
+					case <-time.After(time.Millisecond):
+					}
+					continue
+				}
+				n := atomic.AddInt32(&connected, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond) // nolint: gosec
+				atomic.AddInt32(&connected, -1)
+				l.Release()
+			}
+			l.Remove(notifyC)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak, int32(max))
+	assert.Equal(t, 0, l.Len())
+}
@@ -573,9 +573,9 @@ func (c *Console) drawDetails(g *gocui.Gui) error {
 					fmt.Fprintf(v, "    Status: %s, Error: %s\n", t.Status, errStr)
 				default:
 					if t.Warning != "" {
-						fmt.Fprintf(v, "    Status: %s, Seeders: %d, Leechers: %d Warning: %s\n", t.Status, t.Seeders, t.Leechers, t.Warning)
+						fmt.Fprintf(v, "    Status: %s, Seeders: %d, Leechers: %d, Peers: %d Warning: %s\n", t.Status, t.Seeders, t.Leechers, t.Peers, t.Warning)
 					} else {
-						fmt.Fprintf(v, "    Status: %s, Seeders: %d, Leechers: %d\n", t.Status, t.Seeders, t.Leechers)
+						fmt.Fprintf(v, "    Status: %s, Seeders: %d, Leechers: %d, Peers: %d\n", t.Status, t.Seeders, t.Leechers, t.Peers)
 					}
 				}
 				var nextAnnounce string
@@ -1140,6 +1140,8 @@ func flags(p rpctypes.Peer) string {
 		sb.WriteString("I")
 	case "MANUAL":
 		sb.WriteString("M")
+	case "LSD":
+		sb.WriteString("L")
 	default:
 		sb.WriteString(" ")
 	}
@@ -0,0 +1,148 @@
+// Package datamover moves the files of a torrent from one directory to another.
+package datamover
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Size of the chunks when copying a file across devices.
+const copyChunkSize = 1 << 20
+
+var errClosed = errors.New("data mover is closed")
+
+// DataMover moves the files of a torrent to another directory.
+type DataMover struct {
+	Src   string
+	Dest  string
+	Error error
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// New returns a new DataMover for moving files from src directory to dest directory.
+func New(src, dest string) *DataMover {
+	return &DataMover{
+		Src:    src,
+		Dest:   dest,
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+}
+
+// Close the DataMover. Files that are already moved are not moved back.
+func (m *DataMover) Close() {
+	close(m.closeC)
+	<-m.doneC
+}
+
+// Run the DataMover. Files are paths relative to the source directory.
+// Each file is renamed into the destination directory.
+// If the directories are on different devices the file is copied to the destination and removed from the source.
+func (m *DataMover) Run(files []string, perm os.FileMode, resultC chan *DataMover) {
+	defer close(m.doneC)
+
+	defer func() {
+		select {
+		case resultC <- m:
+		case <-m.closeC:
+		}
+	}()
+
+	for _, name := range files {
+		select {
+		case <-m.closeC:
+			m.Error = errClosed
+			return
+		default:
+		}
+		m.Error = m.moveFile(name, perm)
+		if m.Error != nil {
+			return
+		}
+	}
+	for _, name := range files {
+		removeEmptyParents(m.Src, name)
+	}
+}
+
+func (m *DataMover) moveFile(name string, perm os.FileMode) error {
+	src := filepath.Join(m.Src, name)
+	dest := filepath.Join(m.Dest, name)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		// File might be moved before in an interrupted run.
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(dest), os.ModeDir|perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	err = m.copyFile(src, dest, perm)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to a temporary file next to dest, then renames it to dest,
+// so a partially copied file never appears at the destination path.
+func (m *DataMover) copyFile(src, dest string, perm os.FileMode) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	tmp := dest + ".part"
+	df, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm&^0111)
+	if err != nil {
+		return err
+	}
+	err = m.copyData(df, sf)
+	if err == nil {
+		err = df.Sync()
+	}
+	if err2 := df.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func (m *DataMover) copyData(dst io.Writer, src io.Reader) error {
+	for {
+		select {
+		case <-m.closeC:
+			return errClosed
+		default:
+		}
+		_, err := io.CopyN(dst, src, copyChunkSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// removeEmptyParents removes the parent directories of the file under root if they are empty.
+func removeEmptyParents(root, name string) {
+	dir := filepath.Dir(name)
+	for dir != "." && dir != string(filepath.Separator) {
+		if os.Remove(filepath.Join(root, dir)) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,76 @@
+package datamover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, data string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(data), 0o640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkFile(t *testing.T, name, data string) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != data {
+		t.Fatalf("invalid data in %s: %q", name, string(b))
+	}
+}
+
+func TestMove(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "complete")
+	writeFile(t, filepath.Join(src, "dir", "a"), "foo")
+	writeFile(t, filepath.Join(src, "dir", "sub", "b"), "bar")
+	writeFile(t, filepath.Join(src, "other"), "baz")
+
+	m := New(src, dest)
+	resultC := make(chan *DataMover, 1)
+	m.Run([]string{filepath.Join("dir", "a"), filepath.Join("dir", "sub", "b")}, 0o750, resultC)
+	if res := <-resultC; res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	checkFile(t, filepath.Join(dest, "dir", "a"), "foo")
+	checkFile(t, filepath.Join(dest, "dir", "sub", "b"), "bar")
+	if _, err := os.Stat(filepath.Join(src, "dir")); !os.IsNotExist(err) {
+		t.Fatal("source dir is not removed")
+	}
+	checkFile(t, filepath.Join(src, "other"), "baz")
+}
+
+func TestMoveSkipsMovedFiles(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	writeFile(t, filepath.Join(dest, "a"), "foo")
+
+	m := New(src, dest)
+	resultC := make(chan *DataMover, 1)
+	m.Run([]string{"a"}, 0o750, resultC)
+	if res := <-resultC; res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	checkFile(t, filepath.Join(dest, "a"), "foo")
+}
+
+func TestCopyFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "a")
+	dest := filepath.Join(t.TempDir(), "b")
+	writeFile(t, src, "foo")
+
+	m := New(filepath.Dir(src), filepath.Dir(dest))
+	if err := m.copyFile(src, dest, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, dest, "foo")
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Fatal("temporary file is not removed")
+	}
+}
@@ -0,0 +1,48 @@
+// Package diskspace provides functions for checking the free space on disk before writing files.
+package diskspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsupported is returned on platforms that free disk space cannot be queried.
+var ErrUnsupported = errors.New("disk space check is not supported on this platform")
+
+// Free returns the number of bytes available to the current user on the file system of dir.
+// If dir does not exist yet, the nearest existing parent directory is used.
+func Free(dir string) (int64, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		_, err = os.Stat(dir)
+		if !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	if err != nil {
+		return 0, err
+	}
+	return free(dir)
+}
+
+// Allocated returns the number of bytes that are allocated on disk for the file at path.
+// Sparse files may have less bytes allocated than their size. Zero is returned if the file does not exist.
+func Allocated(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return allocated(fi), nil
+}
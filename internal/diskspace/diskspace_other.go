@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package diskspace
+
+import "os"
+
+func free(dir string) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+func allocated(fi os.FileInfo) int64 {
+	return fi.Size()
+}
@@ -0,0 +1,44 @@
+package diskspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFree(t *testing.T) {
+	dir := t.TempDir()
+	n, err := Free(filepath.Join(dir, "not", "created"))
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n <= 0 {
+		t.Fatalf("invalid free space: %d", n)
+	}
+}
+
+func TestAllocated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	n, err := Allocated(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("missing file has %d bytes allocated", n)
+	}
+	err = os.WriteFile(path, make([]byte, 64<<10), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = Allocated(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 64<<10 {
+		t.Fatalf("allocated %d bytes, want at least %d", n, 64<<10)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd
+
+package diskspace
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func free(dir string) (int64, error) {
+	var st unix.Statfs_t
+	err := unix.Statfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+func allocated(fi os.FileInfo) int64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		// Blocks are counted in 512 byte units independently of the block size of the file system.
+		return int64(st.Blocks) * 512
+	}
+	return fi.Size()
+}
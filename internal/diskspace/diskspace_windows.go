@@ -0,0 +1,25 @@
+package diskspace
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func free(dir string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, totalFree uint64
+	err = windows.GetDiskFreeSpaceEx(p, &available, &total, &totalFree)
+	if err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
+
+// Sparse files are not created on Windows, so the size of the file is allocated on disk.
+func allocated(fi os.FileInfo) int64 {
+	return fi.Size()
+}
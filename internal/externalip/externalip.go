@@ -6,7 +6,7 @@ import (
 	"github.com/cenkalti/log"
 )
 
-var ips []net.IP
+var ips, ips6 []net.IP
 
 func init() {
 	addrs, err := net.InterfaceAddrs()
@@ -21,6 +21,9 @@ func init() {
 		}
 		i4 := in.IP.To4()
 		if i4 == nil {
+			if in.IP.IsGlobalUnicast() && !in.IP.IsPrivate() {
+				ips6 = append(ips6, in.IP)
+			}
 			continue
 		}
 		if !isPublicIP(i4) {
@@ -53,6 +56,11 @@ func IsExternal(ip net.IP) bool {
 			return true
 		}
 	}
+	for i := range ips6 {
+		if ip.Equal(ips6[i]) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -63,3 +71,11 @@ func FirstExternalIP() net.IP {
 	}
 	return ips[0]
 }
+
+// FirstExternalIPv6 returns the first global IPv6 address of the network interfaces on the server.
+func FirstExternalIPv6() net.IP {
+	if len(ips6) == 0 {
+		return nil
+	}
+	return ips6[0]
+}
@@ -58,12 +58,16 @@ func (p Piece) ReadAt(b []byte, off int64) (int, error) {
 // Write implements io.Writer interface.
 // It writes the bytes in p into files in s.
 // Used when writing a downloaded piece (all blocks) after hash check is done.
+// Blocks of the piece are collected in memory while downloading, so a piece is written with a single WriteAt call per file.
 // Calling write does not change the current position in s,
 // so len(p) must be equal to total length of the all files in s in order to issue a full write.
 func (p Piece) Write(b []byte) (n int, err error) {
 	var m int
 	for _, sec := range p {
 		if sec.Padding {
+			// Padding data is not saved but it still takes place in the piece.
+			b = b[sec.Length:]
+			n += int(sec.Length)
 			continue
 		}
 		m, err = sec.File.WriteAt(b[:sec.Length], sec.Offset)
@@ -75,3 +79,40 @@ func (p Piece) Write(b []byte) (n int, err error) {
 	}
 	return
 }
+
+// WriteAt implements io.WriterAt interface.
+// It writes the bytes in b into files in s, starting at offset off in the piece.
+// Used when saving the downloaded blocks of an incomplete piece before the torrent is stopped.
+// Parts of b that belong to padding files are skipped.
+func (p Piece) WriteAt(b []byte, off int64) (n int, err error) {
+	var m int
+	var pos int64
+	for _, sec := range p {
+		if len(b) == 0 {
+			break
+		}
+		end := pos + sec.Length
+		if off >= end {
+			pos = end
+			continue
+		}
+		skip := off - pos
+		l := sec.Length - skip
+		if l > int64(len(b)) {
+			l = int64(len(b))
+		}
+		if sec.Padding {
+			m = int(l)
+		} else {
+			m, err = sec.File.WriteAt(b[:l], sec.Offset+skip)
+		}
+		n += m
+		if err != nil {
+			return
+		}
+		b = b[m:]
+		off += int64(m)
+		pos = end
+	}
+	return
+}
@@ -80,3 +80,119 @@ func content(f *os.File) string {
 	_, _ = f.Read(b)
 	return string(b)
 }
+
+type countingWriter struct {
+	data   []byte
+	writes int
+}
+
+func (w *countingWriter) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, w.data[off:]), nil
+}
+
+func (w *countingWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.writes++
+	return copy(w.data[off:], p), nil
+}
+
+func TestWriteWithPadding(t *testing.T) {
+	f1 := &countingWriter{data: make([]byte, 4)}
+	pad := &countingWriter{data: make([]byte, 2)}
+	f2 := &countingWriter{data: make([]byte, 3)}
+	pf := Piece{
+		{f1, 1, 3, "f1", false},
+		{pad, 0, 2, "pad", true},
+		{f2, 0, 3, "f2", false},
+	}
+	n, err := pf.Write([]byte("abc\x00\x00def"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Errorf("n == %d", n)
+	}
+	if string(f1.data) != "\x00abc" || string(f2.data) != "def" {
+		t.Errorf("invalid data: %q %q", f1.data, f2.data)
+	}
+	if f1.writes != 1 || f2.writes != 1 || pad.writes != 0 {
+		t.Errorf("invalid write counts: %d %d %d", f1.writes, pad.writes, f2.writes)
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	f1 := &countingWriter{data: make([]byte, 4)}
+	pad := &countingWriter{data: make([]byte, 2)}
+	f2 := &countingWriter{data: make([]byte, 3)}
+	pf := Piece{
+		{f1, 1, 3, "f1", false},
+		{pad, 0, 2, "pad", true},
+		{f2, 0, 3, "f2", false},
+	}
+	n, err := pf.WriteAt([]byte("bc\x00\x00d"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("n == %d", n)
+	}
+	n, err = pf.WriteAt([]byte("f"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("n == %d", n)
+	}
+	if string(f1.data) != "\x00\x00bc" || string(f2.data) != "d\x00f" {
+		t.Errorf("invalid data: %q %q", f1.data, f2.data)
+	}
+	if pad.writes != 0 {
+		t.Errorf("padding is written %d times", pad.writes)
+	}
+}
+
+const (
+	benchPieceLength = 256 * 1024
+	benchBlockSize   = 16 * 1024
+)
+
+func benchmarkFile(b *testing.B) *os.File {
+	f, err := os.CreateTemp(b.TempDir(), "bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { f.Close() })
+	return f
+}
+
+// BenchmarkWriteBlocks writes each block of a piece to the file as it arrives.
+func BenchmarkWriteBlocks(b *testing.B) {
+	f := benchmarkFile(b)
+	buf := make([]byte, benchPieceLength)
+	b.SetBytes(benchPieceLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		off := int64(i%64) * benchPieceLength
+		for begin := 0; begin < benchPieceLength; begin += benchBlockSize {
+			_, err := f.WriteAt(buf[begin:begin+benchBlockSize], off+int64(begin))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkWritePiece writes the whole piece at once after all blocks are collected in memory.
+func BenchmarkWritePiece(b *testing.B) {
+	f := benchmarkFile(b)
+	buf := make([]byte, benchPieceLength)
+	b.SetBytes(benchPieceLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		off := int64(i%64) * benchPieceLength
+		pf := Piece{{f, off, benchPieceLength, "", false}}
+		_, err := pf.Write(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -59,3 +59,13 @@ func TestInfoDownloader(t *testing.T) {
 	d.GotBlock(10, make([]byte, 42))
 	assert.True(t, d.Done())
 }
+
+func TestInfoDownloaderInvalidBlock(t *testing.T) {
+	p := &TestPeer{}
+	d := New(p)
+	d.RequestBlocks(20)
+	assert.NotNil(t, d.GotBlock(11, make([]byte, blockSize)))
+	assert.NotNil(t, d.GotBlock(1<<31, make([]byte, blockSize)))
+	assert.NotNil(t, d.GotBlock(10, make([]byte, blockSize)))
+	assert.Nil(t, d.GotBlock(10, make([]byte, 42)))
+}
@@ -44,6 +44,18 @@ func New(name string) Logger {
 	return logger
 }
 
+// NewWithHandler is like New but the messages are sent to h instead of the global handler.
+// If h is nil, the global handler is used.
+func NewWithHandler(name string, h log.Handler) Logger {
+	if h == nil {
+		return New(name)
+	}
+	logger := log.NewLogger(name)
+	logger.SetLevel(log.DEBUG)
+	logger.SetHandler(h)
+	return logger
+}
+
 type logFormatter struct{}
 
 // Format outputs a message like:
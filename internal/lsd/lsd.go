@@ -0,0 +1,275 @@
+// Package lsd implements Local Service Discovery (BEP 14) for finding peers on local network with multicast.
+package lsd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+// Multicast group addresses defined in BEP 14.
+const (
+	Addr4 = "239.192.152.143:6771"
+	Addr6 = "[ff15::efc0:988f]:6771"
+)
+
+// Announces from the same host for the same torrent are ignored during this period.
+const debounceInterval = time.Minute
+
+// Peer is a peer found on local network.
+type Peer struct {
+	InfoHash [20]byte
+	Addr     *net.TCPAddr
+}
+
+// LSD announces torrents to a multicast group and listens for announces of other peers in the same group.
+type LSD struct {
+	network  string
+	addr     *net.UDPAddr
+	ifi      *net.Interface
+	interval time.Duration
+	cookie   string
+	log      logger.Logger
+
+	conn     *net.UDPConn // listens multicast group
+	sendConn *net.UDPConn
+	started  bool
+
+	m        sync.Mutex
+	torrents map[[20]byte]int // info hash -> port
+	seen     map[string]time.Time
+
+	peersC   chan Peer
+	announce chan struct{}
+	closeC   chan struct{}
+	doneC    chan struct{}
+}
+
+// New returns a new LSD for the multicast group address. Network must be "udp4" or "udp6".
+// Registered torrents are announced at every interval.
+// If ifi is nil, the system assigned multicast interface is used.
+func New(network, addr string, ifi *net.Interface, interval time.Duration) (*LSD, error) {
+	uaddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	var b [8]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return nil, err
+	}
+	return &LSD{
+		network:  network,
+		addr:     uaddr,
+		ifi:      ifi,
+		interval: interval,
+		cookie:   hex.EncodeToString(b[:]),
+		log:      logger.New("lsd " + network),
+		torrents: make(map[[20]byte]int),
+		seen:     make(map[string]time.Time),
+		peersC:   make(chan Peer),
+		announce: make(chan struct{}, 1),
+		closeC:   make(chan struct{}),
+		doneC:    make(chan struct{}),
+	}, nil
+}
+
+// Start listening the multicast group and announcing torrents.
+func (l *LSD) Start() error {
+	var err error
+	l.conn, err = net.ListenMulticastUDP(l.network, l.ifi, l.addr)
+	if err != nil {
+		return err
+	}
+	l.sendConn, err = net.ListenUDP(l.network, nil)
+	if err != nil {
+		l.conn.Close()
+		return err
+	}
+	l.started = true
+	go l.readLoop()
+	go l.announceLoop()
+	return nil
+}
+
+// Close stops announcing and listening. It does nothing if the LSD is not started.
+func (l *LSD) Close() {
+	if !l.started {
+		return
+	}
+	close(l.closeC)
+	l.conn.Close()
+	l.sendConn.Close()
+	<-l.doneC
+}
+
+// Peers returns a channel for receiving peers found in local network.
+func (l *LSD) Peers() <-chan Peer {
+	return l.peersC
+}
+
+// Add registers the torrent for announcing. Port is the port number that torrent is accepting peer connections.
+func (l *LSD) Add(infoHash [20]byte, port int) {
+	l.m.Lock()
+	l.torrents[infoHash] = port
+	l.m.Unlock()
+	select {
+	case l.announce <- struct{}{}:
+	default:
+	}
+}
+
+// Remove the torrent from announce list.
+func (l *LSD) Remove(infoHash [20]byte) {
+	l.m.Lock()
+	delete(l.torrents, infoHash)
+	l.m.Unlock()
+}
+
+func (l *LSD) announceLoop() {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.announce:
+		case <-l.closeC:
+			return
+		}
+		l.announceAll()
+	}
+}
+
+func (l *LSD) announceAll() {
+	// Torrents sharing the same port are sent in a single message.
+	byPort := make(map[int][][20]byte)
+	l.m.Lock()
+	for ih, port := range l.torrents {
+		byPort[port] = append(byPort[port], ih)
+	}
+	l.m.Unlock()
+	for port, infoHashes := range byPort {
+		msg := formatAnnounce(l.addr.String(), port, infoHashes, l.cookie)
+		_, err := l.sendConn.WriteToUDP(msg, l.addr)
+		if err != nil {
+			l.log.Debugln("cannot send announce:", err.Error())
+		}
+	}
+}
+
+func (l *LSD) readLoop() {
+	defer close(l.doneC)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-l.closeC:
+			default:
+				l.log.Error(err)
+			}
+			return
+		}
+		a, err := parseAnnounce(buf[:n])
+		if err != nil {
+			l.log.Debugln("invalid announce from", from.String(), err.Error())
+			continue
+		}
+		if a.Cookie == l.cookie {
+			continue
+		}
+		for _, ih := range a.InfoHashes {
+			if !l.shouldDeliver(from.IP, ih) {
+				continue
+			}
+			pe := Peer{
+				InfoHash: ih,
+				Addr:     &net.TCPAddr{IP: from.IP, Port: a.Port},
+			}
+			select {
+			case l.peersC <- pe:
+			case <-l.closeC:
+				return
+			}
+		}
+	}
+}
+
+// shouldDeliver returns false if the same host has announced the torrent recently.
+func (l *LSD) shouldDeliver(ip net.IP, infoHash [20]byte) bool {
+	now := time.Now()
+	for k, t := range l.seen {
+		if now.Sub(t) > debounceInterval {
+			delete(l.seen, k)
+		}
+	}
+	key := ip.String() + string(infoHash[:])
+	if _, ok := l.seen[key]; ok {
+		return false
+	}
+	l.seen[key] = now
+	return true
+}
+
+type announce struct {
+	Port       int
+	InfoHashes [][20]byte
+	Cookie     string
+}
+
+func formatAnnounce(host string, port int, infoHashes [][20]byte, cookie string) []byte {
+	var b bytes.Buffer
+	b.WriteString("BT-SEARCH * HTTP/1.1\r\n")
+	b.WriteString("Host: " + host + "\r\n")
+	b.WriteString("Port: " + strconv.Itoa(port) + "\r\n")
+	for _, ih := range infoHashes {
+		b.WriteString("Infohash: " + hex.EncodeToString(ih[:]) + "\r\n")
+	}
+	b.WriteString("cookie: " + cookie + "\r\n")
+	b.WriteString("\r\n\r\n")
+	return b.Bytes()
+}
+
+func parseAnnounce(data []byte) (*announce, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	if req.Method != "BT-SEARCH" {
+		return nil, errors.New("invalid method")
+	}
+	port, err := strconv.ParseUint(req.Header.Get("Port"), 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	if port == 0 {
+		return nil, errors.New("invalid port")
+	}
+	a := &announce{
+		Port:   int(port),
+		Cookie: req.Header.Get("Cookie"),
+	}
+	for _, s := range req.Header.Values("Infohash") {
+		b, err := hex.DecodeString(strings.TrimSpace(s))
+		if err != nil || len(b) != 20 {
+			return nil, errors.New("invalid info hash")
+		}
+		var ih [20]byte
+		copy(ih[:], b)
+		a.InfoHashes = append(a.InfoHashes, ih)
+	}
+	if len(a.InfoHashes) == 0 {
+		return nil, errors.New("no info hash")
+	}
+	return a, nil
+}
@@ -0,0 +1,81 @@
+package lsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnounceFormatParse(t *testing.T) {
+	infoHashes := [][20]byte{{1}, {2}}
+	msg := formatAnnounce(Addr4, 6881, infoHashes, "abc")
+	a, err := parseAnnounce(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6881, a.Port)
+	assert.Equal(t, infoHashes, a.InfoHashes)
+	assert.Equal(t, "abc", a.Cookie)
+
+	_, err = parseAnnounce([]byte("BT-SEARCH * HTTP/1.1\r\nPort: 6881\r\n\r\n"))
+	assert.Error(t, err)
+}
+
+func TestDebounce(t *testing.T) {
+	l, err := New("udp4", Addr4, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := []byte{10, 0, 0, 1}
+	assert.True(t, l.shouldDeliver(ip, [20]byte{1}))
+	assert.False(t, l.shouldDeliver(ip, [20]byte{1}))
+	assert.True(t, l.shouldDeliver(ip, [20]byte{2}))
+	assert.True(t, l.shouldDeliver([]byte{10, 0, 0, 2}, [20]byte{1}))
+}
+
+func TestCloseNotStarted(t *testing.T) {
+	l, err := New("udp4", Addr4, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+}
+
+func TestDiscovery(t *testing.T) {
+	l1, err := New("udp4", Addr4, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := New("udp4", Addr4, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l1.Start(); err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	defer l1.Close()
+	if err = l2.Start(); err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	defer l2.Close()
+
+	l1.Add([20]byte{1}, 5001)
+	l2.Add([20]byte{2}, 5002)
+
+	found := func(l *LSD, infoHash [20]byte, port int) {
+		for {
+			select {
+			case pe := <-l.Peers():
+				if pe.InfoHash == infoHash {
+					assert.Equal(t, port, pe.Addr.Port)
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("peer is not found")
+			}
+		}
+	}
+	found(l1, [20]byte{2}, 5002)
+	found(l2, [20]byte{1}, 5001)
+}
@@ -80,6 +80,7 @@ func New(s string) (*Magnet, error) {
 	return &magnet, nil
 }
 
+// String returns the magnet link. Parameter values are URL encoded.
 func (m *Magnet) String() string {
 	var b strings.Builder
 	b.Grow(2048)
@@ -89,8 +90,17 @@ func (m *Magnet) String() string {
 		b.WriteString("&dn=")
 		b.WriteString(url.QueryEscape(m.Name))
 	}
+	// Single tracker tiers are written with "tr" key for compatibility with other clients.
+	// If there is a tier with multiple trackers, indexed keys are used for all tiers so their order is preserved.
+	indexed := false
+	for _, ti := range m.Trackers {
+		if len(ti) > 1 {
+			indexed = true
+			break
+		}
+	}
 	for i, ti := range m.Trackers {
-		if len(ti) == 1 {
+		if len(ti) == 1 && !indexed {
 			b.WriteString("&tr=")
 			b.WriteString(url.QueryEscape(ti[0]))
 		} else {
@@ -114,26 +124,35 @@ type trackerTier struct {
 	index    int
 }
 
-// infoHashString returns a new info hash value from a string.
-// s must be 40 (hex encoded) or 32 (base32 encoded) characters, otherwise it returns error.
+// DecodeInfoHash decodes an info hash from 40 characters in hex or 32 characters in base32 encoding.
+// Both encodings are case-insensitive.
+func DecodeInfoHash(s string) ([20]byte, error) {
+	var ih [20]byte
+	var b []byte
+	var err error
+	switch len(s) {
+	case 40:
+		b, err = hex.DecodeString(s)
+	case 32:
+		b, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		return ih, errors.New("info hash must be 32 or 40 characters")
+	}
+	if err != nil {
+		return ih, err
+	}
+	copy(ih[:], b)
+	return ih, nil
+}
+
+// infoHashString returns a new info hash value from the xt param of magnet link.
 func infoHashString(xt string) ([20]byte, error) {
 	var ih [20]byte
 	var b []byte
 	var err error
 	switch {
 	case strings.HasPrefix(xt, "urn:btih:"):
-		xt = xt[9:]
-		switch len(xt) {
-		case 40:
-			b, err = hex.DecodeString(xt)
-		case 32:
-			b, err = base32.StdEncoding.DecodeString(xt)
-		default:
-			return ih, errors.New("info hash must be 32 or 40 characters")
-		}
-		if err != nil {
-			return ih, err
-		}
+		return DecodeInfoHash(xt[9:])
 	case strings.HasPrefix(xt, "urn:btmh:"):
 		xt = xt[9:]
 		b, err = multihash.FromHexString(xt)
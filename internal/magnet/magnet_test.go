@@ -2,6 +2,7 @@ package magnet
 
 import (
 	"encoding/hex"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -31,3 +32,54 @@ func TestParse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestStringTiers(t *testing.T) {
+	m := Magnet{
+		Name: "foo bar",
+		Trackers: [][]string{
+			{"http://a.rain/announce?x=1&y=2"},
+			{"udp://b.rain:2710", "udp://c.rain:2710"},
+			{"http://d.rain/announce"},
+		},
+	}
+	m2, err := New(m.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Name != m.Name {
+		t.Fatalf("invalid name: %q", m2.Name)
+	}
+	if fmt.Sprint(m2.Trackers) != fmt.Sprint(m.Trackers) {
+		t.Fatalf("invalid trackers: %q", m2.Trackers)
+	}
+}
+
+func TestDecodeInfoHash(t *testing.T) {
+	const expected = "f60cc95e3566af84c1ab223fd4ce80fa88e6438a"
+	for _, s := range []string{
+		expected,
+		strings.ToUpper(expected),
+		"6YGMSXRVM2XYJQNLEI75JTUA7KEOMQ4K",
+		"6ygmsxrvm2xyjqnlei75jtua7keomq4k",
+	} {
+		ih, err := DecodeInfoHash(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		if hex.EncodeToString(ih[:]) != expected {
+			t.Fatalf("%s: invalid info hash: %x", s, ih)
+		}
+	}
+	for _, s := range []string{
+		"",
+		expected[:39],
+		expected + "0",
+		"6YGMSXRVM2XYJQNLEI75JTUA7KEOMQ4",
+		"zz0cc95e3566af84c1ab223fd4ce80fa88e6438a",
+		"1YGMSXRVM2XYJQNLEI75JTUA7KEOMQ4K",
+	} {
+		if _, err := DecodeInfoHash(s); err == nil {
+			t.Fatalf("no error for %q", s)
+		}
+	}
+}
@@ -21,6 +21,7 @@ var (
 	errZeroPieceLength  = errors.New("torrent has zero piece length")
 	errZeroPieces       = errors.New("torrent has zero pieces")
 	errPieceLength      = errors.New("piece length must be multiple of 16K")
+	errNotCanonical     = errors.New("info dict is not encoded canonically")
 )
 
 // Info contains information about torrent.
@@ -32,6 +33,7 @@ type Info struct {
 	NumPieces   uint32
 	Bytes       []byte
 	Private     bool
+	Source      string // Private trackers use "source" field to get a different info hash for the same content.
 	Files       []File
 	pieces      []byte
 }
@@ -69,6 +71,7 @@ type infoType struct {
 	Name        string             `bencode:"name"`
 	NameUTF8    string             `bencode:"name.utf-8,omitempty"`
 	Private     bencode.RawMessage `bencode:"private"`
+	Source      bencode.RawMessage `bencode:"source"`
 	Length      int64              `bencode:"length"` // Single File Mode
 	Files       []file             `bencode:"files"`  // Multiple File mode
 }
@@ -117,6 +120,7 @@ func NewInfo(b []byte, utf8 bool, pad bool) (*Info, error) {
 		pieces:      ib.Pieces,
 		Name:        ib.Name,
 		Private:     parsePrivateField(ib.Private),
+		Source:      parseStringField(ib.Source),
 	}
 	multiFile := len(ib.Files) > 0
 	if multiFile {
@@ -217,6 +221,16 @@ func parsePrivateField(s bencode.RawMessage) bool {
 	return !(stringVal == "" || stringVal == "0")
 }
 
+// parseStringField returns the string value of an optional field. Returns empty string if the value is not a string.
+func parseStringField(s bencode.RawMessage) string {
+	if len(s) == 0 {
+		return ""
+	}
+	var stringVal string
+	_ = bencode.DecodeBytes(s, &stringVal)
+	return stringVal
+}
+
 // NewInfoBytes creates a new Info dictionary by reading and hashing the files on the disk.
 func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32, name string, log logger.Logger) ([]byte, error) {
 	var singleFileTorrent bool
@@ -329,6 +343,29 @@ func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32,
 	return bencode.EncodeBytes(b)
 }
 
+// EncodeCanonical decodes the bencoded value in b and encodes it again deterministically.
+// Dictionary keys are sorted, so the output, and the info hash calculated from it, is the same for equal values.
+func EncodeCanonical(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := bencode.DecodeBytes(b, &v); err != nil {
+		return nil, err
+	}
+	return bencode.EncodeBytes(v)
+}
+
+// VerifyEncoding checks that re-encoding the info dict yields the same info hash.
+// Editing an info dict that is not encoded canonically would change its info hash.
+func (i *Info) VerifyEncoding() error {
+	b, err := EncodeCanonical(i.Bytes)
+	if err != nil {
+		return err
+	}
+	if sha1.Sum(b) != i.Hash {
+		return errNotCanonical
+	}
+	return nil
+}
+
 // PieceHash returns the hash of a piece at index.
 func (i *Info) PieceHash(index uint32) []byte {
 	begin := index * sha1.Size
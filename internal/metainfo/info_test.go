@@ -1,6 +1,9 @@
 package metainfo
 
 import (
+	"crypto/sha1"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,3 +50,58 @@ func TestCleanName(t *testing.T) {
 		assert.Equal(t, c.cleaned, cleanNameN(c.name, c.max))
 	}
 }
+
+func TestParsePrivateField(t *testing.T) {
+	cases := []struct {
+		value   string
+		private bool
+	}{
+		{"", false},
+		{"i0e", false},
+		{"i1e", true},
+		{"1:0", false},
+		{"1:1", true},
+		{"0:", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.private, parsePrivateField([]byte(c.value)), c.value)
+	}
+}
+
+func TestEncodeCanonical(t *testing.T) {
+	f, err := os.Open("testdata/ubuntu-14.04.1-server-amd64.iso.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncodeCanonical(tor.Info.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tor.Info.Hash, sha1.Sum(b))
+	assert.Nil(t, tor.Info.VerifyEncoding())
+
+	info, err := NewInfo(b, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tor.Info.Hash, info.Hash)
+
+	// Keys are not sorted.
+	pieces := strings.Repeat("a", 20)
+	b = []byte("d4:name3:foo6:lengthi10e12:piece lengthi16384e6:pieces20:" + pieces + "e")
+	info, err = NewInfo(b, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, errNotCanonical, info.VerifyEncoding())
+	b, err = EncodeCanonical(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "d6:lengthi10e4:name3:foo12:piece lengthi16384e6:pieces20:"+pieces+"e", string(b))
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/zeebo/bencode"
 )
 
@@ -18,6 +19,10 @@ type MetaInfo struct {
 	Info         Info
 	AnnounceList [][]string
 	URLList      []string
+	Comment      string
+	CreatedBy    string
+	// Zero if the torrent file does not contain a creation date.
+	CreationDate time.Time
 }
 
 // New returns a torrent from bencoded stream.
@@ -28,6 +33,9 @@ func New(r io.Reader) (*MetaInfo, error) {
 		Announce     bencode.RawMessage `bencode:"announce"`
 		AnnounceList bencode.RawMessage `bencode:"announce-list"`
 		URLList      bencode.RawMessage `bencode:"url-list"`
+		Comment      bencode.RawMessage `bencode:"comment"`
+		CreatedBy    bencode.RawMessage `bencode:"created by"`
+		CreationDate bencode.RawMessage `bencode:"creation date"`
 	}
 	err := bencode.NewDecoder(r).Decode(&t)
 	if err != nil {
@@ -83,9 +91,33 @@ func New(r io.Reader) (*MetaInfo, error) {
 			}
 		}
 	}
+	// Optional fields are ignored if they have invalid types.
+	ret.Comment = parseStringField(t.Comment)
+	ret.CreatedBy = parseStringField(t.CreatedBy)
+	if len(t.CreationDate) > 0 {
+		var sec int64
+		err = bencode.DecodeBytes(t.CreationDate, &sec)
+		if err == nil && sec > 0 {
+			ret.CreationDate = time.Unix(sec, 0).UTC()
+		}
+	}
 	return &ret, nil
 }
 
+// MagnetURI returns a magnet link containing the info hash, name and trackers of the torrent.
+// Returns error for private torrents because their magnet links should not be shared.
+func (m *MetaInfo) MagnetURI() (string, error) {
+	if m.Info.Private {
+		return "", errors.New("torrent is private")
+	}
+	mag := magnet.Magnet{
+		InfoHash: m.Info.Hash,
+		Name:     m.Info.Name,
+		Trackers: m.AnnounceList,
+	}
+	return mag.String(), nil
+}
+
 func isTrackerSupported(s string) bool {
 	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "udp://")
 }
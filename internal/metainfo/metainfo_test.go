@@ -1,10 +1,14 @@
 package metainfo
 
 import (
+	"crypto/sha1"
 	"encoding/hex"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,4 +30,67 @@ func TestTorrent(t *testing.T) {
 		{"http://torrent.ubuntu.com:6969/announce"},
 		{"http://ipv6.torrent.ubuntu.com:6969/announce"},
 	}, tor.AnnounceList)
+	assert.Equal(t, "Ubuntu CD releases.ubuntu.com", tor.Comment)
+	assert.Equal(t, time.Unix(1406245742, 0).UTC(), tor.CreationDate)
+}
+
+func TestMagnetURI(t *testing.T) {
+	f, err := os.Open("testdata/ubuntu-14.04.1-server-amd64.iso.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := tor.MagnetURI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := magnet.New(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tor.Info.Hash, m.InfoHash)
+	assert.Equal(t, tor.Info.Name, m.Name)
+	assert.Equal(t, tor.AnnounceList, m.Trackers)
+}
+
+func TestMagnetURIPrivate(t *testing.T) {
+	pieces := strings.Repeat("a", 20)
+	info := "d6:lengthi10e4:name3:foo12:piece lengthi16384e6:pieces20:" + pieces + "7:privatei1ee"
+	tor, err := New(strings.NewReader("d4:info" + info + "e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tor.MagnetURI()
+	assert.Error(t, err)
+}
+
+func TestOptionalFields(t *testing.T) {
+	pieces := strings.Repeat("a", 20)
+	info := "d6:lengthi10e4:name3:foo12:piece lengthi16384e6:pieces20:" + pieces + "6:source7:trackere"
+	torrent := "d7:comment5:hello10:created by4:rain13:creation datei1600000000e4:info" + info + "e"
+	tor, err := New(strings.NewReader(torrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "hello", tor.Comment)
+	assert.Equal(t, "rain", tor.CreatedBy)
+	assert.Equal(t, time.Unix(1600000000, 0).UTC(), tor.CreationDate)
+	assert.Equal(t, "tracker", tor.Info.Source)
+	// Info hash must be calculated from the exact bytes, including the source field.
+	assert.Equal(t, sha1.Sum([]byte(info)), tor.Info.Hash)
+
+	// Invalid types for optional fields are ignored.
+	info = "d6:lengthi10e4:name3:foo12:piece lengthi16384e6:pieces20:" + pieces + "6:sourcei1ee"
+	torrent = "d7:commenti1e13:creation date3:foo4:info" + info + "e"
+	tor, err = New(strings.NewReader(torrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", tor.Comment)
+	assert.True(t, tor.CreationDate.IsZero())
+	assert.Equal(t, "", tor.Info.Source)
 }
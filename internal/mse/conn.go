@@ -28,3 +28,8 @@ func (c *Conn) Write(p []byte) (n int, err error) {
 	n, err = c.Stream.Write(p)
 	return
 }
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -1,9 +1,51 @@
 package peer
 
 import (
+	"strconv"
 	"strings"
+
+	"github.com/cenkalti/rain/internal/stringutil"
 )
 
+// Client identifiers in Azureus-style peer IDs.
+var azureusClients = map[string]string{
+	"AG": "Ares",
+	"AZ": "Vuze",
+	"BC": "BitComet",
+	"BI": "BiglyBT",
+	"BT": "BitTorrent",
+	"DE": "Deluge",
+	"FD": "Free Download Manager",
+	"FG": "FlashGet",
+	"FW": "FrostWire",
+	"KT": "KTorrent",
+	"LT": "libtorrent",
+	"lt": "rTorrent",
+	"LW": "LimeWire",
+	"PI": "PicoTorrent",
+	"qB": "qBittorrent",
+	"SD": "Thunder",
+	"TL": "Tribler",
+	"TR": "Transmission",
+	"TX": "Tixati",
+	"UM": "µTorrent Mac",
+	"UT": "µTorrent",
+	"UW": "µTorrent Web",
+	"WW": "WebTorrent",
+	"XL": "Xunlei",
+}
+
+// Client identifiers in Shadow-style peer IDs.
+var shadowClients = map[byte]string{
+	'A': "ABC",
+	'O': "Osprey Permaseed",
+	'Q': "BTQueue",
+	'R': "Tribler",
+	'S': "Shadow",
+	'T': "BitTornado",
+	'U': "UPnP NAT Bit Torrent",
+}
+
 func clientID(id string) string {
 	// ID follows BEP 20 convention
 	if id[7] == '-' {
@@ -20,3 +62,131 @@ func clientID(id string) string {
 
 	return id
 }
+
+// ClientName returns the name and version of the client that generated the peer ID.
+// Azureus-style (e.g. "-qB4550-"), Shadow-style (e.g. "S58B-----") and Mainline-style (e.g. "M4-4-0--") IDs are recognized.
+// For unknown clients, the client part of the ID is returned with non-ascii characters replaced.
+func ClientName(id [20]byte) string {
+	s := string(id[:])
+	if name, ok := rainClientName(s); ok {
+		return name
+	}
+	if name, ok := azureusClientName(s); ok {
+		return name
+	}
+	if name, ok := shadowClientName(s); ok {
+		return name
+	}
+	if name, ok := mainlineClientName(s); ok {
+		return name
+	}
+	return stringutil.Asciify(clientID(s))
+}
+
+func rainClientName(id string) (string, bool) {
+	if !strings.HasPrefix(id, "-RN") {
+		return "", false
+	}
+	i := strings.IndexRune(id[3:], '-')
+	if i <= 0 {
+		return "", false
+	}
+	return "Rain " + stringutil.Asciify(id[3:3+i]), true
+}
+
+func azureusClientName(id string) (string, bool) {
+	if id[0] != '-' || id[7] != '-' {
+		return "", false
+	}
+	name, ok := azureusClients[id[1:3]]
+	if !ok {
+		return "", false
+	}
+	v := id[3:7]
+	// Transmission 1.x-3.x uses "X.YZ" format.
+	if id[1:3] == "TR" && v[0] >= '1' && v[0] <= '3' {
+		return name + " " + v[:1] + "." + v[1:3], true
+	}
+	parts := make([]string, 0, 4)
+	for i := 0; i < len(v); i++ {
+		n, ok := versionDigit(v[i])
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, strconv.Itoa(n))
+	}
+	// Last character is a build number or a release tag for most clients.
+	if last := v[3]; last == '0' || last < '0' || last > '9' {
+		parts = parts[:3]
+	}
+	return name + " " + strings.Join(parts, "."), true
+}
+
+// versionDigit decodes a version character in Azureus-style IDs. Letters are used for numbers greater than 9.
+func versionDigit(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, true
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10, true
+	default:
+		return 0, false
+	}
+}
+
+func shadowClientName(id string) (string, bool) {
+	name, ok := shadowClients[id[0]]
+	if !ok || id[6:9] != "---" {
+		return "", false
+	}
+	parts := make([]string, 0, 5)
+	for i := 1; i < 6 && id[i] != '-'; i++ {
+		n, ok := shadowDigit(id[i])
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, strconv.Itoa(n))
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	return name + " " + strings.Join(parts, "."), true
+}
+
+// shadowDigit decodes a version character in Shadow-style IDs.
+func shadowDigit(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, true
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36, true
+	case c == '.':
+		return 62, true
+	default:
+		return 0, false
+	}
+}
+
+func mainlineClientName(id string) (string, bool) {
+	if id[0] != 'M' {
+		return "", false
+	}
+	end := strings.Index(id, "--")
+	if end < 4 {
+		return "", false
+	}
+	parts := strings.Split(id[1:end], "-")
+	if len(parts) != 3 {
+		return "", false
+	}
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil {
+			return "", false
+		}
+	}
+	return "Mainline " + strings.Join(parts, "."), true
+}
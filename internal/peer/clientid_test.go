@@ -0,0 +1,45 @@
+package peer
+
+import "testing"
+
+func newID(prefix string) [20]byte {
+	var id [20]byte
+	n := copy(id[:], prefix)
+	for i := n; i < len(id); i++ {
+		id[i] = 'x'
+	}
+	return id
+}
+
+func TestClientName(t *testing.T) {
+	cases := []struct {
+		prefix string
+		name   string
+	}{
+		{"-qB4550-", "qBittorrent 4.5.5"},
+		{"-TR2940-", "Transmission 2.94"},
+		{"-TR4060-", "Transmission 4.0.6"},
+		{"-UT355W-", "µTorrent 3.5.5"},
+		{"-DE13F0-", "Deluge 1.3.15"},
+		{"-LT20C0-", "libtorrent 2.0.12"},
+		{"-lt0D60-", "rTorrent 0.13.6"},
+		{"-AZ5761-", "Vuze 5.7.6.1"},
+		{"-RN1.8.5-", "Rain 1.8.5"},
+		{"S58B-----", "Shadow 5.8.11"},
+		{"T03I-----", "BitTornado 0.3.18"},
+		{"M7-4-3--", "Mainline 7.4.3"},
+		{"-ZZ1234-", "-ZZ1234-"},
+	}
+	for _, c := range cases {
+		if name := ClientName(newID(c.prefix)); name != c.name {
+			t.Errorf("%s: got %q, want %q", c.prefix, name, c.name)
+		}
+	}
+}
+
+func TestClientNameUnknown(t *testing.T) {
+	id := [20]byte{0: 0xff, 1: 'a', 19: 'b'}
+	if name := ClientName(id); name != "_a_________________b" {
+		t.Fatalf("unexpected name: %q", name)
+	}
+}
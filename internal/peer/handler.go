@@ -0,0 +1,42 @@
+package peer
+
+import (
+	"github.com/cenkalti/rain/internal/peerconn/peerreader"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// Handler receives the messages read from a Peer as typed callbacks.
+// Methods are called from the goroutine running Peer.Run, so they must not block for long.
+type Handler interface {
+	OnChoke(pe *Peer)
+	OnUnchoke(pe *Peer)
+	OnInterested(pe *Peer)
+	OnNotInterested(pe *Peer)
+	OnHave(pe *Peer, index uint32)
+	OnRequest(pe *Peer, msg peerprotocol.RequestMessage)
+	// OnPiece is called when a block is received. Handler must release msg.Buffer after it is done with the data.
+	OnPiece(pe *Peer, msg peerreader.Piece)
+	// OnMessage is called for all other messages, including extension messages and peerwriter.BlockUploaded.
+	OnMessage(pe *Peer, msg Message)
+}
+
+func (p *Peer) handleMessage(msg Message) {
+	switch m := msg.(type) {
+	case peerprotocol.ChokeMessage:
+		p.handler.OnChoke(p)
+	case peerprotocol.UnchokeMessage:
+		p.handler.OnUnchoke(p)
+	case peerprotocol.InterestedMessage:
+		p.handler.OnInterested(p)
+	case peerprotocol.NotInterestedMessage:
+		p.handler.OnNotInterested(p)
+	case peerprotocol.HaveMessage:
+		p.handler.OnHave(p, m.Index)
+	case peerprotocol.RequestMessage:
+		p.handler.OnRequest(p, m)
+	case peerreader.Piece:
+		p.handler.OnPiece(p, m)
+	default:
+		p.handler.OnMessage(p, msg)
+	}
+}
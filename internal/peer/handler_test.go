@@ -0,0 +1,132 @@
+package peer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/peerconn/peerreader"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+)
+
+type recordingHandler struct {
+	m      sync.Mutex
+	events []string
+	doneC  chan struct{}
+}
+
+func (h *recordingHandler) record(s string) {
+	h.m.Lock()
+	h.events = append(h.events, s)
+	h.m.Unlock()
+	if s == "choke" {
+		close(h.doneC)
+	}
+}
+
+func (h *recordingHandler) OnChoke(pe *Peer)         { h.record("choke") }
+func (h *recordingHandler) OnUnchoke(pe *Peer)       { h.record("unchoke") }
+func (h *recordingHandler) OnInterested(pe *Peer)    { h.record("interested") }
+func (h *recordingHandler) OnNotInterested(pe *Peer) { h.record("not interested") }
+func (h *recordingHandler) OnHave(pe *Peer, index uint32) {
+	h.record(fmt.Sprintf("have %d", index))
+}
+func (h *recordingHandler) OnRequest(pe *Peer, msg peerprotocol.RequestMessage) {
+	h.record(msg.String())
+}
+func (h *recordingHandler) OnPiece(pe *Peer, msg peerreader.Piece) {
+	h.record(fmt.Sprintf("%s %q", msg.String(), msg.Buffer.Data))
+	msg.Buffer.Release()
+}
+func (h *recordingHandler) OnMessage(pe *Peer, msg Message) {
+	h.record(fmt.Sprint(msg))
+}
+
+func writeMessage(t *testing.T, w io.Writer, msg peerprotocol.Message, data []byte) {
+	payload := make([]byte, 16)
+	n, _ := msg.Read(payload)
+	payload = append(payload[:n], data...)
+	buf := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(payload)))
+	buf[4] = byte(msg.MessageID())
+	if _, err := w.Write(append(buf, payload...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() { _, _ = io.Copy(io.Discard, c2) }()
+
+	h := &recordingHandler{doneC: make(chan struct{})}
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, h, nil)
+	go pe.Run(nil, nil, nil, nil)
+	defer pe.Close()
+
+	writeMessage(t, c2, peerprotocol.UnchokeMessage{}, nil)
+	writeMessage(t, c2, peerprotocol.InterestedMessage{}, nil)
+	writeMessage(t, c2, peerprotocol.HaveMessage{Index: 3}, nil)
+	writeMessage(t, c2, peerprotocol.RequestMessage{Index: 1, Begin: 0, Length: 16384}, nil)
+	writeMessage(t, c2, peerprotocol.PieceMessage{Index: 2, Begin: 16}, []byte("data"))
+	writeMessage(t, c2, peerprotocol.PortMessage{Port: 6881}, nil)
+	writeMessage(t, c2, peerprotocol.ChokeMessage{}, nil)
+
+	select {
+	case <-h.doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages are not handled")
+	}
+	expected := []string{
+		"unchoke",
+		"interested",
+		"have 3",
+		"Request(piece=1 begin=0 len=16384)",
+		`Piece(piece=2 begin=16 len=4) "data"`,
+		"Port(port=6881)",
+		"choke",
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if fmt.Sprint(h.events) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected events: %q", h.events)
+	}
+}
+
+func TestHandlerInvalidPortMessage(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() { _, _ = io.Copy(io.Discard, c2) }()
+
+	h := &recordingHandler{doneC: make(chan struct{})}
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, h, nil)
+	go pe.Run(nil, nil, nil, nil)
+	defer pe.Close()
+
+	// Port message with a 3 byte payload must be skipped without closing the connection.
+	if _, err := c2.Write([]byte{0, 0, 0, 4, byte(peerprotocol.Port), 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	writeMessage(t, c2, peerprotocol.PortMessage{Port: 6881}, nil)
+	writeMessage(t, c2, peerprotocol.ChokeMessage{}, nil)
+
+	select {
+	case <-h.doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages are not handled")
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if fmt.Sprint(h.events) != fmt.Sprint([]string{"Port(port=6881)", "choke"}) {
+		t.Fatalf("unexpected events: %q", h.events)
+	}
+}
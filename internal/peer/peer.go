@@ -1,11 +1,13 @@
 package peer
 
 import (
+	"fmt"
 	"math"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/cenkalti/log"
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/fast"
 	"github.com/cenkalti/rain/internal/logger"
@@ -18,8 +20,8 @@ import (
 	"github.com/cenkalti/rain/internal/pexlist"
 	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/sliceset"
+	"github.com/cenkalti/rain/internal/speedlimit"
 	"github.com/cenkalti/rain/internal/stringutil"
-	"github.com/juju/ratelimit"
 	"github.com/rcrowley/go-metrics"
 )
 
@@ -46,10 +48,10 @@ type Peer struct {
 	PeerInterested   bool
 	PeerChoking      bool
 
-	OptimisticUnchoked bool
+	// Number of blocks received from the peer without a matching request.
+	UnsolicitedBlocks int
 
-	// Snubbed means peer is sending pieces too slow.
-	Snubbed bool
+	OptimisticUnchoked bool
 
 	Downloading bool
 
@@ -57,27 +59,44 @@ type Peer struct {
 	uploadSpeed   metrics.Meter
 
 	// Messages received while we don't have info yet are saved here.
-	Messages []interface{}
+	Messages []Message
 
 	ExtensionHandshake *peerprotocol.ExtensionHandshakeMessage
 
 	PEX *pex
 
+	// snubbed means peer is sending pieces too slow.
+	snubbed     bool
 	snubTimeout time.Duration
 	snubTimer   *time.Timer
 
+	handler Handler
+
+	queueSize   int
+	queuePolicy QueuePolicy
+
 	closeC chan struct{}
 	doneC  chan struct{}
 
 	// In some situation the closeC channel is closed twice which create a panic
 	// Prevent this by using a sync object which will ever close the channel once
 	once sync.Once
+	// Makes Close safe to be called multiple times.
+	closeOnce sync.Once
+}
+
+// Message is a message read from a Peer.
+// It is implemented by the message types in peerprotocol package, peerreader.Piece and peerwriter.BlockUploaded,
+// so receivers can type switch on the concrete type. Payloads of built-in extensions are received without a wrapper,
+// messages of extensions registered with peerprotocol.RegisterExtension are received as peerprotocol.ExtensionMessage.
+type Message interface {
+	MessageID() peerprotocol.MessageID
 }
 
-// Message that is read from Peer
-type Message struct {
+// ReceivedMessage is a Message that is read from Peer
+type ReceivedMessage struct {
 	*Peer
-	Message interface{}
+	Message Message
 }
 
 // PieceMessage is a Piece message that is read from Peer
@@ -87,7 +106,9 @@ type PieceMessage struct {
 }
 
 // New wraps the net.Conn and returns a new Peer.
-func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, snubTimeout time.Duration, maxRequestsIn int, br, bw *ratelimit.Bucket) *Peer {
+// If h is not nil, messages read from the peer are passed to h instead of the channels given to Run.
+// If lh is not nil, log messages of the peer are sent to lh instead of the global log handler.
+func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byte, cipher mse.CryptoMethod, pieceReadTimeout, writeTimeout, snubTimeout time.Duration, maxRequestsIn, maxUnknownMessages int, br, bw *speedlimit.Limiter, h Handler, lh log.Handler) *Peer {
 	bf, _ := bitfield.NewBytes(extensions[:], 64)
 	fastEnabled := bf.Test(61)
 	extensionsEnabled := bf.Test(43)
@@ -96,7 +117,7 @@ func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byt
 	t := time.NewTimer(math.MaxInt64)
 	t.Stop()
 	return &Peer{
-		Conn:              peerconn.New(conn, newPeerLogger(source, conn), pieceReadTimeout, maxRequestsIn, fastEnabled, br, bw),
+		Conn:              peerconn.New(conn, newPeerLogger(source, conn, lh), pieceReadTimeout, writeTimeout, maxRequestsIn, maxUnknownMessages, br, bw),
 		Source:            source,
 		ConnectedAt:       time.Now(),
 		ID:                id,
@@ -108,6 +129,7 @@ func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byt
 		EncryptionCipher:  cipher,
 		snubTimeout:       snubTimeout,
 		snubTimer:         t,
+		handler:           h,
 		closeC:            make(chan struct{}),
 		doneC:             make(chan struct{}),
 		downloadSpeed:     metrics.NewMeter(),
@@ -115,23 +137,26 @@ func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byt
 	}
 }
 
-func newPeerLogger(src peersource.Source, conn net.Conn) logger.Logger {
+func newPeerLogger(src peersource.Source, conn net.Conn, h log.Handler) logger.Logger {
 	if src == peersource.Incoming {
-		return logger.New("peer <- " + conn.RemoteAddr().String())
+		return logger.NewWithHandler("peer <- "+conn.RemoteAddr().String(), h)
 	}
-	return logger.New("peer -> " + conn.RemoteAddr().String())
+	return logger.NewWithHandler("peer -> "+conn.RemoteAddr().String(), h)
 }
 
-// Close the peer connection.
+// Close the peer connection and wait for the Run loop to return.
+// It is safe to call Close multiple times.
 func (p *Peer) Close() {
-	p.snubTimer.Stop()
-	if p.PEX != nil {
-		p.PEX.close()
-	}
-	p.SafeClose()
-	p.Conn.Close()
-	p.downloadSpeed.Stop()
-	p.uploadSpeed.Stop()
+	p.closeOnce.Do(func() {
+		p.snubTimer.Stop()
+		if p.PEX != nil {
+			p.PEX.close()
+		}
+		p.SafeClose()
+		p.Conn.Close()
+		p.downloadSpeed.Stop()
+		p.uploadSpeed.Stop()
+	})
 	<-p.doneC
 }
 
@@ -148,13 +173,33 @@ func (p *Peer) Done() chan struct{} {
 }
 
 // Run loop that reads messages from the Peer.
-func (p *Peer) Run(messages chan Message, pieces chan PieceMessage, snubbed, disconnect chan *Peer) {
+// Messages are buffered as configured with SetMessageQueue while messages and pieces channels are not ready.
+func (p *Peer) Run(messages chan ReceivedMessage, pieces chan PieceMessage, snubbed, disconnect chan *Peer) {
 	defer close(p.doneC)
 	go p.Conn.Run()
 
+	var queue []Message
+	defer func() { releaseQueue(queue) }()
 	for {
+		var readC <-chan interface{}
+		if p.canQueue(queue) {
+			readC = p.Conn.Messages()
+		}
+		var messagesC chan ReceivedMessage
+		var piecesC chan PieceMessage
+		var headMessage ReceivedMessage
+		var headPiece PieceMessage
+		if len(queue) > 0 {
+			if m, ok := queue[0].(peerreader.Piece); ok {
+				piecesC = pieces
+				headPiece = PieceMessage{Peer: p, Piece: m}
+			} else {
+				messagesC = messages
+				headMessage = ReceivedMessage{Peer: p, Message: queue[0]}
+			}
+		}
 		select {
-		case pm, ok := <-p.Conn.Messages():
+		case m, ok := <-readC:
 			if !ok {
 				select {
 				case disconnect <- p:
@@ -162,23 +207,23 @@ func (p *Peer) Run(messages chan Message, pieces chan PieceMessage, snubbed, dis
 				}
 				return
 			}
+			pm := m.(Message)
 			if m, ok := pm.(peerreader.Piece); ok {
 				p.downloadSpeed.Mark(int64(len(m.Buffer.Data)))
-				select {
-				case pieces <- PieceMessage{Peer: p, Piece: m}:
-				case <-p.closeC:
-					return
-				}
-			} else {
-				if m, ok := pm.(peerwriter.BlockUploaded); ok {
-					p.uploadSpeed.Mark(int64(m.Length))
-				}
-				select {
-				case messages <- Message{Peer: p, Message: pm}:
-				case <-p.closeC:
-					return
-				}
+			} else if m, ok := pm.(peerwriter.BlockUploaded); ok {
+				p.uploadSpeed.Mark(int64(m.Length))
+			}
+			if p.handler != nil {
+				p.handleMessage(pm)
+				continue
 			}
+			queue = p.enqueue(queue, pm)
+		case messagesC <- headMessage:
+			queue[0] = nil
+			queue = queue[1:]
+		case piecesC <- headPiece:
+			queue[0] = nil
+			queue = queue[1:]
 		case <-p.snubTimer.C:
 			select {
 			case snubbed <- p:
@@ -204,6 +249,17 @@ func (p *Peer) ResetSnubTimer() {
 	p.snubTimer.Reset(p.snubTimeout)
 }
 
+// Snubbed returns true if the Peer has not sent any block for the snub timeout given to New while we are waiting for requested blocks.
+// Pieces of snubbed peers can be downloaded from other peers.
+func (p *Peer) Snubbed() bool {
+	return p.snubbed
+}
+
+// SetSnubbed sets the snubbed status of the Peer.
+func (p *Peer) SetSnubbed(value bool) {
+	p.snubbed = value
+}
+
 // StopSnubTimer is used to stop the timer that is for detecting if the Peer is snub.
 func (p *Peer) StopSnubTimer() {
 	p.snubTimer.Stop()
@@ -231,6 +287,35 @@ func (p *Peer) Unchoke() {
 	p.SendMessage(peerprotocol.UnchokeMessage{})
 }
 
+// SendBitfield announces the pieces we have to the Peer.
+// If the Peer supports Fast extension, "have all" or "have none" is sent instead of a full "bitfield" message when possible.
+// Nothing is sent if we have no pieces and the Peer does not support Fast extension. b may be nil if we don't have info yet.
+func (p *Peer) SendBitfield(b *bitfield.Bitfield) error {
+	if b != nil && p.Bitfield != nil && b.Len() != p.Bitfield.Len() {
+		return fmt.Errorf("invalid bitfield length: %d, expected: %d", b.Len(), p.Bitfield.Len())
+	}
+	switch {
+	case p.FastEnabled && b != nil && b.All():
+		p.SendMessage(peerprotocol.HaveAllMessage{})
+	case p.FastEnabled && (b == nil || b.Count() == 0):
+		p.SendMessage(peerprotocol.HaveNoneMessage{})
+	case b != nil && b.Count() > 0:
+		data := make([]byte, len(b.Bytes()))
+		copy(data, b.Bytes())
+		p.SendMessage(&peerprotocol.BitfieldMessage{Data: data})
+	}
+	return nil
+}
+
+// SendPort advertises the UDP port of our DHT node by sending a "port" protocol message.
+// Does nothing if the remote Peer has not indicated DHT support in handshake.
+func (p *Peer) SendPort(port uint16) {
+	if !p.DHTEnabled {
+		return
+	}
+	p.SendMessage(peerprotocol.PortMessage{Port: port})
+}
+
 // Choking returns true if we are choking the remote Peer.
 func (p *Peer) Choking() bool {
 	return p.ClientChoking
@@ -285,12 +370,17 @@ func (p *Peer) EnabledFast() bool {
 }
 
 // Client returns the name of the client.
-// Returns client string in extension handshake. If extension handshake is not done, returns asciified version of the peer ID.
+// Returns client string in extension handshake. If extension handshake is not done, returns the client name decoded from the peer ID.
 func (p *Peer) Client() string {
 	if p.ExtensionHandshake != nil && p.ExtensionHandshake.V != "" {
 		return stringutil.Printable(p.ExtensionHandshake.V)
 	}
-	return stringutil.Asciify(clientID(string(p.ID[:])))
+	return p.ClientName()
+}
+
+// ClientName returns the name of the client decoded from the peer ID.
+func (p *Peer) ClientName() string {
+	return ClientName(p.ID)
 }
 
 // GenerateAndSendAllowedFastMessages is used to send "allowed fast" protocol messages after handshake.
@@ -301,7 +391,11 @@ func (p *Peer) GenerateAndSendAllowedFastMessages(k int, numPieces uint32, infoH
 	if p.SentAllowedFast.Len() > 0 {
 		return
 	}
-	a := fast.GenerateFastSet(k, numPieces, infoHash, p.Conn.Addr().IP)
+	addr, ok := p.RemoteTCPAddr()
+	if !ok {
+		return
+	}
+	a := fast.GenerateFastSet(k, numPieces, infoHash, addr.IP)
 	for _, index := range a {
 		p.SentAllowedFast.Add(&pieces[index])
 		p.SendMessage(peerprotocol.AllowedFastMessage{HaveMessage: peerprotocol.HaveMessage{Index: index}})
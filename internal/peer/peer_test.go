@@ -0,0 +1,229 @@
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/peerconn/peerreader"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+)
+
+// readBytes reads n bytes that are sent by the Peer to the other end of the pipe.
+func readBytes(t *testing.T, conn net.Conn, n int) []byte {
+	buf := make([]byte, n)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestSendBitfield(t *testing.T) {
+	full := bitfield.New(10)
+	full.SetRange(0, 10)
+	partial := bitfield.New(10)
+	partial.Set(0)
+	partial.Set(9)
+	empty := bitfield.New(10)
+
+	choke := []byte{0, 0, 0, 1, byte(peerprotocol.Choke)}
+	cases := []struct {
+		name     string
+		fast     bool
+		bf       *bitfield.Bitfield
+		expected []byte
+	}{
+		{"full", true, full, []byte{0, 0, 0, 1, byte(peerprotocol.HaveAll)}},
+		{"empty", true, empty, []byte{0, 0, 0, 1, byte(peerprotocol.HaveNone)}},
+		{"no info", true, nil, []byte{0, 0, 0, 1, byte(peerprotocol.HaveNone)}},
+		{"partial", true, partial, []byte{0, 0, 0, 3, byte(peerprotocol.Bitfield), 0x80, 0x40}},
+		{"full without fast", false, full, []byte{0, 0, 0, 3, byte(peerprotocol.Bitfield), 0xff, 0xc0}},
+		{"empty without fast", false, empty, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+			var id [20]byte
+			var ext [8]byte
+			if c.fast {
+				ext[7] |= 0x04
+			}
+			pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, &recordingHandler{doneC: make(chan struct{})}, nil)
+			pe.Bitfield = bitfield.New(10)
+			go pe.Run(nil, nil, nil, nil)
+			defer pe.Close()
+
+			if err := pe.SendBitfield(c.bf); err != nil {
+				t.Fatal(err)
+			}
+			pe.SendMessage(peerprotocol.ChokeMessage{})
+			expected := append(c.expected, choke...)
+			if buf := readBytes(t, c2, len(expected)); string(buf) != string(expected) {
+				t.Fatalf("unexpected bytes: %v", buf)
+			}
+		})
+	}
+}
+
+func TestSendBitfieldInvalidLength(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, nil, nil)
+	pe.Bitfield = bitfield.New(10)
+	if err := pe.SendBitfield(bitfield.New(11)); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestSendPort(t *testing.T) {
+	for _, dht := range []bool{false, true} {
+		c1, c2 := net.Pipe()
+		var id [20]byte
+		var ext [8]byte
+		if dht {
+			ext[7] |= 0x01
+		}
+		pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, &recordingHandler{doneC: make(chan struct{})}, nil)
+		go pe.Run(nil, nil, nil, nil)
+
+		pe.SendPort(6881)
+		pe.SendMessage(peerprotocol.ChokeMessage{})
+
+		expected := []byte{0, 0, 0, 1, byte(peerprotocol.Choke)}
+		if dht {
+			expected = append([]byte{0, 0, 0, 3, byte(peerprotocol.Port), 0x1a, 0xe1}, expected...)
+		}
+		if buf := readBytes(t, c2, len(expected)); string(buf) != string(expected) {
+			t.Fatalf("dht: %v, unexpected bytes: %v", dht, buf)
+		}
+		pe.Close()
+		c2.Close()
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, nil, nil)
+	go pe.Run(make(chan ReceivedMessage), make(chan PieceMessage), make(chan *Peer), make(chan *Peer, 1))
+	pe.Close()
+	pe.Close()
+	select {
+	case <-pe.Done():
+	default:
+		t.Fatal("run loop is not ended")
+	}
+}
+
+// Extensions are registered globally, so they are registered once when tests are run multiple times.
+var registerTestExtension sync.Once
+
+func TestMessageTypeSwitch(t *testing.T) {
+	const extID = 200
+	registerTestExtension.Do(func() {
+		peerprotocol.RegisterExtension("test_echo", extID, func(payload []byte) (interface{}, error) {
+			return string(payload), nil
+		})
+	})
+	if hs := peerprotocol.NewExtensionHandshake(0, "", nil, 0); hs.M["test_echo"] != extID {
+		t.Fatalf("registered extension is not advertised in handshake: %v", hs.M)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() { _, _ = io.Copy(io.Discard, c2) }()
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, nil, nil)
+	pe.SetMessageQueue(4, QueueBlock)
+	messages := make(chan ReceivedMessage)
+	pieces := make(chan PieceMessage)
+	go pe.Run(messages, pieces, make(chan *Peer), make(chan *Peer, 1))
+	defer pe.Close()
+
+	writeMessage(t, c2, peerprotocol.ChokeMessage{}, nil)
+	writeMessage(t, c2, peerprotocol.HaveMessage{Index: 5}, nil)
+	writeMessage(t, c2, peerprotocol.PieceMessage{Index: 1, Begin: 0}, []byte("data"))
+	if _, err := c2.Write([]byte{0, 0, 0, 7, byte(peerprotocol.Extension), extID, 'h', 'e', 'l', 'l', 'o'}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var ids []peerprotocol.MessageID
+	for len(got) < 4 {
+		var msg Message
+		select {
+		case m := <-messages:
+			msg = m.Message
+		case m := <-pieces:
+			msg = m.Piece
+		case <-time.After(5 * time.Second):
+			t.Fatalf("messages are not received, got: %q", got)
+		}
+		switch m := msg.(type) {
+		case peerprotocol.ChokeMessage:
+			got = append(got, "choke")
+		case peerprotocol.HaveMessage:
+			got = append(got, fmt.Sprintf("have %d", m.Index))
+		case peerreader.Piece:
+			got = append(got, fmt.Sprintf("piece %d %q", m.Index, m.Buffer.Data))
+			m.Buffer.Release()
+		case peerprotocol.ExtensionMessage:
+			got = append(got, fmt.Sprintf("extension %d %v", m.ExtendedMessageID, m.Payload))
+		default:
+			t.Fatalf("unexpected message: %#v", msg)
+		}
+		ids = append(ids, msg.MessageID())
+	}
+	expected := []string{"choke", "have 5", `piece 1 "data"`, "extension 200 hello"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected messages: %q", got)
+	}
+	expectedIDs := []peerprotocol.MessageID{peerprotocol.Choke, peerprotocol.Have, peerprotocol.Piece, peerprotocol.Extension}
+	if fmt.Sprint(ids) != fmt.Sprint(expectedIDs) {
+		t.Fatalf("unexpected message ids: %v", ids)
+	}
+}
+
+func TestBitfieldIsReceivedAsSingleMessage(t *testing.T) {
+	_, conn, messages := newQueueTestPeer(t, 2, QueueBlock)
+	bf := bitfield.New(20)
+	bf.Set(1)
+	bf.Set(7)
+	bf.Set(19)
+	writeMessage(t, conn, &peerprotocol.BitfieldMessage{Data: bf.Bytes()}, nil)
+	writeMessage(t, conn, peerprotocol.ChokeMessage{}, nil)
+
+	var bitfields, haves int
+	for {
+		msg := receiveMessage(t, messages)
+		if _, ok := msg.(peerprotocol.ChokeMessage); ok {
+			break
+		}
+		switch m := msg.(type) {
+		case peerprotocol.BitfieldMessage:
+			bitfields++
+			if !bytes.Equal(m.Data, bf.Bytes()) {
+				t.Fatalf("invalid bitfield data: %x", m.Data)
+			}
+		case peerprotocol.HaveMessage:
+			haves++
+		}
+	}
+	if bitfields != 1 || haves != 0 {
+		t.Fatalf("received %d bitfield and %d have messages, expected a single bitfield", bitfields, haves)
+	}
+}
@@ -0,0 +1,20 @@
+package peer
+
+import (
+	"crypto/rand"
+)
+
+// GenerateID returns a new peer id that starts with clientPrefix and followed by random bytes.
+//
+// Azureus-style prefix (BEP 20) is 8 bytes long: a dash, two characters for client identifier,
+// four characters for version number and another dash, e.g. "-RN0100-".
+// Remaining 12 bytes are read from crypto/rand. Prefix is truncated if it is longer than 20 bytes.
+func GenerateID(clientPrefix string) [20]byte {
+	var id [20]byte
+	n := copy(id[:], clientPrefix)
+	_, err := rand.Read(id[n:])
+	if err != nil {
+		panic("cannot read random bytes for peer id: " + err.Error())
+	}
+	return id
+}
@@ -0,0 +1,29 @@
+package peer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateID(t *testing.T) {
+	const prefix = "-RN0100-"
+	id1 := GenerateID(prefix)
+	id2 := GenerateID(prefix)
+	if string(id1[:8]) != prefix || string(id2[:8]) != prefix {
+		t.Fatalf("prefix is not preserved: %q %q", id1[:8], id2[:8])
+	}
+	if bytes.Equal(id1[8:], id2[8:]) {
+		t.Fatal("random parts are same")
+	}
+	if clientID(string(id1[:])) != prefix {
+		t.Fatalf("unexpected client id: %q", clientID(string(id1[:])))
+	}
+}
+
+func TestGenerateIDLongPrefix(t *testing.T) {
+	prefix := "-RN0100-0123456789abcdef"
+	id := GenerateID(prefix)
+	if string(id[:]) != prefix[:20] {
+		t.Fatalf("unexpected id: %q", id)
+	}
+}
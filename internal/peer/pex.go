@@ -26,8 +26,9 @@ type pex struct {
 func newPEX(conn *peerconn.Conn, extID uint8, initialPeers map[*Peer]struct{}, recentlySeen *pexlist.RecentlySeen) *pex {
 	pl := pexlist.NewWithRecentlySeen(recentlySeen.Peers())
 	for pe := range initialPeers {
-		if pe.Addr().String() != conn.Addr().String() {
-			pl.Add(pe.Addr())
+		addr, ok := pe.RemoteTCPAddr()
+		if ok && addr.String() != conn.String() {
+			pl.Add(addr)
 		}
 	}
 	return &pex{
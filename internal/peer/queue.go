@@ -0,0 +1,52 @@
+package peer
+
+import (
+	"github.com/cenkalti/rain/internal/peerconn/peerreader"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// QueuePolicy determines what Peer.Run does when the message queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock stops reading from the connection until the consumer receives a message from the queue.
+	QueueBlock QueuePolicy = iota
+	// QueueDropHave keeps reading from the connection while the queue is full and discards "have" messages.
+	// Reading is stopped as in QueueBlock when a message of other type is received.
+	// Dropped messages are not reflected in the piece availability of the Peer.
+	QueueDropHave
+)
+
+// SetMessageQueue sets the number of messages that can be buffered while the channels given to Run are not ready to receive.
+// Size 0, which is the default, means that reading pauses until each message is received by the consumer.
+// It must be called before Run.
+func (p *Peer) SetMessageQueue(size int, policy QueuePolicy) {
+	p.queueSize = size
+	p.queuePolicy = policy
+}
+
+// canQueue returns true if Run may read the next message from the connection.
+func (p *Peer) canQueue(queue []Message) bool {
+	if len(queue) == 0 || len(queue) < p.queueSize {
+		return true
+	}
+	return p.queuePolicy == QueueDropHave && len(queue) == p.queueSize && p.queueSize > 0
+}
+
+// enqueue appends msg to the queue unless the policy allows it to be dropped.
+func (p *Peer) enqueue(queue []Message, msg Message) []Message {
+	if len(queue) >= p.queueSize && p.queuePolicy == QueueDropHave {
+		if _, ok := msg.(peerprotocol.HaveMessage); ok {
+			return queue
+		}
+	}
+	return append(queue, msg)
+}
+
+func releaseQueue(queue []Message) {
+	for _, msg := range queue {
+		if m, ok := msg.(peerreader.Piece); ok {
+			m.Buffer.Release()
+		}
+	}
+}
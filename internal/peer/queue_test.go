@@ -0,0 +1,107 @@
+package peer
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+)
+
+func newQueueTestPeer(t *testing.T, size int, policy QueuePolicy) (*Peer, net.Conn, chan ReceivedMessage) {
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() { c2.Close() })
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, nil, nil)
+	pe.SetMessageQueue(size, policy)
+	messages := make(chan ReceivedMessage)
+	go pe.Run(messages, make(chan PieceMessage), make(chan *Peer), make(chan *Peer))
+	t.Cleanup(pe.Close)
+	return pe, c2, messages
+}
+
+func receiveMessage(t *testing.T, messages chan ReceivedMessage) Message {
+	select {
+	case msg := <-messages:
+		return msg.Message
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not received")
+		return nil
+	}
+}
+
+func TestMessageQueueBlock(t *testing.T) {
+	_, conn, messages := newQueueTestPeer(t, 5, QueueBlock)
+
+	// Messages must be read into the queue while nobody is receiving from the channel.
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 5; i++ {
+		writeMessage(t, conn, peerprotocol.HaveMessage{Index: uint32(i)}, nil)
+	}
+	// Writes must not fail when the queue is full. The peer applies backpressure until the consumer catches up.
+	_ = conn.SetWriteDeadline(time.Time{})
+	go func() {
+		for i := 5; i < 20; i++ {
+			writeMessage(t, conn, peerprotocol.HaveMessage{Index: uint32(i)}, nil)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if i%5 == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		msg := receiveMessage(t, messages)
+		if msg != (peerprotocol.HaveMessage{Index: uint32(i)}) {
+			t.Fatalf("unexpected message: %v", msg)
+		}
+	}
+}
+
+func TestMessageQueueDropHave(t *testing.T) {
+	_, conn, messages := newQueueTestPeer(t, 2, QueueDropHave)
+
+	// Peer must keep reading while the consumer is stuck.
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 100; i++ {
+		writeMessage(t, conn, peerprotocol.HaveMessage{Index: uint32(i)}, nil)
+	}
+	writeMessage(t, conn, peerprotocol.UnchokeMessage{}, nil)
+
+	for i := 0; i < 2; i++ {
+		if msg := receiveMessage(t, messages); msg != (peerprotocol.HaveMessage{Index: uint32(i)}) {
+			t.Fatalf("unexpected message: %v", msg)
+		}
+	}
+	// A few messages that are read before the queue is drained may still be delivered.
+	for i := 0; ; i++ {
+		msg := receiveMessage(t, messages)
+		if msg == (peerprotocol.UnchokeMessage{}) {
+			break
+		}
+		if _, ok := msg.(peerprotocol.HaveMessage); !ok || i > 2 {
+			t.Fatalf("unexpected message: %v", msg)
+		}
+	}
+}
+
+func TestMessageQueueDisconnect(t *testing.T) {
+	c1, c2 := net.Pipe()
+	var id [20]byte
+	var ext [8]byte
+	pe := New(c1, peersource.Manual, id, ext, 0, 10*time.Second, 0, 10*time.Second, 10, 0, nil, nil, nil, nil)
+	pe.SetMessageQueue(10, QueueBlock)
+	disconnect := make(chan *Peer)
+	go pe.Run(make(chan ReceivedMessage), make(chan PieceMessage), make(chan *Peer), disconnect)
+	defer pe.Close()
+
+	writeMessage(t, c2, peerprotocol.HaveMessage{Index: 1}, nil)
+	c2.Close()
+	select {
+	case <-disconnect:
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer is not disconnected while messages are queued")
+	}
+	_, _ = io.Copy(io.Discard, c2)
+}
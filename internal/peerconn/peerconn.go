@@ -3,13 +3,14 @@ package peerconn
 import (
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerconn/peerreader"
 	"github.com/cenkalti/rain/internal/peerconn/peerwriter"
 	"github.com/cenkalti/rain/internal/peerprotocol"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 // Conn is a peer connection that provides a channel for receiving messages and methods for sending messages.
@@ -21,14 +22,15 @@ type Conn struct {
 	log      logger.Logger
 	closeC   chan struct{}
 	doneC    chan struct{}
+	closed   sync.Once
 }
 
 // New returns a new PeerConn by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, maxRequestsIn int, fastEnabled bool, br, bw *ratelimit.Bucket) *Conn {
+func New(conn net.Conn, l logger.Logger, pieceTimeout, writeTimeout time.Duration, maxRequestsIn, maxUnknownMessages int, br, bw *speedlimit.Limiter) *Conn {
 	return &Conn{
 		conn:     conn,
-		reader:   peerreader.New(conn, l, pieceTimeout, br),
-		writer:   peerwriter.New(conn, l, maxRequestsIn, fastEnabled, bw),
+		reader:   peerreader.New(conn, l, pieceTimeout, maxUnknownMessages, br),
+		writer:   peerwriter.New(conn, l, maxRequestsIn, writeTimeout, bw),
 		messages: make(chan interface{}),
 		log:      l,
 		closeC:   make(chan struct{}),
@@ -37,13 +39,39 @@ func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, maxRequests
 }
 
 // Addr returns the net.TCPAddr of the peer.
+// It panics if the connection is not made over TCP. Use RemoteTCPAddr if not sure.
 func (p *Conn) Addr() *net.TCPAddr {
 	return p.conn.RemoteAddr().(*net.TCPAddr)
 }
 
+// RemoteAddr returns the remote network address of the peer.
+func (p *Conn) RemoteAddr() net.Addr {
+	return p.conn.RemoteAddr()
+}
+
+// RemoteTCPAddr returns the remote address of the peer if the connection is made over TCP.
+func (p *Conn) RemoteTCPAddr() (*net.TCPAddr, bool) {
+	addr, ok := p.conn.RemoteAddr().(*net.TCPAddr)
+	return addr, ok
+}
+
 // IP returns the string representation of IP address.
+// For connections that are not made over TCP, the host part of the remote address is returned.
 func (p *Conn) IP() string {
-	return p.conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	return Host(p.conn.RemoteAddr())
+}
+
+// Host returns the IP address of addr as string if it is a TCP address.
+// Otherwise, it returns the host part of the address string, or the whole string if it does not contain a port.
+func Host(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
 }
 
 // String returns the remote address as string.
@@ -51,12 +79,48 @@ func (p *Conn) String() string {
 	return p.conn.RemoteAddr().String()
 }
 
+// SetNoDelay controls whether the operating system should delay packet transmission in hopes of sending fewer packets (Nagle's algorithm).
+// It has effect only if the underlying connection is a TCP connection. Connections are created with no delay set.
+func (p *Conn) SetNoDelay(noDelay bool) error {
+	c, ok := tcpConn(p.conn)
+	if !ok {
+		return nil
+	}
+	return c.SetNoDelay(noDelay)
+}
+
+// tcpConn unwraps the connection returned from btconn package.
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
 // Close stops receiving and sending messages and closes underlying net.Conn.
+// It waits until Run returns and is safe to be called multiple times.
 func (p *Conn) Close() {
-	close(p.closeC)
+	p.closed.Do(func() { close(p.closeC) })
 	<-p.doneC
 }
 
+// Err returns the protocol violation of the peer that caused the connection to be closed. See peerreader.PeerReader.Err.
+// Must be called after the channel returned from Messages is closed.
+func (p *Conn) Err() error {
+	return p.reader.Err()
+}
+
+// DiscardedBytes returns the total number of bytes received in messages of unknown type that are discarded.
+func (p *Conn) DiscardedBytes() int64 {
+	return p.reader.DiscardedBytes()
+}
+
 // Logger for the peer that logs messages prefixed with peer address.
 func (p *Conn) Logger() logger.Logger {
 	return p.log
@@ -73,11 +137,17 @@ func (p *Conn) SendMessage(msg peerprotocol.Message) {
 	p.writer.SendMessage(msg)
 }
 
+// SendHaves queues "have" messages for pieces at indexes. Messages are written to the connection at once. Does not block.
+func (p *Conn) SendHaves(indexes []uint32) {
+	p.writer.SendMessage(peerwriter.Haves(indexes))
+}
+
 // SendPiece queues a piece message for sending. Does not block.
 // Piece data is read just before the message is sent.
-// If queued messages greater than `maxRequestsIn` specified in constructor, the last message is dropped.
-func (p *Conn) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt) {
-	p.writer.SendPiece(msg, pi)
+// Duplicate requests are ignored. If queued messages greater than `maxRequestsIn` specified in constructor, the peer is disconnected.
+// Queued pieces with lower availability in the swarm are sent first.
+func (p *Conn) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt, availability int) {
+	p.writer.SendPiece(msg, pi, availability)
 }
 
 // CancelRequest removes previously queued piece message matching msg.
@@ -0,0 +1,77 @@
+package peerconn
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/mse"
+)
+
+func noDelay(t *testing.T, c *net.TCPConn) bool {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		value, serr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	return value != 0
+}
+
+func TestSetNoDelay(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			defer c.Close()
+			var b [1]byte
+			_, _ = c.Read(b[:])
+		}
+	}()
+	raw, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	tcp := raw.(*net.TCPConn)
+
+	// Wrapped connections must be unwrapped to reach the socket.
+	conn := New(mse.WrapConn(raw), logger.New("test"), time.Second, 0, 10, 0, nil, nil)
+	if err = conn.SetNoDelay(false); err != nil {
+		t.Fatal(err)
+	}
+	if noDelay(t, tcp) {
+		t.Fatal("no delay is set")
+	}
+	if err = conn.SetNoDelay(true); err != nil {
+		t.Fatal(err)
+	}
+	if !noDelay(t, tcp) {
+		t.Fatal("no delay is not set")
+	}
+}
+
+func TestSetNoDelayNotTCP(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := New(c1, logger.New("test"), time.Second, 0, 10, 0, nil, nil)
+	if err := conn.SetNoDelay(true); err != nil {
+		t.Fatal(err)
+	}
+}
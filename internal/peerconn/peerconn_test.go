@@ -0,0 +1,97 @@
+package peerconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// waitClosed reads the messages of conn until the channel is closed and checks that the underlying connection is closed.
+func waitClosed(t *testing.T, conn *Conn, remote net.Conn) {
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-conn.Messages():
+			if !ok {
+				_ = remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if _, err := io.Copy(io.Discard, remote); err != nil {
+					t.Fatalf("connection is not closed: %s", err)
+				}
+				return
+			}
+		case <-timer.C:
+			t.Fatal("run loop is not ended")
+		}
+	}
+}
+
+func TestConnClosedOnReadError(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	conn := New(c1, logger.New("test"), time.Second, 0, 10, 0, nil, nil)
+	go conn.Run()
+
+	// Request with a length larger than allowed is a protocol violation.
+	msg := make([]byte, 17)
+	binary.BigEndian.PutUint32(msg[0:4], 13)
+	msg[4] = byte(peerprotocol.Request)
+	binary.BigEndian.PutUint32(msg[13:17], 1<<20)
+	go func() { _, _ = c2.Write(msg) }()
+
+	waitClosed(t, conn, c2)
+	if conn.Err() == nil {
+		t.Fatal("protocol error is not set")
+	}
+}
+
+func TestConnClosedOnWriteError(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	conn := New(c1, logger.New("test"), time.Second, 0, 1, 0, nil, nil)
+	go conn.Run()
+
+	// Nothing is read from c2 until the queue overflows and the peer is disconnected.
+	data := bytes.NewReader(make([]byte, 10))
+	for i := uint32(0); i < 3; i++ {
+		conn.SendPiece(peerprotocol.RequestMessage{Begin: i, Length: 1}, data, 0)
+	}
+	waitClosed(t, conn, c2)
+}
+
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.addr }
+
+func TestRemoteAddr(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	tcpAddr := &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5678}
+	conn := New(addrConn{Conn: c1, addr: tcpAddr}, logger.New("test"), time.Second, 0, 10, 0, nil, nil)
+	if conn.RemoteAddr() != tcpAddr {
+		t.Fatalf("unexpected address: %s", conn.RemoteAddr())
+	}
+	addr, ok := conn.RemoteTCPAddr()
+	if !ok || addr != tcpAddr {
+		t.Fatalf("unexpected tcp address: %s", addr)
+	}
+	if conn.String() != "1.2.3.4:5678" {
+		t.Fatalf("unexpected string: %s", conn.String())
+	}
+
+	conn = New(c1, logger.New("test"), time.Second, 0, 10, 0, nil, nil)
+	if _, ok = conn.RemoteTCPAddr(); ok {
+		t.Fatal("pipe address is returned as tcp address")
+	}
+}
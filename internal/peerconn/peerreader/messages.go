@@ -1,6 +1,8 @@
 package peerreader
 
 import (
+	"fmt"
+
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 )
@@ -11,3 +13,7 @@ type Piece struct {
 	peerprotocol.PieceMessage
 	Buffer bufferpool.Buffer
 }
+
+func (p Piece) String() string {
+	return fmt.Sprintf("Piece(piece=%d begin=%d len=%d)", p.Index, p.Begin, len(p.Buffer.Data))
+}
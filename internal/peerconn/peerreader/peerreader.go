@@ -7,13 +7,15 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/piece"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 const (
@@ -25,7 +27,10 @@ const (
 	readBufferSize = 4 + 1 + 12
 )
 
-var blockPool = bufferpool.New(piece.BlockSize)
+var (
+	blockPool      = bufferpool.New(piece.BlockSize)
+	largeBlockPool = bufferpool.New(piece.MaxBlockSize)
+)
 
 // PeerReader is used for reading and parsing messages from a net.Conn.
 type PeerReader struct {
@@ -33,23 +38,32 @@ type PeerReader struct {
 	r            io.Reader
 	log          logger.Logger
 	pieceTimeout time.Duration
-	bucket       *ratelimit.Bucket
-	messages     chan interface{}
-	stopC        chan struct{}
-	doneC        chan struct{}
+	// Peer is disconnected after this many consecutive messages of unknown type. Zero means no limit.
+	maxUnknownMessages int
+	bucket             *speedlimit.Limiter
+	messages           chan interface{}
+	err                error
+	stopC              chan struct{}
+	stopped            sync.Once
+	doneC              chan struct{}
+
+	// Total number of bytes read and discarded for messages of unknown type. Accessed atomically.
+	discardedBytes int64
 }
 
 // New returns a new PeerReader by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, b *ratelimit.Bucket) *PeerReader {
+// Peer is disconnected after maxUnknownMessages consecutive messages of unknown type. Zero means no limit.
+func New(conn net.Conn, l logger.Logger, pieceTimeout time.Duration, maxUnknownMessages int, b *speedlimit.Limiter) *PeerReader {
 	return &PeerReader{
-		conn:         conn,
-		r:            bufio.NewReaderSize(conn, readBufferSize),
-		log:          l,
-		pieceTimeout: pieceTimeout,
-		bucket:       b,
-		messages:     make(chan interface{}),
-		stopC:        make(chan struct{}),
-		doneC:        make(chan struct{}),
+		conn:               conn,
+		r:                  bufio.NewReaderSize(conn, readBufferSize),
+		log:                l,
+		pieceTimeout:       pieceTimeout,
+		maxUnknownMessages: maxUnknownMessages,
+		bucket:             b,
+		messages:           make(chan interface{}),
+		stopC:              make(chan struct{}),
+		doneC:              make(chan struct{}),
 	}
 }
 
@@ -58,9 +72,9 @@ func (p *PeerReader) Messages() <-chan interface{} {
 	return p.messages
 }
 
-// Stop the read loop.
+// Stop the read loop. It is safe to call Stop multiple times.
 func (p *PeerReader) Stop() {
-	close(p.stopC)
+	p.stopped.Do(func() { close(p.stopC) })
 }
 
 // Done returns a channel that is closed when the read loop exists.
@@ -68,12 +82,30 @@ func (p *PeerReader) Done() chan struct{} {
 	return p.doneC
 }
 
+// Err returns the reason of the read loop exit if the peer has sent a message that violates the protocol.
+// Returns nil if the loop is ended for other reasons, e.g. the connection is closed. Must be called after Done channel is closed.
+func (p *PeerReader) Err() error {
+	return p.err
+}
+
+// DiscardedBytes returns the total number of bytes discarded for messages of unknown type. Safe to call concurrently with Run.
+func (p *PeerReader) DiscardedBytes() int64 {
+	return atomic.LoadInt64(&p.discardedBytes)
+}
+
 // Run the read loop.
 func (p *PeerReader) Run() {
 	defer close(p.doneC)
 
 	var err error
 	defer func() {
+		switch err.(type) {
+		case *blockSizeError, *invalidMessageError:
+			p.err = err
+		}
+		if err == errTooManyUnknownMessages {
+			p.err = err
+		}
 		if err == nil {
 			return
 		} else if err == io.EOF { // peer closed the connection
@@ -88,7 +120,7 @@ func (p *PeerReader) Run() {
 		select {
 		case <-p.stopC: // don't log error if peer is stopped
 		default:
-			if _, ok := err.(*blockSizeError); ok {
+			if _, ok := err.(*blockSizeError); ok || err == errTooManyUnknownMessages {
 				p.log.Debug(err)
 			} else {
 				p.log.Error(err)
@@ -96,6 +128,10 @@ func (p *PeerReader) Run() {
 		}
 	}()
 
+	// Number of consecutive messages of unknown type.
+	var unknownMessages int
+	// Only the first message of unknown type is logged to prevent flooding the log.
+	var unknownLogged bool
 	for {
 		err = p.conn.SetReadDeadline(time.Now().Add(readTimeout))
 		if err != nil {
@@ -128,16 +164,12 @@ func (p *PeerReader) Run() {
 
 		switch id {
 		case peerprotocol.Choke:
-			p.log.Debug("Received Choke")
 			msg = peerprotocol.ChokeMessage{}
 		case peerprotocol.Unchoke:
-			p.log.Debug("Received Unchoke")
 			msg = peerprotocol.UnchokeMessage{}
 		case peerprotocol.Interested:
-			p.log.Debug("Received Interested")
 			msg = peerprotocol.InterestedMessage{}
 		case peerprotocol.NotInterested:
-			p.log.Debug("Received NotInterested")
 			msg = peerprotocol.NotInterestedMessage{}
 		case peerprotocol.Have:
 			var hm peerprotocol.HaveMessage
@@ -147,6 +179,8 @@ func (p *PeerReader) Run() {
 			}
 			msg = hm
 		case peerprotocol.Bitfield:
+			// The bitfield is delivered as a single message instead of a "have" message per piece,
+			// so the receiver updates the availability of all pieces at once.
 			var bm peerprotocol.BitfieldMessage
 			bm.Data = make([]byte, length)
 			_, err = io.ReadFull(p.r, bm.Data)
@@ -160,8 +194,6 @@ func (p *PeerReader) Run() {
 			if err != nil {
 				return
 			}
-			// p.log.Debugf("Received Request: %+v", rm)
-
 			if rm.Length > MaxBlockSize {
 				err = &blockSizeError{
 					messageID:  id,
@@ -177,7 +209,6 @@ func (p *PeerReader) Run() {
 			if err != nil {
 				return
 			}
-			p.log.Debugf("Received Reject: %+v", rm)
 			msg = rm
 		case peerprotocol.Cancel:
 			var cm peerprotocol.CancelMessage
@@ -193,11 +224,11 @@ func (p *PeerReader) Run() {
 				return
 			}
 			length -= 8
-			if length > piece.BlockSize {
+			if length > piece.MaxBlockSize {
 				err = &blockSizeError{
 					messageID:  id,
 					got:        length,
-					allowedMax: piece.BlockSize,
+					allowedMax: piece.MaxBlockSize,
 				}
 				return
 			}
@@ -219,6 +250,14 @@ func (p *PeerReader) Run() {
 			}
 			msg = am
 		case peerprotocol.Port:
+			if length != 2 {
+				p.log.Debugln("invalid port message length:", length)
+				_, err = io.CopyN(io.Discard, p.r, int64(length))
+				if err != nil {
+					return
+				}
+				continue
+			}
 			var pm peerprotocol.PortMessage
 			err = binary.Read(p.r, binary.BigEndian, &pm)
 			if err != nil {
@@ -234,13 +273,28 @@ func (p *PeerReader) Run() {
 			var em peerprotocol.ExtensionMessage
 			err = em.UnmarshalBinary(buf)
 			if err != nil {
+				err = &invalidMessageError{messageID: id, err: err}
 				return
 			}
-			msg = em.Payload
+			if peerprotocol.IsRegisteredExtension(em.ExtendedMessageID) {
+				// Receivers need the id to find out the extension of the payload.
+				msg = em
+			} else {
+				msg = em.Payload
+			}
 		default:
-			p.log.Debugf("unhandled message type: %s", id)
-			p.log.Debugln("Discarding", length, "bytes...")
-			_, err = io.CopyN(io.Discard, p.r, int64(length))
+			unknownMessages++
+			if p.maxUnknownMessages > 0 && unknownMessages > p.maxUnknownMessages {
+				err = errTooManyUnknownMessages
+				return
+			}
+			if !unknownLogged {
+				p.log.Debugf("unhandled message type: %s, discarding %d bytes (further unknown messages are not logged)", id, length)
+				unknownLogged = true
+			}
+			var n int64
+			n, err = io.CopyN(io.Discard, p.r, int64(length))
+			atomic.AddInt64(&p.discardedBytes, n)
 			if err != nil {
 				return
 			}
@@ -249,6 +303,13 @@ func (p *PeerReader) Run() {
 		if msg == nil {
 			panic("msg unset")
 		}
+		unknownMessages = 0
+		switch id {
+		case peerprotocol.Have, peerprotocol.Request, peerprotocol.Cancel, peerprotocol.Piece, peerprotocol.Extension:
+			// Logging these would be too noisy.
+		default:
+			p.log.Debugln("Received", msg)
+		}
 		select {
 		case p.messages <- msg:
 		case <-p.stopC:
@@ -258,7 +319,11 @@ func (p *PeerReader) Run() {
 }
 
 func (p *PeerReader) readPiece(length uint32) (buf bufferpool.Buffer, err error) {
-	buf = blockPool.Get(int(length))
+	if length > piece.BlockSize {
+		buf = largeBlockPool.Get(int(length))
+	} else {
+		buf = blockPool.Get(int(length))
+	}
 	defer func() {
 		if err != nil {
 			buf.Release()
@@ -301,7 +366,10 @@ func (p *PeerReader) readPiece(length uint32) (buf bufferpool.Buffer, err error)
 	}
 }
 
-var errStoppedWhileWaitingBucket = errors.New("peer reader stopped while waiting for bucket")
+var (
+	errStoppedWhileWaitingBucket = errors.New("peer reader stopped while waiting for bucket")
+	errTooManyUnknownMessages    = errors.New("received too many messages of unknown type")
+)
 
 type blockSizeError struct {
 	messageID  peerprotocol.MessageID
@@ -312,3 +380,16 @@ type blockSizeError struct {
 func (e *blockSizeError) Error() string {
 	return fmt.Sprintf("received %s message with block size larger than allowed (%d > %d)", e.messageID, e.got, e.allowedMax)
 }
+
+type invalidMessageError struct {
+	messageID peerprotocol.MessageID
+	err       error
+}
+
+func (e *invalidMessageError) Error() string {
+	return fmt.Sprintf("received invalid %s message: %s", e.messageID, e.err)
+}
+
+func (e *invalidMessageError) Unwrap() error {
+	return e.err
+}
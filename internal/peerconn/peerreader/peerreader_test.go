@@ -0,0 +1,120 @@
+package peerreader
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/log"
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+func TestTooManyUnknownMessages(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	r := New(c1, logger.New("test"), time.Second, 3, nil)
+	go r.Run()
+	defer r.Stop()
+
+	unknown := []byte{0, 0, 0, 2, 99, 0}
+	choke := []byte{0, 0, 0, 1, byte(peerprotocol.Choke)}
+	write := func(msgs ...[]byte) {
+		go func() {
+			for _, b := range msgs {
+				if _, err := c2.Write(b); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	expectMessage := func() {
+		select {
+		case msg := <-r.Messages():
+			if _, ok := msg.(peerprotocol.ChokeMessage); !ok {
+				t.Fatalf("unexpected message: %v", msg)
+			}
+		case <-r.Done():
+			t.Fatal("peer is disconnected before limit")
+		case <-time.After(5 * time.Second):
+			t.Fatal("message is not read")
+		}
+	}
+
+	// Known messages reset the counter.
+	write(unknown, unknown, unknown, choke)
+	expectMessage()
+	write(unknown, unknown, unknown, choke)
+	expectMessage()
+
+	write(unknown, unknown, unknown, unknown, choke)
+	select {
+	case <-r.Done():
+	case <-r.Messages():
+		t.Fatal("message is read after limit")
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer is not disconnected")
+	}
+	if r.Err() != errTooManyUnknownMessages {
+		t.Fatalf("unexpected error: %v", r.Err())
+	}
+}
+
+type recordingLogHandler struct {
+	m        sync.Mutex
+	messages []string
+}
+
+func (h *recordingLogHandler) SetFormatter(log.Formatter) {}
+func (h *recordingLogHandler) SetLevel(log.Level)         {}
+func (h *recordingLogHandler) Close() error               { return nil }
+func (h *recordingLogHandler) Handle(rec *log.Record) {
+	h.m.Lock()
+	h.messages = append(h.messages, rec.Message)
+	h.m.Unlock()
+}
+
+func TestUnknownMessageLogSampling(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	h := &recordingLogHandler{}
+	r := New(c1, logger.NewWithHandler("test", h), time.Second, 0, nil)
+	go r.Run()
+	defer r.Stop()
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			if _, err := c2.Write([]byte{0, 0, 0, 4, 99, 1, 2, 3}); err != nil {
+				return
+			}
+		}
+		_, _ = c2.Write([]byte{0, 0, 0, 1, byte(peerprotocol.Choke)})
+	}()
+	select {
+	case msg := <-r.Messages():
+		if _, ok := msg.(peerprotocol.ChokeMessage); !ok {
+			t.Fatalf("unexpected message: %v", msg)
+		}
+	case <-r.Done():
+		t.Fatal("peer is disconnected")
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not read")
+	}
+
+	if n := r.DiscardedBytes(); n != 30 {
+		t.Errorf("unexpected discarded bytes: %d", n)
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	var logged int
+	for _, msg := range h.messages {
+		if strings.Contains(msg, "unhandled message type") {
+			logged++
+		}
+	}
+	if logged != 1 {
+		t.Errorf("unknown messages are logged %d times: %q", logged, h.messages)
+	}
+}
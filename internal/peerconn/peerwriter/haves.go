@@ -0,0 +1,30 @@
+package peerwriter
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// Haves is a batch of "have" messages. All messages in the batch are written to the connection at once.
+type Haves []uint32
+
+// MessageID returns the BitTorrent protocol message ID.
+func (h Haves) MessageID() peerprotocol.MessageID { return peerprotocol.Have }
+
+// Read is not used. Haves are serialized with WriteTo.
+func (h Haves) Read(b []byte) (int, error) { return 0, io.EOF }
+
+// WriteTo writes all messages in the batch, including their length prefix and message ID.
+func (h Haves) WriteTo(w io.Writer) (int64, error) {
+	b := make([]byte, 9*len(h))
+	for i, index := range h {
+		m := b[9*i : 9*i+9]
+		binary.BigEndian.PutUint32(m[0:4], 5)
+		m[4] = byte(peerprotocol.Have)
+		binary.BigEndian.PutUint32(m[5:9], index)
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
@@ -1,7 +1,12 @@
 package peerwriter
 
+import "github.com/cenkalti/rain/internal/peerprotocol"
+
 // BlockUploaded is used to signal the Torrent when a piece block is uploaded to remote peer.
 // BlockUploaded can be used to count the number of bytes uploaded to peers.
 type BlockUploaded struct {
 	Length uint32
 }
+
+// MessageID returns Piece because BlockUploaded is sent after a piece message is written. It is not sent to peers.
+func (m BlockUploaded) MessageID() peerprotocol.MessageID { return peerprotocol.Piece }
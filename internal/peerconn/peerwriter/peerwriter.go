@@ -6,15 +6,21 @@ import (
 	"encoding/binary"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/peerconn/peerreader"
 	"github.com/cenkalti/rain/internal/peerprotocol"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
-const keepAlivePeriod = 2 * time.Minute
+const (
+	keepAlivePeriod = 2 * time.Minute
+
+	// Duplicate requests are ignored if the same block is served in this duration.
+	duplicateRequestWindow = 30 * time.Second
+)
 
 // PeerWriter is responsible for writing BitTorrent protocol messages to the peer connection.
 type PeerWriter struct {
@@ -23,30 +29,36 @@ type PeerWriter struct {
 	cancelC               chan peerprotocol.CancelMessage
 	writeQueue            *list.List
 	maxQueuedRequests     int
-	fastEnabled           bool
 	currentQueuedRequests int
 	writeC                chan peerprotocol.Message
 	messages              chan interface{}
-	servedRequests        map[peerprotocol.RequestMessage]struct{}
-	bucket                *ratelimit.Bucket
-	log                   logger.Logger
-	stopC                 chan struct{}
-	doneC                 chan struct{}
+	// Requests that are queued (zero time) or served recently (time of serving).
+	requests map[peerprotocol.RequestMessage]time.Time
+	bucket   *speedlimit.Limiter
+	// Deadline for each write to the connection. Zero means no deadline.
+	writeTimeout    time.Duration
+	keepAlivePeriod time.Duration
+	log             logger.Logger
+	stopC           chan struct{}
+	stopped         sync.Once
+	doneC           chan struct{}
 }
 
 // New returns a new PeerWriter by wrapping a net.Conn.
-func New(conn net.Conn, l logger.Logger, maxQueuedRequests int, fastEnabled bool, b *ratelimit.Bucket) *PeerWriter {
+// If a write to the connection does not complete in writeTimeout, the connection is closed. Zero means no timeout.
+func New(conn net.Conn, l logger.Logger, maxQueuedRequests int, writeTimeout time.Duration, b *speedlimit.Limiter) *PeerWriter {
 	return &PeerWriter{
 		conn:              conn,
 		queueC:            make(chan peerprotocol.Message),
 		cancelC:           make(chan peerprotocol.CancelMessage),
 		writeQueue:        list.New(),
 		maxQueuedRequests: maxQueuedRequests,
-		fastEnabled:       fastEnabled,
 		writeC:            make(chan peerprotocol.Message),
 		messages:          make(chan interface{}),
-		servedRequests:    make(map[peerprotocol.RequestMessage]struct{}),
+		requests:          make(map[peerprotocol.RequestMessage]time.Time),
 		bucket:            b,
+		writeTimeout:      writeTimeout,
+		keepAlivePeriod:   keepAlivePeriod,
 		log:               l,
 		stopC:             make(chan struct{}),
 		doneC:             make(chan struct{}),
@@ -69,8 +81,9 @@ func (p *PeerWriter) SendMessage(msg peerprotocol.Message) {
 // SendPiece is used to send a "piece" message to the Peer.
 // Data is not read when the method is called.
 // Data is read by the run loop when writing the piece message.
-func (p *PeerWriter) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt) {
-	m := Piece{Data: pi, RequestMessage: msg}
+// Among the queued pieces, the ones with lower availability are sent first.
+func (p *PeerWriter) SendPiece(msg peerprotocol.RequestMessage, pi io.ReaderAt, availability int) {
+	m := Piece{Data: pi, RequestMessage: msg, Availability: availability}
 	select {
 	case p.queueC <- m:
 	case <-p.doneC:
@@ -85,9 +98,9 @@ func (p *PeerWriter) CancelRequest(msg peerprotocol.CancelMessage) {
 	}
 }
 
-// Stop the writer loop.
+// Stop the writer loop. It is safe to call Stop multiple times.
 func (p *PeerWriter) Stop() {
-	close(p.stopC)
+	p.stopped.Do(func() { close(p.stopC) })
 }
 
 // Done returns a channel that is closed when run loop exists.
@@ -101,6 +114,9 @@ func (p *PeerWriter) Run() {
 
 	go p.messageWriter()
 
+	purgeTicker := time.NewTicker(duplicateRequestWindow)
+	defer purgeTicker.Stop()
+
 	for {
 		var (
 			e      *list.Element
@@ -108,53 +124,94 @@ func (p *PeerWriter) Run() {
 			writeC chan peerprotocol.Message
 		)
 		if p.writeQueue.Len() > 0 {
-			e = p.writeQueue.Front()
+			e = p.nextMessage()
 			msg = e.Value.(peerprotocol.Message)
 			writeC = p.writeC
 		}
 		select {
 		case msg = <-p.queueC:
-			p.queueMessage(msg)
+			if !p.queueMessage(msg) {
+				return
+			}
 		case writeC <- msg:
 			p.writeQueue.Remove(e)
-			if _, ok := msg.(Piece); ok {
+			if pi, ok := msg.(Piece); ok {
 				p.currentQueuedRequests--
+				p.requests[pi.RequestMessage] = time.Now()
 			}
 		case cm := <-p.cancelC:
 			p.cancelRequest(cm)
+		case now := <-purgeTicker.C:
+			p.purgeServedRequests(now)
 		case <-p.stopC:
 			return
 		}
 	}
 }
 
-func (p *PeerWriter) queueMessage(msg peerprotocol.Message) {
+// queueMessage puts the message into the write queue.
+// Returns false if the peer must be disconnected.
+func (p *PeerWriter) queueMessage(msg peerprotocol.Message) bool {
 	switch msg2 := msg.(type) {
 	case peerprotocol.ChokeMessage:
 		p.cancelQueuedPieceMessages()
 	case Piece:
-		// Reject request if peer queued to many requests
+		// Ignore the request if the same block is already queued or served recently.
+		// Otherwise, a peer could repeat the same request to waste our disk I/O.
+		if _, ok := p.requests[msg2.RequestMessage]; ok {
+			p.log.Debugln("ignoring duplicate request:", msg2.RequestMessage)
+			return true
+		}
 		if p.currentQueuedRequests >= p.maxQueuedRequests {
-			if p.fastEnabled {
-				msg = peerprotocol.RejectMessage{RequestMessage: msg2.RequestMessage}
-				break
-			} else {
-				// Drop message silently
-				return
-			}
+			p.log.Errorln("peer exceeded max queued requests:", p.maxQueuedRequests)
+			return false
 		}
+		p.requests[msg2.RequestMessage] = time.Time{}
 		p.currentQueuedRequests++
 	}
 	p.writeQueue.PushBack(msg)
+	return true
+}
+
+// nextMessage returns the element of the next message to write.
+// Messages are written in order, except consecutive piece messages are written in the order of rarity.
+func (p *PeerWriter) nextMessage() *list.Element {
+	next := p.writeQueue.Front()
+	pi, ok := next.Value.(Piece)
+	if !ok {
+		return next
+	}
+	availability := pi.Availability
+	for e := next.Next(); e != nil; e = e.Next() {
+		pi, ok = e.Value.(Piece)
+		if !ok {
+			break
+		}
+		if pi.Availability < availability {
+			next = e
+			availability = pi.Availability
+		}
+	}
+	return next
+}
+
+// purgeServedRequests forgets requests that are served before duplicateRequestWindow.
+func (p *PeerWriter) purgeServedRequests(now time.Time) {
+	for req, servedAt := range p.requests {
+		if !servedAt.IsZero() && now.Sub(servedAt) > duplicateRequestWindow {
+			delete(p.requests, req)
+		}
+	}
 }
 
 func (p *PeerWriter) cancelQueuedPieceMessages() {
 	var next *list.Element
 	for e := p.writeQueue.Front(); e != nil; e = next {
 		next = e.Next()
-		if _, ok := e.Value.(Piece); ok {
+		if pi, ok := e.Value.(Piece); ok {
 			p.writeQueue.Remove(e)
 			p.currentQueuedRequests--
+			delete(p.requests, pi.RequestMessage)
 		}
 	}
 }
@@ -164,6 +221,7 @@ func (p *PeerWriter) cancelRequest(cm peerprotocol.CancelMessage) {
 		if pi, ok := e.Value.(Piece); ok && pi.Index == cm.Index && pi.Begin == cm.Begin && pi.Length == cm.Length {
 			p.writeQueue.Remove(e)
 			p.currentQueuedRequests--
+			delete(p.requests, pi.RequestMessage)
 			break
 		}
 	}
@@ -183,7 +241,7 @@ func (p *PeerWriter) messageWriter() {
 		return
 	}
 
-	keepAliveTicker := time.NewTicker(keepAlivePeriod / 2)
+	keepAliveTicker := time.NewTicker(p.keepAlivePeriod / 2)
 	defer keepAliveTicker.Stop()
 
 	// Use a fixed-size array for slice storage.
@@ -196,17 +254,24 @@ func (p *PeerWriter) messageWriter() {
 	for {
 		select {
 		case msg := <-p.writeC:
-			// Reject duplicate requests
-			if pi, ok := msg.(Piece); ok {
-				if _, ok = p.servedRequests[pi.RequestMessage]; ok {
-					msg = peerprotocol.RejectMessage{RequestMessage: pi.RequestMessage}
-				} else {
-					p.servedRequests[pi.RequestMessage] = struct{}{}
+			// p.log.Debugf("writing message of type: %q", msg.MessageID())
+
+			if hs, ok := msg.(Haves); ok {
+				// Messages in batch are serialized with their own headers.
+				var hb bytes.Buffer
+				_, _ = hs.WriteTo(&hb)
+				_, err = p.writeWithDeadline(hb.Bytes())
+				if _, ok := err.(*net.OpError); ok {
+					p.log.Debugf("cannot write have messages: %s", err.Error())
+					return
+				}
+				if err != nil {
+					p.log.Errorf("cannot write have messages: %s", err.Error())
+					return
 				}
+				break
 			}
 
-			// p.log.Debugf("writing message of type: %q", msg.ID())
-
 			buf := bytes.NewBuffer(b)
 
 			// Reserve space for length and message ID
@@ -224,14 +289,14 @@ func (p *PeerWriter) messageWriter() {
 					return
 				default:
 				}
-				p.log.Errorf("cannot serialize message [%v]: %s", msg.ID(), err.Error())
+				p.log.Errorf("cannot serialize message [%v]: %s", msg.MessageID(), err.Error())
 				return
 			}
 
 			// Put length
 			binary.BigEndian.PutUint32(buf.Bytes()[:4], uint32(1+m))
 			// Put message ID
-			buf.Bytes()[4] = uint8(msg.ID())
+			buf.Bytes()[4] = uint8(msg.MessageID())
 
 			if _, ok := msg.(Piece); ok && p.bucket != nil {
 				d := p.bucket.Take(int64(buf.Len()))
@@ -239,23 +304,25 @@ func (p *PeerWriter) messageWriter() {
 				case <-time.After(d):
 				case <-p.stopC:
 					return
+				case <-p.doneC:
+					return
 				}
 			}
 
-			n, err := p.conn.Write(buf.Bytes())
+			n, err := p.writeWithDeadline(buf.Bytes())
 			if _, ok := msg.(Piece); ok {
 				p.countUploadBytes(n)
 			}
 			if _, ok := err.(*net.OpError); ok {
-				p.log.Debugf("cannot write message [%v]: %s", msg.ID(), err.Error())
+				p.log.Debugf("cannot write message [%v]: %s", msg.MessageID(), err.Error())
 				return
 			}
 			if err != nil {
-				p.log.Errorf("cannot write message [%v]: %s", msg.ID(), err.Error())
+				p.log.Errorf("cannot write message [%v]: %s", msg.MessageID(), err.Error())
 				return
 			}
 		case <-keepAliveTicker.C:
-			_, err := p.conn.Write([]byte{0, 0, 0, 0})
+			_, err := p.writeWithDeadline([]byte{0, 0, 0, 0})
 			if _, ok := err.(*net.OpError); ok {
 				p.log.Debugf("cannot write keepalive message: %s", err.Error())
 				return
@@ -266,8 +333,22 @@ func (p *PeerWriter) messageWriter() {
 			}
 		case <-p.stopC:
 			return
+		case <-p.doneC:
+			return
+		}
+	}
+}
+
+// writeWithDeadline writes b to the connection. If writeTimeout is set, write deadline is extended before writing.
+// All writes to the connection must be done with this method so a stuck write cannot block the writer forever.
+func (p *PeerWriter) writeWithDeadline(b []byte) (int, error) {
+	if p.writeTimeout > 0 {
+		err := p.conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+		if err != nil {
+			return 0, err
 		}
 	}
+	return p.conn.Write(b)
 }
 
 func (p *PeerWriter) countUploadBytes(n int) {
@@ -280,6 +361,7 @@ func (p *PeerWriter) countUploadBytes(n int) {
 		select {
 		case p.messages <- BlockUploaded{Length: uploaded}:
 		case <-p.stopC:
+		case <-p.doneC:
 		}
 	}
 }
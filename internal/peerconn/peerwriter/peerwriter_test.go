@@ -0,0 +1,206 @@
+package peerwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+func drainMessages(w *PeerWriter) {
+	go func() {
+		for {
+			select {
+			case <-w.Messages():
+			case <-w.Done():
+				return
+			}
+		}
+	}()
+}
+
+// readMessage reads the next message other than keep-alive.
+func readMessage(t *testing.T, r io.Reader) (peerprotocol.MessageID, []byte) {
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(r, header[:4]); err != nil {
+			t.Fatal(err)
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		if length == 0 {
+			continue
+		}
+		if _, err := io.ReadFull(r, header[4:]); err != nil {
+			t.Fatal(err)
+		}
+		payload := make([]byte, length-1)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			t.Fatal(err)
+		}
+		return peerprotocol.MessageID(header[4]), payload
+	}
+}
+
+func TestDuplicateRequest(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	w := New(c1, logger.New("test"), 10, 0, nil)
+	go w.Run()
+	defer w.Stop()
+	drainMessages(w)
+
+	data := bytes.NewReader([]byte("foobar"))
+	w.SendPiece(peerprotocol.RequestMessage{Index: 0, Begin: 0, Length: 3}, data, 0)
+	w.SendPiece(peerprotocol.RequestMessage{Index: 0, Begin: 0, Length: 3}, data, 0)
+	w.SendPiece(peerprotocol.RequestMessage{Index: 0, Begin: 3, Length: 3}, data, 0)
+	w.SendPiece(peerprotocol.RequestMessage{Index: 0, Begin: 0, Length: 3}, data, 0)
+	w.SendMessage(peerprotocol.HaveMessage{Index: 1})
+
+	_ = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var pieces []string
+	for {
+		id, payload := readMessage(t, c2)
+		if id == peerprotocol.Have {
+			break
+		}
+		pieces = append(pieces, string(payload[8:]))
+	}
+	if len(pieces) != 2 || pieces[0] != "foo" || pieces[1] != "bar" {
+		t.Fatalf("unexpected pieces: %q", pieces)
+	}
+}
+
+func TestTooManyRequests(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	w := New(c1, logger.New("test"), 2, 0, nil)
+	go w.Run()
+	defer w.Stop()
+	drainMessages(w)
+
+	// Nothing is read from c2 so requests stay in queue.
+	data := bytes.NewReader(make([]byte, 10))
+	for i := uint32(0); i < 4; i++ {
+		w.SendPiece(peerprotocol.RequestMessage{Index: 0, Begin: i, Length: 1}, data, 0)
+	}
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer is not stopped")
+	}
+}
+
+func TestRarestPieceFirst(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	w := New(c1, logger.New("test"), 10, 0, nil)
+	go w.Run()
+	defer w.Stop()
+	drainMessages(w)
+
+	// Writer is blocked on the first message until it is read, so the pieces below are queued together.
+	w.SendMessage(peerprotocol.HaveMessage{Index: 9})
+	data := bytes.NewReader(make([]byte, 10))
+	w.SendPiece(peerprotocol.RequestMessage{Index: 1, Length: 1}, data, 5)
+	w.SendPiece(peerprotocol.RequestMessage{Index: 2, Length: 1}, data, 1)
+	w.SendPiece(peerprotocol.RequestMessage{Index: 3, Length: 1}, data, 3)
+	w.SendMessage(peerprotocol.HaveMessage{Index: 8})
+	w.SendPiece(peerprotocol.RequestMessage{Index: 4, Length: 1}, data, 0)
+
+	_ = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var order []uint32
+	for len(order) < 6 {
+		_, payload := readMessage(t, c2)
+		order = append(order, binary.BigEndian.Uint32(payload[:4]))
+	}
+	// Pieces are not moved before other messages.
+	expected := []uint32{9, 2, 3, 1, 8, 4}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("unexpected order: %v", order)
+		}
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	w := New(c1, logger.New("test"), 10, 0, nil)
+	go w.Run()
+	w.Stop()
+	w.Stop()
+	<-w.Done()
+}
+
+type writeCounter struct {
+	net.Conn
+	writes int32
+}
+
+func (c *writeCounter) Write(b []byte) (int, error) {
+	atomic.AddInt32(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func TestHaves(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	wc := &writeCounter{Conn: c1}
+	w := New(wc, logger.New("test"), 10, 0, nil)
+	go w.Run()
+	defer w.Stop()
+	drainMessages(w)
+
+	w.SendMessage(Haves{3, 5, 7})
+	_ = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expected := range []uint32{3, 5, 7} {
+		id, payload := readMessage(t, c2)
+		if id != peerprotocol.Have || binary.BigEndian.Uint32(payload) != expected {
+			t.Fatalf("unexpected message: %d %v", id, payload)
+		}
+	}
+	if n := atomic.LoadInt32(&wc.writes); n != 1 {
+		t.Fatalf("unexpected number of writes: %d", n)
+	}
+}
+
+func TestAllowedFastMessageID(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	w := New(c1, logger.New("test"), 10, 0, nil)
+	go w.Run()
+	defer w.Stop()
+	drainMessages(w)
+
+	// AllowedFastMessage embeds HaveMessage but must not be sent as a have message.
+	w.SendMessage(peerprotocol.AllowedFastMessage{HaveMessage: peerprotocol.HaveMessage{Index: 7}})
+	_ = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	id, payload := readMessage(t, c2)
+	if id != peerprotocol.AllowedFast || binary.BigEndian.Uint32(payload) != 7 {
+		t.Fatalf("unexpected message: %d %v", id, payload)
+	}
+}
+
+func TestKeepAliveWriteTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	w := New(c1, logger.New("test"), 10, 100*time.Millisecond, nil)
+	w.keepAlivePeriod = 100 * time.Millisecond
+	go w.Run()
+	defer w.Stop()
+	drainMessages(w)
+
+	// Nothing is read from c2, so keep-alive write blocks until the deadline and the connection is closed.
+	// Write to c2 blocks while c1 is open because nothing reads from c1 either.
+	_ = c2.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := c2.Write([]byte{0})
+	if err != io.ErrClosedPipe {
+		t.Fatalf("connection is not closed: %v", err)
+	}
+}
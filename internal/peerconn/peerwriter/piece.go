@@ -11,10 +11,12 @@ import (
 type Piece struct {
 	Data io.ReaderAt
 	peerprotocol.RequestMessage
+	// Number of peers having the piece. Rarest pieces are sent first.
+	Availability int
 }
 
-// ID returns the BitTorrent protocol message ID.
-func (p Piece) ID() peerprotocol.MessageID { return peerprotocol.Piece }
+// MessageID returns the BitTorrent protocol message ID.
+func (p Piece) MessageID() peerprotocol.MessageID { return peerprotocol.Piece }
 
 // Read piece data.
 func (p Piece) Read(b []byte) (int, error) {
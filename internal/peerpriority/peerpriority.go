@@ -38,6 +38,12 @@ func calculateBytes(a, b *net.TCPAddr) (ret [2][]byte) {
 	}
 	a4 := a.IP.To4()
 	b4 := b.IP.To4()
+	if a4 == nil || b4 == nil {
+		// Masks are implemented for IPv4 only. Full addresses are used otherwise.
+		ret[0] = a.IP.To16()
+		ret[1] = b.IP.To16()
+		return
+	}
 	m := ipv4Mask(a4, b4)
 	ret[0] = a4.Mask(m)
 	ret[1] = b4.Mask(m)
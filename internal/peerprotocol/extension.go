@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 
 	"github.com/zeebo/bencode"
 )
@@ -41,8 +42,8 @@ type ExtensionMessage struct {
 	Payload           interface{}
 }
 
-// ID returns the type of a peer message.
-func (m ExtensionMessage) ID() MessageID { return Extension }
+// MessageID returns the type of a peer message.
+func (m ExtensionMessage) MessageID() MessageID { return Extension }
 
 // Read extension message bytes.
 func (m ExtensionMessage) Read([]byte) (int, error) {
@@ -84,13 +85,13 @@ func (m *ExtensionMessage) UnmarshalBinary(data []byte) error {
 	case ExtensionIDHandshake:
 		var extMsg ExtensionHandshakeMessage
 		err = dec.Decode(&extMsg)
-		m.Payload = extMsg
 		if extMsg.MetadataSize < 0 {
 			extMsg.MetadataSize = 0
 		}
 		if extMsg.RequestQueue < 0 {
 			extMsg.RequestQueue = 0
 		}
+		m.Payload = extMsg
 	case ExtensionIDMetadata:
 		var extMsg ExtensionMetadataMessage
 		err = dec.Decode(&extMsg)
@@ -101,11 +102,61 @@ func (m *ExtensionMessage) UnmarshalBinary(data []byte) error {
 		err = dec.Decode(&extMsg)
 		m.Payload = extMsg
 	default:
-		return fmt.Errorf("peer sent invalid extension message id: %d", m.ExtendedMessageID)
+		decode, ok := registeredDecoder(m.ExtendedMessageID)
+		if !ok {
+			return fmt.Errorf("peer sent invalid extension message id: %d", m.ExtendedMessageID)
+		}
+		m.Payload, err = decode(payload)
 	}
 	return err
 }
 
+// ExtensionDecoder decodes the payload of a message of an extension registered with RegisterExtension.
+type ExtensionDecoder func(payload []byte) (interface{}, error)
+
+var registeredExtensions struct {
+	sync.RWMutex
+	ids      map[string]uint8
+	decoders map[uint8]ExtensionDecoder
+}
+
+// RegisterExtension registers an extension that is not implemented in this package.
+// The extension is advertised with key in extension handshakes, so peers send messages of the extension with id.
+// Received messages are decoded with decode and delivered as ExtensionMessage with the decoded value in Payload.
+// It must be called before connecting to peers. It panics if key or id is already registered.
+func RegisterExtension(key string, id uint8, decode ExtensionDecoder) {
+	registeredExtensions.Lock()
+	defer registeredExtensions.Unlock()
+	if id <= ExtensionIDPEX || key == ExtensionKeyMetadata || key == ExtensionKeyPEX {
+		panic("extension is implemented by peerprotocol: " + key)
+	}
+	if registeredExtensions.ids == nil {
+		registeredExtensions.ids = make(map[string]uint8)
+		registeredExtensions.decoders = make(map[uint8]ExtensionDecoder)
+	}
+	if _, ok := registeredExtensions.ids[key]; ok {
+		panic("extension is already registered: " + key)
+	}
+	if _, ok := registeredExtensions.decoders[id]; ok {
+		panic(fmt.Sprintf("extension message id is already registered: %d", id))
+	}
+	registeredExtensions.ids[key] = id
+	registeredExtensions.decoders[id] = decode
+}
+
+// IsRegisteredExtension returns true if the extended message id is registered with RegisterExtension.
+func IsRegisteredExtension(id uint8) bool {
+	_, ok := registeredDecoder(id)
+	return ok
+}
+
+func registeredDecoder(id uint8) (ExtensionDecoder, bool) {
+	registeredExtensions.RLock()
+	defer registeredExtensions.RUnlock()
+	decode, ok := registeredExtensions.decoders[id]
+	return decode, ok
+}
+
 // ExtensionHandshakeMessage contains the information to do the extension handshake.
 type ExtensionHandshakeMessage struct {
 	M            map[string]uint8 `bencode:"m"`
@@ -117,11 +168,17 @@ type ExtensionHandshakeMessage struct {
 
 // NewExtensionHandshake returns a new ExtensionHandshakeMessage by filling the struct with given values.
 func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, requestQueueLength int) ExtensionHandshakeMessage {
+	m := map[string]uint8{
+		ExtensionKeyMetadata: ExtensionIDMetadata,
+		ExtensionKeyPEX:      ExtensionIDPEX,
+	}
+	registeredExtensions.RLock()
+	for key, id := range registeredExtensions.ids {
+		m[key] = id
+	}
+	registeredExtensions.RUnlock()
 	return ExtensionHandshakeMessage{
-		M: map[string]uint8{
-			ExtensionKeyMetadata: ExtensionIDMetadata,
-			ExtensionKeyPEX:      ExtensionIDPEX,
-		},
+		M:            m,
 		V:            version,
 		YourIP:       string(truncateIP(yourip)),
 		MetadataSize: int(metadataSize),
@@ -129,6 +186,9 @@ func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, r
 	}
 }
 
+// MessageID returns Extension. Payloads of built-in extensions are delivered without the ExtensionMessage wrapper.
+func (m ExtensionHandshakeMessage) MessageID() MessageID { return Extension }
+
 // ExtensionMetadataMessage is the message for the Metadata extension.
 type ExtensionMetadataMessage struct {
 	Type      int    `bencode:"msg_type"`
@@ -137,12 +197,18 @@ type ExtensionMetadataMessage struct {
 	Data      []byte `bencode:"-"`
 }
 
+// MessageID returns Extension. Payloads of built-in extensions are delivered without the ExtensionMessage wrapper.
+func (m ExtensionMetadataMessage) MessageID() MessageID { return Extension }
+
 // ExtensionPEXMessage is the message for the PEX extension.
 type ExtensionPEXMessage struct {
 	Added   string `bencode:"added"`
 	Dropped string `bencode:"dropped"`
 }
 
+// MessageID returns Extension. Payloads of built-in extensions are delivered without the ExtensionMessage wrapper.
+func (m ExtensionPEXMessage) MessageID() MessageID { return Extension }
+
 func truncateIP(ip net.IP) net.IP {
 	ip4 := ip.To4()
 	if ip4 != nil {
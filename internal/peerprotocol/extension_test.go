@@ -0,0 +1,53 @@
+package peerprotocol
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestExtensionHandshakeNegativeValues(t *testing.T) {
+	data := append([]byte{ExtensionIDHandshake}, "d13:metadata_sizei-1e4:reqqi-5ee"...)
+	var msg ExtensionMessage
+	if err := msg.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	hs := msg.Payload.(ExtensionHandshakeMessage)
+	if hs.MetadataSize != 0 {
+		t.Errorf("unexpected metadata size: %d", hs.MetadataSize)
+	}
+	if hs.RequestQueue != 0 {
+		t.Errorf("unexpected request queue: %d", hs.RequestQueue)
+	}
+}
+
+// Extensions are registered globally, so they are registered once when tests are run multiple times.
+var registerTestExtension sync.Once
+
+func TestRegisterExtension(t *testing.T) {
+	const id = 201
+	registerTestExtension.Do(func() {
+		RegisterExtension("test_registry", id, func(payload []byte) (interface{}, error) {
+			return len(payload), nil
+		})
+	})
+	var msg ExtensionMessage
+	if err := msg.UnmarshalBinary([]byte{id, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Payload != 3 {
+		t.Errorf("unexpected payload: %v", msg.Payload)
+	}
+	if err := msg.UnmarshalBinary([]byte{id + 1}); err == nil {
+		t.Error("unregistered extension message is decoded")
+	}
+	for _, key := range []string{"test_registry", ExtensionKeyPEX} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q again did not panic", key)
+				}
+			}()
+			RegisterExtension(key, id+2, nil)
+		}()
+	}
+}
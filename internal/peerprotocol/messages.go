@@ -2,13 +2,14 @@ package peerprotocol
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 )
 
 // Message is a Peer message of BitTorrent protocol.
 type Message interface {
 	io.Reader
-	ID() MessageID
+	MessageID() MessageID
 }
 
 // HaveMessage indicates a peer has the piece with index.
@@ -16,21 +17,23 @@ type HaveMessage struct {
 	Index uint32
 }
 
-// ID returns the peer protocol message type.
-func (m HaveMessage) ID() MessageID { return Have }
+// MessageID returns the peer protocol message type.
+func (m HaveMessage) MessageID() MessageID { return Have }
 
 func (m HaveMessage) Read(b []byte) (int, error) {
 	binary.BigEndian.PutUint32(b[0:4], m.Index)
 	return 4, io.EOF
 }
 
+func (m HaveMessage) String() string { return fmt.Sprintf("Have(piece=%d)", m.Index) }
+
 // RequestMessage is sent when a peer needs a certain piece.
 type RequestMessage struct {
 	Index, Begin, Length uint32
 }
 
-// ID returns the peer protocol message type.
-func (m RequestMessage) ID() MessageID { return Request }
+// MessageID returns the peer protocol message type.
+func (m RequestMessage) MessageID() MessageID { return Request }
 
 // Read message data into buffer b.
 func (m RequestMessage) Read(b []byte) (int, error) {
@@ -40,13 +43,17 @@ func (m RequestMessage) Read(b []byte) (int, error) {
 	return 12, io.EOF
 }
 
+func (m RequestMessage) String() string {
+	return fmt.Sprintf("Request(piece=%d begin=%d len=%d)", m.Index, m.Begin, m.Length)
+}
+
 // PieceMessage is sent when a peer wants to upload piece data.
 type PieceMessage struct {
 	Index, Begin uint32
 }
 
-// ID returns the peer protocol message type.
-func (m PieceMessage) ID() MessageID { return Piece }
+// MessageID returns the peer protocol message type.
+func (m PieceMessage) MessageID() MessageID { return Piece }
 
 // Read message data into buffer b.
 func (m PieceMessage) Read(b []byte) (int, error) {
@@ -55,14 +62,18 @@ func (m PieceMessage) Read(b []byte) (int, error) {
 	return 8, io.EOF
 }
 
+func (m PieceMessage) String() string {
+	return fmt.Sprintf("Piece(piece=%d begin=%d)", m.Index, m.Begin)
+}
+
 // BitfieldMessage sent after the peer handshake to exchange piece availability information between peers.
 type BitfieldMessage struct {
 	Data []byte
 	pos  int
 }
 
-// ID returns the peer protocol message type.
-func (m BitfieldMessage) ID() MessageID { return Bitfield }
+// MessageID returns the peer protocol message type.
+func (m BitfieldMessage) MessageID() MessageID { return Bitfield }
 
 // Read message data into buffer b.
 func (m *BitfieldMessage) Read(b []byte) (n int, err error) {
@@ -74,13 +85,15 @@ func (m *BitfieldMessage) Read(b []byte) (n int, err error) {
 	return
 }
 
+func (m BitfieldMessage) String() string { return fmt.Sprintf("Bitfield(bytes=%d)", len(m.Data)) }
+
 // PortMessage is sent to announce the UDP port number of DHT node run by the peer.
 type PortMessage struct {
 	Port uint16
 }
 
-// ID returns the peer protocol message type.
-func (m PortMessage) ID() MessageID { return Port }
+// MessageID returns the peer protocol message type.
+func (m PortMessage) MessageID() MessageID { return Port }
 
 // Read message data into buffer b.
 func (m PortMessage) Read(b []byte) (n int, err error) {
@@ -88,6 +101,8 @@ func (m PortMessage) Read(b []byte) (n int, err error) {
 	return 2, io.EOF
 }
 
+func (m PortMessage) String() string { return fmt.Sprintf("Port(port=%d)", m.Port) }
+
 type emptyMessage struct{}
 
 func (m emptyMessage) Read(b []byte) (int, error) {
@@ -121,26 +136,45 @@ type RejectMessage struct{ RequestMessage }
 // CancelMessage is sent to peer to cancel previosly sent request.
 type CancelMessage struct{ RequestMessage }
 
-// ID returns the peer protocol message type.
-func (m ChokeMessage) ID() MessageID { return Choke }
+// MessageID returns the peer protocol message type.
+func (m AllowedFastMessage) MessageID() MessageID { return AllowedFast }
 
-// ID returns the peer protocol message type.
-func (m UnchokeMessage) ID() MessageID { return Unchoke }
+// MessageID returns the peer protocol message type.
+func (m ChokeMessage) MessageID() MessageID { return Choke }
 
-// ID returns the peer protocol message type.
-func (m InterestedMessage) ID() MessageID { return Interested }
+// MessageID returns the peer protocol message type.
+func (m UnchokeMessage) MessageID() MessageID { return Unchoke }
 
-// ID returns the peer protocol message type.
-func (m NotInterestedMessage) ID() MessageID { return NotInterested }
+// MessageID returns the peer protocol message type.
+func (m InterestedMessage) MessageID() MessageID { return Interested }
 
-// ID returns the peer protocol message type.
-func (m HaveAllMessage) ID() MessageID { return HaveAll }
+// MessageID returns the peer protocol message type.
+func (m NotInterestedMessage) MessageID() MessageID { return NotInterested }
 
-// ID returns the peer protocol message type.
-func (m HaveNoneMessage) ID() MessageID { return HaveNone }
+// MessageID returns the peer protocol message type.
+func (m HaveAllMessage) MessageID() MessageID { return HaveAll }
 
-// ID returns the peer protocol message type.
-func (m RejectMessage) ID() MessageID { return Reject }
+// MessageID returns the peer protocol message type.
+func (m HaveNoneMessage) MessageID() MessageID { return HaveNone }
 
-// ID returns the peer protocol message type.
-func (m CancelMessage) ID() MessageID { return Cancel }
+// MessageID returns the peer protocol message type.
+func (m RejectMessage) MessageID() MessageID { return Reject }
+
+// MessageID returns the peer protocol message type.
+func (m CancelMessage) MessageID() MessageID { return Cancel }
+
+func (m ChokeMessage) String() string         { return "Choke" }
+func (m UnchokeMessage) String() string       { return "Unchoke" }
+func (m InterestedMessage) String() string    { return "Interested" }
+func (m NotInterestedMessage) String() string { return "NotInterested" }
+func (m HaveAllMessage) String() string       { return "HaveAll" }
+func (m HaveNoneMessage) String() string      { return "HaveNone" }
+func (m AllowedFastMessage) String() string   { return fmt.Sprintf("AllowedFast(piece=%d)", m.Index) }
+
+func (m RejectMessage) String() string {
+	return fmt.Sprintf("Reject(piece=%d begin=%d len=%d)", m.Index, m.Begin, m.Length)
+}
+
+func (m CancelMessage) String() string {
+	return fmt.Sprintf("Cancel(piece=%d begin=%d len=%d)", m.Index, m.Begin, m.Length)
+}
@@ -0,0 +1,37 @@
+package peerprotocol
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	cases := []struct {
+		msg      Message
+		id       MessageID
+		expected string
+	}{
+		{ChokeMessage{}, Choke, "Choke"},
+		{UnchokeMessage{}, Unchoke, "Unchoke"},
+		{InterestedMessage{}, Interested, "Interested"},
+		{NotInterestedMessage{}, NotInterested, "NotInterested"},
+		{HaveMessage{Index: 3}, Have, "Have(piece=3)"},
+		{&BitfieldMessage{Data: []byte{0xff, 0x80}}, Bitfield, "Bitfield(bytes=2)"},
+		{RequestMessage{Index: 3, Begin: 16384, Length: 16384}, Request, "Request(piece=3 begin=16384 len=16384)"},
+		{PieceMessage{Index: 3, Begin: 16384}, Piece, "Piece(piece=3 begin=16384)"},
+		{CancelMessage{RequestMessage{Index: 1, Begin: 0, Length: 100}}, Cancel, "Cancel(piece=1 begin=0 len=100)"},
+		{PortMessage{Port: 6881}, Port, "Port(port=6881)"},
+		{HaveAllMessage{}, HaveAll, "HaveAll"},
+		{HaveNoneMessage{}, HaveNone, "HaveNone"},
+		{RejectMessage{RequestMessage{Index: 2, Begin: 32768, Length: 512}}, Reject, "Reject(piece=2 begin=32768 len=512)"},
+		{AllowedFastMessage{HaveMessage{Index: 7}}, AllowedFast, "AllowedFast(piece=7)"},
+	}
+	for _, c := range cases {
+		if id := c.msg.MessageID(); id != c.id {
+			t.Errorf("%s: expected id %s, got %s", c.expected, c.id, id)
+		}
+		if s := fmt.Sprint(c.msg); s != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.msg.MessageID(), c.expected, s)
+		}
+	}
+}
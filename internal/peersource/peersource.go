@@ -14,6 +14,8 @@ const (
 	Manual
 	// Incoming indicates that the peer found us. We did not found the peer.
 	Incoming
+	// LSD indicates that the peer is found with Local Service Discovery.
+	LSD
 )
 
 func (s Source) String() string {
@@ -28,6 +30,8 @@ func (s Source) String() string {
 		return "manual"
 	case Incoming:
 		return "incoming"
+	case LSD:
+		return "lsd"
 	default:
 		panic("unhandled source")
 	}
@@ -39,7 +39,11 @@ func NewWithRecentlySeen(rs []tracker.CompactPeer) *PEXList {
 }
 
 // Add adds the address to the added part and removes from dropped part.
+// IPv6 addresses are ignored because they cannot be encoded in compact form.
 func (l *PEXList) Add(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		return
+	}
 	p := tracker.NewCompactPeer(addr)
 	l.added[p] = struct{}{}
 	delete(l.dropped, p)
@@ -47,6 +51,9 @@ func (l *PEXList) Add(addr *net.TCPAddr) {
 
 // Drop adds the address to the dropped part and removes from added part.
 func (l *PEXList) Drop(addr *net.TCPAddr) {
+	if addr.IP.To4() == nil {
+		return
+	}
 	peer := tracker.NewCompactPeer(addr)
 	l.dropped[peer] = struct{}{}
 	delete(l.added, peer)
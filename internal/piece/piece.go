@@ -10,8 +10,12 @@ import (
 	"golang.org/x/exp/constraints"
 )
 
-// BlockSize is the size of smallest piece data that we are going to request from peers.
-const BlockSize = 16 * 1024
+const (
+	// BlockSize is the default size of piece data that we are going to request from peers.
+	BlockSize = 16 * 1024
+	// MaxBlockSize is the largest block size that can be requested from peers.
+	MaxBlockSize = 128 * 1024
+)
 
 // Piece of a torrent.
 type Piece struct {
@@ -26,7 +30,7 @@ type Piece struct {
 // Block is part of a Piece that is specified in peerprotocol.Request messages.
 type Block struct {
 	Begin  uint32 // Offset in piece
-	Length uint32 // Cannot exceed BlockSize. It's shorter for last block or if the next file is a padding file.
+	Length uint32 // Cannot exceed the block size. It's shorter for last block or if the next file is a padding file.
 }
 
 // NewPieces returns a slice of Pieces by mapping files to the pieces.
@@ -100,8 +104,8 @@ func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
 // numBlocks returns the number of blocks in the piece.
 // The calculation is only correct when there is no padding in piece.
 // It is only used in per-allocation of blocks slice in CalculateBlocks().
-func (p *Piece) numBlocks() int {
-	div, mod := divmod(p.Length, BlockSize)
+func (p *Piece) numBlocks(blockSize uint32) int {
+	div, mod := divmod(p.Length, blockSize)
 	numBlocks := div
 	if mod != 0 {
 		numBlocks++
@@ -109,12 +113,10 @@ func (p *Piece) numBlocks() int {
 	return int(numBlocks)
 }
 
-func (p *Piece) CalculateBlocks() []Block {
-	return p.calculateBlocks(BlockSize)
-}
-
-func (p *Piece) calculateBlocks(blockSize uint32) []Block {
-	blocks := make([]Block, 0, p.numBlocks())
+// CalculateBlocks splits the piece into blocks of blockSize for requesting from peers.
+// Parts of the piece that belong to padding files are not included.
+func (p *Piece) CalculateBlocks(blockSize uint32) []Block {
+	blocks := make([]Block, 0, p.numBlocks(blockSize))
 
 	secIndex := 0
 	sec := p.Data[secIndex]
@@ -1,18 +1,24 @@
 package piece
 
 import (
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNumBlocks(t *testing.T) {
 	p := Piece{Length: 2 * 16 * 1024}
-	assert.Equal(t, 2, p.numBlocks())
+	assert.Equal(t, 2, p.numBlocks(BlockSize))
 
 	p = Piece{Length: 2*16*1024 + 42}
-	assert.Equal(t, 3, p.numBlocks())
+	assert.Equal(t, 3, p.numBlocks(BlockSize))
 }
 
 func TestFindBlock(t *testing.T) {
@@ -24,7 +30,7 @@ func TestFindBlock(t *testing.T) {
 			},
 		},
 	}
-	blocks := p.CalculateBlocks()
+	blocks := p.CalculateBlocks(BlockSize)
 	findBlock := func(begin, length uint32) bool {
 		for _, blk := range blocks {
 			if blk.Begin == begin && blk.Length == length {
@@ -168,7 +174,47 @@ func TestCalculateBlocks(t *testing.T) {
 			t.Errorf("error in test case #%d: piece and data length do not match", i)
 			continue
 		}
-		blocks := tc.piece.calculateBlocks(blockSize)
+		blocks := tc.piece.CalculateBlocks(blockSize)
 		assert.Equal(t, tc.expected, blocks, "test case #%d", i)
 	}
 }
+
+func TestLastPiece(t *testing.T) {
+	const pieceLength = 32 * 1024
+	dir := t.TempDir()
+	sizes := []int{70000, 12345}
+	for i, size := range sizes {
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(i)), make([]byte, size), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := metainfo.NewInfoBytes("", []string{dir}, false, pieceLength, "", logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := metainfo.NewInfo(b, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make([]allocator.File, len(info.Files))
+	for i, f := range info.Files {
+		files[i] = allocator.File{Name: f.Path}
+	}
+	pieces := NewPieces(info, files)
+
+	var total int64
+	for _, p := range pieces {
+		total += int64(p.Length)
+	}
+	assert.Equal(t, info.Length, total)
+	last := pieces[len(pieces)-1]
+	lastLength := uint32(info.Length % pieceLength)
+	assert.Equal(t, lastLength, last.Length)
+
+	for _, blockSize := range []uint32{BlockSize, 4 * 1024} {
+		blocks := last.CalculateBlocks(blockSize)
+		lastBlock := blocks[len(blocks)-1]
+		assert.Equal(t, lastLength%blockSize, lastBlock.Length, "block size %d", blockSize)
+		assert.Equal(t, last.Length, lastBlock.Begin+lastBlock.Length, "block size %d", blockSize)
+	}
+}
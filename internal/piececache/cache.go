@@ -2,6 +2,7 @@ package piececache
 
 import (
 	"container/heap"
+	"strings"
 	"sync"
 	"time"
 
@@ -66,6 +67,21 @@ func (c *Cache) Clear() {
 	c.m.Unlock()
 }
 
+// RemovePrefix drops the items with keys that start with prefix.
+func (c *Cache) RemovePrefix(prefix string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var remove []*item
+	for _, i := range c.accessList {
+		if strings.HasPrefix(i.key, prefix) {
+			remove = append(remove, i)
+		}
+	}
+	for _, i := range remove {
+		c.removeItem(i)
+	}
+}
+
 // Len returns the number of items in the cache. Items may be in different sizes.
 func (c *Cache) Len() int {
 	c.m.RLock()
@@ -2,6 +2,7 @@ package piecedownloader
 
 import (
 	"errors"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/piece"
@@ -22,13 +23,16 @@ type PieceDownloader struct {
 	Peer        Peer
 	AllowedFast bool
 	Buffer      bufferpool.Buffer
+	// Restored is true if some blocks in Buffer are loaded from disk instead of being received from Peer.
+	Restored bool
 
 	// blocks contains blocks that needs to be downloaded from peers.
 	// It does not contain the parts that belong to padding files.
-	blocks    map[uint32]uint32   // begin -> length
-	remaining []uint32            // blocks to be downloaded from peers in consecutive order.
-	pending   map[uint32]struct{} // in-flight requests
-	done      map[uint32]struct{} // downloaded requests
+	blocks    map[uint32]uint32    // begin -> length
+	remaining []uint32             // blocks to be downloaded from peers in consecutive order.
+	pending   map[uint32]time.Time // in-flight requests -> request time
+	timedOut  []uint32             // requests canceled by CancelTimedOut, not requested again until Unsnubbed is called.
+	done      map[uint32]struct{}  // downloaded requests
 }
 
 // Peer of a Torrent.
@@ -38,9 +42,9 @@ type Peer interface {
 	EnabledFast() bool
 }
 
-// New returns a new PieceDownloader.
-func New(pi *piece.Piece, pe Peer, allowedFast bool, buf bufferpool.Buffer) *PieceDownloader {
-	blocks := pi.CalculateBlocks()
+// New returns a new PieceDownloader that requests the piece in blocks of blockSize.
+func New(pi *piece.Piece, pe Peer, allowedFast bool, buf bufferpool.Buffer, blockSize uint32) *PieceDownloader {
+	blocks := pi.CalculateBlocks(blockSize)
 	return &PieceDownloader{
 		Piece:       pi,
 		Peer:        pe,
@@ -48,7 +52,7 @@ func New(pi *piece.Piece, pe Peer, allowedFast bool, buf bufferpool.Buffer) *Pie
 		Buffer:      buf,
 		blocks:      makeBlocks(blocks),
 		remaining:   makeRemaining(blocks),
-		pending:     make(map[uint32]struct{}, len(blocks)),
+		pending:     make(map[uint32]time.Time, len(blocks)),
 		done:        make(map[uint32]struct{}, len(blocks)),
 	}
 }
@@ -113,6 +117,10 @@ func (d *PieceDownloader) Rejected(begin, length uint32) bool {
 	if !d.findBlock(begin, length) {
 		return false
 	}
+	if _, ok := d.pending[begin]; !ok {
+		// Peer may reject a request after we cancel it.
+		return true
+	}
 	delete(d.pending, begin)
 	d.remaining = append(d.remaining, begin)
 	return true
@@ -130,8 +138,42 @@ func (d *PieceDownloader) CancelPending() {
 	}
 }
 
+// CancelTimedOut cancels the pending requests that are not received in timeout.
+// Canceled blocks are not requested again from the peer until Unsnubbed is called,
+// so the caller must mark the peer as snubbed to let other peers download the piece.
+// Returns the number of canceled requests.
+func (d *PieceDownloader) CancelTimedOut(now time.Time, timeout time.Duration) int {
+	var n int
+	for begin, requestedAt := range d.pending {
+		if now.Sub(requestedAt) < timeout {
+			continue
+		}
+		length, ok := d.blocks[begin]
+		if !ok {
+			panic("cannot get block")
+		}
+		d.Peer.CancelPiece(d.Piece.Index, begin, length)
+		delete(d.pending, begin)
+		d.timedOut = append(d.timedOut, begin)
+		n++
+	}
+	return n
+}
+
+// Unsnubbed must be called when the snubbed peer starts sending blocks again.
+// Requests canceled by CancelTimedOut are requested again on next RequestBlocks call unless they are received meanwhile.
+func (d *PieceDownloader) Unsnubbed() {
+	for _, begin := range d.timedOut {
+		if _, ok := d.done[begin]; !ok {
+			d.remaining = append(d.remaining, begin)
+		}
+	}
+	d.timedOut = nil
+}
+
 // RequestBlocks is called to request remaining blocks of the piece up to `queueLength`.
 func (d *PieceDownloader) RequestBlocks(queueLength int) {
+	now := time.Now()
 	remaining := d.remaining
 	for _, begin := range remaining {
 		if len(d.pending) >= queueLength {
@@ -145,8 +187,30 @@ func (d *PieceDownloader) RequestBlocks(queueLength int) {
 			d.Peer.RequestPiece(d.Piece.Index, begin, length)
 		}
 		d.remaining = d.remaining[1:]
-		d.pending[begin] = struct{}{}
+		d.pending[begin] = now
+	}
+}
+
+// SetDownloaded marks the block at offset begin as downloaded, so it is not requested from the peer.
+// Data of the block must be copied into Buffer by the caller. Must be called before RequestBlocks.
+func (d *PieceDownloader) SetDownloaded(begin uint32) {
+	if _, ok := d.blocks[begin]; !ok {
+		panic("cannot get block")
 	}
+	d.done[begin] = struct{}{}
+	d.Restored = true
+	for i, b := range d.remaining {
+		if b == begin {
+			d.remaining = append(d.remaining[:i], d.remaining[i+1:]...)
+			break
+		}
+	}
+}
+
+// Downloaded returns true if the block at offset begin has been received from the peer.
+func (d *PieceDownloader) Downloaded(begin uint32) bool {
+	_, ok := d.done[begin]
+	return ok
 }
 
 // Done returns true if all blocks of the piece has been downloaded.
@@ -2,6 +2,7 @@ package piecedownloader
 
 import (
 	"testing"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/filesection"
@@ -56,7 +57,7 @@ func TestPieceDownloader(t *testing.T) {
 		},
 	}
 	pe := &TestPeer{}
-	d := New(pi, pe, false, buf)
+	d := New(pi, pe, false, buf, blockSize)
 	assert.Equal(t, 10, len(d.remaining))
 	assert.Equal(t, 0, len(d.pending))
 	assert.Equal(t, 0, len(d.done))
@@ -154,3 +155,92 @@ func TestPieceDownloader(t *testing.T) {
 	assert.Equal(t, 10, len(d.done))
 	assert.True(t, d.Done())
 }
+
+func TestCancelTimedOut(t *testing.T) {
+	bp := bufferpool.New(4 * blockSize)
+	pi := &piece.Piece{
+		Index:  2,
+		Length: 4 * blockSize,
+		Data:   []filesection.FileSection{{Length: 4 * blockSize}},
+	}
+	pe := &TestPeer{}
+	d := New(pi, pe, false, bp.Get(4*blockSize), blockSize)
+	d.RequestBlocks(2)
+	assert.Nil(t, d.GotBlock(0, make([]byte, blockSize)))
+
+	assert.Equal(t, 0, d.CancelTimedOut(time.Now(), time.Minute))
+	assert.Equal(t, 0, len(pe.canceled))
+
+	assert.Equal(t, 1, d.CancelTimedOut(time.Now().Add(time.Minute), time.Minute))
+	assert.Equal(t, []Message{{Index: 2, Begin: 1 * blockSize, Length: blockSize}}, pe.canceled)
+	assert.Equal(t, 0, len(d.pending))
+	assert.Equal(t, 2, len(d.remaining))
+
+	// Canceled block is not requested again from the same peer.
+	d.RequestBlocks(3)
+	assert.Equal(t, []Message{
+		{Index: 2, Begin: 0 * blockSize, Length: blockSize},
+		{Index: 2, Begin: 1 * blockSize, Length: blockSize},
+		{Index: 2, Begin: 2 * blockSize, Length: blockSize},
+		{Index: 2, Begin: 3 * blockSize, Length: blockSize},
+	}, pe.requested)
+
+	// Reject for the canceled request is ignored.
+	assert.True(t, d.Rejected(1*blockSize, blockSize))
+	assert.Equal(t, 0, len(d.remaining))
+
+	// Canceled block is requested again after the peer starts sending blocks.
+	assert.Nil(t, d.GotBlock(2*blockSize, make([]byte, blockSize)))
+	d.Unsnubbed()
+	d.RequestBlocks(3)
+	assert.Equal(t, Message{Index: 2, Begin: 1 * blockSize, Length: blockSize}, pe.requested[len(pe.requested)-1])
+	assert.Equal(t, 5, len(pe.requested))
+}
+
+func TestPieceDownloaderBlockSize(t *testing.T) {
+	const size = 4 * blockSize
+	bp := bufferpool.New(3 * size)
+	pi := &piece.Piece{
+		Index:  3,
+		Length: 3 * size,
+		Data:   []filesection.FileSection{{Length: 3 * size}},
+	}
+	pe := &TestPeer{}
+	d := New(pi, pe, false, bp.Get(3*size), size)
+	d.RequestBlocks(10)
+	assert.Equal(t, []Message{
+		{Index: 3, Begin: 0 * size, Length: size},
+		{Index: 3, Begin: 1 * size, Length: size},
+		{Index: 3, Begin: 2 * size, Length: size},
+	}, pe.requested)
+	assert.Equal(t, ErrBlockInvalid, d.GotBlock(blockSize, make([]byte, blockSize)))
+	for i := uint32(0); i < 3; i++ {
+		assert.Nil(t, d.GotBlock(i*size, make([]byte, size)))
+	}
+	assert.True(t, d.Done())
+}
+
+func TestSetDownloaded(t *testing.T) {
+	bp := bufferpool.New(4 * blockSize)
+	pi := &piece.Piece{
+		Index:  4,
+		Length: 4 * blockSize,
+		Data:   []filesection.FileSection{{Length: 4 * blockSize}},
+	}
+	pe := &TestPeer{}
+	d := New(pi, pe, false, bp.Get(4*blockSize), blockSize)
+	d.SetDownloaded(1 * blockSize)
+	d.SetDownloaded(2 * blockSize)
+	assert.True(t, d.Downloaded(1*blockSize))
+	assert.False(t, d.Downloaded(0))
+	d.RequestBlocks(10)
+	assert.Equal(t, []Message{
+		{Index: 4, Begin: 0 * blockSize, Length: blockSize},
+		{Index: 4, Begin: 3 * blockSize, Length: blockSize},
+	}, pe.requested)
+	assert.Equal(t, 2, len(d.pending))
+	assert.Nil(t, d.GotBlock(0, make([]byte, blockSize)))
+	assert.False(t, d.Done())
+	assert.Nil(t, d.GotBlock(3*blockSize, make([]byte, blockSize)))
+	assert.True(t, d.Done())
+}
@@ -2,11 +2,12 @@ package piecepicker
 
 import (
 	"fmt"
+	"math/rand"
 	"sort"
 
 	"github.com/cenkalti/rain/internal/peer"
-	"github.com/cenkalti/rain/internal/sliceset"
 	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/sliceset"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
 )
@@ -17,13 +18,16 @@ These are the things to consider when selecting a piece for downloading:
 
   * Piece is done (hash checked and written to disk)
   * Piece is writing
+  * Piece is skipped (belongs only to files that are not wanted)
   * Peer has the piece
   * Peer is choking us
   * Piece is marked as allowed-fast
   * Piece is requested from another peers
   * Piece is reserved for downloading by a webseed source
-  * Is endgame mode activated (all pieces are requested)
+  * Is endgame mode activated (all pieces are requested or remaining pieces are less than threshold)
+  * Is random-first mode active (only a few pieces are downloaded)
   * Are there stalled peers (snubbed or choked in the middle of download)
+  * Is the limit of pieces in progress reached
 
 Do not forget to re-check these when making changes.
 
@@ -39,6 +43,16 @@ type PiecePicker struct {
 	maxDuplicateDownload int
 	available            uint32
 	endgame              bool
+	endgameThreshold     int
+	randomFirst          int
+	maxActivePieces      int
+	sequential           bool
+	priority             Range
+
+	// Counters that are updated on state changes, so they are not calculated by iterating over all pieces.
+	numDone      int // pieces that are downloaded
+	numWanted    int // pieces that are not downloaded and not skipped
+	numRequested int // pieces that are requested from at least one peer
 }
 
 type myPiece struct {
@@ -50,6 +64,9 @@ type myPiece struct {
 
 	// Downloading from webseed source or marked to be downloaded later.
 	RequestedWebseed *webseedsource.WebseedSource
+
+	// Skipped pieces are not downloaded because they contain no data of a wanted file.
+	Skipped bool
 }
 
 // RunningDownloads returns the number of pieces that are being downloaded actively.
@@ -66,7 +83,7 @@ func (p *myPiece) StalledDownloads() int {
 // AvailableForWebseed returns true if the piece can be downloaded from a webseed source.
 // If the piece is already requested from a peer, it does not become eligible for downloading from webseed until entering the endgame mode.
 func (p *myPiece) AvailableForWebseed(duplicate bool) bool {
-	if p.Done || p.Writing || p.RequestedWebseed != nil {
+	if p.Done || p.Writing || p.Skipped || p.RequestedWebseed != nil {
 		return false
 	}
 	if !duplicate {
@@ -83,9 +100,13 @@ func New(pieces []piece.Piece, maxDuplicateDownload int, webseedSources []*webse
 	}
 	sps := make([]*myPiece, len(ps))
 	sps2 := make([]*myPiece, len(ps))
+	var numDone int
 	for i := range sps {
 		sps[i] = &ps[i]
 		sps2[i] = &ps[i]
+		if ps[i].Done {
+			numDone++
+		}
 	}
 	return &PiecePicker{
 		pieces:               ps,
@@ -93,6 +114,8 @@ func New(pieces []piece.Piece, maxDuplicateDownload int, webseedSources []*webse
 		piecesByStalled:      sps2,
 		maxDuplicateDownload: maxDuplicateDownload,
 		webseedSources:       webseedSources,
+		numDone:              numDone,
+		numWanted:            len(ps) - numDone,
 	}
 }
 
@@ -136,6 +159,11 @@ func (p *PiecePicker) Available() uint32 {
 	return p.available
 }
 
+// Availability returns the number of peers that have the piece with the index.
+func (p *PiecePicker) Availability(i uint32) int {
+	return p.pieces[i].Having.Len()
+}
+
 // RequestedPeers returns the number of peers that the piece with the index is requested from.
 func (p *PiecePicker) RequestedPeers(i uint32) []*peer.Peer {
 	return p.pieces[i].Requested.Items
@@ -146,6 +174,80 @@ func (p *PiecePicker) RequestedWebseedSource(i uint32) *webseedsource.WebseedSou
 	return p.pieces[i].RequestedWebseed
 }
 
+// SetSkipped sets the skip status of the piece with the index.
+// Skipped pieces are not picked for downloading from peers or webseed sources.
+func (p *PiecePicker) SetSkipped(i uint32, value bool) {
+	mp := &p.pieces[i]
+	if mp.Skipped == value {
+		return
+	}
+	mp.Skipped = value
+	if mp.Done {
+		return
+	}
+	if value {
+		p.numWanted--
+	} else {
+		p.numWanted++
+	}
+}
+
+// HandleDone must be called to mark the piece with the index as downloaded.
+func (p *PiecePicker) HandleDone(i uint32) {
+	mp := &p.pieces[i]
+	if mp.Done {
+		return
+	}
+	mp.Done = true
+	p.numDone++
+	if !mp.Skipped {
+		p.numWanted--
+	}
+}
+
+// SetSequential sets the piece selection mode.
+// In sequential mode, pieces are picked in index order instead of rarest-first.
+func (p *PiecePicker) SetSequential(value bool) {
+	p.sequential = value
+}
+
+// SetRandomFirst sets the number of pieces that are picked randomly instead of rarest-first at the start of download.
+// Random pieces are completed faster because they are available from more peers, so there is something to upload early.
+// Zero disables picking random pieces. It has no effect in sequential mode.
+func (p *PiecePicker) SetRandomFirst(n int) {
+	p.randomFirst = n
+}
+
+// SetEndgameThreshold sets the number of remaining pieces that are not requested yet to activate endgame mode.
+// Zero means endgame mode is activated only after all pieces are requested.
+func (p *PiecePicker) SetEndgameThreshold(n int) {
+	p.endgameThreshold = n
+}
+
+// SetMaxActivePieces sets the max number of pieces that are requested from peers at the same time.
+// Each piece in progress holds a buffer of piece length in memory, so this limits the memory used for downloading by a torrent.
+// The piece that is being written to disk is not counted.
+// When the limit is reached, only pieces that are already in progress are picked, e.g. in endgame mode.
+// Zero means no limit.
+func (p *PiecePicker) SetMaxActivePieces(n int) {
+	p.maxActivePieces = n
+}
+
+// SetPriority sets the range of pieces that are picked before any other piece.
+// Priority pieces are downloaded even if they are skipped.
+// Setting an empty range clears the priority.
+func (p *PiecePicker) SetPriority(r Range) {
+	if r.End > uint32(len(p.pieces)) {
+		r.End = uint32(len(p.pieces))
+	}
+	p.priority = r
+}
+
+// Skipped returns the value previously set by SetSkipped.
+func (p *PiecePicker) Skipped(i uint32) bool {
+	return p.pieces[i].Skipped
+}
+
 // HandleHave must be called to set the availability of the piece at the peer.
 func (p *PiecePicker) HandleHave(pe *peer.Peer, i uint32) {
 	pe.Bitfield.Set(i)
@@ -165,6 +267,11 @@ func (p *PiecePicker) HandleSnubbed(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Add(pe)
 }
 
+// HandleUnsnubbed must be called when a snubbed peer starts sending blocks again.
+func (p *PiecePicker) HandleUnsnubbed(pe *peer.Peer, i uint32) {
+	p.pieces[i].Snubbed.Remove(pe)
+}
+
 // HandleChoke must be called to set choke status of the remote peer.
 func (p *PiecePicker) HandleChoke(pe *peer.Peer, i uint32) {
 	p.pieces[i].Snubbed.Remove(pe)
@@ -178,7 +285,9 @@ func (p *PiecePicker) HandleUnchoke(pe *peer.Peer, i uint32) {
 
 // HandleCancelDownload must be called to update indexes when a piece download is canceled from the peer.
 func (p *PiecePicker) HandleCancelDownload(pe *peer.Peer, i uint32) {
-	p.pieces[i].Requested.Remove(pe)
+	if p.pieces[i].Requested.Remove(pe) && p.pieces[i].Requested.Len() == 0 {
+		p.numRequested--
+	}
 	p.pieces[i].Snubbed.Remove(pe)
 }
 
@@ -210,8 +319,10 @@ func (p *PiecePicker) PickFor(pe *peer.Peer) (pp *piece.Piece, allowedFast bool)
 	if pi == nil {
 		return nil, false
 	}
-	pe.Snubbed = false
-	pi.Requested.Add(pe)
+	pe.SetSnubbed(false)
+	if pi.Requested.Add(pe) && pi.Requested.Len() == 1 {
+		p.numRequested++
+	}
 	return pi.Piece, allowedFast
 }
 
@@ -234,6 +345,16 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 		}
 		return nil, false
 	}
+	// Do not start a new piece if there are too many pieces in progress.
+	if p.activePiecesFull() {
+		if pe.PeerChoking {
+			return nil, false
+		}
+		if p.endgame {
+			return p.pickEndgame(pe), false
+		}
+		return p.pickStalled(pe), false
+	}
 	// Pick allowed fast piece
 	pi := p.pickAllowedFast(pe)
 	if pi != nil {
@@ -243,12 +364,30 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 	if pe.PeerChoking {
 		return nil, false
 	}
+	// Pick pieces in priority range
+	pi = p.pickPriority(pe)
+	if pi != nil {
+		return pi, false
+	}
 	// Short path for endgame mode.
 	if p.endgame {
 		return p.pickEndgame(pe), false
 	}
-	// Pieck rarest piece
-	pi = p.pickRarest(pe)
+	if p.endgameThreshold > 0 && p.numUnrequested() <= p.endgameThreshold {
+		p.endgame = true
+		return p.pickEndgame(pe), false
+	}
+	// Pick first missing piece in sequential mode, rarest piece otherwise.
+	if p.sequential {
+		pi = p.pickSequential(pe)
+	} else {
+		if p.randomFirst > 0 && p.numDone < p.randomFirst {
+			pi = p.pickRandom(pe)
+		}
+		if pi == nil {
+			pi = p.pickRarest(pe)
+		}
+	}
 	if pi != nil {
 		return pi, false
 	}
@@ -263,7 +402,7 @@ func (p *PiecePicker) findPiece(pe *peer.Peer) (mp *myPiece, allowedFast bool) {
 func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 	for _, pi := range pe.ReceivedAllowedFast.Items {
 		mp := &p.pieces[pi.Index]
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
 			continue
 		}
 		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
@@ -282,7 +421,7 @@ func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
 	var hasUnrequested bool
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
 			continue
 		}
 		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
@@ -299,14 +438,83 @@ func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
 	return picked
 }
 
+func (p *PiecePicker) pickRandom(pe *peer.Peer) *myPiece {
+	var candidates []*myPiece
+	for i := range p.pieces {
+		mp := &p.pieces[i]
+		if mp.Done || mp.Writing || mp.Skipped {
+			continue
+		}
+		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+			candidates = append(candidates, mp)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// numUnrequested returns the approximate number of missing pieces that are not requested from any peer.
+// The piece that is being written is counted as unrequested and skipped pieces that are requested in priority range are subtracted.
+func (p *PiecePicker) numUnrequested() int {
+	n := p.numWanted - p.numRequested
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func (p *PiecePicker) activePiecesFull() bool {
+	return p.maxActivePieces > 0 && p.numRequested >= p.maxActivePieces
+}
+
+func (p *PiecePicker) pickPriority(pe *peer.Peer) *myPiece {
+	for i := p.priority.Begin; i < p.priority.End; i++ {
+		mp := &p.pieces[i]
+		if mp.Done || mp.Writing {
+			continue
+		}
+		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+			return mp
+		}
+	}
+	return nil
+}
+
+func (p *PiecePicker) pickSequential(pe *peer.Peer) *myPiece {
+	var hasUnrequested bool
+	// Select unrequested piece with the lowest index
+	for i := range p.pieces {
+		mp := &p.pieces[i]
+		if mp.Done || mp.Writing || mp.Skipped {
+			continue
+		}
+		if mp.Requested.Len() == 0 && mp.Having.Has(pe) {
+			return mp
+		}
+		if mp.Requested.Len() == 0 {
+			hasUnrequested = true
+		}
+	}
+	if !hasUnrequested {
+		p.endgame = true
+	}
+	return nil
+}
+
 func (p *PiecePicker) pickEndgame(pe *peer.Peer) *myPiece {
 	// Sort by request count
 	sort.Slice(p.piecesByAvailability, func(i, j int) bool {
 		return p.piecesByAvailability[i].RunningDownloads() < p.piecesByAvailability[j].RunningDownloads()
 	})
+	full := p.activePiecesFull()
 	// Select unrequested piece
 	for _, mp := range p.piecesByAvailability {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
+			continue
+		}
+		if full && mp.Requested.Len() == 0 {
 			continue
 		}
 		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
@@ -321,14 +529,18 @@ func (p *PiecePicker) pickStalled(pe *peer.Peer) *myPiece {
 	sort.Slice(p.piecesByStalled, func(i, j int) bool {
 		return p.piecesByStalled[i].StalledDownloads() < p.piecesByStalled[j].StalledDownloads()
 	})
+	full := p.activePiecesFull()
 	// Select unrequested piece
 	for _, mp := range p.piecesByStalled {
-		if mp.Done || mp.Writing {
+		if mp.Done || mp.Writing || mp.Skipped {
 			continue
 		}
 		if mp.RunningDownloads() > 0 {
 			continue
 		}
+		if full && mp.Requested.Len() == 0 {
+			continue
+		}
 		if mp.Requested.Len() < p.maxDuplicateDownload && mp.Having.Has(pe) {
 			return mp
 		}
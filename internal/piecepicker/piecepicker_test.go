@@ -84,3 +84,167 @@ func (p *PiecePicker) pickFor(pe *peer.Peer) *piece.Piece {
 	pi, _ := p.PickFor(pe)
 	return pi
 }
+
+func TestPiecePickerSkipped(t *testing.T) {
+	// Two files: first file is in pieces [0, 4), second file is in pieces [3, 7).
+	// Second file is skipped. Piece 3 is shared by both files so it must be downloaded.
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pp := New(pieces, 2, nil)
+	for i := uint32(4); i < numPieces; i++ {
+		pp.SetSkipped(i, true)
+	}
+	pe := newPeer(0)
+	for i := uint32(0); i < numPieces; i++ {
+		pp.HandleHave(pe, i)
+	}
+	picked := make(map[uint32]struct{})
+	for {
+		pi := pp.pickFor(pe)
+		if pi == nil {
+			break
+		}
+		assert.Less(t, pi.Index, uint32(4))
+		if _, ok := picked[pi.Index]; ok {
+			break
+		}
+		picked[pi.Index] = struct{}{}
+		pp.HandleCancelDownload(pe, pi.Index)
+		pp.HandleDone(pi.Index)
+	}
+	assert.Len(t, picked, 4)
+}
+
+func TestPiecePickerSequential(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pp := New(pieces, 2, nil)
+	pp.SetSequential(true)
+	seeder := newPeer(0)
+	for i := uint32(0); i < numPieces; i++ {
+		pp.HandleHave(seeder, i)
+	}
+	for i := uint32(0); i < numPieces; i++ {
+		pi := pp.pickFor(seeder)
+		assert.Equal(t, &pieces[i], pi)
+		assert.False(t, pp.endgame)
+	}
+	// All pieces are requested. Next pick must activate endgame mode.
+	pp.pickFor(seeder)
+	assert.True(t, pp.endgame)
+}
+
+func TestPiecePickerRandomFirst(t *testing.T) {
+	// Piece 6 is the rarest one.
+	newPicker := func(randomFirst int, done ...int) (*PiecePicker, *peer.Peer) {
+		pieces := make([]piece.Piece, numPieces)
+		for i := range pieces {
+			pieces[i] = newPiece(i)
+		}
+		for _, i := range done {
+			pieces[i].Done = true
+		}
+		pp := New(pieces, 2, nil)
+		pp.SetRandomFirst(randomFirst)
+		seeder, other := newPeer(0), newPeer(1)
+		for i := uint32(0); i < numPieces; i++ {
+			pp.HandleHave(seeder, i)
+			if i != 6 {
+				pp.HandleHave(other, i)
+			}
+		}
+		return pp, seeder
+	}
+	pickedOther := false
+	for i := 0; i < 50; i++ {
+		pp, seeder := newPicker(0)
+		assert.Equal(t, uint32(6), pp.pickFor(seeder).Index)
+		pp, seeder = newPicker(4)
+		if pp.pickFor(seeder).Index != 6 {
+			pickedOther = true
+		}
+		// Rarest-first after random pieces are downloaded.
+		pp, seeder = newPicker(4, 0, 1, 2, 3)
+		assert.Equal(t, uint32(6), pp.pickFor(seeder).Index)
+	}
+	assert.True(t, pickedOther)
+}
+
+func TestPiecePickerEndgameThreshold(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pp := New(pieces, 2, nil)
+	pp.SetSequential(true)
+	pp.SetEndgameThreshold(2)
+	seeder := newPeer(0)
+	for i := uint32(0); i < numPieces; i++ {
+		pp.HandleHave(seeder, i)
+	}
+	for i := uint32(0); i < numPieces-2; i++ {
+		assert.Equal(t, &pieces[i], pp.pickFor(seeder))
+		assert.False(t, pp.endgame)
+	}
+	assert.NotNil(t, pp.pickFor(seeder))
+	assert.True(t, pp.endgame)
+}
+
+func TestPiecePickerMaxActivePieces(t *testing.T) {
+	const (
+		numPieces = 50
+		numPeers  = 20
+		maxActive = 4
+	)
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pp := New(pieces, 2, nil)
+	pp.SetMaxActivePieces(maxActive)
+	peers := make([]*peer.Peer, numPeers)
+	for i := range peers {
+		peers[i] = &peer.Peer{ID: [20]byte{byte(i)}, Bitfield: bitfield.New(numPieces)}
+		for j := uint32(0); j < numPieces; j++ {
+			pp.HandleHave(peers[i], j)
+		}
+	}
+	var reached bool
+	for done := 0; done < numPieces; done++ {
+		// Idle peers try to start a piece download.
+		for _, pe := range peers {
+			pi := pp.pickFor(pe)
+			if pi != nil {
+				pe.Downloading = true
+			}
+			n := pp.numRequested
+			assert.LessOrEqual(t, n, maxActive)
+			if n == maxActive {
+				reached = true
+			}
+		}
+		// Complete one of the active pieces.
+		var completed bool
+		for i := range pieces {
+			mp := &pp.pieces[i]
+			if mp.Done || mp.Requested.Len() == 0 {
+				continue
+			}
+			for _, pe := range append([]*peer.Peer(nil), pp.RequestedPeers(uint32(i))...) {
+				pp.HandleCancelDownload(pe, uint32(i))
+				pe.Downloading = false
+			}
+			pp.HandleDone(uint32(i))
+			completed = true
+			break
+		}
+		if !completed {
+			t.Fatal("no active piece")
+		}
+	}
+	assert.True(t, reached)
+}
@@ -2,6 +2,9 @@ package piecewriter
 
 import (
 	"crypto/sha1"
+	"errors"
+	"syscall"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/piece"
@@ -9,11 +12,20 @@ import (
 	"github.com/rcrowley/go-metrics"
 )
 
+const (
+	// Number of times a write is retried after a transient error.
+	maxWriteRetries = 3
+	// Time to wait before retrying a write. Doubles after each retry.
+	writeRetryDelay = 100 * time.Millisecond
+)
+
 // PieceWriter writes the data in the buffer to disk.
 type PieceWriter struct {
 	Piece  *piece.Piece
 	Source interface{}
 	Buffer bufferpool.Buffer
+	// Restored is true if some of the data is loaded from disk instead of being received from Source.
+	Restored bool
 
 	HashOK bool
 	Error  error
@@ -29,13 +41,14 @@ func New(p *piece.Piece, source interface{}, buf bufferpool.Buffer) *PieceWriter
 }
 
 // Run checks the hash, then writes the data in the buffer to the disk.
+// Writes failing with a transient error are retried a few times before the error is returned.
 func (w *PieceWriter) Run(resultC chan *PieceWriter, closeC chan struct{}, writesPerSecond, writeBytesPerSecond metrics.Meter, sem *semaphore.Semaphore) {
 	w.HashOK = w.Piece.VerifyHash(w.Buffer.Data, sha1.New())
 	if w.HashOK {
 		writesPerSecond.Mark(1)
 		writeBytesPerSecond.Mark(int64(len(w.Buffer.Data)))
 		sem.Wait()
-		_, w.Error = w.Piece.Data.Write(w.Buffer.Data)
+		w.Error = w.write(closeC)
 		sem.Signal()
 	}
 	select {
@@ -43,3 +56,24 @@ func (w *PieceWriter) Run(resultC chan *PieceWriter, closeC chan struct{}, write
 	case <-closeC:
 	}
 }
+
+func (w *PieceWriter) write(closeC chan struct{}) error {
+	delay := writeRetryDelay
+	for i := 0; ; i++ {
+		_, err := w.Piece.Data.Write(w.Buffer.Data)
+		if err == nil || i == maxWriteRetries || !isTransient(err) {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-closeC:
+			return err
+		}
+	}
+}
+
+// isTransient returns true if the write may succeed when it is tried again.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY)
+}
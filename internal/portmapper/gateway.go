@@ -0,0 +1,57 @@
+package portmapper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateway returns the IP address of the default gateway.
+// It reads the routing table on Linux, otherwise it assumes the gateway is the first address in local network.
+func defaultGateway() (net.IP, error) {
+	if ip, err := gatewayFromProc("/proc/net/route"); err == nil {
+		return ip, nil
+	}
+	conn, err := net.Dial("udp4", "8.8.8.8:53")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP.To4()
+	if ip == nil {
+		return nil, errors.New("cannot determine gateway")
+	}
+	return net.IPv4(ip[0], ip[1], ip[2], 1), nil
+}
+
+func gatewayFromProc(name string) (net.IP, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Iface Destination Gateway Flags ...
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		// Values are in host byte order which is little endian on common platforms.
+		var ip [4]byte
+		binary.LittleEndian.PutUint32(ip[:], binary.BigEndian.Uint32(b))
+		return net.IPv4(ip[0], ip[1], ip[2], ip[3]), nil
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("default route not found")
+}
@@ -0,0 +1,141 @@
+package portmapper
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// http://tools.ietf.org/html/rfc6886
+
+const (
+	natpmpPort           = 5351
+	natpmpInitialTimeout = 250 * time.Millisecond
+	natpmpMaxTries       = 5
+
+	natpmpOpExternalAddress = 0
+	natpmpOpMapTCP          = 2
+)
+
+// natpmp implements NAT Port Mapping Protocol.
+type natpmp struct {
+	// Address of the NAT-PMP server.
+	gateway *net.UDPAddr
+}
+
+func newNATPMP(gateway *net.UDPAddr) *natpmp {
+	return &natpmp{gateway: gateway}
+}
+
+func newNATPMPFromGateway() *natpmp {
+	return &natpmp{}
+}
+
+func (n *natpmp) String() string { return "NAT-PMP" }
+
+func (n *natpmp) Map(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (net.IP, int, error) {
+	ip, err := n.externalAddress(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	port, err := n.mapPort(ctx, internalPort, externalPort, lifetime)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ip, port, nil
+}
+
+func (n *natpmp) Unmap(ctx context.Context, internalPort, externalPort int) error {
+	_, err := n.mapPort(ctx, internalPort, 0, 0)
+	return err
+}
+
+func (n *natpmp) externalAddress(ctx context.Context) (net.IP, error) {
+	resp, err := n.request(ctx, []byte{0, natpmpOpExternalAddress}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+func (n *natpmp) mapPort(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	req := make([]byte, 12)
+	req[1] = natpmpOpMapTCP
+	binary.BigEndian.PutUint16(req[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime/time.Second))
+	resp, err := n.request(ctx, req, 16)
+	if err != nil {
+		return 0, err
+	}
+	if int(binary.BigEndian.Uint16(resp[8:10])) != internalPort {
+		return 0, errors.New("internal port mismatch in response")
+	}
+	return int(binary.BigEndian.Uint16(resp[10:12])), nil
+}
+
+// request sends the message to the gateway and waits for a response with the expected size.
+// Requests are retransmitted with doubling timeouts.
+func (n *natpmp) request(ctx context.Context, msg []byte, size int) ([]byte, error) {
+	gateway := n.gateway
+	if gateway == nil {
+		ip, err := defaultGateway()
+		if err != nil {
+			return nil, err
+		}
+		gateway = &net.UDPAddr{IP: ip, Port: natpmpPort}
+	}
+	conn, err := net.DialUDP("udp4", nil, gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now()) // nolint: errcheck
+		case <-done:
+		}
+	}()
+
+	expectedOp := msg[1] + 128
+	buf := make([]byte, 16)
+	timeout := natpmpInitialTimeout
+	for i := 0; i < natpmpMaxTries; i++ {
+		_, err = conn.Write(msg)
+		if err != nil {
+			return nil, err
+		}
+		err = conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return nil, err
+		}
+		timeout *= 2
+		for {
+			var m int
+			m, err = conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if m < size || buf[0] != 0 || buf[1] != expectedOp {
+				continue
+			}
+			if code := binary.BigEndian.Uint16(buf[2:4]); code != 0 {
+				return nil, fmt.Errorf("nat-pmp result code: %d", code)
+			}
+			return buf[:size], nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			return nil, err
+		}
+	}
+	return nil, errors.New("nat-pmp request timed out")
+}
@@ -0,0 +1,140 @@
+package portmapper
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type natpmpMapRequest struct {
+	InternalPort uint16
+	ExternalPort uint16
+	Lifetime     uint32
+}
+
+// startNATPMPServer starts a NAT-PMP server that maps internal ports to the same external port.
+// Received map requests are sent to requestC.
+func startNATPMPServer(t *testing.T, externalIP net.IP, requestC chan natpmpMapRequest) (*net.UDPAddr, func()) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < 2 || buf[0] != 0 {
+				continue
+			}
+			var resp []byte
+			switch buf[1] {
+			case natpmpOpExternalAddress:
+				resp = make([]byte, 12)
+				resp[1] = 128 + natpmpOpExternalAddress
+				copy(resp[8:12], externalIP.To4())
+			case natpmpOpMapTCP:
+				if n < 12 {
+					continue
+				}
+				req := natpmpMapRequest{
+					InternalPort: binary.BigEndian.Uint16(buf[4:6]),
+					ExternalPort: binary.BigEndian.Uint16(buf[6:8]),
+					Lifetime:     binary.BigEndian.Uint32(buf[8:12]),
+				}
+				requestC <- req
+				resp = make([]byte, 16)
+				resp[1] = 128 + natpmpOpMapTCP
+				binary.BigEndian.PutUint16(resp[8:10], req.InternalPort)
+				binary.BigEndian.PutUint16(resp[10:12], req.InternalPort+1)
+				binary.BigEndian.PutUint32(resp[12:16], req.Lifetime)
+			default:
+				continue
+			}
+			_, _ = conn.WriteToUDP(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr), func() { conn.Close() }
+}
+
+func TestPortMapperNATPMP(t *testing.T) {
+	requestC := make(chan natpmpMapRequest, 10)
+	externalIP := net.IPv4(1, 2, 3, 4)
+	addr, stop := startNATPMPServer(t, externalIP, requestC)
+	defer stop()
+
+	m := New(5000, time.Hour, logger.New("test"))
+	m.protocols = []protocol{newNATPMP(addr)}
+	m.Start()
+
+	select {
+	case req := <-requestC:
+		assert.Equal(t, natpmpMapRequest{InternalPort: 5000, ExternalPort: 5000, Lifetime: 3600}, req)
+	case <-time.After(5 * time.Second):
+		t.Fatal("map request not received")
+	}
+	// Wait until run loop sets the external address.
+	for i := 0; i < 100; i++ {
+		if _, port := m.ExternalAddr(); port != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ip, port := m.ExternalAddr()
+	assert.True(t, externalIP.Equal(ip))
+	assert.Equal(t, 5001, port)
+
+	m.Close()
+	select {
+	case req := <-requestC:
+		assert.Equal(t, natpmpMapRequest{InternalPort: 5000, ExternalPort: 0, Lifetime: 0}, req)
+	case <-time.After(5 * time.Second):
+		t.Fatal("unmap request not received")
+	}
+	<-m.doneC
+}
+
+func TestNATPMPNoServer(t *testing.T) {
+	// Nothing is listening at this address.
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	conn.Close()
+
+	m := New(5000, time.Hour, logger.New("test"))
+	m.protocols = []protocol{newNATPMP(addr)}
+	m.Start()
+	m.Close()
+	<-m.doneC
+	// Torrents may close the same mapper again if they are stopped after a failed start.
+	m.Close()
+	ip, port := m.ExternalAddr()
+	assert.Nil(t, ip)
+	assert.Equal(t, 0, port)
+}
+
+func TestGatewayFromProc(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "route")
+	data := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t0000A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+		"eth0\t00000000\t0100A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"
+	err := os.WriteFile(name, []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := gatewayFromProc(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "192.168.0.1", ip.String())
+}
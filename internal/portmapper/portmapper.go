@@ -0,0 +1,133 @@
+// Package portmapper maps a port on the NAT device to a local port with NAT-PMP or UPnP IGD protocols.
+package portmapper
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+// Time to wait for removing the mapping when the PortMapper is closed.
+const deleteTimeout = 5 * time.Second
+
+// protocol maps a port with a specific method.
+type protocol interface {
+	// Map the external port to internal port. Returns the external address that can be used for connecting to the local port.
+	Map(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (ip net.IP, port int, err error)
+	// Unmap deletes the mapping that is done by Map.
+	Unmap(ctx context.Context, internalPort, externalPort int) error
+	String() string
+}
+
+// PortMapper keeps a TCP port mapped on the NAT device to a local port.
+// NAT-PMP is tried first, UPnP IGD is used if NAT-PMP fails.
+// Errors are logged and the mapping is retried at next renewal.
+type PortMapper struct {
+	port     int
+	lifetime time.Duration
+	log      logger.Logger
+
+	// Protocols to try in order.
+	protocols []protocol
+
+	m            sync.Mutex
+	externalIP   net.IP
+	externalPort int
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+	doneC     chan struct{}
+}
+
+// New returns a new PortMapper for the local TCP port.
+// Mapping is renewed at the half of lifetime.
+func New(port int, lifetime time.Duration, l logger.Logger) *PortMapper {
+	return &PortMapper{
+		port:      port,
+		lifetime:  lifetime,
+		log:       l,
+		protocols: []protocol{newNATPMPFromGateway(), newUPnP()},
+		closeC:    make(chan struct{}),
+		doneC:     make(chan struct{}),
+	}
+}
+
+// Start mapping the port in a new goroutine.
+func (m *PortMapper) Start() {
+	go m.run()
+}
+
+// Close stops renewing the mapping. The mapping is removed with a new goroutine, Close does not wait for it.
+// It is safe to call Close multiple times.
+func (m *PortMapper) Close() {
+	m.closeOnce.Do(func() { close(m.closeC) })
+}
+
+// ExternalAddr returns the address that can be used to connect to the local port from outside.
+// Returns nil IP and zero port if the port is not mapped yet.
+func (m *PortMapper) ExternalAddr() (net.IP, int) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.externalIP, m.externalPort
+}
+
+func (m *PortMapper) run() {
+	defer close(m.doneC)
+	var mapped protocol
+	externalPort := m.port
+	for {
+		mapped, externalPort = m.tryMap(mapped, externalPort)
+		select {
+		case <-time.After(m.lifetime / 2):
+		case <-m.closeC:
+			if mapped != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+				err := mapped.Unmap(ctx, m.port, externalPort)
+				cancel()
+				if err != nil {
+					m.log.Debugf("cannot remove port mapping with %s: %s", mapped, err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// tryMap tries the protocols in order until the port is mapped.
+// The protocol that is used for the previous mapping is tried first.
+// Returns the successful protocol and the external port. Returned protocol is nil if all of them fail.
+func (m *PortMapper) tryMap(last protocol, externalPort int) (protocol, int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-m.closeC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	protocols := m.protocols
+	if last != nil {
+		protocols = append([]protocol{last}, protocols...)
+	}
+	for _, p := range protocols {
+		ip, port, err := p.Map(ctx, m.port, externalPort, m.lifetime)
+		if err != nil {
+			m.log.Debugf("cannot map port %d with %s: %s", m.port, p, err)
+			continue
+		}
+		m.log.Infof("mapped external port %s:%d to local port %d with %s", ip, port, m.port, p)
+		m.m.Lock()
+		m.externalIP, m.externalPort = ip, port
+		m.m.Unlock()
+		return p, port
+	}
+	m.log.Warningf("cannot map port %d", m.port)
+	m.m.Lock()
+	m.externalIP, m.externalPort = nil, 0
+	m.m.Unlock()
+	return nil, externalPort
+}
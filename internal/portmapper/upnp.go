@@ -0,0 +1,267 @@
+package portmapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpAddr    = "239.255.255.250:1900"
+	ssdpTimeout = 2 * time.Second
+
+	// Maximum size of responses read from the device.
+	upnpMaxResponseSize = 1 << 20
+)
+
+var ssdpSearchTargets = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+}
+
+// upnp implements port mapping with UPnP Internet Gateway Device protocol.
+type upnp struct {
+	client http.Client
+
+	// Set after the device is discovered.
+	controlURL  string
+	serviceType string
+	localIP     net.IP
+}
+
+func newUPnP() *upnp {
+	return &upnp{}
+}
+
+func (u *upnp) String() string { return "UPnP" }
+
+func (u *upnp) Map(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (net.IP, int, error) {
+	if u.controlURL == "" {
+		err := u.discover(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	args := []soapArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", "TCP"},
+		{"NewInternalPort", strconv.Itoa(internalPort)},
+		{"NewInternalClient", u.localIP.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "rain"},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	}
+	_, err := u.soapRequest(ctx, "AddPortMapping", args)
+	if err != nil {
+		// Device may have been changed. Discover again at next try.
+		u.controlURL = ""
+		return nil, 0, err
+	}
+	body, err := u.soapRequest(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	err = xml.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := net.ParseIP(resp.IP)
+	if ip == nil {
+		return nil, 0, errors.New("invalid external ip address")
+	}
+	return ip, externalPort, nil
+}
+
+func (u *upnp) Unmap(ctx context.Context, internalPort, externalPort int) error {
+	if u.controlURL == "" {
+		return nil
+	}
+	args := []soapArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", "TCP"},
+	}
+	_, err := u.soapRequest(ctx, "DeletePortMapping", args)
+	return err
+}
+
+// discover finds the gateway device with SSDP and reads its control URL from device description.
+func (u *upnp) discover(ctx context.Context) error {
+	location, err := ssdpSearch(ctx)
+	if err != nil {
+		return err
+	}
+	controlURL, serviceType, err := u.readDescription(ctx, location)
+	if err != nil {
+		return err
+	}
+	lu, err := url.Parse(controlURL)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("udp", lu.Host)
+	if err != nil {
+		return err
+	}
+	u.localIP = conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+	u.controlURL, u.serviceType = controlURL, serviceType
+	return nil
+}
+
+func ssdpSearch(ctx context.Context) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	for _, st := range ssdpSearchTargets {
+		msg := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddr + "\r\n" +
+			"ST: " + st + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n\r\n"
+		_, err = conn.WriteToUDP([]byte(msg), addr)
+		if err != nil {
+			return "", err
+		}
+	}
+	deadline := time.Now().Add(ssdpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return "", fmt.Errorf("gateway device not found: %w", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+func (d *upnpDevice) findService() *upnpService {
+	for i, s := range d.Services {
+		if strings.Contains(s.ServiceType, ":WANIPConnection:") || strings.Contains(s.ServiceType, ":WANPPPConnection:") {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		if s := d.Devices[i].findService(); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+func (u *upnp) readDescription(ctx context.Context, location string) (controlURL, serviceType string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	err = xml.NewDecoder(io.LimitReader(resp.Body, upnpMaxResponseSize)).Decode(&root)
+	if err != nil {
+		return "", "", err
+	}
+	s := root.Device.findService()
+	if s == nil {
+		return "", "", errors.New("no WAN connection service in device")
+	}
+	base := location
+	if root.URLBase != "" {
+		base = root.URLBase
+	}
+	bu, err := url.Parse(base)
+	if err != nil {
+		return "", "", err
+	}
+	cu, err := bu.Parse(s.ControlURL)
+	if err != nil {
+		return "", "", err
+	}
+	return cu.String(), s.ServiceType, nil
+}
+
+type soapArg struct {
+	Name  string
+	Value string
+}
+
+func (u *upnp) soapRequest(ctx context.Context, action string, args []soapArg) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?>`)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	b.WriteString(`<u:` + action + ` xmlns:u="` + u.serviceType + `">`)
+	for _, a := range args {
+		b.WriteString("<" + a.Name + ">")
+		_ = xml.EscapeText(&b, []byte(a.Value))
+		b.WriteString("</" + a.Name + ">")
+	}
+	b.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.controlURL, &b)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+u.serviceType+"#"+action+`"`)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, upnpMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upnp %s: http status %d", action, resp.StatusCode)
+	}
+	return body, nil
+}
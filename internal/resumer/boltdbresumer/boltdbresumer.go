@@ -33,7 +33,14 @@ var Keys = struct {
 	Started           []byte
 	StopAfterDownload []byte
 	StopAfterMetadata []byte
+	Sequential        []byte
+	Paused            []byte
+	StopAtRatio       []byte
+	StopAtUploadBytes []byte
+	SeedDuration      []byte
 	CompleteCmdRun    []byte
+	FilePriorities    []byte
+	PartialPieces     []byte
 	Version           []byte
 }{
 	InfoHash:          []byte("info_hash"),
@@ -53,7 +60,14 @@ var Keys = struct {
 	Started:           []byte("started"),
 	StopAfterDownload: []byte("stop_after_download"),
 	StopAfterMetadata: []byte("stop_after_metadata"),
+	Sequential:        []byte("sequential"),
+	Paused:            []byte("paused"),
+	StopAtRatio:       []byte("stop_at_ratio"),
+	StopAtUploadBytes: []byte("stop_at_upload_bytes"),
+	SeedDuration:      []byte("seed_duration"),
 	CompleteCmdRun:    []byte("complete_cmd_run"),
+	FilePriorities:    []byte("file_priorities"),
+	PartialPieces:     []byte("partial_pieces"),
 	Version:           []byte("version"),
 }
 
@@ -93,6 +107,14 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 	if err != nil {
 		return err
 	}
+	filePriorities, err := json.Marshal(spec.FilePriorities)
+	if err != nil {
+		return err
+	}
+	partialPieces, err := json.Marshal(spec.PartialPieces)
+	if err != nil {
+		return err
+	}
 	version := LatestVersion
 	if spec.Version != 0 {
 		version = spec.Version
@@ -108,6 +130,7 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.Trackers, trackers)
 		_ = b.Put(Keys.URLList, urlList)
 		_ = b.Put(Keys.FixedPeers, fixedPeers)
+		_ = b.Put(Keys.Dest, []byte(spec.Dest))
 		_ = b.Put(Keys.Info, spec.Info)
 		_ = b.Put(Keys.Bitfield, spec.Bitfield)
 		_ = b.Put(Keys.AddedAt, []byte(spec.AddedAt.Format(time.RFC3339)))
@@ -118,7 +141,14 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.Started, []byte(strconv.FormatBool(spec.Started)))
 		_ = b.Put(Keys.StopAfterDownload, []byte(strconv.FormatBool(spec.StopAfterDownload)))
 		_ = b.Put(Keys.StopAfterMetadata, []byte(strconv.FormatBool(spec.StopAfterMetadata)))
+		_ = b.Put(Keys.Sequential, []byte(strconv.FormatBool(spec.Sequential)))
+		_ = b.Put(Keys.Paused, []byte(strconv.FormatBool(spec.Paused)))
+		_ = b.Put(Keys.StopAtRatio, []byte(strconv.FormatFloat(spec.StopAtRatio, 'g', -1, 64)))
+		_ = b.Put(Keys.StopAtUploadBytes, []byte(strconv.FormatInt(spec.StopAtUploadBytes, 10)))
+		_ = b.Put(Keys.SeedDuration, []byte(spec.SeedDuration.String()))
 		_ = b.Put(Keys.CompleteCmdRun, []byte(strconv.FormatBool(spec.CompleteCmdRun)))
+		_ = b.Put(Keys.FilePriorities, filePriorities)
+		_ = b.Put(Keys.PartialPieces, partialPieces)
 		_ = b.Put(Keys.Version, []byte(strconv.Itoa(version)))
 		return nil
 	})
@@ -146,6 +176,17 @@ func (r *Resumer) WriteBitfield(torrentID string, value []byte) error {
 	})
 }
 
+// WriteDest writes the directory that the files of a torrent are moved into.
+func (r *Resumer) WriteDest(torrentID string, value string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Dest, []byte(value))
+	})
+}
+
 // WriteStarted writes the start status of a torrent.
 func (r *Resumer) WriteStarted(torrentID string, value bool) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
@@ -157,6 +198,17 @@ func (r *Resumer) WriteStarted(torrentID string, value bool) error {
 	})
 }
 
+// WritePaused writes the pause status of a torrent.
+func (r *Resumer) WritePaused(torrentID string, value bool) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Paused, []byte(strconv.FormatBool(value)))
+	})
+}
+
 // HandleStopAfterDownload clears the start status and stop_after_download fields.
 func (r *Resumer) HandleStopAfterDownload(torrentID string) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
@@ -172,6 +224,29 @@ func (r *Resumer) HandleStopAfterDownload(torrentID string) error {
 	})
 }
 
+// HandleStopAtLimit clears the start status, stop_at_ratio, stop_at_upload_bytes and seed_duration fields.
+func (r *Resumer) HandleStopAtLimit(torrentID string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		err := b.Put(Keys.Started, []byte(strconv.FormatBool(false)))
+		if err != nil {
+			return err
+		}
+		err = b.Put(Keys.StopAtRatio, []byte(strconv.FormatFloat(0, 'g', -1, 64)))
+		if err != nil {
+			return err
+		}
+		err = b.Put(Keys.StopAtUploadBytes, []byte(strconv.FormatInt(0, 10)))
+		if err != nil {
+			return err
+		}
+		return b.Put(Keys.SeedDuration, []byte(time.Duration(0).String()))
+	})
+}
+
 // HandleStopAfterMetadata clears the start status and stop_after_metadata fields.
 func (r *Resumer) HandleStopAfterMetadata(torrentID string) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
@@ -198,6 +273,36 @@ func (r *Resumer) WriteCompleteCmdRun(torrentID string) error {
 	})
 }
 
+// WriteFilePriorities writes the download priorities of files in a torrent.
+func (r *Resumer) WriteFilePriorities(torrentID string, value []int) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		bu := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if bu == nil {
+			return nil
+		}
+		return bu.Put(Keys.FilePriorities, b)
+	})
+}
+
+// WritePartialPieces writes the blocks of incomplete pieces that are saved to disk.
+func (r *Resumer) WritePartialPieces(torrentID string, value []PartialPiece) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		bu := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if bu == nil {
+			return nil
+		}
+		return bu.Put(Keys.PartialPieces, b)
+	})
+}
+
 func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
 	defer func() {
@@ -275,6 +380,11 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.Dest)
+		if value != nil {
+			spec.Dest = string(value)
+		}
+
 		value = b.Get(Keys.Info)
 		if value != nil {
 			spec.Info = make([]byte, len(value))
@@ -351,6 +461,46 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.Sequential)
+		if value != nil {
+			spec.Sequential, err = strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Paused)
+		if value != nil {
+			spec.Paused, err = strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.StopAtRatio)
+		if value != nil {
+			spec.StopAtRatio, err = strconv.ParseFloat(string(value), 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.StopAtUploadBytes)
+		if value != nil {
+			spec.StopAtUploadBytes, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.SeedDuration)
+		if value != nil {
+			spec.SeedDuration, err = time.ParseDuration(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
 		value = b.Get(Keys.CompleteCmdRun)
 		if value != nil {
 			spec.CompleteCmdRun, err = strconv.ParseBool(string(value))
@@ -359,6 +509,22 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.FilePriorities)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.FilePriorities)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.PartialPieces)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.PartialPieces)
+			if err != nil {
+				return err
+			}
+		}
+
 		value = b.Get(Keys.Version)
 		if value != nil {
 			spec.Version, err = strconv.Atoi(string(value))
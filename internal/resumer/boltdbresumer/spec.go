@@ -14,6 +14,7 @@ type Spec struct {
 	Trackers          [][]string
 	URLList           []string
 	FixedPeers        []string
+	Dest              string
 	Info              []byte
 	Bitfield          []byte
 	AddedAt           time.Time
@@ -24,16 +25,33 @@ type Spec struct {
 	Started           bool
 	StopAfterDownload bool
 	StopAfterMetadata bool
+	Sequential        bool
+	Paused            bool
+	StopAtRatio       float64
+	StopAtUploadBytes int64
+	SeedDuration      time.Duration
 	CompleteCmdRun    bool
+	FilePriorities    []int
+	PartialPieces     []PartialPiece
 	Version           int
 }
 
+// PartialPiece contains the blocks of an incomplete piece that are written to disk.
+type PartialPiece struct {
+	Index     uint32
+	BlockSize uint32
+	// Blocks is a bitfield of the blocks in the piece that are written.
+	// Blocks are counted in the order they are requested from peers, parts belonging to padding files are not included.
+	Blocks []byte
+}
+
 type jsonSpec struct {
 	Port              int
 	Name              string
 	Trackers          [][]string
 	URLList           []string
 	FixedPeers        []string
+	Dest              string
 	AddedAt           time.Time
 	BytesDownloaded   int64
 	BytesUploaded     int64
@@ -41,14 +59,21 @@ type jsonSpec struct {
 	Started           bool
 	StopAfterDownload bool
 	StopAfterMetadata bool
+	Sequential        bool
+	Paused            bool
+	StopAtRatio       float64
+	StopAtUploadBytes int64
 	CompleteCmdRun    bool
+	FilePriorities    []int
+	PartialPieces     []PartialPiece
 	Version           int
 
 	// JSON unsafe types
-	InfoHash  string
-	Info      string
-	Bitfield  string
-	SeededFor int64
+	InfoHash     string
+	Info         string
+	Bitfield     string
+	SeededFor    int64
+	SeedDuration int64
 }
 
 // MarshalJSON converts the Spec to a JSON string.
@@ -59,6 +84,7 @@ func (s Spec) MarshalJSON() ([]byte, error) {
 		Trackers:          s.Trackers,
 		URLList:           s.URLList,
 		FixedPeers:        s.FixedPeers,
+		Dest:              s.Dest,
 		AddedAt:           s.AddedAt,
 		BytesDownloaded:   s.BytesDownloaded,
 		BytesUploaded:     s.BytesUploaded,
@@ -66,13 +92,20 @@ func (s Spec) MarshalJSON() ([]byte, error) {
 		Started:           s.Started,
 		StopAfterDownload: s.StopAfterDownload,
 		StopAfterMetadata: s.StopAfterMetadata,
+		Sequential:        s.Sequential,
+		Paused:            s.Paused,
+		StopAtRatio:       s.StopAtRatio,
+		StopAtUploadBytes: s.StopAtUploadBytes,
 		CompleteCmdRun:    s.CompleteCmdRun,
+		FilePriorities:    s.FilePriorities,
+		PartialPieces:     s.PartialPieces,
 		Version:           s.Version,
 
-		InfoHash:  base64.StdEncoding.EncodeToString(s.InfoHash),
-		Info:      base64.StdEncoding.EncodeToString(s.Info),
-		Bitfield:  base64.StdEncoding.EncodeToString(s.Bitfield),
-		SeededFor: int64(s.SeededFor),
+		InfoHash:     base64.StdEncoding.EncodeToString(s.InfoHash),
+		Info:         base64.StdEncoding.EncodeToString(s.Info),
+		Bitfield:     base64.StdEncoding.EncodeToString(s.Bitfield),
+		SeededFor:    int64(s.SeededFor),
+		SeedDuration: int64(s.SeedDuration),
 	}
 	return json.Marshal(j)
 }
@@ -97,11 +130,13 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	s.SeededFor = time.Duration(j.SeededFor)
+	s.SeedDuration = time.Duration(j.SeedDuration)
 	s.Port = j.Port
 	s.Name = j.Name
 	s.Trackers = j.Trackers
 	s.URLList = j.URLList
 	s.FixedPeers = j.FixedPeers
+	s.Dest = j.Dest
 	s.AddedAt = j.AddedAt
 	s.BytesDownloaded = j.BytesDownloaded
 	s.BytesUploaded = j.BytesUploaded
@@ -109,7 +144,13 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	s.Started = j.Started
 	s.StopAfterDownload = j.StopAfterDownload
 	s.StopAfterMetadata = j.StopAfterMetadata
+	s.Sequential = j.Sequential
+	s.Paused = j.Paused
+	s.StopAtRatio = j.StopAtRatio
+	s.StopAtUploadBytes = j.StopAtUploadBytes
 	s.CompleteCmdRun = j.CompleteCmdRun
+	s.FilePriorities = j.FilePriorities
+	s.PartialPieces = j.PartialPieces
 	s.Version = j.Version
 	return nil
 }
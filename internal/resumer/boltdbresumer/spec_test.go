@@ -7,8 +7,12 @@ import (
 
 func TestMarshalUnmarshalSpec(t *testing.T) {
 	s := Spec{
-		Info: []byte{1, 2, 3},
-		Name: "foo",
+		Info:              []byte{1, 2, 3},
+		Name:              "foo",
+		Dest:              "/tmp/complete",
+		StopAtRatio:       1.5,
+		StopAtUploadBytes: 1000,
+		PartialPieces:     []PartialPiece{{Index: 3, BlockSize: 16384, Blocks: []byte{0xa0}}},
 	}
 	b, err := s.MarshalJSON()
 	if err != nil {
@@ -22,7 +26,13 @@ func TestMarshalUnmarshalSpec(t *testing.T) {
 	if !bytes.Equal(s.Info, s2.Info) {
 		t.FailNow()
 	}
-	if s.Name != s2.Name {
+	if s.Name != s2.Name || s.Dest != s2.Dest {
+		t.FailNow()
+	}
+	if s.StopAtRatio != s2.StopAtRatio || s.StopAtUploadBytes != s2.StopAtUploadBytes {
+		t.FailNow()
+	}
+	if len(s2.PartialPieces) != 1 || s2.PartialPieces[0].Index != 3 || !bytes.Equal(s2.PartialPieces[0].Blocks, []byte{0xa0}) {
 		t.FailNow()
 	}
 }
@@ -42,6 +42,7 @@ type Tracker struct {
 	Status        string
 	Leechers      int
 	Seeders       int
+	Peers         int
 	Warning       string
 	Error         string
 	ErrorUnknown  bool
@@ -124,6 +125,7 @@ type Stats struct {
 		Tracker int
 		DHT     int
 		PEX     int
+		LSD     int
 	}
 	Downloads struct {
 		Total   int
@@ -291,6 +293,24 @@ type StopTorrentRequest struct {
 type StopTorrentResponse struct {
 }
 
+// PauseTorrentRequest contains request arguments for Session.PauseTorrent method.
+type PauseTorrentRequest struct {
+	ID string
+}
+
+// PauseTorrentResponse contains response arguments for Session.PauseTorrent method.
+type PauseTorrentResponse struct {
+}
+
+// ResumeTorrentRequest contains request arguments for Session.ResumeTorrent method.
+type ResumeTorrentRequest struct {
+	ID string
+}
+
+// ResumeTorrentResponse contains response arguments for Session.ResumeTorrent method.
+type ResumeTorrentResponse struct {
+}
+
 // AnnounceTorrentRequest contains request arguments for Session.AnnounceTorrent method.
 type AnnounceTorrentRequest struct {
 	ID string
@@ -0,0 +1,60 @@
+// Package speedlimit provides a rate limiter for transferred bytes whose rate can be changed while it is in use.
+package speedlimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// Limiter is a token bucket with a capacity of one second of transfer. It is safe for concurrent use.
+type Limiter struct {
+	m      sync.Mutex
+	rate   int64
+	bucket *ratelimit.Bucket
+}
+
+// New returns a new Limiter with the rate in bytes per second. Zero rate means unlimited.
+func New(rate int64) *Limiter {
+	l := new(Limiter)
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate in bytes per second. Zero rate means unlimited.
+// Waits returned from previous Take calls are not changed, so ongoing transfers are not interrupted.
+func (l *Limiter) SetRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	if rate == l.rate {
+		return
+	}
+	l.rate = rate
+	if rate == 0 {
+		l.bucket = nil
+		return
+	}
+	l.bucket = ratelimit.NewBucketWithRate(float64(rate), rate)
+}
+
+// Rate returns the current rate in bytes per second.
+func (l *Limiter) Rate() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.rate
+}
+
+// Take removes count bytes from the bucket and returns the time to wait before transferring them.
+func (l *Limiter) Take(count int64) time.Duration {
+	l.m.Lock()
+	b := l.bucket
+	l.m.Unlock()
+	if b == nil {
+		return 0
+	}
+	return b.Take(count)
+}
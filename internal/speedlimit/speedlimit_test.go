@@ -0,0 +1,30 @@
+package speedlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetRate(t *testing.T) {
+	l := New(0)
+	if d := l.Take(1 << 30); d != 0 {
+		t.Fatalf("unlimited limiter waits %s", d)
+	}
+
+	l.SetRate(100)
+	if l.Rate() != 100 {
+		t.Fatalf("unexpected rate: %d", l.Rate())
+	}
+	// Bucket is full after the rate is set.
+	if d := l.Take(100); d != 0 {
+		t.Fatalf("unexpected wait: %s", d)
+	}
+	if d := l.Take(100); d < 900*time.Millisecond || d > time.Second {
+		t.Fatalf("unexpected wait: %s", d)
+	}
+
+	l.SetRate(0)
+	if d := l.Take(1 << 30); d != 0 {
+		t.Fatalf("limit is not removed, waits %s", d)
+	}
+}
@@ -0,0 +1,88 @@
+// Package encryptedstorage implements Storage interface that encrypts the data of an underlying Storage.
+package encryptedstorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+// EncryptedStorage wraps a Storage and encrypts the file contents with AES in CTR mode.
+// The counter is derived from the file name and the offset in file so files can be read and written at random positions.
+// Keystream is reused when the same region of a file is written again, so it must not be used for data that changes often.
+// Torrent pieces are written once after hash check, which fits this limitation.
+type EncryptedStorage struct {
+	storage.Storage
+	block cipher.Block
+}
+
+var _ storage.Storage = (*EncryptedStorage)(nil)
+
+// New returns a new EncryptedStorage that wraps sto.
+// Key length must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+func New(sto storage.Storage, key []byte) (*EncryptedStorage, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStorage{
+		Storage: sto,
+		block:   block,
+	}, nil
+}
+
+// Open a file in the underlying storage.
+func (s *EncryptedStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	f, exists, err = s.Storage.Open(name, size)
+	if err != nil {
+		return
+	}
+	// Each file has a distinct nonce so files do not share the keystream.
+	sum := sha256.Sum256([]byte(name))
+	ef := &file{
+		File:  f,
+		block: s.block,
+	}
+	copy(ef.nonce[:], sum[:])
+	return ef, exists, nil
+}
+
+type file struct {
+	storage.File
+	block cipher.Block
+	nonce [8]byte
+}
+
+// ReadAt reads the encrypted data from the underlying file and decrypts it into p.
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.xorKeyStream(p[:n], p[:n], off)
+	return n, err
+}
+
+// WriteAt encrypts p and writes it to the underlying file. p is not modified.
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	b := make([]byte, len(p))
+	f.xorKeyStream(b, p, off)
+	return f.File.WriteAt(b, off)
+}
+
+func (f *file) xorKeyStream(dst, src []byte, off int64) {
+	if len(src) == 0 {
+		return
+	}
+	// IV is the nonce of the file followed by the index of the AES block at offset.
+	var iv [aes.BlockSize]byte
+	copy(iv[:8], f.nonce[:])
+	binary.BigEndian.PutUint64(iv[8:], uint64(off/aes.BlockSize))
+	stream := cipher.NewCTR(f.block, iv[:])
+	// Skip the part of keystream before offset in the first block.
+	if skip := off % aes.BlockSize; skip != 0 {
+		var discard [aes.BlockSize]byte
+		stream.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	stream.XORKeyStream(dst, src)
+}
@@ -0,0 +1,106 @@
+package encryptedstorage
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+func TestReadWrite(t *testing.T) {
+	const size = 1 << 16
+	dir := t.TempDir()
+	fs, err := filestorage.New(dir, 0o750, filestorage.PreallocateSparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(fs, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := s.Open("file", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := rand.New(rand.NewSource(1)) // nolint: gosec
+	plain := make([]byte, size)
+	r.Read(plain)
+	// Write the data in random sized chunks at unaligned offsets in random order.
+	type chunk struct{ begin, end int }
+	var chunks []chunk
+	for begin := 0; begin < size; {
+		end := begin + 1 + r.Intn(1000)
+		if end > size {
+			end = size
+		}
+		chunks = append(chunks, chunk{begin, end})
+		begin = end
+	}
+	r.Shuffle(len(chunks), func(i, j int) { chunks[i], chunks[j] = chunks[j], chunks[i] })
+	for _, c := range chunks {
+		data := append([]byte(nil), plain[c.begin:c.end]...)
+		_, err = f.WriteAt(data, int64(c.begin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, plain[c.begin:c.end]) {
+			t.Fatal("WriteAt modified the input")
+		}
+	}
+
+	// Random reads return the plaintext.
+	for i := 0; i < 100; i++ {
+		begin := r.Intn(size)
+		end := begin + r.Intn(size-begin)
+		b := make([]byte, end-begin)
+		_, err = f.ReadAt(b, int64(begin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, plain[begin:end]) {
+			t.Fatalf("invalid data at [%d, %d)", begin, end)
+		}
+	}
+
+	// Data on disk is not the plaintext.
+	raw, err := os.ReadFile(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != size {
+		t.Fatalf("file size: %d", len(raw))
+	}
+	if bytes.Equal(raw, plain) {
+		t.Fatal("data is not encrypted")
+	}
+
+	// Another file does not share the keystream.
+	f2, _, err := s.Open("file2", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	_, err = f2.WriteAt(plain, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw2, err := os.ReadFile(filepath.Join(dir, "file2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(raw, raw2) {
+		t.Fatal("files have the same ciphertext")
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	_, err := New(nil, []byte("short"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -9,20 +9,33 @@ import (
 	"github.com/cenkalti/rain/internal/storage"
 )
 
+// Preallocation determines how the disk space for files is reserved when they are opened.
+type Preallocation int
+
+const (
+	// PreallocateSparse sets the file size with truncate. Disk blocks are allocated when data is written.
+	PreallocateSparse Preallocation = iota
+	// PreallocateFull allocates all disk blocks of the file on open.
+	// Disk full errors are returned from Open instead of being returned later during the download.
+	// Uses fallocate on Linux. Other platforms fall back to PreallocateSparse.
+	PreallocateFull
+)
+
 // FileStorage implements Storage interface for saving files on disk.
 type FileStorage struct {
-	dest string
-	perm fs.FileMode
+	dest     string
+	perm     fs.FileMode
+	prealloc Preallocation
 }
 
 // New returns a new FileStorage at the destination.
-func New(dest string, perm fs.FileMode) (*FileStorage, error) {
+func New(dest string, perm fs.FileMode, prealloc Preallocation) (*FileStorage, error) {
 	var err error
 	dest, err = filepath.Abs(dest)
 	if err != nil {
 		return nil, err
 	}
-	return &FileStorage{dest: dest, perm: perm}, nil
+	return &FileStorage{dest: dest, perm: perm, prealloc: prealloc}, nil
 }
 
 var _ storage.Storage = (*FileStorage)(nil)
@@ -64,7 +77,7 @@ func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool
 		if err != nil {
 			return
 		}
-		err = of.Truncate(size)
+		err = s.allocate(of, size)
 		return
 	}
 	if err != nil {
@@ -77,10 +90,24 @@ func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool
 	}
 	if fi.Size() != size {
 		err = of.Truncate(size)
+		if err != nil {
+			return
+		}
+	}
+	if s.prealloc == PreallocateFull {
+		// Fills the holes left from a previous sparse allocation or a size change.
+		err = fallocate(of, size)
 	}
 	return
 }
 
+func (s *FileStorage) allocate(f *os.File, size int64) error {
+	if s.prealloc == PreallocateFull {
+		return fallocate(f, size)
+	}
+	return f.Truncate(size)
+}
+
 // RootDir is the root of opened storage file.
 func (s *FileStorage) RootDir() string {
 	return s.dest
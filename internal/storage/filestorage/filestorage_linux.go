@@ -1,12 +1,26 @@
 package filestorage
 
 import (
+	"errors"
 	"os"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
+// fallocate allocates disk space for the file up to size.
+// Falls back to truncate if the file system does not support fallocate.
+func fallocate(f *os.File, size int64) error {
+	if size == 0 {
+		return f.Truncate(size)
+	}
+	err := unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return f.Truncate(size)
+	}
+	return err
+}
+
 func disableReadAhead(f *os.File) error {
 	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_RANDOM)
 }
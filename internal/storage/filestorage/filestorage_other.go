@@ -4,6 +4,10 @@ package filestorage
 
 import "os"
 
+func fallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
+
 func disableReadAhead(f *os.File) error {
 	return nil
 }
@@ -0,0 +1,60 @@
+package filestorage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenPreallocate(t *testing.T) {
+	cases := []struct {
+		name     string
+		prealloc Preallocation
+		size     int64
+	}{
+		{"sparse", PreallocateSparse, 4 << 30},
+		{"full", PreallocateFull, 1 << 20},
+		{"empty", PreallocateFull, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := New(dir, 0o750, tc.prealloc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, exists, err := s.Open(filepath.Join("dir", "file"), tc.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if exists {
+				t.Fatal("file must not exist")
+			}
+			fi, err := os.Stat(filepath.Join(dir, "dir", "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != tc.size {
+				t.Fatalf("file size is %d, want %d", fi.Size(), tc.size)
+			}
+
+			// Open again with a different size.
+			f2, exists, err := s.Open(filepath.Join("dir", "file"), tc.size+10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f2.Close()
+			if !exists {
+				t.Fatal("file must exist")
+			}
+			fi, err = os.Stat(filepath.Join(dir, "dir", "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != tc.size+10 {
+				t.Fatalf("file size is %d, want %d", fi.Size(), tc.size+10)
+			}
+		})
+	}
+}
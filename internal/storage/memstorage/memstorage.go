@@ -0,0 +1,140 @@
+// Package memstorage implements Storage interface that keeps the files in memory.
+package memstorage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+// ErrStorageFull is returned from Open when the total size of the files exceeds the size limit of the storage.
+var ErrStorageFull = errors.New("memory storage is full")
+
+// MemStorage implements Storage interface for keeping files in memory.
+type MemStorage struct {
+	maxSize int64
+
+	m     sync.Mutex
+	size  int64
+	files map[string]*File
+}
+
+// New returns a new MemStorage that can hold at most maxSize bytes. Zero means no limit.
+func New(maxSize int64) *MemStorage {
+	return &MemStorage{
+		maxSize: maxSize,
+		files:   make(map[string]*File),
+	}
+}
+
+var _ storage.Storage = (*MemStorage)(nil)
+
+// Open a file. The file is created if it does not exist.
+// If the file exists with a different size, it is truncated or extended to the size.
+func (s *MemStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	name = filepath.Clean(name)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	mf, exists := s.files[name]
+	var oldSize int64
+	if exists {
+		oldSize = mf.Size()
+	}
+	if s.maxSize > 0 && s.size-oldSize+size > s.maxSize {
+		return nil, false, ErrStorageFull
+	}
+	if !exists {
+		mf = &File{}
+		s.files[name] = mf
+	}
+	mf.truncate(size)
+	s.size += size - oldSize
+	return mf, exists, nil
+}
+
+// RootDir returns an empty string because the files are not saved on disk.
+func (s *MemStorage) RootDir() string {
+	return ""
+}
+
+// Size returns the total size of the files in storage.
+func (s *MemStorage) Size() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.size
+}
+
+// File is a file in MemStorage.
+type File struct {
+	m    sync.RWMutex
+	data []byte
+}
+
+var _ storage.File = (*File)(nil)
+
+func (f *File) truncate(size int64) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if size <= int64(cap(f.data)) {
+		n := len(f.data)
+		f.data = f.data[:size]
+		if int(size) > n {
+			// Clear the data left from a previous truncate.
+			for i := n; i < len(f.data); i++ {
+				f.data[i] = 0
+			}
+		}
+		return
+	}
+	data := make([]byte, size)
+	copy(data, f.data)
+	f.data = data
+}
+
+// Size returns the length of the file.
+func (f *File) Size() int64 {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return int64(len(f.data))
+}
+
+// ReadAt implements io.ReaderAt interface.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt interface.
+// Writes beyond the size of the file are not allowed because the size of the file is fixed on Open.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off+int64(len(p)) > int64(len(f.data)) {
+		return 0, errors.New("write beyond end of file")
+	}
+	return copy(f.data[off:], p), nil
+}
+
+// Close does nothing. Data of the file is still kept in the storage.
+func (f *File) Close() error {
+	return nil
+}
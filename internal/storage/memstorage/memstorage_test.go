@@ -0,0 +1,94 @@
+package memstorage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	s := New(0)
+	f, exists, err := s.Open("foo/bar", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file must not exist")
+	}
+	n, err := f.WriteAt([]byte("hello"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("written %d bytes", n)
+	}
+	_, err = f.WriteAt([]byte("hello"), 6)
+	if err == nil {
+		t.Fatal("expected error when writing beyond end of file")
+	}
+
+	f2, exists, err := s.Open("foo/bar", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("file must exist")
+	}
+	b := make([]byte, 10)
+	n, err = f2.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || !bytes.Equal(b, []byte("\x00\x00\x00hello\x00\x00")) {
+		t.Fatalf("invalid data: %q", b[:n])
+	}
+	n, err = f2.ReadAt(b, 5)
+	if err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("read %d bytes", n)
+	}
+
+	// Shrinking and extending the file must not bring back the old data.
+	_, _, err = s.Open("foo/bar", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.Open("foo/bar", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f2.ReadAt(b, 0)
+	if !bytes.Equal(b, []byte("\x00\x00\x00h\x00\x00\x00\x00\x00\x00")) {
+		t.Fatalf("invalid data after resize: %q", b)
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	s := New(100)
+	_, _, err := s.Open("a", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.Open("b", 50)
+	if err != ErrStorageFull {
+		t.Fatalf("expected ErrStorageFull, got %v", err)
+	}
+	_, _, err = s.Open("b", 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != 100 {
+		t.Fatalf("size is %d", s.Size())
+	}
+	// Resizing an existing file counts only the difference.
+	_, _, err = s.Open("a", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.Open("b", 51)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
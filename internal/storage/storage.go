@@ -4,14 +4,27 @@ package storage
 import "io"
 
 // Storage is an interface for reading/writing torrent files.
+//
+// A torrent is a list of files; pieces of the torrent span over these files.
+// The torrent opens each file once when it is started and keeps it open until it is stopped.
+// Reads and writes of piece data are converted to ReadAt/WriteAt calls on the files that contain the piece.
+// Methods of Storage and File may be called from different goroutines.
 type Storage interface {
+	// Open the file at name with the given size. Name is a slash separated path, relative to the root of storage.
+	// If the file does not exist, it must be created with the given size.
+	// If the file exists with a different size, it must be truncated or extended to the size.
+	// exists must be true if the file was present before Open is called, then existing pieces are verified by hash check.
 	Open(name string, size int64) (f File, exists bool, err error)
+	// RootDir returns the directory on disk that files are saved into.
+	// It is passed to the command that is run on completion. It can be empty if the storage is not on disk.
 	RootDir() string
 }
 
 // File interface for reading/writing torrent data.
+// Offsets are relative to the beginning of the file and never exceed the size given to Storage.Open.
 type File interface {
 	io.ReaderAt
 	io.WriterAt
+	// Close is called when the torrent is stopped. Pending writes must be persisted before Close returns.
 	io.Closer
 }
@@ -58,3 +58,20 @@ func DecodePeersCompact(b []byte) ([]*net.TCPAddr, error) {
 	}
 	return addrs, nil
 }
+
+// DecodePeersCompact6 parses and returns addresses for list of IPv6 peers in compact form (BEP 7).
+// Each peer is a 16-bytes IP address followed by a 2-bytes port value.
+func DecodePeersCompact6(b []byte) ([]*net.TCPAddr, error) {
+	if len(b)%18 != 0 {
+		return nil, errors.New("invalid peer list length")
+	}
+	count := len(b) / 18
+	addrs := make([]*net.TCPAddr, 0, count)
+	for i := 0; i < len(b); i += 18 {
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, b[i:i+16])
+		port := binary.BigEndian.Uint16(b[i+16 : i+18])
+		addrs = append(addrs, &net.TCPAddr{IP: ip, Port: int(port)})
+	}
+	return addrs, nil
+}
@@ -1,7 +1,6 @@
 package httptracker
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"fmt"
@@ -87,37 +86,15 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		sb.WriteString(t.trackerID)
 	}
 	sb.WriteString("&key=")
-	sb.WriteString(hex.EncodeToString(req.Torrent.PeerID[16:20]))
-
-	t.log.Debugf("making request to: %q", sb.String())
-
-	httpReq, err := http.NewRequest(http.MethodGet, sb.String(), nil)
-	if err != nil {
-		return nil, err
+	sb.WriteString(fmt.Sprintf("%08x", req.Torrent.Key))
+	if req.Torrent.IPv6 != nil {
+		sb.WriteString("&ipv6=")
+		sb.WriteString(url.QueryEscape(req.Torrent.IPv6.String()))
 	}
-	httpReq = httpReq.WithContext(ctx)
-
-	httpReq.Header.Set("User-Agent", t.userAgent)
 
-	doReq := func() (int, http.Header, []byte, error) {
-		resp, err := t.http.Do(httpReq)
-		if err != nil {
-			return 0, nil, nil, err
-		}
-		t.log.Debugf("tracker responded %d with %d bytes body", resp.StatusCode, resp.ContentLength)
-		defer resp.Body.Close()
-		if resp.ContentLength > t.maxResponseLength {
-			return 0, resp.Header, nil, fmt.Errorf("tracker respsonse too large: %d", resp.ContentLength)
-		}
-		r := io.LimitReader(resp.Body, t.maxResponseLength)
-		data, err := io.ReadAll(r)
-		return resp.StatusCode, resp.Header, data, err
-	}
+	t.log.Debugf("making request to: %q", sb.String())
 
-	code, header, body, err := doReq()
-	if uerr, ok := err.(*url.Error); ok && uerr.Err == context.Canceled {
-		return nil, context.Canceled
-	}
+	code, header, body, err := t.get(ctx, sb.String())
 	if err != nil {
 		return nil, err
 	}
@@ -165,14 +142,22 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	if err != nil {
 		return nil, err
 	}
+	if len(response.Peers6) > 0 {
+		peers6, err := tracker.DecodePeersCompact6(response.Peers6)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peers6...)
+	}
 	t.log.Debugf("got %d peers", len(peers))
 
 	// Filter external IP
 	if len(response.ExternalIP) != 0 {
+		externalIP := net.IP(response.ExternalIP)
 		var filtered int
-		for i, p := range peers {
-			if !bytes.Equal(p.IP[:], response.ExternalIP) {
-				peers[i] = p
+		for _, p := range peers {
+			if !p.IP.Equal(externalIP) {
+				peers[filtered] = p
 				filtered++
 			}
 		}
@@ -189,6 +174,38 @@ func (t *HTTPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 	}, nil
 }
 
+// get does a GET request to the tracker and returns the response with body limited to maxResponseLength.
+func (t *HTTPTracker) get(ctx context.Context, u string) (int, http.Header, []byte, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+
+	httpReq.Header.Set("User-Agent", t.userAgent)
+
+	doReq := func() (int, http.Header, []byte, error) {
+		resp, err := t.http.Do(httpReq)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		t.log.Debugf("tracker responded %d with %d bytes body", resp.StatusCode, resp.ContentLength)
+		defer resp.Body.Close()
+		if resp.ContentLength > t.maxResponseLength {
+			return 0, resp.Header, nil, fmt.Errorf("tracker respsonse too large: %d", resp.ContentLength)
+		}
+		r := io.LimitReader(resp.Body, t.maxResponseLength)
+		data, err := io.ReadAll(r)
+		return resp.StatusCode, resp.Header, data, err
+	}
+
+	code, header, body, err := doReq()
+	if uerr, ok := err.(*url.Error); ok && uerr.Err == context.Canceled {
+		return 0, nil, nil, context.Canceled
+	}
+	return code, header, body, err
+}
+
 // percentEscape puts `%` before every byte.
 // Some trackers don't like the output of url.QueryEscape function because it may skip encoding safe characters.
 // This function escapes every byte explicitly.
@@ -214,10 +231,17 @@ func parsePeersDictionary(b bencode.RawMessage) ([]*net.TCPAddr, error) {
 		return nil, tracker.ErrDecode
 	}
 
-	addrs := make([]*net.TCPAddr, len(peers))
-	for i, p := range peers {
-		pe := &net.TCPAddr{IP: net.ParseIP(p.IP), Port: int(p.Port)}
-		addrs[i] = pe
+	addrs := make([]*net.TCPAddr, 0, len(peers))
+	for _, p := range peers {
+		// Skip host names and invalid addresses.
+		ip := net.ParseIP(p.IP)
+		if ip == nil || p.Port == 0 {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		addrs = append(addrs, &net.TCPAddr{IP: ip, Port: int(p.Port)})
 	}
-	return addrs, err
+	return addrs, nil
 }
@@ -1,9 +1,13 @@
 package httptracker_test
 
 import (
+	"bytes"
 	"context"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
@@ -13,6 +17,7 @@ import (
 	"github.com/chihaya/chihaya/middleware"
 	"github.com/chihaya/chihaya/storage"
 	_ "github.com/chihaya/chihaya/storage/memory"
+	"github.com/stretchr/testify/assert"
 )
 
 const timeout = 2 * time.Second
@@ -99,3 +104,231 @@ func TestHTTPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestHTTPTrackerCompactResponse(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		peers := []byte{
+			10, 0, 0, 1, 0x1a, 0xe1, // 10.0.0.1:6881
+			10, 0, 0, 2, 0x1a, 0xe2, // 10.0.0.2:6882
+			10, 0, 0, 3, 0x1a, 0xe3, // 10.0.0.3:6883 (our external IP)
+		}
+		var b bytes.Buffer
+		b.WriteString("d8:completei5e10:incompletei7e8:intervali1800e12:min intervali60e")
+		b.WriteString("11:external ip4:\x0a\x00\x00\x03")
+		b.WriteString("5:peers" + strconv.Itoa(len(peers)) + ":")
+		b.Write(peers)
+		b.WriteString("e")
+		_, _ = w.Write(b.Bytes())
+	}))
+	defer srv.Close()
+
+	rawURL := srv.URL + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash:        [20]byte{6},
+			PeerID:          [20]byte{1},
+			Port:            1111,
+			BytesUploaded:   10,
+			BytesDownloaded: 20,
+			BytesLeft:       30,
+		},
+		Event:   tracker.EventStarted,
+		NumWant: 50,
+	}
+	resp, err := trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(req.Torrent.InfoHash[:]), query.Get("info_hash"))
+	assert.Equal(t, string(req.Torrent.PeerID[:]), query.Get("peer_id"))
+	assert.Equal(t, "1111", query.Get("port"))
+	assert.Equal(t, "10", query.Get("uploaded"))
+	assert.Equal(t, "20", query.Get("downloaded"))
+	assert.Equal(t, "30", query.Get("left"))
+	assert.Equal(t, "1", query.Get("compact"))
+	assert.Equal(t, "started", query.Get("event"))
+	assert.Equal(t, "50", query.Get("numwant"))
+
+	assert.Equal(t, 30*time.Minute, resp.Interval)
+	assert.Equal(t, time.Minute, resp.MinInterval)
+	assert.Equal(t, int32(5), resp.Seeders)
+	assert.Equal(t, int32(7), resp.Leechers)
+	assert.Equal(t, []*net.TCPAddr{
+		{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 6881},
+		{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 6882},
+	}, resp.Peers)
+}
+
+func TestHTTPTrackerPeers6(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		peers := []byte{10, 0, 0, 1, 0x1a, 0xe1}                 // 10.0.0.1:6881
+		peers6 := append(net.ParseIP("2001:db8::1"), 0x1a, 0xe2) // [2001:db8::1]:6882
+		var b bytes.Buffer
+		b.WriteString("d8:intervali1800e")
+		b.WriteString("5:peers" + strconv.Itoa(len(peers)) + ":")
+		b.Write(peers)
+		b.WriteString("6:peers6" + strconv.Itoa(len(peers6)) + ":")
+		b.Write(peers6)
+		b.WriteString("e")
+		_, _ = w.Write(b.Bytes())
+	}))
+	defer srv.Close()
+
+	rawURL := srv.URL + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash: [20]byte{6},
+			PeerID:   [20]byte{1},
+			Port:     1111,
+			IPv6:     net.ParseIP("2001:db8::2"),
+		},
+	}
+	resp, err := trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "2001:db8::2", query.Get("ipv6"))
+	assert.Equal(t, []*net.TCPAddr{
+		{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 6881},
+		{IP: net.ParseIP("2001:db8::1"), Port: 6882},
+	}, resp.Peers)
+}
+
+func TestHTTPTrackerDictionaryResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Tracker ignores compact=1 and returns a list of dictionaries.
+		var b bytes.Buffer
+		b.WriteString("d8:intervali1800e5:peersl")
+		b.WriteString("d2:ip8:10.0.0.17:peer id20:aaaaaaaaaaaaaaaaaaaa4:porti6881ee")
+		b.WriteString("d2:ip11:2001:db8::14:porti6882ee")
+		b.WriteString("d2:ip11:example.com4:porti6883ee")
+		b.WriteString("ee")
+		_, _ = w.Write(b.Bytes())
+	}))
+	defer srv.Close()
+
+	rawURL := srv.URL + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash: [20]byte{6},
+			PeerID:   [20]byte{1},
+			Port:     1111,
+		},
+		NumWant: 50,
+	}
+	resp, err := trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Host names are not resolved.
+	assert.Equal(t, []*net.TCPAddr{
+		{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 6881},
+		{IP: net.ParseIP("2001:db8::1"), Port: 6882},
+	}, resp.Peers)
+}
+
+func TestScrapeURL(t *testing.T) {
+	cases := []struct {
+		announce string
+		scrape   string
+		ok       bool
+	}{
+		{"http://example.com/announce", "http://example.com/scrape", true},
+		{"http://example.com/x/announce", "http://example.com/x/scrape", true},
+		{"http://example.com/announce.php", "http://example.com/scrape.php", true},
+		{"http://example.com/announce?x2%0644", "http://example.com/scrape?x2%0644", true},
+		{"http://example.com/announce?passkey=announce", "http://example.com/scrape?passkey=announce", true},
+		{"http://example.com/a", "", false},
+		{"http://example.com/announce/x", "", false},
+		{"http://example.com/x%064announce", "", false},
+	}
+	for _, c := range cases {
+		s, ok := httptracker.ScrapeURL(c.announce)
+		assert.Equal(t, c.ok, ok, c.announce)
+		assert.Equal(t, c.scrape, s, c.announce)
+	}
+}
+
+func TestHTTPTrackerScrape(t *testing.T) {
+	ih1 := [20]byte{1}
+	ih2 := [20]byte{2}
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.Query()
+		var b bytes.Buffer
+		b.WriteString("d5:filesd")
+		b.WriteString("20:" + string(ih1[:]) + "d8:completei5e10:downloadedi50e10:incompletei10ee")
+		b.WriteString("20:" + string(ih2[:]) + "d8:completei1e10:downloadedi2e10:incompletei3ee")
+		b.WriteString("ee")
+		_, _ = w.Write(b.Bytes())
+	}))
+	defer srv.Close()
+
+	rawURL := srv.URL + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results, err := trk.Scrape(ctx, [][20]byte{ih1, ih2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{string(ih1[:]), string(ih2[:])}, query["info_hash"])
+	assert.Equal(t, map[[20]byte]tracker.ScrapeResult{
+		ih1: {Complete: 5, Incomplete: 10, Downloaded: 50},
+		ih2: {Complete: 1, Incomplete: 3, Downloaded: 2},
+	}, results)
+}
+
+func TestHTTPTrackerScrapeNotSupported(t *testing.T) {
+	const rawURL = "http://127.0.0.1:5000/tracker"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trk := httptracker.New(rawURL, u, timeout, new(http.Transport), "Mozilla/5.0", 2*1024*1024)
+	_, err = trk.Scrape(context.Background(), [][20]byte{{1}})
+	assert.Equal(t, tracker.ErrScrapeNotSupported, err)
+}
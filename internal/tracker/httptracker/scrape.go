@@ -0,0 +1,102 @@
+package httptracker
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/rain/internal/tracker"
+	"github.com/zeebo/bencode"
+)
+
+var _ tracker.Scraper = (*HTTPTracker)(nil)
+
+type scrapeResponse struct {
+	FailureReason string                `bencode:"failure reason"`
+	RetryIn       string                `bencode:"retry in"`
+	Files         map[string]scrapeFile `bencode:"files"`
+}
+
+type scrapeFile struct {
+	Complete   int32 `bencode:"complete"`
+	Incomplete int32 `bencode:"incomplete"`
+	Downloaded int32 `bencode:"downloaded"`
+}
+
+// Scrape the torrents with given info hashes by doing a GET request to the scrape URL of the tracker.
+// Returns tracker.ErrScrapeNotSupported if the scrape URL cannot be derived from announce URL.
+func (t *HTTPTracker) Scrape(ctx context.Context, infoHashes [][20]byte) (map[[20]byte]tracker.ScrapeResult, error) {
+	scrapeURL, ok := ScrapeURL(t.rawURL)
+	if !ok {
+		return nil, tracker.ErrScrapeNotSupported
+	}
+	var sb strings.Builder
+	sb.WriteString(scrapeURL)
+	for i, ih := range infoHashes {
+		if i == 0 && !strings.ContainsRune(scrapeURL, '?') {
+			sb.WriteString("?info_hash=")
+		} else {
+			sb.WriteString("&info_hash=")
+		}
+		sb.WriteString(percentEscape(ih))
+	}
+
+	t.log.Debugf("making scrape request to: %q", sb.String())
+
+	code, header, body, err := t.get(ctx, sb.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var response scrapeResponse
+	err = bencode.DecodeBytes(body, &response)
+	if err != nil {
+		if code != 200 {
+			return nil, &StatusError{
+				Code:   code,
+				Header: header,
+				Body:   string(body),
+			}
+		}
+		return nil, tracker.ErrDecode
+	}
+
+	if response.FailureReason != "" {
+		retryIn, _ := strconv.Atoi(response.RetryIn)
+		return nil, &tracker.Error{
+			FailureReason: response.FailureReason,
+			RetryIn:       time.Duration(retryIn) * time.Minute,
+		}
+	}
+
+	ret := make(map[[20]byte]tracker.ScrapeResult, len(response.Files))
+	for key, f := range response.Files {
+		if len(key) != 20 {
+			return nil, tracker.ErrDecode
+		}
+		var ih [20]byte
+		copy(ih[:], key)
+		ret[ih] = tracker.ScrapeResult{
+			Complete:   f.Complete,
+			Incomplete: f.Incomplete,
+			Downloaded: f.Downloaded,
+		}
+	}
+	return ret, nil
+}
+
+// ScrapeURL returns the scrape URL of the tracker by replacing the "announce" at the beginning of last path segment with "scrape".
+// Returns false if the tracker does not support scrape convention.
+func ScrapeURL(announceURL string) (string, bool) {
+	path := announceURL
+	var query string
+	if i := strings.IndexRune(announceURL, '?'); i >= 0 {
+		path, query = announceURL[:i], announceURL[i:]
+	}
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 || !strings.HasPrefix(path[i+1:], "announce") {
+		return "", false
+	}
+	return path[:i+1] + "scrape" + path[i+1+len("announce"):] + query, true
+}
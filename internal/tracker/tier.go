@@ -3,45 +3,65 @@ package tracker
 import (
 	"context"
 	"math/rand"
-	"sync/atomic"
+	"sync"
 )
 
 // Tier implements the Tracker interface and contains multiple Trackers which tries to announce to the working Tracker.
+// Trackers are tried in order as described in BEP 12. The Tracker that responds successfully is moved to the front of the Tier.
 type Tier struct {
-	Trackers []Tracker
-	index    int32
+	trackers []Tracker
+	m        sync.RWMutex
 }
 
 var _ Tracker = (*Tier)(nil)
 
-// NewTier returns a new Tier.
+// NewTier returns a new Tier. Order of trackers is shuffled.
 func NewTier(trackers []Tracker) *Tier {
 	rand.Shuffle(len(trackers), func(i, j int) { trackers[i], trackers[j] = trackers[j], trackers[i] })
 	return &Tier{
-		Trackers: trackers,
+		trackers: trackers,
 	}
 }
 
+// Trackers returns the Trackers in the Tier in the order that they are tried.
+func (t *Tier) Trackers() []Tracker {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return append([]Tracker(nil), t.trackers...)
+}
+
 // Announce a torrent to the tracker.
-// If annouce fails, the next announce will be made to the next Tracker in the tier.
-func (t *Tier) Announce(ctx context.Context, req AnnounceRequest) (*AnnounceResponse, error) {
-	index := t.loadIndex()
-	resp, err := t.Trackers[index].Announce(ctx, req)
-	if err != nil {
-		atomic.CompareAndSwapInt32(&t.index, index, index+1)
+// If annouce fails, the next Tracker in the Tier is tried until one succeeds. The error from the last Tracker is returned if all of them fail.
+func (t *Tier) Announce(ctx context.Context, req AnnounceRequest) (resp *AnnounceResponse, err error) {
+	for _, trk := range t.Trackers() {
+		resp, err = trk.Announce(ctx, req)
+		if err == nil {
+			t.promote(trk)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
 	}
-	return resp, err
+	return
 }
 
-// URL returns the current Tracker in the Tier.
-func (t *Tier) URL() string {
-	return t.Trackers[t.loadIndex()].URL()
+// promote moves the tracker to the front of the Tier.
+func (t *Tier) promote(trk Tracker) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for i, tr := range t.trackers {
+		if tr == trk {
+			copy(t.trackers[1:i+1], t.trackers[:i])
+			t.trackers[0] = trk
+			return
+		}
+	}
 }
 
-func (t *Tier) loadIndex() int32 {
-	index := atomic.LoadInt32(&t.index)
-	if index >= int32(len(t.Trackers)) {
-		index = 0
-	}
-	return index
+// URL returns the current Tracker in the Tier.
+func (t *Tier) URL() string {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.trackers[0].URL()
 }
@@ -0,0 +1,72 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type testTracker struct {
+	url       string
+	err       error
+	announces int
+}
+
+func (t *testTracker) Announce(ctx context.Context, req AnnounceRequest) (*AnnounceResponse, error) {
+	t.announces++
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &AnnounceResponse{}, nil
+}
+
+func (t *testTracker) URL() string { return t.url }
+
+func TestTierFailover(t *testing.T) {
+	errTracker := errors.New("tracker error")
+	bad1 := &testTracker{url: "bad1", err: errTracker}
+	bad2 := &testTracker{url: "bad2", err: errTracker}
+	good := &testTracker{url: "good"}
+	tier := &Tier{trackers: []Tracker{bad1, good, bad2}}
+
+	_, err := tier.Announce(context.Background(), AnnounceRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad1.announces != 1 || good.announces != 1 || bad2.announces != 0 {
+		t.Fatalf("unexpected announces: %d %d %d", bad1.announces, good.announces, bad2.announces)
+	}
+	if tier.URL() != "good" {
+		t.Fatalf("working tracker is not promoted: %s", tier.URL())
+	}
+	// Working tracker is tried first on next announce.
+	_, err = tier.Announce(context.Background(), AnnounceRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad1.announces != 1 || good.announces != 2 {
+		t.Fatalf("unexpected announces: %d %d", bad1.announces, good.announces)
+	}
+	urls := make([]string, 0, 3)
+	for _, tr := range tier.Trackers() {
+		urls = append(urls, tr.URL())
+	}
+	if urls[0] != "good" || urls[1] != "bad1" || urls[2] != "bad2" {
+		t.Fatalf("unexpected order: %v", urls)
+	}
+}
+
+func TestTierAllFail(t *testing.T) {
+	err1 := errors.New("error 1")
+	err2 := errors.New("error 2")
+	tier := NewTier([]Tracker{&testTracker{err: err1}, &testTracker{err: err2}})
+	_, err := tier.Announce(context.Background(), AnnounceRequest{})
+	if err != err1 && err != err2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tr := range tier.Trackers() {
+		if tr.(*testTracker).announces != 1 {
+			t.Fatal("all trackers must be tried once")
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package tracker
 
+import "net"
+
 // Torrent contains fields that are sent in an announce request.
 type Torrent struct {
 	BytesUploaded   int64
@@ -8,4 +10,8 @@ type Torrent struct {
 	InfoHash        [20]byte
 	PeerID          [20]byte
 	Port            int
+	// IPv6 address of the client (BEP 7). Set if the client accepts connections on IPv6.
+	IPv6 net.IP
+	// Random value that identifies the client to trackers when its IP address changes.
+	Key uint32
 }
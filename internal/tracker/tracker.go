@@ -36,6 +36,25 @@ type AnnounceResponse struct {
 	Peers          []*net.TCPAddr
 }
 
+// Scraper is implemented by trackers that support scrape requests.
+type Scraper interface {
+	// Scrape returns the swarm statistics of torrents with given info hashes.
+	Scrape(ctx context.Context, infoHashes [][20]byte) (map[[20]byte]ScrapeResult, error)
+}
+
+// ScrapeResult contains the statistics of a torrent returned from tracker in scrape response.
+type ScrapeResult struct {
+	// Number of peers that have the complete file.
+	Complete int32
+	// Number of peers that are still downloading.
+	Incomplete int32
+	// Number of times the tracker registered a completion.
+	Downloaded int32
+}
+
+// ErrScrapeNotSupported is returned from Scraper.Scrape method when the tracker does not support scraping.
+var ErrScrapeNotSupported = errors.New("tracker does not support scrape")
+
 // ErrDecode is returned from Tracker.Announce method when there is problem with the encoding of response.
 var ErrDecode = errors.New("cannot decode response")
 
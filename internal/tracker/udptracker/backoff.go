@@ -1,15 +1,25 @@
 package udptracker
 
-import "time"
+import (
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+)
+
+// Maximum value of n in BEP 15 retransmission timeout formula 15 * 2 ^ n.
+const maxRetransmit = 8
 
 type udpBackOff int
 
+// NextBackOff returns the duration to wait before retransmitting the request.
+// Returns backoff.Stop after the request is transmitted maxRetransmit+1 times.
 func (b *udpBackOff) NextBackOff() time.Duration {
-	defer func() { *b++ }()
-	if *b > 8 {
-		*b = 8
+	if *b > maxRetransmit {
+		return backoff.Stop
 	}
-	return time.Duration(15*(2^*b)) * time.Second
+	d := 15 * time.Second << uint(*b)
+	*b++
+	return d
 }
 
 func (b *udpBackOff) Reset() { *b = 0 }
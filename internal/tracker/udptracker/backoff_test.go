@@ -0,0 +1,19 @@
+package udptracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPBackOff(t *testing.T) {
+	b := new(udpBackOff)
+	for n := 0; n <= maxRetransmit; n++ {
+		assert.Equal(t, time.Duration(15*(1<<n))*time.Second, b.NextBackOff())
+	}
+	assert.Equal(t, backoff.Stop, b.NextBackOff())
+	b.Reset()
+	assert.Equal(t, 15*time.Second, b.NextBackOff())
+}
@@ -20,6 +20,8 @@ type udpRequestHeader struct {
 	udpMessageHeader
 }
 
+func (h *udpRequestHeader) SetConnectionID(id int64) { h.ConnectionID = id }
+
 type connectRequest struct {
 	udpRequestHeader
 }
@@ -94,3 +96,26 @@ func (r *transferAnnounceRequest) WriteTo(w io.Writer) (int64, error) {
 
 	return buf.WriteTo(w)
 }
+
+type scrapeRequest struct {
+	udpRequestHeader
+	InfoHashes [][20]byte
+}
+
+func (r *scrapeRequest) WriteTo(w io.Writer) (int64, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 16+20*len(r.InfoHashes)))
+	err := binary.Write(buf, binary.BigEndian, r.udpRequestHeader)
+	if err != nil {
+		return 0, err
+	}
+	for _, ih := range r.InfoHashes {
+		buf.Write(ih[:])
+	}
+	return buf.WriteTo(w)
+}
+
+type scrapeResponseEntry struct {
+	Seeders   int32
+	Completed int32
+	Leechers  int32
+}
@@ -2,14 +2,22 @@ package udptracker
 
 import (
 	"context"
-	"encoding/binary"
+	"io"
 
 	"github.com/cenkalti/rain/internal/tracker"
 )
 
+// transportRequest is a request that is sent to the tracker after the connection is established.
 type transportRequest struct {
 	*requestBase
-	transferAnnounceRequest
+	transportMessage
+}
+
+// transportMessage is the message in transportRequest. It can be an announce or scrape request.
+type transportMessage interface {
+	io.WriterTo
+	SetTransactionID(int32)
+	SetConnectionID(int64)
 }
 
 var _ udpRequest = (*transportRequest)(nil)
@@ -24,15 +32,24 @@ func newTransportRequest(ctx context.Context, req tracker.AnnounceRequest, dest
 		Event:      req.Event,
 		NumWant:    int32(req.NumWant),
 		Port:       uint16(req.Torrent.Port),
+		Key:        req.Torrent.Key,
 	}
-	binary.BigEndian.PutUint32(request.PeerID[16:20], request.Key)
 	request.Action = actionAnnounce
 
 	return &transportRequest{
 		requestBase: newRequestBase(ctx, dest),
-		transferAnnounceRequest: transferAnnounceRequest{
+		transportMessage: &transferAnnounceRequest{
 			announceRequest: request,
 			urlData:         urlData,
 		},
 	}
 }
+
+func newScrapeTransportRequest(ctx context.Context, infoHashes [][20]byte, dest string) *transportRequest {
+	request := &scrapeRequest{InfoHashes: infoHashes}
+	request.Action = actionScrape
+	return &transportRequest{
+		requestBase:      newRequestBase(ctx, dest),
+		transportMessage: request,
+	}
+}
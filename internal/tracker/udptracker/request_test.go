@@ -0,0 +1,21 @@
+package udptracker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+func TestAnnounceRequestKey(t *testing.T) {
+	peerID := [20]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	req := tracker.AnnounceRequest{Torrent: tracker.Torrent{PeerID: peerID, Key: 0xdeadbeef}}
+	r := newTransportRequest(context.Background(), req, "127.0.0.1:5000", "")
+	ar := r.transportMessage.(*transferAnnounceRequest).announceRequest
+	if ar.Key != 0xdeadbeef {
+		t.Fatalf("invalid key: %x", ar.Key)
+	}
+	if ar.PeerID != peerID {
+		t.Fatalf("peer id is modified: %x", ar.PeerID)
+	}
+}
@@ -0,0 +1,62 @@
+package udptracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+// Maximum number of info hashes that can be scraped in a single request as defined in BEP 15.
+const maxScrapeInfoHashes = 74
+
+var _ tracker.Scraper = (*UDPTracker)(nil)
+
+// Scrape the torrents with given info hashes.
+// If there are more info hashes than can fit into a single packet, multiple requests are made.
+func (t *UDPTracker) Scrape(ctx context.Context, infoHashes [][20]byte) (map[[20]byte]tracker.ScrapeResult, error) {
+	ret := make(map[[20]byte]tracker.ScrapeResult, len(infoHashes))
+	for len(infoHashes) > 0 {
+		n := len(infoHashes)
+		if n > maxScrapeInfoHashes {
+			n = maxScrapeInfoHashes
+		}
+		reply, err := t.transport.Do(newScrapeTransportRequest(ctx, infoHashes[:n], t.dest))
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseScrapeResponse(reply, n)
+		if err != nil {
+			return nil, tracker.ErrDecode
+		}
+		for i, e := range entries {
+			ret[infoHashes[i]] = tracker.ScrapeResult{
+				Complete:   e.Seeders,
+				Incomplete: e.Leechers,
+				Downloaded: e.Completed,
+			}
+		}
+		infoHashes = infoHashes[n:]
+	}
+	return ret, nil
+}
+
+func parseScrapeResponse(data []byte, count int) ([]scrapeResponseEntry, error) {
+	r := bytes.NewReader(data)
+	var header udpMessageHeader
+	err := binary.Read(r, binary.BigEndian, &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Action != actionScrape {
+		return nil, errors.New("invalid action")
+	}
+	entries := make([]scrapeResponseEntry, count)
+	err = binary.Read(r, binary.BigEndian, entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -136,7 +136,7 @@ func (t *Transport) Run() {
 				}
 			} else {
 				if !conn.connectedAt.IsZero() {
-					req.ConnectionID = conn.id
+					req.SetConnectionID(conn.id)
 					trx, err := beginTransaction(req)
 					if err != nil {
 						trx.request.SetResponse(nil, err)
@@ -184,7 +184,7 @@ func (t *Transport) Run() {
 
 			// Start announce transaction for all waiting requests.
 			for _, req := range conn.requests {
-				req.ConnectionID = conn.id
+				req.SetConnectionID(conn.id)
 				trx, err := beginTransaction(req)
 				if err != nil {
 					trx.request.SetResponse(nil, err)
@@ -359,7 +359,12 @@ func retryTransaction(trx *transaction, conn *net.UDPConn, addr net.Addr) {
 	defer ticker.Stop()
 	for {
 		select {
-		case <-ticker.C:
+		case _, ok := <-ticker.C:
+			if !ok {
+				// Retransmission limit is reached. Wait until the transaction is canceled.
+				<-trx.ctx.Done()
+				return
+			}
 			_, _ = conn.WriteTo(data, addr)
 		case <-trx.ctx.Done():
 			return
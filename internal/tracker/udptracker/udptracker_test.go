@@ -2,6 +2,8 @@ package udptracker_test
 
 import (
 	"context"
+	"encoding/binary"
+	"net"
 	"net/url"
 	"strconv"
 	"testing"
@@ -13,6 +15,7 @@ import (
 	"github.com/chihaya/chihaya/middleware"
 	"github.com/chihaya/chihaya/storage"
 	_ "github.com/chihaya/chihaya/storage/memory"
+	"github.com/stretchr/testify/assert"
 )
 
 const timeout = 2 * time.Second
@@ -96,3 +99,155 @@ func TestUDPTracker(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// startMinimalUDPTracker starts a UDP tracker that implements only connect, announce and scrape actions of BEP 15.
+// Announce requests are sent to announceC.
+func startMinimalUDPTracker(t *testing.T, peers []byte, announceC chan []byte) (addr string, stop func()) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const connectionID = 0x1234
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, raddr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < 16 {
+				continue
+			}
+			connID := binary.BigEndian.Uint64(buf[0:8])
+			action := binary.BigEndian.Uint32(buf[8:12])
+			txID := binary.BigEndian.Uint32(buf[12:16])
+			var resp []byte
+			switch {
+			case action == 0 && connID == 0x41727101980:
+				resp = make([]byte, 16)
+				binary.BigEndian.PutUint32(resp[0:4], 0)
+				binary.BigEndian.PutUint32(resp[4:8], txID)
+				binary.BigEndian.PutUint64(resp[8:16], connectionID)
+			case action == 2 && connID == connectionID:
+				// Reply with stats derived from first byte of info hash.
+				resp = make([]byte, 8)
+				binary.BigEndian.PutUint32(resp[0:4], 2)
+				binary.BigEndian.PutUint32(resp[4:8], txID)
+				for i := 16; i+20 <= n; i += 20 {
+					b := uint32(buf[i])
+					var entry [12]byte
+					binary.BigEndian.PutUint32(entry[0:4], b)    // seeders
+					binary.BigEndian.PutUint32(entry[4:8], b*2)  // completed
+					binary.BigEndian.PutUint32(entry[8:12], b*3) // leechers
+					resp = append(resp, entry[:]...)
+				}
+			case action == 1 && connID == connectionID && n >= 98:
+				req := make([]byte, n)
+				copy(req, buf[:n])
+				announceC <- req
+				resp = make([]byte, 20, 20+len(peers))
+				binary.BigEndian.PutUint32(resp[0:4], 1)
+				binary.BigEndian.PutUint32(resp[4:8], txID)
+				binary.BigEndian.PutUint32(resp[8:12], 1800) // interval
+				binary.BigEndian.PutUint32(resp[12:16], 3)   // leechers
+				binary.BigEndian.PutUint32(resp[16:20], 4)   // seeders
+				resp = append(resp, peers...)
+			default:
+				continue
+			}
+			_, _ = conn.WriteToUDP(resp, raddr)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestUDPTrackerMinimalServer(t *testing.T) {
+	announceC := make(chan []byte, 1)
+	peers := []byte{
+		10, 0, 0, 1, 0x1a, 0xe1, // 10.0.0.1:6881
+		10, 0, 0, 2, 0x1a, 0xe2, // 10.0.0.2:6882
+	}
+	addr, stop := startMinimalUDPTracker(t, peers, announceC)
+	defer stop()
+
+	rawURL := "udp://" + addr + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := udptracker.NewTransport(nil, 5*time.Second)
+	go tr.Run()
+	defer tr.Close()
+	trk := udptracker.New(rawURL, u, tr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req := tracker.AnnounceRequest{
+		Torrent: tracker.Torrent{
+			InfoHash:  [20]byte{6},
+			PeerID:    [20]byte{1},
+			Port:      1111,
+			BytesLeft: 30,
+		},
+		Event:   tracker.EventStarted,
+		NumWant: 50,
+	}
+	resp, err := trk.Announce(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	announce := <-announceC
+	assert.Equal(t, req.Torrent.InfoHash[:], announce[16:36])
+	assert.Equal(t, req.Torrent.PeerID[:], announce[36:56])
+	assert.Equal(t, uint64(30), binary.BigEndian.Uint64(announce[64:72]))
+	assert.Equal(t, uint32(tracker.EventStarted), binary.BigEndian.Uint32(announce[80:84]))
+	assert.Equal(t, uint32(50), binary.BigEndian.Uint32(announce[92:96]))
+	assert.Equal(t, uint16(1111), binary.BigEndian.Uint16(announce[96:98]))
+
+	assert.Equal(t, 30*time.Minute, resp.Interval)
+	assert.Equal(t, int32(3), resp.Leechers)
+	assert.Equal(t, int32(4), resp.Seeders)
+	assert.Equal(t, []*net.TCPAddr{
+		{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 6881},
+		{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 6882},
+	}, resp.Peers)
+}
+
+func TestUDPTrackerScrape(t *testing.T) {
+	addr, stop := startMinimalUDPTracker(t, nil, nil)
+	defer stop()
+
+	rawURL := "udp://" + addr + "/announce"
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := udptracker.NewTransport(nil, 5*time.Second)
+	go tr.Run()
+	defer tr.Close()
+	trk := udptracker.New(rawURL, u, tr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// More than fits into a single request.
+	infoHashes := make([][20]byte, 100)
+	for i := range infoHashes {
+		infoHashes[i][0] = byte(i)
+		infoHashes[i][1] = 1
+	}
+	results, err := trk.Scrape(ctx, infoHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, results, len(infoHashes))
+	for i, ih := range infoHashes {
+		assert.Equal(t, tracker.ScrapeResult{
+			Complete:   int32(i),
+			Downloaded: int32(i * 2),
+			Incomplete: int32(i * 3),
+		}, results[ih])
+	}
+}
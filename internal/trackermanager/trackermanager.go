@@ -3,6 +3,7 @@ package trackermanager
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,18 +15,24 @@ import (
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/tracker/httptracker"
 	"github.com/cenkalti/rain/internal/tracker/udptracker"
+	"golang.org/x/net/proxy"
 )
 
+var errUDPProxy = errors.New("UDP trackers are not supported when a proxy is used")
+
 // TrackerManager is a manager for using the same transport for same domains/IPs.
 // Manages both HTTP and UDP trackers.
 type TrackerManager struct {
 	httpTransport *http.Transport
 	udpTransport  *udptracker.Transport
+	proxy         proxy.ContextDialer
 }
 
 // New returns a new TrackerManager.
-func New(bl *blocklist.Blocklist, dnsTimeout time.Duration, tlsSkipVerify bool) *TrackerManager {
+// If proxyDialer is not nil, HTTP trackers are connected through it and UDP trackers are not supported.
+func New(bl *blocklist.Blocklist, dnsTimeout time.Duration, tlsSkipVerify bool, proxyDialer proxy.ContextDialer) *TrackerManager {
 	m := &TrackerManager{
+		proxy: proxyDialer,
 		httpTransport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: tlsSkipVerify}, // nolint: gosec
 		},
@@ -33,6 +40,11 @@ func New(bl *blocklist.Blocklist, dnsTimeout time.Duration, tlsSkipVerify bool)
 	}
 	go m.udpTransport.Run()
 	m.httpTransport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if m.proxy != nil {
+			// Host name is resolved by the proxy to prevent leaking DNS queries.
+			// Blocklist is not applied because the IP address is not known.
+			return m.proxy.DialContext(ctx, network, addr)
+		}
 		ip, port, err := resolver.Resolve(ctx, addr, dnsTimeout, bl)
 		if err != nil {
 			return nil, err
@@ -60,6 +72,9 @@ func (m *TrackerManager) Get(s string, httpTimeout time.Duration, httpUserAgent
 		tr := httptracker.New(s, u, httpTimeout, m.httpTransport, httpUserAgent, httpMaxResponseLength)
 		return tr, nil
 	case "udp":
+		if m.proxy != nil {
+			return nil, errUDPProxy
+		}
 		tr := udptracker.New(s, u, m.udpTransport)
 		return tr, nil
 	default:
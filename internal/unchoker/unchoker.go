@@ -48,17 +48,33 @@ func New(numUnchoked, numOptimisticUnchoked int) *Unchoker {
 	}
 }
 
+// SetNumUnchoked changes the number of peers to be unchoked.
+// Excess peers are choked at next call to TickUnchoke.
+func (u *Unchoker) SetNumUnchoked(n int) {
+	u.numUnchoked = n
+}
+
+// ChokeAll chokes all peers including the optimistic unchoked ones.
+func (u *Unchoker) ChokeAll(allPeers []Peer) {
+	for _, pe := range allPeers {
+		u.chokePeer(pe)
+	}
+}
+
 // HandleDisconnect must be called to remove the peer from internal indexes.
 func (u *Unchoker) HandleDisconnect(pe Peer) {
 	delete(u.peersUnchoked, pe)
 	delete(u.peersUnchokedOptimistic, pe)
 }
 
+// candidatesUnchoke returns interested peers. Peers that are not interested are choked so they don't hold unchoke slots.
 func (u *Unchoker) candidatesUnchoke(allPeers []Peer) []Peer {
 	peers := allPeers[:0]
 	for _, pe := range allPeers {
 		if pe.Interested() {
 			peers = append(peers, pe)
+		} else {
+			u.chokePeer(pe)
 		}
 	}
 	return peers
@@ -74,7 +90,7 @@ func (u *Unchoker) sortPeers(peers []Peer, completed bool) {
 	}
 }
 
-// TickUnchoke must be called at every 10 seconds.
+// TickUnchoke must be called at every choking round, which is 10 seconds by default.
 func (u *Unchoker) TickUnchoke(allPeers []Peer, torrentCompleted bool) {
 	optimistic := u.round == 0
 	peers := u.candidatesUnchoke(allPeers)
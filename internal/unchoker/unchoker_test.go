@@ -1,6 +1,7 @@
 package unchoker
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -159,3 +160,53 @@ func (p *TestPeer) Optimistic() bool         { return p.optimistic }
 func (p *TestPeer) SetOptimistic(value bool) { p.optimistic = value }
 func (p *TestPeer) DownloadSpeed() int       { return p.downloadSpeed }
 func (p *TestPeer) UploadSpeed() int         { return p.uploadSpeed }
+
+func TestUnchokeSlotsChurn(t *testing.T) {
+	const numOptimistic = 1
+	r := rand.New(rand.NewSource(1)) // nolint: gosec
+	testPeers := make([]*TestPeer, 30)
+	for i := range testPeers {
+		testPeers[i] = &TestPeer{choking: true}
+	}
+	getPeers := func() []Peer {
+		peers := make([]Peer, len(testPeers))
+		for i := range peers {
+			peers[i] = testPeers[i]
+		}
+		return peers
+	}
+	count := func() (unchoked, optimistic int) {
+		for _, pe := range testPeers {
+			if pe.choking || !pe.interested {
+				continue
+			}
+			if pe.optimistic {
+				optimistic++
+			} else {
+				unchoked++
+			}
+		}
+		return
+	}
+	slots := 4
+	u := New(slots, numOptimistic)
+	for i := 0; i < 1000; i++ {
+		pe := testPeers[r.Intn(len(testPeers))]
+		pe.interested = r.Intn(2) == 0
+		pe.downloadSpeed = r.Intn(100)
+		pe.uploadSpeed = r.Intn(100)
+		if pe.interested {
+			u.FastUnchoke(pe)
+		}
+		if r.Intn(50) == 0 {
+			slots = r.Intn(6)
+			u.SetNumUnchoked(slots)
+			u.TickUnchoke(getPeers(), false)
+		} else if r.Intn(5) == 0 {
+			u.TickUnchoke(getPeers(), r.Intn(2) == 0)
+		}
+		unchoked, optimistic := count()
+		assert.LessOrEqual(t, unchoked, slots)
+		assert.LessOrEqual(t, optimistic, numOptimistic)
+	}
+}
@@ -2,23 +2,26 @@ package urldownloader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/rain/internal/bufferpool"
 	"github.com/cenkalti/rain/internal/piece"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/speedlimit"
 )
 
 // URLDownloader downloads files from a HTTP source.
 type URLDownloader struct {
 	URL                 string
 	Begin, End, current uint32 // piece index
-	bucket              *ratelimit.Bucket
+	bucket              *speedlimit.Limiter
 	closeC, doneC       chan struct{}
 }
 
@@ -32,7 +35,7 @@ type PieceResult struct {
 }
 
 // New returns a new URLDownloader for the given source and piece range.
-func New(source string, begin, end uint32, b *ratelimit.Bucket) *URLDownloader {
+func New(source string, begin, end uint32, b *speedlimit.Limiter) *URLDownloader {
 	return &URLDownloader{
 		URL:     source,
 		Begin:   begin,
@@ -105,7 +108,7 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 			return false
 		}
 		defer resp.Body.Close()
-		err = checkStatus(resp)
+		err = checkStatus(resp, job.RangeBegin)
 		if err != nil {
 			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
 			return false
@@ -181,14 +184,23 @@ func (d *URLDownloader) getURL(filename string, multifile bool) string {
 	src := d.URL
 	if !multifile {
 		if src[len(src)-1] == '/' {
-			src += url.PathEscape(filename)
+			src += escapePath(filename)
 		}
 		return src
 	}
 	if src[len(src)-1] != '/' {
 		src += "/"
 	}
-	return src + url.PathEscape(filename)
+	return src + escapePath(filename)
+}
+
+// escapePath escapes each segment of the file path so directory separators are kept in the URL.
+func escapePath(filename string) string {
+	parts := strings.Split(filepath.ToSlash(filename), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
 }
 
 func (d *URLDownloader) sendResult(resultC chan *PieceResult, res *PieceResult) {
@@ -203,9 +215,16 @@ func (d *URLDownloader) sendResult(resultC chan *PieceResult, res *PieceResult)
 	}
 }
 
-func checkStatus(resp *http.Response) error {
+func checkStatus(resp *http.Response, rangeBegin int64) error {
 	switch resp.StatusCode {
-	case 200, 206:
+	case 206:
+		return nil
+	case 200:
+		// Server does not support range requests and sends the whole file.
+		// The response is usable only if the requested range starts at the beginning of file.
+		if rangeBegin != 0 {
+			return errors.New("server does not support range requests")
+		}
 		return nil
 	default:
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
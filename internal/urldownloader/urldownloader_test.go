@@ -0,0 +1,104 @@
+package urldownloader
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bufferpool"
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveFiles(files map[string][]byte, rangeSupport bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !rangeSupport {
+			_, _ = w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func download(t *testing.T, source string, pieces []piece.Piece, multifile bool) [][]byte {
+	resultC := make(chan *PieceResult)
+	d := New(source, 0, uint32(len(pieces)), nil)
+	go d.Run(http.DefaultClient, pieces, multifile, resultC, bufferpool.New(int(pieces[0].Length)), time.Second)
+	defer d.Close()
+	var ret [][]byte
+	for {
+		select {
+		case res := <-resultC:
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+			assert.Equal(t, uint32(len(ret)), res.Index)
+			ret = append(ret, append([]byte(nil), res.Buffer.Data...))
+			res.Buffer.Release()
+			if res.Done {
+				return ret
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestDownloadMultiFile(t *testing.T) {
+	srv := serveFiles(map[string][]byte{
+		"/seed/torrent/dir/a": []byte("0123456"),
+		"/seed/torrent/b c":   []byte("789"),
+	}, true)
+	defer srv.Close()
+
+	pieces := []piece.Piece{
+		{Index: 0, Length: 4, Data: filesection.Piece{
+			{Name: "torrent/dir/a", Offset: 0, Length: 4},
+		}},
+		{Index: 1, Length: 4, Data: filesection.Piece{
+			{Name: "torrent/dir/a", Offset: 4, Length: 3},
+			{Name: "torrent/b c", Offset: 0, Length: 1},
+		}},
+		{Index: 2, Length: 2, Data: filesection.Piece{
+			{Name: "torrent/b c", Offset: 1, Length: 2},
+		}},
+	}
+	data := download(t, srv.URL+"/seed", pieces, true)
+	assert.Equal(t, [][]byte{[]byte("0123"), []byte("4567"), []byte("89")}, data)
+}
+
+func TestDownloadSingleFile(t *testing.T) {
+	srv := serveFiles(map[string][]byte{"/file.bin": []byte("abcdef")}, true)
+	defer srv.Close()
+
+	pieces := []piece.Piece{
+		{Index: 0, Length: 4, Data: filesection.Piece{{Name: "torrent", Offset: 0, Length: 4}}},
+		{Index: 1, Length: 2, Data: filesection.Piece{{Name: "torrent", Offset: 4, Length: 2}}},
+	}
+	data := download(t, srv.URL+"/file.bin", pieces, false)
+	assert.Equal(t, [][]byte{[]byte("abcd"), []byte("ef")}, data)
+}
+
+func TestDownloadRangeNotSupported(t *testing.T) {
+	srv := serveFiles(map[string][]byte{"/file.bin": []byte("abcdef")}, false)
+	defer srv.Close()
+
+	pieces := []piece.Piece{
+		{Index: 0, Length: 4, Data: filesection.Piece{{Name: "torrent", Offset: 0, Length: 4}}},
+		{Index: 1, Length: 2, Data: filesection.Piece{{Name: "torrent", Offset: 4, Length: 2}}},
+	}
+	resultC := make(chan *PieceResult)
+	d := New(srv.URL+"/file.bin", 1, 2, nil)
+	go d.Run(http.DefaultClient, pieces, false, resultC, bufferpool.New(4), time.Second)
+	defer d.Close()
+	res := <-resultC
+	assert.Error(t, res.Error)
+}
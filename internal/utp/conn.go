@@ -0,0 +1,603 @@
+package utp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxPayload keeps packets below the common path MTU after IP and UDP headers are added.
+	maxPayload = 1200
+	// maxSendWindow is the number of bytes in flight when the peer advertises a larger window.
+	maxSendWindow = 256 * 1024
+	// initialCongestionWindow is the number of bytes sent before the first ack is received.
+	initialCongestionWindow = 10 * maxPayload
+	minCongestionWindow     = 2 * maxPayload
+	// maxRecvBuffer is the number of bytes buffered before they are read by the application.
+	maxRecvBuffer = 1024 * 1024
+	// maxOutOfOrder is the number of packets ahead of the last in-order packet that are buffered.
+	maxOutOfOrder = 1024
+
+	initialRTO          = time.Second
+	minRTO              = 500 * time.Millisecond
+	maxRTO              = 16 * time.Second
+	maxTransmissions    = 8
+	maxSynTransmissions = 4
+	tickInterval        = 100 * time.Millisecond
+	lingerTimeout       = 5 * time.Second
+	fastRetransmitAcks  = 3
+)
+
+var (
+	errReset   = errors.New("connection reset by peer")
+	errTimeout = errors.New("connection timed out")
+)
+
+type connState int
+
+const (
+	stateSynSent connState = iota
+	stateConnected
+)
+
+type packet struct {
+	typ           uint8
+	seq           uint16
+	payload       []byte
+	sentAt        time.Time
+	transmissions int
+}
+
+// Conn is a uTP connection. It implements net.Conn.
+type Conn struct {
+	socket *Socket
+	raddr  net.Addr
+	recvID uint16
+	sendID uint16
+
+	m    sync.Mutex
+	cond *sync.Cond
+
+	state      connState
+	seqNr      uint16
+	ackNr      uint16
+	initialSeq uint16
+	peerWnd    uint32
+	replyMicro uint32
+
+	outQueue []*packet
+	inflight int
+	lastAck  uint16
+	dupAcks  int
+	// Packets up to recoverSeq were in flight when a loss was detected.
+	recovering bool
+	recoverSeq uint16
+	cwnd       int
+	ssthresh   int
+
+	srtt   time.Duration
+	rttvar time.Duration
+	rto    time.Duration
+
+	readBuf     bytes.Buffer
+	outOfOrder  map[uint16][]byte
+	oooBytes    int
+	lastWndSent uint32
+	finReceived bool
+	finSeq      uint16
+	eof         bool
+
+	closed      bool
+	lingerUntil time.Time
+	err         error
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	writeTimer    *time.Timer
+
+	establishedC chan struct{}
+	doneC        chan struct{}
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+func newConn(s *Socket, raddr net.Addr, recvID, sendID uint16) *Conn {
+	c := &Conn{
+		socket:       s,
+		raddr:        raddr,
+		recvID:       recvID,
+		sendID:       sendID,
+		rto:          initialRTO,
+		cwnd:         initialCongestionWindow,
+		ssthresh:     maxSendWindow,
+		outOfOrder:   make(map[uint16][]byte),
+		establishedC: make(chan struct{}),
+		doneC:        make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.m)
+	return c
+}
+
+// LocalAddr returns the address of the UDP socket.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.socket.Addr()
+}
+
+// RemoteAddr returns the UDP address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// Read reads in-order data from the connection. It returns io.EOF after the peer has closed the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for {
+		if c.closed {
+			return 0, net.ErrClosed
+		}
+		if c.readBuf.Len() > 0 {
+			n, _ := c.readBuf.Read(b)
+			// Let the peer know that it can send again if the window was almost closed.
+			if c.lastWndSent < maxRecvBuffer/2 && c.recvWindow() >= maxRecvBuffer/2 && c.err == nil {
+				c.sendState()
+			}
+			return n, nil
+		}
+		if c.eof {
+			return 0, io.EOF
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if deadlineExceeded(c.readDeadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.cond.Wait()
+	}
+}
+
+// Write splits b into packets and sends them as the send window allows.
+// It blocks until all of b is sent, but does not wait for it to be acknowledged.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var n int
+	for len(b) > 0 {
+		size := len(b)
+		if size > maxPayload {
+			size = maxPayload
+		}
+		for {
+			if c.closed {
+				return n, net.ErrClosed
+			}
+			if c.err != nil {
+				return n, c.err
+			}
+			if deadlineExceeded(c.writeDeadline) {
+				return n, os.ErrDeadlineExceeded
+			}
+			if c.inflight == 0 || (c.inflight+size <= c.sendWindow() && len(c.outQueue) < maxOutOfOrder) {
+				break
+			}
+			c.cond.Wait()
+		}
+		p := &packet{typ: stData, seq: c.seqNr, payload: append([]byte(nil), b[:size]...)}
+		c.seqNr++
+		c.outQueue = append(c.outQueue, p)
+		c.inflight += size
+		c.transmit(p)
+		b = b[size:]
+		n += size
+	}
+	return n, nil
+}
+
+// Close sends a FIN packet after the data already written.
+// The connection is kept open in the background until the FIN is acknowledged.
+func (c *Conn) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.stopTimers()
+	c.cond.Broadcast()
+	if c.err != nil {
+		return nil
+	}
+	if c.state != stateConnected {
+		c.destroy(net.ErrClosed)
+		return nil
+	}
+	p := &packet{typ: stFin, seq: c.seqNr}
+	c.seqNr++
+	c.outQueue = append(c.outQueue, p)
+	c.transmit(p)
+	return nil
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.setTimer(&c.readTimer, t)
+	c.setTimer(&c.writeTimer, t)
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read calls.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readDeadline = t
+	c.setTimer(&c.readTimer, t)
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write calls.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.writeDeadline = t
+	c.setTimer(&c.writeTimer, t)
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *Conn) setTimer(timer **time.Timer, t time.Time) {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if t.IsZero() {
+		return
+	}
+	*timer = time.AfterFunc(time.Until(t), func() {
+		c.m.Lock()
+		c.cond.Broadcast()
+		c.m.Unlock()
+	})
+}
+
+func (c *Conn) stopTimers() {
+	c.setTimer(&c.readTimer, time.Time{})
+	c.setTimer(&c.writeTimer, time.Time{})
+}
+
+func deadlineExceeded(t time.Time) bool {
+	return !t.IsZero() && !time.Now().Before(t)
+}
+
+func (c *Conn) sendWindow() int {
+	if int64(c.peerWnd) < int64(c.cwnd) {
+		return int(c.peerWnd)
+	}
+	return c.cwnd
+}
+
+func (c *Conn) recvWindow() uint32 {
+	buffered := c.readBuf.Len() + c.oooBytes
+	if buffered >= maxRecvBuffer {
+		return 0
+	}
+	return uint32(maxRecvBuffer - buffered)
+}
+
+// transmit sends p with the current ack number.
+func (c *Conn) transmit(p *packet) {
+	p.sentAt = time.Now()
+	p.transmissions++
+	c.send(p.typ, p.seq, p.payload)
+}
+
+func (c *Conn) sendState() {
+	if c.state == stateSynSent {
+		return
+	}
+	c.send(stState, c.seqNr, nil)
+}
+
+func (c *Conn) send(typ uint8, seq uint16, payload []byte) {
+	connID := c.sendID
+	if typ == stSyn {
+		connID = c.recvID
+	}
+	h := header{
+		Type:          typ,
+		ConnID:        connID,
+		Timestamp:     nowMicros(),
+		TimestampDiff: c.replyMicro,
+		WndSize:       c.recvWindow(),
+		SeqNr:         seq,
+		AckNr:         c.ackNr,
+	}
+	c.lastWndSent = h.WndSize
+	c.socket.writePacket(&h, payload, c.raddr)
+}
+
+func nowMicros() uint32 {
+	return uint32(time.Now().UnixNano() / int64(time.Microsecond))
+}
+
+// handlePacket processes a packet received from the peer. The payload is only valid during the call.
+func (c *Conn) handlePacket(h *header, payload []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.replyMicro = nowMicros() - h.Timestamp
+	switch h.Type {
+	case stReset:
+		c.destroy(errReset)
+		return
+	case stSyn:
+		// Our STATE reply is lost, SYN is retransmitted.
+		c.send(stState, c.initialSeq, nil)
+		return
+	}
+	if c.state == stateSynSent {
+		c.ackNr = h.SeqNr - 1
+		c.state = stateConnected
+		close(c.establishedC)
+	}
+	c.peerWnd = h.WndSize
+	c.handleAck(h.AckNr, h.Type == stState)
+	switch h.Type {
+	case stData:
+		c.handleData(h.SeqNr, payload)
+	case stFin:
+		c.handleFin(h.SeqNr)
+	}
+	c.cond.Broadcast()
+	c.checkClosed()
+}
+
+func (c *Conn) handleAck(ack uint16, isState bool) {
+	// Ignore acks for packets that are not sent yet.
+	if seqLess(c.seqNr-1, ack) {
+		return
+	}
+	var acked bool
+	var ackedBytes int
+	for len(c.outQueue) > 0 && !seqLess(ack, c.outQueue[0].seq) {
+		p := c.outQueue[0]
+		c.outQueue[0] = nil
+		c.outQueue = c.outQueue[1:]
+		c.inflight -= len(p.payload)
+		ackedBytes += len(p.payload)
+		if p.transmissions == 1 {
+			c.updateRTT(time.Since(p.sentAt))
+		}
+		acked = true
+	}
+	if acked {
+		c.dupAcks = 0
+		c.rto = c.computeRTO()
+		if !c.recovering {
+			c.growWindow(ackedBytes)
+		} else {
+			if seqLess(ack, c.recoverSeq) && len(c.outQueue) > 0 {
+				// Partial ack, the next packet is lost too.
+				c.transmit(c.outQueue[0])
+			} else {
+				c.recovering = false
+			}
+		}
+	} else if isState && ack == c.lastAck && len(c.outQueue) > 0 {
+		c.dupAcks++
+		if c.dupAcks == fastRetransmitAcks {
+			c.retransmit()
+		}
+	}
+	c.lastAck = ack
+}
+
+// growWindow increases the congestion window exponentially until ssthresh and linearly after that.
+func (c *Conn) growWindow(ackedBytes int) {
+	if c.cwnd < c.ssthresh {
+		c.cwnd += ackedBytes
+	} else {
+		c.cwnd += maxPayload * ackedBytes / c.cwnd
+	}
+	if c.cwnd > maxSendWindow {
+		c.cwnd = maxSendWindow
+	}
+}
+
+// shrinkWindow halves the congestion window on packet loss.
+func (c *Conn) shrinkWindow() {
+	c.ssthresh = c.inflight / 2
+	if c.ssthresh < minCongestionWindow {
+		c.ssthresh = minCongestionWindow
+	}
+	c.cwnd = c.ssthresh
+}
+
+// updateRTT updates the round trip time estimate as described in RFC 6298.
+func (c *Conn) updateRTT(sample time.Duration) {
+	if c.srtt == 0 {
+		c.srtt = sample
+		c.rttvar = sample / 2
+		return
+	}
+	delta := c.srtt - sample
+	if delta < 0 {
+		delta = -delta
+	}
+	c.rttvar = (3*c.rttvar + delta) / 4
+	c.srtt = (7*c.srtt + sample) / 8
+}
+
+func (c *Conn) computeRTO() time.Duration {
+	if c.srtt == 0 {
+		return initialRTO
+	}
+	rto := c.srtt + 4*c.rttvar
+	if rto < minRTO {
+		rto = minRTO
+	}
+	if rto > maxRTO {
+		rto = maxRTO
+	}
+	return rto
+}
+
+func (c *Conn) handleData(seq uint16, payload []byte) {
+	if c.finReceived && !seqLess(seq, c.finSeq) {
+		return
+	}
+	// Duplicate packet, our ack may be lost.
+	if !seqLess(c.ackNr, seq) {
+		c.sendState()
+		return
+	}
+	if seq-c.ackNr > maxOutOfOrder || c.readBuf.Len()+c.oooBytes+len(payload) > maxRecvBuffer {
+		// Drop without ack, the peer is going to retransmit it.
+		return
+	}
+	if seq == c.ackNr+1 {
+		c.readBuf.Write(payload)
+		c.ackNr = seq
+		for {
+			b, ok := c.outOfOrder[c.ackNr+1]
+			if !ok {
+				break
+			}
+			delete(c.outOfOrder, c.ackNr+1)
+			c.oooBytes -= len(b)
+			c.readBuf.Write(b)
+			c.ackNr++
+		}
+		if c.finReceived && c.ackNr+1 == c.finSeq {
+			c.ackNr = c.finSeq
+			c.eof = true
+		}
+	} else if _, ok := c.outOfOrder[seq]; !ok {
+		c.outOfOrder[seq] = append([]byte(nil), payload...)
+		c.oooBytes += len(payload)
+	}
+	c.sendState()
+}
+
+func (c *Conn) handleFin(seq uint16) {
+	if !c.finReceived {
+		c.finReceived = true
+		c.finSeq = seq
+		if c.ackNr+1 == seq {
+			c.ackNr = seq
+			c.eof = true
+		}
+	}
+	c.sendState()
+}
+
+// checkClosed destroys the connection after it is closed locally and all packets are acknowledged.
+// If the peer has not sent its FIN yet, the connection lingers for a while to acknowledge it.
+func (c *Conn) checkClosed() {
+	if !c.closed || len(c.outQueue) > 0 || c.err != nil {
+		return
+	}
+	if c.eof {
+		c.destroy(net.ErrClosed)
+		return
+	}
+	if c.lingerUntil.IsZero() {
+		c.lingerUntil = time.Now().Add(lingerTimeout)
+	}
+}
+
+// tick retransmits the oldest unacknowledged packet after its timeout.
+func (c *Conn) tick() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	if !c.lingerUntil.IsZero() && time.Now().After(c.lingerUntil) {
+		c.destroy(net.ErrClosed)
+		return
+	}
+	if len(c.outQueue) == 0 {
+		return
+	}
+	p := c.outQueue[0]
+	if time.Since(p.sentAt) < c.rto {
+		return
+	}
+	limit := maxTransmissions
+	if p.typ == stSyn {
+		limit = maxSynTransmissions
+	}
+	if p.transmissions >= limit {
+		c.destroy(errTimeout)
+		return
+	}
+	c.rto *= 2
+	if c.rto > maxRTO {
+		c.rto = maxRTO
+	}
+	c.retransmit()
+	c.cwnd = minCongestionWindow
+}
+
+// retransmit sends the oldest unacknowledged packet again and starts recovery,
+// during which each partial ack also retransmits the next packet.
+func (c *Conn) retransmit() {
+	if !c.recovering {
+		c.shrinkWindow()
+	}
+	c.recovering = true
+	c.recoverSeq = c.seqNr - 1
+	c.transmit(c.outQueue[0])
+}
+
+func (c *Conn) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.tick()
+		case <-c.doneC:
+			return
+		}
+	}
+}
+
+// destroy removes the connection from the socket. Blocked calls return err.
+func (c *Conn) destroy(err error) {
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.outQueue = nil
+	c.inflight = 0
+	if c.state == stateSynSent {
+		close(c.establishedC)
+	}
+	close(c.doneC)
+	c.stopTimers()
+	c.socket.removeConn(c)
+	c.cond.Broadcast()
+}
+
+// fail is called by the socket when it is closed.
+func (c *Conn) fail(err error) {
+	c.m.Lock()
+	c.destroy(err)
+	c.m.Unlock()
+}
@@ -0,0 +1,56 @@
+package utp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	h := header{
+		Type:          stData,
+		ConnID:        1234,
+		Timestamp:     5,
+		TimestampDiff: 6,
+		WndSize:       7,
+		SeqNr:         8,
+		AckNr:         9,
+	}
+	b := make([]byte, headerSize, headerSize+10)
+	h.marshal(b)
+	if b[0] != 0x01 {
+		t.Fatalf("unexpected type and version: %x", b[0])
+	}
+	// Selective ack extension with a 4 byte bitmask is skipped.
+	b[1] = 1
+	b = append(b, 0, 4, 0xff, 0xff, 0xff, 0xff)
+	b = append(b, "data"...)
+
+	var h2 header
+	payload, err := h2.unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2 != h {
+		t.Fatalf("unexpected header: %+v", h2)
+	}
+	if !bytes.Equal(payload, []byte("data")) {
+		t.Fatalf("unexpected payload: %q", payload)
+	}
+
+	if _, err = h2.unmarshal(b[:headerSize+3]); err != errInvalidPacket {
+		t.Fatalf("truncated extension is parsed: %v", err)
+	}
+	b[0] = 0x02
+	if _, err = h2.unmarshal(b); err != errInvalidPacket {
+		t.Fatalf("invalid version is parsed: %v", err)
+	}
+}
+
+func TestSeqLess(t *testing.T) {
+	if !seqLess(1, 2) || seqLess(2, 1) || seqLess(1, 1) {
+		t.Fatal("invalid comparison")
+	}
+	if !seqLess(65535, 0) || seqLess(0, 65535) {
+		t.Fatal("invalid comparison on wrap around")
+	}
+}
@@ -0,0 +1,251 @@
+// Package utp implements the Micro Transport Protocol (BEP 29) for peer connections over UDP.
+//
+// Connections are reliable and ordered like TCP connections. LEDBAT congestion control is not implemented;
+// the send window is a loss based congestion window limited by the window advertised by the peer.
+// Lost packets are retransmitted after a timeout or after three duplicate acks. Selective acks are not sent.
+package utp
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+)
+
+const acceptBacklog = 32
+
+// Socket multiplexes uTP connections over a single UDP socket.
+// It implements net.Listener for incoming connections and DialContext for outgoing connections.
+type Socket struct {
+	pc        net.PacketConn
+	m         sync.Mutex
+	conns     map[connKey]*Conn
+	acceptC   chan *Conn
+	closeC    chan struct{}
+	closeOnce sync.Once
+	doneC     chan struct{}
+}
+
+type connKey struct {
+	addr string
+	id   uint16
+}
+
+var _ net.Listener = (*Socket)(nil)
+
+// Listen opens a UDP socket on address for uTP connections.
+func Listen(network, address string) (*Socket, error) {
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewSocket(pc), nil
+}
+
+// NewSocket returns a new Socket that reads packets from pc. The Socket closes pc when it is closed.
+func NewSocket(pc net.PacketConn) *Socket {
+	s := &Socket{
+		pc:      pc,
+		conns:   make(map[connKey]*Conn),
+		acceptC: make(chan *Conn, acceptBacklog),
+		closeC:  make(chan struct{}),
+		doneC:   make(chan struct{}),
+	}
+	go s.read()
+	return s
+}
+
+// Addr returns the local address of the UDP socket.
+func (s *Socket) Addr() net.Addr {
+	return s.pc.LocalAddr()
+}
+
+// Accept waits for the next incoming connection.
+func (s *Socket) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.acceptC:
+		return c, nil
+	case <-s.closeC:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the UDP socket. Open connections are closed without sending a FIN.
+func (s *Socket) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closeC)
+		err = s.pc.Close()
+		<-s.doneC
+		s.m.Lock()
+		conns := make([]*Conn, 0, len(s.conns))
+		for _, c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.m.Unlock()
+		for _, c := range conns {
+			c.fail(net.ErrClosed)
+		}
+	})
+	return err
+}
+
+// DialContext opens a uTP connection to address. TCP network names are accepted and converted to UDP,
+// so the Socket can be used as the dialer of BitTorrent connections.
+func (s *Socket) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if strings.HasPrefix(network, "tcp") {
+		network = "udp" + strings.TrimPrefix(network, "tcp")
+	}
+	raddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	select {
+	case <-s.closeC:
+		s.m.Unlock()
+		return nil, net.ErrClosed
+	default:
+	}
+	var c *Conn
+	for {
+		id := uint16(rand.Intn(1 << 16))
+		key := connKey{addr: raddr.String(), id: id}
+		if _, ok := s.conns[key]; !ok {
+			c = newConn(s, raddr, id, id+1)
+			s.conns[key] = c
+			break
+		}
+	}
+	s.m.Unlock()
+
+	c.m.Lock()
+	c.state = stateSynSent
+	c.seqNr = 1
+	p := &packet{typ: stSyn, seq: c.seqNr}
+	c.seqNr++
+	c.outQueue = append(c.outQueue, p)
+	c.transmit(p)
+	c.m.Unlock()
+	go c.run()
+
+	select {
+	case <-c.establishedC:
+	case <-ctx.Done():
+		c.fail(ctx.Err())
+		return nil, ctx.Err()
+	}
+	c.m.Lock()
+	err = c.err
+	c.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Socket) read() {
+	defer close(s.doneC)
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.closeC:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			go s.Close()
+			return
+		}
+		s.handlePacket(buf[:n], addr)
+	}
+}
+
+func (s *Socket) handlePacket(b []byte, addr net.Addr) {
+	var h header
+	payload, err := h.unmarshal(b)
+	if err != nil {
+		return
+	}
+	key := connKey{addr: addr.String(), id: h.ConnID}
+	if h.Type == stSyn {
+		key.id = h.ConnID + 1
+	}
+	s.m.Lock()
+	c, ok := s.conns[key]
+	if !ok && h.Type == stReset {
+		// The peer may send the reset with either of our connection ids.
+		c, ok = s.conns[connKey{addr: key.addr, id: h.ConnID + 1}]
+		if !ok {
+			c, ok = s.conns[connKey{addr: key.addr, id: h.ConnID - 1}]
+		}
+	}
+	if !ok && h.Type == stSyn {
+		c = newConn(s, addr, h.ConnID+1, h.ConnID)
+		s.conns[key] = c
+		s.m.Unlock()
+		s.accept(c, &h)
+		return
+	}
+	s.m.Unlock()
+	if ok {
+		c.handlePacket(&h, payload)
+	} else if h.Type != stReset {
+		s.sendReset(&h, addr)
+	}
+}
+
+func (s *Socket) accept(c *Conn, syn *header) {
+	c.m.Lock()
+	c.state = stateConnected
+	close(c.establishedC)
+	c.seqNr = uint16(rand.Intn(1 << 16))
+	c.initialSeq = c.seqNr
+	c.ackNr = syn.SeqNr
+	c.lastAck = c.seqNr - 1
+	c.peerWnd = syn.WndSize
+	c.replyMicro = nowMicros() - syn.Timestamp
+	c.sendState()
+	c.m.Unlock()
+	go c.run()
+	select {
+	case s.acceptC <- c:
+	default:
+		// Backlog is full.
+		c.fail(errReset)
+		s.sendReset(syn, c.raddr)
+	}
+}
+
+func (s *Socket) sendReset(h *header, addr net.Addr) {
+	r := header{
+		Type:      stReset,
+		ConnID:    h.ConnID,
+		Timestamp: nowMicros(),
+		SeqNr:     uint16(rand.Intn(1 << 16)),
+		AckNr:     h.SeqNr,
+	}
+	s.writePacket(&r, nil, addr)
+}
+
+func (s *Socket) writePacket(h *header, payload []byte, addr net.Addr) {
+	b := make([]byte, headerSize+len(payload))
+	h.marshal(b)
+	copy(b[headerSize:], payload)
+	// UDP is unreliable anyway. Errors are handled by retransmission timeouts.
+	_, _ = s.pc.WriteTo(b, addr)
+}
+
+func (s *Socket) removeConn(c *Conn) {
+	s.m.Lock()
+	key := connKey{addr: c.raddr.String(), id: c.recvID}
+	if s.conns[key] == c {
+		delete(s.conns, key)
+	}
+	s.m.Unlock()
+}
@@ -0,0 +1,223 @@
+package utp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+const timeout = 10 * time.Second
+
+func newTestSocket(t *testing.T) *Socket {
+	s, err := Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dialAccept(t *testing.T, s1, s2 *Socket) (*Conn, *Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	c1, err := s1.DialContext(ctx, "tcp", s2.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := s2.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c1.(*Conn), c2.(*Conn)
+}
+
+func numConns(s *Socket) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.conns)
+}
+
+func TestDialAccept(t *testing.T) {
+	s1 := newTestSocket(t)
+	s2 := newTestSocket(t)
+	c1, c2 := dialAccept(t, s1, s2)
+	if c2.RemoteAddr().String() != s1.Addr().String() {
+		t.Fatalf("unexpected remote address: %s", c2.RemoteAddr())
+	}
+	_ = c1.SetDeadline(time.Now().Add(timeout))
+	_ = c2.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := c1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c2, b); err != nil || string(b) != "hello" {
+		t.Fatalf("unexpected read: %q %v", b, err)
+	}
+	if _, err := c2.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(c1, b); err != nil || string(b) != "world" {
+		t.Fatalf("unexpected read: %q %v", b, err)
+	}
+
+	// FIN is delivered after the data written before Close.
+	if _, err := c1.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	c1.Close()
+	data, err := io.ReadAll(c2)
+	if err != nil || string(data) != "bye" {
+		t.Fatalf("unexpected read: %q %v", data, err)
+	}
+	c2.Close()
+	if _, err = c1.Read(b); err != net.ErrClosed {
+		t.Fatalf("read from closed connection: %v", err)
+	}
+
+	// Both sides are removed after FINs are acked.
+	deadline := time.Now().Add(timeout)
+	for numConns(s1) > 0 || numConns(s2) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections are not removed: %d %d", numConns(s1), numConns(s2))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// lossyConn drops every nth packet written.
+type lossyConn struct {
+	net.PacketConn
+	n       int
+	m       sync.Mutex
+	count   int
+	dropped int
+}
+
+func (c *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.m.Lock()
+	c.count++
+	drop := c.count%c.n == 0
+	if drop {
+		c.dropped++
+	}
+	c.m.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func TestPacketLoss(t *testing.T) {
+	pc1, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc2, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1 := &lossyConn{PacketConn: pc1, n: 50}
+	l2 := &lossyConn{PacketConn: pc2, n: 30}
+	s1 := NewSocket(l1)
+	defer s1.Close()
+	s2 := NewSocket(l2)
+	defer s2.Close()
+	c1, c2 := dialAccept(t, s1, s2)
+	_ = c1.SetDeadline(time.Now().Add(timeout))
+	_ = c2.SetDeadline(time.Now().Add(timeout))
+
+	data := make([]byte, 300*1024)
+	rand.Read(data)
+	go func() {
+		_, _ = c1.Write(data)
+		c1.Close()
+	}()
+	received, err := io.ReadAll(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatalf("data is corrupted, received %d bytes", len(received))
+	}
+	l1.m.Lock()
+	defer l1.m.Unlock()
+	if l1.dropped == 0 {
+		t.Fatal("no packets are dropped")
+	}
+}
+
+func TestReset(t *testing.T) {
+	s := newTestSocket(t)
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// Data for an unknown connection is answered with a reset.
+	h := header{Type: stData, ConnID: 42, SeqNr: 5}
+	b := make([]byte, headerSize+4)
+	h.marshal(b)
+	if _, err = pc.WriteTo(b, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	_ = pc.SetReadDeadline(time.Now().Add(timeout))
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r header
+	if _, err = r.unmarshal(b[:n]); err != nil {
+		t.Fatal(err)
+	}
+	if r.Type != stReset || r.ConnID != 42 || r.AckNr != 5 {
+		t.Fatalf("unexpected reply: %+v", r)
+	}
+
+	// Reset closes the connection.
+	s1 := newTestSocket(t)
+	c1, c2 := dialAccept(t, s1, s)
+	s.sendReset(&header{ConnID: c2.sendID}, c2.raddr)
+	_ = c1.SetReadDeadline(time.Now().Add(timeout))
+	if _, err = c1.Read(b); err != errReset {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	s1 := newTestSocket(t)
+	s2 := newTestSocket(t)
+	c1, _ := dialAccept(t, s1, s2)
+	_ = c1.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err := c1.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() || err != os.ErrDeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	s := newTestSocket(t)
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// Nothing answers the SYN.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = s.DialContext(ctx, "udp", pc.LocalAddr().String())
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if numConns(s) != 0 {
+		t.Fatal("connection is not removed")
+	}
+}
@@ -2,6 +2,8 @@ package verifier
 
 import (
 	"crypto/sha1"
+	"runtime"
+	"sync"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/piece"
@@ -36,7 +38,8 @@ func (v *Verifier) Close() {
 }
 
 // Run and verify all pieces of the torrent.
-func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC chan *Verifier) {
+// Pieces are read and hashed in parallel by a number of workers. If workers is not positive, the number of CPUs is used.
+func (v *Verifier) Run(pieces []piece.Piece, workers int, progressC chan Progress, resultC chan *Verifier) {
 	defer close(v.doneC)
 
 	defer func() {
@@ -46,26 +49,87 @@ func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC ch
 		}
 	}()
 
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(pieces) {
+		workers = len(pieces)
+	}
+
+	indexC := make(chan int)
+	checkedC := make(chan checkResult)
+	stopC := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			checkPieces(pieces, indexC, checkedC, stopC)
+		}()
+	}
+	go func() {
+		defer close(indexC)
+		for i := range pieces {
+			select {
+			case indexC <- i:
+			case <-stopC:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(checkedC)
+	}()
+	// Workers must be finished before sending the result because they read from files.
+	defer func() {
+		close(stopC)
+		for range checkedC {
+		}
+	}()
+
+	// Results are collected in this goroutine, so bitfield is not accessed concurrently.
 	v.Bitfield = bitfield.New(uint32(len(pieces)))
-	buf := make([]byte, pieces[0].Length)
-	hash := sha1.New()
-	var numOK uint32
-	for _, p := range pieces {
-		buf = buf[:p.Length]
-		_, v.Error = p.Data.ReadAt(buf, 0)
-		if v.Error != nil {
+	var checked uint32
+	for res := range checkedC {
+		if res.Error != nil {
+			v.Error = res.Error
 			return
 		}
-		ok := p.VerifyHash(buf, hash)
-		if ok {
-			v.Bitfield.Set(p.Index)
-			numOK++
+		if res.OK {
+			v.Bitfield.Set(res.Index)
 		}
+		checked++
 		select {
-		case progressC <- Progress{Checked: p.Index + 1}:
+		case progressC <- Progress{Checked: checked}:
 		case <-v.closeC:
 			return
 		}
-		hash.Reset()
+	}
+}
+
+type checkResult struct {
+	Index uint32
+	OK    bool
+	Error error
+}
+
+func checkPieces(pieces []piece.Piece, indexC chan int, resultC chan checkResult, stopC chan struct{}) {
+	buf := make([]byte, pieces[0].Length)
+	hash := sha1.New()
+	for i := range indexC {
+		p := &pieces[i]
+		buf = buf[:p.Length]
+		_, err := p.Data.ReadAt(buf, 0)
+		res := checkResult{Index: p.Index, Error: err}
+		if err == nil {
+			res.OK = p.VerifyHash(buf, hash)
+			hash.Reset()
+		}
+		select {
+		case resultC <- res:
+		case <-stopC:
+			return
+		}
 	}
 }
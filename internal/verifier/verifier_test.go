@@ -0,0 +1,111 @@
+package verifier
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/storage/memstorage"
+)
+
+// newTestPieces returns pieces of random data. Pieces at the corrupt indexes have invalid hashes.
+func newTestPieces(t testing.TB, numPieces int, pieceLength uint32, corrupt ...uint32) []piece.Piece {
+	size := int64(numPieces) * int64(pieceLength)
+	f, _, err := memstorage.New(size).Open("data", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	if _, err = f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		off := int64(i) * int64(pieceLength)
+		sum := sha1.Sum(data[off : off+int64(pieceLength)]) // nolint: gosec
+		pieces[i] = piece.Piece{
+			Index:  uint32(i),
+			Length: pieceLength,
+			Data:   filesection.Piece{{File: f, Offset: off, Length: int64(pieceLength)}},
+			Hash:   sum[:],
+		}
+	}
+	for _, i := range corrupt {
+		pieces[i].Hash = make([]byte, sha1.Size)
+	}
+	return pieces
+}
+
+func runVerifier(pieces []piece.Piece, workers int) *Verifier {
+	progressC := make(chan Progress)
+	resultC := make(chan *Verifier, 1)
+	v := New()
+	go v.Run(pieces, workers, progressC, resultC)
+	for {
+		select {
+		case <-progressC:
+		case v = <-resultC:
+			return v
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, workers := range []int{1, 4, 0} {
+		pieces := newTestPieces(t, 50, 1024, 3, 17, 49)
+		v := runVerifier(pieces, workers)
+		if v.Error != nil {
+			t.Fatal(v.Error)
+		}
+		if v.Bitfield.Count() != 47 {
+			t.Fatalf("workers: %d, count: %d", workers, v.Bitfield.Count())
+		}
+		for _, i := range []uint32{3, 17, 49} {
+			if v.Bitfield.Test(i) {
+				t.Fatalf("workers: %d, corrupt piece %d is marked as valid", workers, i)
+			}
+		}
+	}
+}
+
+type errorFile struct{}
+
+var errRead = errors.New("read error")
+
+func (errorFile) ReadAt(p []byte, off int64) (int, error)  { return 0, errRead }
+func (errorFile) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+
+func TestVerifyReadError(t *testing.T) {
+	pieces := newTestPieces(t, 20, 1024)
+	pieces[10].Data = filesection.Piece{{File: errorFile{}, Length: 1024}}
+	v := runVerifier(pieces, 4)
+	if v.Error != errRead {
+		t.Fatalf("unexpected error: %v", v.Error)
+	}
+}
+
+func TestVerifyClose(t *testing.T) {
+	pieces := newTestPieces(t, 20, 1024)
+	v := New()
+	go v.Run(pieces, 4, make(chan Progress), make(chan *Verifier))
+	v.Close()
+}
+
+func BenchmarkVerify(b *testing.B) {
+	pieces := newTestPieces(b, 64, 256<<10)
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{{"Serial", 1}, {"Parallel", 0}} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(64 * 256 << 10)
+			for i := 0; i < b.N; i++ {
+				runVerifier(pieces, bc.workers)
+			}
+		})
+	}
+}
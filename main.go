@@ -155,6 +155,11 @@ func main() {
 					Usage: "request timeout",
 					Value: 10 * time.Second,
 				},
+				cli.StringFlag{
+					Name:   "token",
+					Usage:  "bearer token for authenticating to RPC server",
+					EnvVar: "RAIN_RPC_TOKEN",
+				},
 			},
 			Before: handleBeforeClient,
 			Subcommands: []cli.Command{
@@ -363,6 +368,30 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "pause",
+					Usage:    "pause torrent",
+					Category: "Actions",
+					Action:   handlePause,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:     "resume",
+					Usage:    "resume paused torrent",
+					Category: "Actions",
+					Action:   handleResume,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "start-all",
 					Usage:    "start all torrents",
@@ -846,6 +875,9 @@ func handleMagnetToTorrent(c *cli.Context) error {
 func handleBeforeClient(c *cli.Context) error {
 	clt = rainrpc.NewClient(c.String("url"))
 	clt.SetTimeout(c.Duration("timeout"))
+	if token := c.String("token"); token != "" {
+		clt.SetToken(token)
+	}
 	return nil
 }
 
@@ -1023,6 +1055,14 @@ func handleStop(c *cli.Context) error {
 	return clt.StopTorrent(c.String("id"))
 }
 
+func handlePause(c *cli.Context) error {
+	return clt.PauseTorrent(c.String("id"))
+}
+
+func handleResume(c *cli.Context) error {
+	return clt.ResumeTorrent(c.String("id"))
+}
+
 func handleStartAll(c *cli.Context) error {
 	return clt.StartAllTorrents()
 }
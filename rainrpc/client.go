@@ -30,6 +30,21 @@ func NewClient(addr string) *Client {
 	}
 }
 
+// SetToken sets the bearer token sent in Authorization header of requests.
+func (c *Client) SetToken(token string) {
+	c.httpClient.Transport = tokenTransport{token: token}
+}
+
+type tokenTransport struct {
+	token string
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
 // SetTimeout sets the timeout value on underlying HTTP client.
 func (c *Client) SetTimeout(d time.Duration) {
 	c.httpClient.Timeout = d
@@ -177,6 +192,20 @@ func (c *Client) StopTorrent(id string) error {
 	return c.client.Call("Session.StopTorrent", args, &reply)
 }
 
+// PauseTorrent chokes all peers of the torrent and stops requesting new pieces.
+func (c *Client) PauseTorrent(id string) error {
+	args := rpctypes.PauseTorrentRequest{ID: id}
+	var reply rpctypes.PauseTorrentResponse
+	return c.client.Call("Session.PauseTorrent", args, &reply)
+}
+
+// ResumeTorrent resumes the torrent after PauseTorrent.
+func (c *Client) ResumeTorrent(id string) error {
+	args := rpctypes.ResumeTorrentRequest{ID: id}
+	var reply rpctypes.ResumeTorrentResponse
+	return c.client.Call("Session.ResumeTorrent", args, &reply)
+}
+
 // AnnounceTorrent forces the torrent to re-announce to trackers and DHT.
 func (c *Client) AnnounceTorrent(id string) error {
 	args := rpctypes.AnnounceTorrentRequest{ID: id}
@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"fmt"
+
 	"github.com/cenkalti/rain/internal/announcer"
 )
 
@@ -25,6 +27,19 @@ func (e *InputError) Unwrap() error {
 	return e.err
 }
 
+// DiskSpaceError is the error that the torrent is stopped with when there is not enough free space for the files.
+type DiskSpaceError struct {
+	// Number of bytes that are needed to be allocated for the files.
+	Required int64
+	// Number of free bytes on the file system of the storage directory.
+	Available int64
+}
+
+// Error implements error interface.
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space: %d bytes required, %d bytes available", e.Required, e.Available)
+}
+
 // AnnounceError is the error returned from announce response to a tracker.
 type AnnounceError struct {
 	err *announcer.AnnounceError
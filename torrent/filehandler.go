@@ -0,0 +1,48 @@
+package torrent
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"time"
+)
+
+// FileHandler returns a handler that serves the file at index returned from Torrent.Files.
+// Range requests and HEAD method are supported, so media players can seek in a file while it is being downloaded.
+// Requests block until the pieces containing the requested range are downloaded.
+// These pieces are downloaded before other pieces. The read is cancelled when the client closes the connection.
+// The handler responds with 404 if torrent metadata is not downloaded yet or the index is invalid.
+func FileHandler(t *Torrent, fileIndex int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		files := t.Files()
+		if fileIndex < 0 || fileIndex >= len(files) {
+			http.NotFound(w, req)
+			return
+		}
+		r, err := t.NewReader(fileIndex)
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		defer r.Close()
+		doneC := make(chan struct{})
+		defer close(doneC)
+		go func() {
+			select {
+			case <-req.Context().Done():
+				// Unblock the pending read.
+				r.Close()
+			case <-doneC:
+			}
+		}()
+		// Content type is taken from the file extension only.
+		// Sniffing the content would wait for the first piece of the file even if another range is requested.
+		name := path.Base(files[fileIndex].Path)
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ctype)
+		http.ServeContent(w, req, name, time.Time{}, r)
+	})
+}
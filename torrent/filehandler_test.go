@@ -0,0 +1,103 @@
+package torrent
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileHandler(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := -1
+	for i, file := range tor.Files() {
+		if strings.HasSuffix(file.Path, "data/file2.bin") {
+			index = i
+		}
+	}
+	if index == -1 {
+		t.Fatal("file is not found in torrent")
+	}
+	expected, err := os.ReadFile(filepath.Join(torrentDataDir, torrentName, "data", "file2.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(FileHandler(tor, index))
+	defer srv.Close()
+
+	// Request is sent before the download is started. Response is sent after the pieces are downloaded.
+	type result struct {
+		resp *http.Response
+		body []byte
+		err  error
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("Range", "bytes=100-299")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			resultC <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resultC <- result{resp: resp, body: body, err: err}
+	}()
+	tor.Start()
+	tor.AddPeer(addr)
+	var res result
+	select {
+	case res = <-resultC:
+	case <-time.After(timeout):
+		t.Fatal("no response")
+	}
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("unexpected status: %d", res.resp.StatusCode)
+	}
+	if cr := res.resp.Header.Get("Content-Range"); cr != "bytes 100-299/"+strconv.Itoa(len(expected)) {
+		t.Fatalf("unexpected Content-Range: %s", cr)
+	}
+	if !bytes.Equal(res.body, expected[100:300]) {
+		t.Fatal("invalid data")
+	}
+
+	resp, err := http.Head(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(expected)) {
+		t.Fatalf("unexpected HEAD response: status=%d length=%d", resp.StatusCode, resp.ContentLength)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatal("ranges are not accepted")
+	}
+
+	rec := httptest.NewRecorder()
+	FileHandler(tor, len(tor.Files())).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status for invalid index: %d", rec.Code)
+	}
+}
@@ -13,21 +13,29 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cenkalti/rain/internal/acceptor"
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/blocklist"
+	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/connlimiter"
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/lsd"
 	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/piececache"
+	"github.com/cenkalti/rain/internal/portmapper"
 	"github.com/cenkalti/rain/internal/resolver"
 	"github.com/cenkalti/rain/internal/resourcemanager"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/cenkalti/rain/internal/speedlimit"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/trackermanager"
-	"github.com/juju/ratelimit"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/mitchellh/go-homedir"
 	"github.com/nictuku/dht"
 	"go.etcd.io/bbolt"
+	"golang.org/x/net/proxy"
 )
 
 var (
@@ -38,6 +46,9 @@ var (
 	blocklistURLHashKey   = []byte("blocklist-url-hash")
 )
 
+// Max number of torrents waiting for a free connection slot when the session peer limit is reached.
+const maxConnWaiters = 10
+
 // Session contains torrents, DHT node, caches and other data structures shared by multiple torrents.
 type Session struct {
 	config         Config
@@ -46,18 +57,33 @@ type Session struct {
 	log            logger.Logger
 	extensions     [8]byte
 	dht            *dht.DHT
+	lsd            []*lsd.LSD
 	rpc            *rpcServer
 	trackerManager *trackermanager.TrackerManager
+	trackerKey     uint32
 	ram            *resourcemanager.ResourceManager[*peer.Peer]
+	connLimiter    *connlimiter.ConnLimiter
+	halfOpen       *connlimiter.ConnLimiter
 	pieceCache     *piececache.Cache
 	webseedClient  http.Client
+	peerDialer     btconn.Dialer
 	createdAt      time.Time
 	semWrite       *semaphore.Semaphore
 	metrics        *sessionMetrics
-	bucketDownload *ratelimit.Bucket
-	bucketUpload   *ratelimit.Bucket
+	bucketDownload *speedlimit.Limiter
+	bucketUpload   *speedlimit.Limiter
+	acceptor       *acceptor.Acceptor
+	utpAcceptor    *acceptor.Acceptor
+	utpSocket      *utp.Socket
+	listenPortTCP  int
+	listenPortUDP  int
+	incomingConnC  chan net.Conn
+	portMapper     *portmapper.PortMapper
 	closeC         chan struct{}
 
+	// Rules for changing the rates of bucketDownload and bucketUpload.
+	speedLimitSchedule []speedLimitRange
+
 	mPeerRequests   sync.Mutex
 	dhtPeerRequests map[*torrent]struct{}
 
@@ -77,9 +103,22 @@ type Session struct {
 // NewSession creates a new Session for downloading and seeding torrents.
 // Returned session must be closed after use.
 func NewSession(cfg Config) (*Session, error) {
-	if cfg.PortBegin >= cfg.PortEnd {
+	if cfg.ListenPort == 0 && cfg.PortBegin >= cfg.PortEnd {
 		return nil, errors.New("invalid port range")
 	}
+	if n := cfg.RequestBlockSize; n < 1024 || n > piece.MaxBlockSize || n&(n-1) != 0 {
+		return nil, errors.New("invalid request block size")
+	}
+	if cfg.UnchokeInterval <= 0 {
+		return nil, errors.New("invalid unchoke interval")
+	}
+	if n := len(cfg.StorageEncryptionKey); n != 0 && n != 16 && n != 24 && n != 32 {
+		return nil, errors.New("invalid storage encryption key length")
+	}
+	if cfg.UTPEnabled && cfg.DHTEnabled && cfg.ListenPort != 0 && cfg.DHTPort == cfg.ListenPort {
+		// uTP and DHT are not multiplexed on the same UDP socket.
+		return nil, errors.New("DHT port must be different from listen port if uTP is enabled")
+	}
 	if cfg.MaxOpenFiles > 0 {
 		err := setNoFile(cfg.MaxOpenFiles)
 		if err != nil {
@@ -95,11 +134,43 @@ func NewSession(cfg Config) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.CompletedDataDir, err = homedir.Expand(cfg.CompletedDataDir)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := parseSpeedLimitSchedule(cfg.SpeedLimitSchedule)
+	if err != nil {
+		return nil, err
+	}
+	netDialer := &net.Dialer{Timeout: cfg.PeerConnectTimeout}
+	if cfg.PeerDialHost != "" {
+		ip := net.ParseIP(cfg.PeerDialHost)
+		if ip == nil {
+			return nil, errors.New("invalid peer dial host: " + cfg.PeerDialHost)
+		}
+		netDialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if cfg.outgoingPortReuse() {
+		var ip net.IP
+		if addr, ok := netDialer.LocalAddr.(*net.TCPAddr); ok {
+			ip = addr.IP
+		}
+		netDialer = acceptor.ReusePortDialer(ip, int(cfg.ListenPort), cfg.PeerConnectTimeout)
+	}
+	var peerDialer btconn.Dialer = netDialer
+	var proxyDialer proxy.ContextDialer
+	if cfg.ProxyURL != "" {
+		proxyDialer, err = newProxyDialer(cfg.ProxyURL, netDialer)
+		if err != nil {
+			return nil, errors.New("invalid proxy url: " + err.Error())
+		}
+		peerDialer = timeoutDialer{ContextDialer: proxyDialer, timeout: cfg.PeerConnectTimeout}
+	}
 	err = os.MkdirAll(filepath.Dir(cfg.Database), os.ModeDir|cfg.FilePermissions)
 	if err != nil {
 		return nil, err
 	}
-	l := logger.New("session")
+	l := logger.NewWithHandler("session", cfg.LogHandler)
 	db, err := bbolt.Open(cfg.Database, cfg.FilePermissions&^0111, &bbolt.Options{Timeout: time.Second})
 	if err == bbolt.ErrTimeout {
 		return nil, errors.New("resume database is locked by another process")
@@ -164,7 +235,8 @@ func NewSession(cfg Config) (*Session, error) {
 		db:                 db,
 		resumer:            res,
 		blocklist:          bl,
-		trackerManager:     trackermanager.New(blTracker, cfg.DNSResolveTimeout, !cfg.TrackerHTTPVerifyTLS),
+		trackerManager:     trackermanager.New(blTracker, cfg.DNSResolveTimeout, !cfg.TrackerHTTPVerifyTLS, proxyDialer),
+		trackerKey:         generateTrackerKey(),
 		log:                l,
 		torrents:           make(map[string]*Torrent),
 		torrentsByInfoHash: make(map[dht.InfoHash][]*Torrent),
@@ -172,20 +244,28 @@ func NewSession(cfg Config) (*Session, error) {
 		dht:                dhtNode,
 		pieceCache:         piececache.New(cfg.ReadCacheSize, cfg.ReadCacheTTL, cfg.ParallelReads),
 		ram:                resourcemanager.New[*peer.Peer](cfg.WriteCacheSize),
+		connLimiter:        connlimiter.New(cfg.MaxPeers, maxConnWaiters),
+		halfOpen:           connlimiter.New(cfg.MaxHalfOpenConns, maxConnWaiters),
 		createdAt:          time.Now(),
 		semWrite:           semaphore.New(int(cfg.ParallelWrites)),
+		peerDialer:         peerDialer,
 		closeC:             make(chan struct{}),
 		webseedClient: http.Client{
 			Transport: &http.Transport{
 				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					dctx, cancel := context.WithTimeout(ctx, cfg.WebseedDialTimeout)
+					defer cancel()
+					if proxyDialer != nil {
+						// Host name is resolved by the proxy to prevent leaking DNS queries.
+						// Blocklist is not applied because the IP address is not known.
+						return proxyDialer.DialContext(dctx, network, addr)
+					}
 					ip, port, err := resolver.Resolve(ctx, addr, cfg.DNSResolveTimeout, bl)
 					if err != nil {
 						return nil, err
 					}
 					var d net.Dialer
 					taddr := &net.TCPAddr{IP: ip, Port: port}
-					dctx, cancel := context.WithTimeout(ctx, cfg.WebseedDialTimeout)
-					defer cancel()
 					return d.DialContext(dctx, network, taddr.String())
 				},
 				TLSHandshakeTimeout:   cfg.WebseedTLSHandshakeTimeout,
@@ -194,13 +274,24 @@ func NewSession(cfg Config) (*Session, error) {
 			},
 		},
 	}
-	dlSpeed := cfg.SpeedLimitDownload * 1024
-	if cfg.SpeedLimitDownload > 0 {
-		c.bucketDownload = ratelimit.NewBucketWithRate(float64(dlSpeed), dlSpeed)
+	defer func() {
+		if err != nil {
+			close(c.closeC)
+			c.stopListener()
+			if dhtNode != nil {
+				dhtNode.Stop()
+			}
+		}
+	}()
+	if cfg.SpeedLimitDownload > 0 || len(schedule) > 0 {
+		c.bucketDownload = speedlimit.New(cfg.SpeedLimitDownload * 1024)
+	}
+	if cfg.SpeedLimitUpload > 0 || len(schedule) > 0 {
+		c.bucketUpload = speedlimit.New(cfg.SpeedLimitUpload * 1024)
 	}
-	ulSpeed := cfg.SpeedLimitUpload * 1024
-	if cfg.SpeedLimitUpload > 0 {
-		c.bucketUpload = ratelimit.NewBucketWithRate(float64(ulSpeed), ulSpeed)
+	if len(schedule) > 0 {
+		c.speedLimitSchedule = schedule
+		c.applySpeedLimits(time.Now())
 	}
 	err = c.startBlocklistReloader()
 	if err != nil {
@@ -217,6 +308,12 @@ func NewSession(cfg Config) (*Session, error) {
 		c.dhtPeerRequests = make(map[*torrent]struct{})
 	}
 	c.initMetrics()
+	if cfg.ListenPort != 0 {
+		err = c.startListener()
+		if err != nil {
+			return nil, err
+		}
+	}
 	c.loadExistingTorrents(ids)
 	if c.config.RPCEnabled {
 		c.rpc = newRPCServer(c)
@@ -228,10 +325,18 @@ func NewSession(cfg Config) (*Session, error) {
 	if cfg.DHTEnabled {
 		go c.processDHTResults()
 	}
+	if cfg.LSDEnabled {
+		c.startLSD()
+	}
+	if len(schedule) > 0 {
+		go c.runSpeedLimitScheduler()
+	}
 	go c.updateStatsLoop()
 	return c, nil
 }
 
+// parseTrackers returns a Tier for each tier in announce-list.
+// Tiers are announced concurrently, so a failing tier does not prevent getting peers from the next tier.
 func (s *Session) parseTrackers(tiers [][]string, private bool) []tracker.Tracker {
 	ret := make([]tracker.Tracker, 0, len(tiers))
 	for _, tier := range tiers {
@@ -255,17 +360,22 @@ func (s *Session) getTrackerUserAgent(private bool) string {
 	if private {
 		return s.config.TrackerHTTPPrivateUserAgent
 	}
-	return trackerHTTPPublicUserAgent
+	return s.config.TrackerHTTPPublicUserAgent
 }
 
 // Close stops all torrents and release the resources.
 func (s *Session) Close() error {
 	close(s.closeC)
+	s.stopListener()
 
 	if s.config.DHTEnabled {
 		s.dht.Stop()
 	}
 
+	for _, l := range s.lsd {
+		l.Close()
+	}
+
 	s.updateStats()
 
 	var wg sync.WaitGroup
@@ -308,6 +418,9 @@ func (s *Session) ListTorrents() []*Torrent {
 }
 
 func (s *Session) getPort() (int, error) {
+	if s.config.ListenPort != 0 {
+		return int(s.config.ListenPort), nil
+	}
 	s.mPorts.Lock()
 	defer s.mPorts.Unlock()
 	for p := range s.availablePorts {
@@ -318,6 +431,9 @@ func (s *Session) getPort() (int, error) {
 }
 
 func (s *Session) releasePort(port int) {
+	if s.config.ListenPort != 0 {
+		return
+	}
 	s.mPorts.Lock()
 	defer s.mPorts.Unlock()
 	s.availablePorts[port] = struct{}{}
@@ -330,6 +446,14 @@ func (s *Session) GetTorrent(id string) *Torrent {
 	return s.torrents[id]
 }
 
+// GetTorrentsByInfoHash returns the torrents with the info hash. Session may contain multiple torrents with the same info hash.
+func (s *Session) GetTorrentsByInfoHash(ih InfoHash) []*Torrent {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	a := s.torrentsByInfoHash[dht.InfoHash(ih[:])]
+	return append([]*Torrent(nil), a...)
+}
+
 // RemoveTorrent removes the torrent from the session and delete its files.
 func (s *Session) RemoveTorrent(id string) error {
 	t, err := s.removeTorrentFromClient(id)
@@ -379,10 +503,15 @@ func (s *Session) stopAndRemoveData(t *Torrent) error {
 	s.releasePort(t.torrent.port)
 	var err error
 	var dest string
+	dir := s.getDataDir(t.torrent.id)
+	if s.config.Storage == nil {
+		// Files may be moved into CompletedDataDir.
+		dir = t.torrent.rootDir()
+	}
 	if s.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(s.config.DataDir, t.torrent.id)
+		dest = dir
 	} else if t.torrent.info != nil {
-		dest = filepath.Join(s.config.DataDir, t.torrent.info.Name)
+		dest = filepath.Join(dir, t.torrent.info.Name)
 	}
 	if dest != "" {
 		err = os.RemoveAll(dest)
@@ -441,3 +570,10 @@ func (s *Session) getDataDir(torrentID string) string {
 	}
 	return s.config.DataDir
 }
+
+func (s *Session) getCompletedDataDir(torrentID string) string {
+	if s.config.DataDirIncludesTorrentID {
+		return filepath.Join(s.config.CompletedDataDir, torrentID)
+	}
+	return s.config.CompletedDataDir
+}
@@ -10,11 +10,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cenkalti/log"
 	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/gofrs/uuid"
 	"github.com/nictuku/dht"
@@ -30,7 +30,32 @@ type AddTorrentOptions struct {
 	// Stop torrent after all pieces are downloaded.
 	StopAfterDownload bool
 	// Stop torrent after metadata is downloaded from magnet links.
+	// No piece is requested from peers, so names and sizes of files can be inspected with Torrent.Files
+	// after Torrent.NotifyMetadata without downloading any data.
 	StopAfterMetadata bool
+	// Download pieces in order instead of rarest-first. Useful for streaming media files.
+	Sequential bool
+	// Stop seeding after the ratio of uploaded bytes to downloaded bytes reaches this value. Zero means no limit.
+	// Ratio limit is not checked if nothing is downloaded, e.g. when seeding a torrent that is created locally.
+	// StopAtUploadBytes can be used for that case.
+	StopAtRatio float64
+	// Stop seeding after uploaded bytes reaches this value. Zero means no limit.
+	StopAtUploadBytes int64
+	// Stop seeding after the torrent is in Seeding state for this duration. Zero means no limit.
+	// Paused time is counted only if Config.SeedDurationCountsPaused is set.
+	SeedDuration time.Duration
+	// Function to call in a new goroutine when all pieces of the torrent are downloaded.
+	// It is called once and not saved into the database, so it is not called for torrents loaded on session start.
+	OnComplete func(*Torrent)
+	// Handler for log messages of the torrent and its peers. Overrides Config.LogHandler.
+	// It is not saved into the database.
+	LogHandler log.Handler
+	// Overrides Config.RandomFirstPieces if not nil. Zero disables random picking for the torrent.
+	// It is not saved into the database, so Config value is used for torrents loaded on session start.
+	RandomFirstPieces *int
+	// Overrides Config.EndgameThreshold if not nil.
+	// It is not saved into the database, so Config value is used for torrents loaded on session start.
+	EndgameThreshold *int
 }
 
 // AddTorrent adds a new torrent to the session by reading .torrent metainfo from reader.
@@ -91,11 +116,23 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 		webseedsource.NewList(mi.URLList),
 		opt.StopAfterDownload,
 		opt.StopAfterMetadata,
+		opt.Sequential,
 		false, // completeCmdRun
+		opt.LogHandler,
 	)
 	if err != nil {
 		return nil, err
 	}
+	t.stopAtRatio = opt.StopAtRatio
+	t.stopAtUploadBytes = opt.StopAtUploadBytes
+	t.seedDuration = opt.SeedDuration
+	t.onComplete = opt.OnComplete
+	if opt.RandomFirstPieces != nil {
+		t.randomFirstPieces = *opt.RandomFirstPieces
+	}
+	if opt.EndgameThreshold != nil {
+		t.endgameThreshold = *opt.EndgameThreshold
+	}
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -112,6 +149,10 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
 		StopAfterMetadata: opt.StopAfterMetadata,
+		Sequential:        opt.Sequential,
+		StopAtRatio:       opt.StopAtRatio,
+		StopAtUploadBytes: opt.StopAtUploadBytes,
+		SeedDuration:      opt.SeedDuration,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
@@ -122,7 +163,7 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 }
 
 // AddURI adds a new torrent to the session from a URI.
-// URI may be a magnet link or a HTTP URL.
+// URI may be a magnet link, a HTTP URL or an info hash encoded in hex (40 characters) or base32 (32 characters).
 // In case of a HTTP address, a torrent is tried to be downloaded from that URL.
 // Nil value can be passed as opt for default options.
 func (s *Session) AddURI(uri string, opt *AddTorrentOptions) (*Torrent, error) {
@@ -130,6 +171,9 @@ func (s *Session) AddURI(uri string, opt *AddTorrentOptions) (*Torrent, error) {
 	if opt == nil {
 		opt = &AddTorrentOptions{}
 	}
+	if _, err := DecodeInfoHash(uri); err == nil {
+		return s.addMagnet("magnet:?xt=urn:btih:"+uri, opt)
+	}
 	u, err := url.Parse(uri)
 	if err != nil {
 		return nil, newInputError(err)
@@ -204,11 +248,23 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 		nil, // webseedSources
 		opt.StopAfterDownload,
 		opt.StopAfterMetadata,
+		opt.Sequential,
 		false, // completeCmdRun
+		opt.LogHandler,
 	)
 	if err != nil {
 		return nil, err
 	}
+	t.stopAtRatio = opt.StopAtRatio
+	t.stopAtUploadBytes = opt.StopAtUploadBytes
+	t.seedDuration = opt.SeedDuration
+	t.onComplete = opt.OnComplete
+	if opt.RandomFirstPieces != nil {
+		t.randomFirstPieces = *opt.RandomFirstPieces
+	}
+	if opt.EndgameThreshold != nil {
+		t.endgameThreshold = *opt.EndgameThreshold
+	}
 	go s.checkTorrent(t)
 	defer func() {
 		if err != nil {
@@ -224,6 +280,10 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
 		StopAfterMetadata: opt.StopAfterMetadata,
+		Sequential:        opt.Sequential,
+		StopAtRatio:       opt.StopAtRatio,
+		StopAtUploadBytes: opt.StopAtUploadBytes,
+		SeedDuration:      opt.SeedDuration,
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
@@ -236,7 +296,7 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	return t2, err
 }
 
-func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filestorage.FileStorage, err error) {
+func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto Storage, err error) {
 	port, err = s.getPort()
 	if err != nil {
 		return
@@ -266,7 +326,7 @@ func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filesto
 		}
 		id = base64.RawURLEncoding.EncodeToString(u1[:])
 	}
-	sto, err = filestorage.New(s.getDataDir(id), s.config.FilePermissions)
+	sto, err = s.newStorage(id, "")
 	if err != nil {
 		return
 	}
@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"io"
+	"os"
 	"strings"
 	"testing"
 
@@ -19,3 +21,33 @@ func TestInvalidTorrentData(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestAddTorrentPiecePickerOptions(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, DefaultConfig.RandomFirstPieces, tor.torrent.randomFirstPieces)
+	assert.Equal(t, DefaultConfig.EndgameThreshold, tor.torrent.endgameThreshold)
+	assert.NoError(t, s.RemoveTorrent(tor.ID()))
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomFirst, threshold := 0, 5
+	tor, err = s.AddTorrent(f, &AddTorrentOptions{RandomFirstPieces: &randomFirst, EndgameThreshold: &threshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, tor.torrent.randomFirstPieces)
+	assert.Equal(t, 5, tor.torrent.endgameThreshold)
+}
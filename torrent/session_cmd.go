@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"os"
@@ -14,21 +15,49 @@ func (s *Session) runOnCompleteCmd(torrent *torrent) {
 		return
 	}
 
-	cmd := exec.Command(command)
-	if len(s.config.OnCompleteCmd) > 1 {
-		cmd.Args = append(cmd.Args, s.config.OnCompleteCmd[1:]...)
+	vars := map[string]string{
+		"RAIN_TORRENT_ADDED": fmt.Sprint(torrent.addedAt.Unix()),
+		"RAIN_TORRENT_DIR":   torrent.rootDir(),
+		"RAIN_TORRENT_HASH":  hex.EncodeToString(torrent.infoHash[:]),
+		"RAIN_TORRENT_ID":    torrent.id,
+		"RAIN_TORRENT_NAME":  torrent.name,
 	}
 
-	cmd.Env = append(os.Environ(),
-		"RAIN_TORRENT_ADDED="+fmt.Sprint(torrent.addedAt.Unix()),
-		"RAIN_TORRENT_DIR="+torrent.storage.RootDir(),
-		"RAIN_TORRENT_HASH="+hex.EncodeToString(torrent.infoHash[:]),
-		"RAIN_TORRENT_ID="+torrent.id,
-		"RAIN_TORRENT_NAME="+torrent.name)
+	ctx := context.Background()
+	if s.config.OnCompleteCmdTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.OnCompleteCmdTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, command)
+	for _, arg := range s.config.OnCompleteCmd[1:] {
+		cmd.Args = append(cmd.Args, expandCmdArg(arg, vars))
+	}
+
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
 
 	s.log.Debugf("executing completion hook for torrent %s: %s", torrent.id, cmd.String())
 
-	if err := cmd.Run(); err != nil {
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		s.log.Infof("completion hook output for torrent %s: %s", torrent.id, out)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		s.log.Errorf("completion hook is killed after %s", s.config.OnCompleteCmdTimeout)
+	} else if err != nil {
 		s.log.Errorf("completion hook execution failed: %s", err)
 	}
 }
+
+// expandCmdArg replaces the torrent variables in arg. Other variables are left as is.
+func expandCmdArg(arg string, vars map[string]string) string {
+	return os.Expand(arg, func(name string) string {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return "${" + name + "}"
+	})
+}
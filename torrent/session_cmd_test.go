@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestOnComplete(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	calledC := make(chan *Torrent, 2)
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{OnComplete: func(t *Torrent) { calledC <- t }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+	assertCompleted(t, tor)
+	select {
+	case t2 := <-calledC:
+		if t2.ID() != tor.ID() {
+			t.Fatalf("called with torrent %s", t2.ID())
+		}
+	case <-time.After(timeout):
+		t.Fatal("callback is not called")
+	}
+	select {
+	case <-calledC:
+		t.Fatal("callback is called twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnCompleteCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.OnCompleteCmd = []string{"sh", "-c", `echo "$1" > "$2"`, "sh", "${RAIN_TORRENT_NAME}", out}
+	})
+	defer closeSession()
+	tor := addCompletedTorrent(t, s, AddTorrentOptions{})
+	tor.Start()
+	deadline := time.Now().Add(timeout)
+	for {
+		b, err := os.ReadFile(out)
+		if err == nil && len(b) > 0 {
+			if string(b) != tor.Name()+"\n" {
+				t.Fatalf("unexpected output: %q", b)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command is not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExpandCmdArg(t *testing.T) {
+	vars := map[string]string{"RAIN_TORRENT_NAME": "foo"}
+	if s := expandCmdArg("name=${RAIN_TORRENT_NAME} $HOME", vars); s != "name=foo ${HOME}" {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,88 @@
+package torrent
+
+import (
+	"expvar"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collector exports the statistics of a Session as Prometheus metrics.
+type collector struct {
+	session *Session
+
+	torrents        *prometheus.Desc
+	torrentsActive  *prometheus.Desc
+	peers           *prometheus.Desc
+	piecesCompleted *prometheus.Desc
+	speedDownload   *prometheus.Desc
+	speedUpload     *prometheus.Desc
+	bytesDownloaded *prometheus.Desc
+	bytesUploaded   *prometheus.Desc
+	uptime          *prometheus.Desc
+}
+
+// Collector returns a prometheus.Collector that exports the statistics of the Session.
+// Labels are attached to all metrics. Collectors of different sessions can be registered to the same registry if they have different labels.
+func (s *Session) Collector(labels prometheus.Labels) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("rain", "", name), help, nil, labels)
+	}
+	return &collector{
+		session:         s,
+		torrents:        desc("torrents", "Number of torrents in session."),
+		torrentsActive:  desc("torrents_active", "Number of torrents that are not stopped."),
+		peers:           desc("peers", "Number of connected peers."),
+		piecesCompleted: desc("pieces_completed", "Number of completed pieces in all torrents."),
+		speedDownload:   desc("download_speed_bytes", "Download speed from peers in bytes/s."),
+		speedUpload:     desc("upload_speed_bytes", "Upload speed to peers in bytes/s."),
+		bytesDownloaded: desc("downloaded_bytes_total", "Number of bytes downloaded from peers."),
+		bytesUploaded:   desc("uploaded_bytes_total", "Number of bytes uploaded to peers."),
+		uptime:          desc("uptime_seconds", "Time elapsed after creation of the session."),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.torrents
+	ch <- c.torrentsActive
+	ch <- c.peers
+	ch <- c.piecesCompleted
+	ch <- c.speedDownload
+	ch <- c.speedUpload
+	ch <- c.bytesDownloaded
+	ch <- c.bytesUploaded
+	ch <- c.uptime
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.session.Stats()
+	var active int
+	var pieces uint32
+	for _, t := range c.session.ListTorrents() {
+		ts := t.Stats()
+		if ts.Status != Stopped {
+			active++
+		}
+		pieces += ts.Pieces.Have
+	}
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+	gauge(c.torrents, float64(stats.Torrents))
+	gauge(c.torrentsActive, float64(active))
+	gauge(c.peers, float64(stats.Peers))
+	gauge(c.piecesCompleted, float64(pieces))
+	gauge(c.speedDownload, float64(stats.SpeedDownload))
+	gauge(c.speedUpload, float64(stats.SpeedUpload))
+	counter(c.bytesDownloaded, float64(stats.BytesDownloaded))
+	counter(c.bytesUploaded, float64(stats.BytesUploaded))
+	gauge(c.uptime, stats.Uptime.Seconds())
+}
+
+// Expvar returns an expvar.Var that reports current SessionStats as JSON.
+// It is not published automatically. Call expvar.Publish with a unique name for each Session.
+func (s *Session) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} { return s.Stats() })
+}
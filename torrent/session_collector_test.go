@@ -0,0 +1,72 @@
+package torrent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	addCompletedTorrent(t, s1, AddTorrentOptions{Stopped: true})
+
+	// Collectors of multiple sessions can live in the same registry.
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(s1.Collector(prometheus.Labels{"session": "1"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(s2.Collector(prometheus.Labels{"session": "2"})); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]map[string]float64)
+	for _, f := range families {
+		values[f.GetName()] = make(map[string]float64)
+		for _, m := range f.GetMetric() {
+			v := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+			values[f.GetName()][m.GetLabel()[0].GetValue()] = v
+		}
+	}
+	for _, name := range []string{
+		"rain_torrents",
+		"rain_torrents_active",
+		"rain_peers",
+		"rain_pieces_completed",
+		"rain_download_speed_bytes",
+		"rain_upload_speed_bytes",
+		"rain_downloaded_bytes_total",
+		"rain_uploaded_bytes_total",
+		"rain_uptime_seconds",
+	} {
+		if len(values[name]) != 2 {
+			t.Fatalf("metric %s is not exported for both sessions: %v", name, values[name])
+		}
+	}
+	if v := values["rain_torrents"]; v["1"] != 1 || v["2"] != 0 {
+		t.Fatalf("unexpected torrents: %v", v)
+	}
+	if v := values["rain_torrents_active"]; v["1"] != 0 {
+		t.Fatalf("unexpected active torrents: %v", v)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	addCompletedTorrent(t, s, AddTorrentOptions{Stopped: true})
+
+	var stats SessionStats
+	if err := json.Unmarshal([]byte(s.Expvar().String()), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Torrents != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -48,13 +48,14 @@ func (s *Session) handleDHTtick() {
 func parseDHTPeers(peers []string) []*net.TCPAddr {
 	addrs := make([]*net.TCPAddr, 0, len(peers))
 	for _, peer := range peers {
-		if len(peer) != 6 {
-			// only IPv4 is supported for now
+		// Compact peer info is IP address followed by 2 bytes port number.
+		if len(peer) != 6 && len(peer) != 18 {
 			continue
 		}
+		n := len(peer) - 2
 		addr := &net.TCPAddr{
-			IP:   net.IP(peer[:4]),
-			Port: int((uint16(peer[4]) << 8) | uint16(peer[5])),
+			IP:   net.IP(peer[:n]),
+			Port: int((uint16(peer[n]) << 8) | uint16(peer[n+1])),
 		}
 		addrs = append(addrs, addr)
 	}
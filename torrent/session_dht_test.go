@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/nictuku/dht"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDHTPeers(t *testing.T) {
+	peers := []string{
+		"\x01\x02\x03\x04\x1a\xe1",
+		"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x1a\xe2",
+		"invalid",
+	}
+	addrs := parseDHTPeers(peers)
+	assert.Equal(t, []*net.TCPAddr{
+		{IP: net.IPv4(1, 2, 3, 4).To4(), Port: 6881},
+		{IP: net.ParseIP("2001:db8::1"), Port: 6882},
+	}, addrs)
+}
+
+func TestParseDHTPeersRoundTrip(t *testing.T) {
+	addrs := []*net.TCPAddr{
+		{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 1},
+		{IP: net.IPv4(192, 168, 1, 2).To4(), Port: 65535},
+		{IP: net.ParseIP("fe80::1"), Port: 51413},
+	}
+	peers := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, compactPeer(addr))
+	}
+	assert.Equal(t, addrs, parseDHTPeers(peers))
+}
+
+func TestDHTPeersAreConnected(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.DHTEnabled = true
+		cfg.DHTPort = freePort(t)
+		cfg.DHTBootstrapNodes = nil
+	})
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ih := dht.InfoHash(tor.torrent.infoHash[:])
+	res := map[dht.InfoHash][]string{ih: {compactPeer(taddr)}}
+	// Results are dropped if the torrent is busy, so they are sent until the peer is connected.
+	waitStats(t, tor, func(st Stats) bool {
+		if st.Peers.Outgoing > 0 {
+			return true
+		}
+		select {
+		case s.dht.PeersRequestResults <- res:
+		default:
+		}
+		return false
+	})
+	assertCompleted(t, tor)
+}
+
+// compactPeer returns the address in compact peer info format used in DHT get_peers responses.
+func compactPeer(addr *net.TCPAddr) string {
+	ip := addr.IP.To4()
+	if ip == nil {
+		ip = addr.IP.To16()
+	}
+	b := make([]byte, len(ip)+2)
+	copy(b, ip)
+	binary.BigEndian.PutUint16(b[len(ip):], uint16(addr.Port))
+	return string(b)
+}
@@ -0,0 +1,148 @@
+package torrent
+
+import (
+	"net"
+
+	"github.com/cenkalti/rain/internal/acceptor"
+	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
+	"github.com/cenkalti/rain/internal/portmapper"
+	"github.com/nictuku/dht"
+)
+
+// startListener starts accepting peer connections for all torrents at Config.ListenPort.
+func (s *Session) startListener() error {
+	listen := acceptor.Listen
+	if s.config.outgoingPortReuse() {
+		listen = acceptor.ListenReusePort
+	}
+	listener, err := listen(net.ParseIP(s.config.Host), int(s.config.ListenPort))
+	if err != nil {
+		return err
+	}
+	s.log.Info("Listening peers on tcp://" + listener.Addr().String())
+	s.listenPortTCP = listener.Addr().(*net.TCPAddr).Port
+	s.incomingConnC = make(chan net.Conn)
+	s.acceptor = acceptor.New(listener, s.incomingConnC, s.log)
+	go s.acceptor.Run()
+	if s.config.UTPEnabled {
+		socket, err := acceptor.ListenUTP(net.ParseIP(s.config.Host), int(s.config.ListenPort))
+		if err != nil {
+			s.log.Warningf("cannot listen utp port %d: %s", s.config.ListenPort, err)
+		} else {
+			s.log.Info("Listening peers on utp://" + socket.Addr().String())
+			s.listenPortUDP = socket.Addr().(*net.UDPAddr).Port
+			s.utpSocket = socket
+			s.utpAcceptor = acceptor.New(socket, s.incomingConnC, s.log)
+			go s.utpAcceptor.Run()
+		}
+	}
+	if s.config.PortMappingEnabled {
+		s.portMapper = portmapper.New(int(s.config.ListenPort), s.config.PortMappingLifetime, s.log)
+		s.portMapper.Start()
+	}
+	go s.handleIncomingConnections()
+	return nil
+}
+
+func (s *Session) stopListener() {
+	if s.acceptor != nil {
+		s.acceptor.Close()
+	}
+	if s.utpAcceptor != nil {
+		s.utpAcceptor.Close()
+	}
+	if s.portMapper != nil {
+		s.portMapper.Close()
+	}
+}
+
+func (s *Session) handleIncomingConnections() {
+	for {
+		select {
+		case conn := <-s.incomingConnC:
+			s.handleIncomingConnection(conn)
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+func (s *Session) handleIncomingConnection(conn net.Conn) {
+	if ip := remoteIP(conn.RemoteAddr()); ip != nil && s.config.BlocklistEnabledForIncomingConnections && s.blocklist != nil && s.blocklist.Blocked(ip) {
+		s.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
+	// Limiter slot is passed to the torrent with the connection after the handshake.
+	if !s.connLimiter.Acquire(nil) {
+		s.log.Debugln("session peer limit reached, rejecting peer", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
+	go s.handshakeIncoming(incominghandshaker.New(conn))
+}
+
+// handshakeIncoming does the handshake and passes the connection to the torrent with the info hash sent by the peer.
+func (s *Session) handshakeIncoming(h *incominghandshaker.IncomingHandshaker) {
+	resultC := make(chan *incominghandshaker.IncomingHandshaker, 1)
+	allowEncryption, forceEncryption := s.config.incomingEncryption()
+	getSKey := s.getSKey
+	if !allowEncryption {
+		getSKey = nil
+	}
+	// The torrent that our peer ID is sent for is the one that receives the connection.
+	var t *Torrent
+	getPeerID := func(infoHash [20]byte) [20]byte {
+		t = s.torrentForInfoHash(infoHash)
+		if t == nil {
+			return [20]byte{}
+		}
+		return t.torrent.peerID
+	}
+	h.Run(getPeerID, getSKey, s.hasInfoHash, resultC, s.config.PeerHandshakeTimeout, s.extensions, forceEncryption)
+	if h.Error != nil {
+		h.Conn.Close()
+		s.connLimiter.Release()
+		return
+	}
+	if t == nil {
+		// Torrent is removed before the peer ID is sent.
+		h.Conn.Close()
+		s.connLimiter.Release()
+		return
+	}
+	select {
+	case t.torrent.sharedConnC <- h:
+	case <-t.torrent.doneC:
+		h.Conn.Close()
+		s.connLimiter.Release()
+	}
+}
+
+// torrentForInfoHash returns the torrent that accepts incoming connections for the info hash.
+// Session may contain multiple torrents with the same info hash.
+// In that case, connections are passed to the torrent that is added first and others do not accept incoming connections.
+func (s *Session) torrentForInfoHash(infoHash [20]byte) *Torrent {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	a := s.torrentsByInfoHash[dht.InfoHash(infoHash[:])]
+	if len(a) == 0 {
+		return nil
+	}
+	return a[0]
+}
+
+func (s *Session) getSKey(sKeyHash [20]byte) []byte {
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	for _, t := range s.torrents {
+		if t.torrent.sKeyHash == sKeyHash {
+			return t.torrent.infoHash[:]
+		}
+	}
+	return nil
+}
+
+func (s *Session) hasInfoHash(infoHash [20]byte) bool {
+	return s.torrentForInfoHash(infoHash) != nil
+}
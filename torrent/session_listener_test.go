@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/utp"
+)
+
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestSharedListenPort(t *testing.T) {
+	port := freePort(t)
+	s1, closeSession1 := newTestSessionWithConfig(t, func(cfg *Config) { cfg.ListenPort = port })
+	defer closeSession1()
+	seed := addCompletedTorrent(t, s1, AddTorrentOptions{})
+	seed.Start()
+	other, err := s1.AddURI("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tor := range []*Torrent{seed, other} {
+		select {
+		case p := <-tor.torrent.NotifyListen():
+			if p != int(port) {
+				t.Fatalf("torrent is listening on port %d, expected %d", p, port)
+			}
+		case <-time.After(timeout):
+			t.Fatal("torrent is not listening")
+		}
+		if tor.Port() != int(port) {
+			t.Fatalf("invalid port: %d", tor.Port())
+		}
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s2.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer("127.0.0.1:" + strconv.Itoa(int(port)))
+	assertCompleted(t, tor)
+	if st := other.Stats(); st.Peers.Total != 0 {
+		t.Fatalf("connection is routed to wrong torrent: %+v", st.Peers)
+	}
+}
+
+func TestSharedListenPortUTP(t *testing.T) {
+	port := freePort(t)
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.ListenPort = port
+		cfg.UTPEnabled = true
+		cfg.OutgoingPortReuse = true
+	})
+	defer closeSession()
+	if st := s.Stats(); st.ListenPortTCP != int(port) || st.ListenPortUDP != int(port) {
+		t.Fatalf("unexpected ports: tcp=%d udp=%d, expected %d", st.ListenPortTCP, st.ListenPortUDP, port)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	var ext [8]byte
+	var id [20]byte
+
+	// Both transports accept connections on the same port. Peers dial from different IPs to pass the duplicate IP check.
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}
+	copy(id[:], "-XX0000-tcppeer.....")
+	tcpConn, _, _, _, err := btconn.Dial(addr, &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}}, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpConn.Close()
+	go func() { _, _ = io.Copy(io.Discard, tcpConn) }()
+	socket, err := utp.Listen("udp4", "127.0.0.3:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	copy(id[:], "-XX0000-utppeer.....")
+	utpConn, _, _, _, err := btconn.Dial(addr, socket, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer utpConn.Close()
+	go func() { _, _ = io.Copy(io.Discard, utpConn) }()
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 2 })
+
+	// Outgoing connections are made from the listen port.
+	l, err := net.Listen("tcp", "127.0.0.4:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	tor.AddPeer(l.Addr().String())
+	_ = l.(*net.TCPListener).SetDeadline(time.Now().Add(timeout))
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p := conn.RemoteAddr().(*net.TCPAddr).Port; p != int(port) {
+		t.Fatalf("outgoing connection is made from port %d, expected %d", p, port)
+	}
+}
+
+func TestSharedListenPortUTPAndDHT(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.ListenPort = 7246
+	cfg.DHTPort = 7246
+	cfg.DHTEnabled = true
+	cfg.UTPEnabled = true
+	if _, err := NewSession(cfg); err == nil {
+		t.Fatal("session is created with the same port for uTP and DHT")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"go.etcd.io/bbolt"
 )
@@ -86,10 +85,14 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 			bf = bf3
 		}
 	}
-	sto, err := filestorage.New(s.getDataDir(id), s.config.FilePermissions)
+	sto, err := s.newStorage(id, spec.Dest)
 	if err != nil {
 		return
 	}
+	port := spec.Port
+	if s.config.ListenPort != 0 {
+		port = int(s.config.ListenPort)
+	}
 	t, err := newTorrent2(
 		s,
 		id,
@@ -97,7 +100,7 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 		spec.InfoHash,
 		sto,
 		spec.Name,
-		spec.Port,
+		port,
 		s.parseTrackers(spec.Trackers, private),
 		spec.FixedPeers,
 		info,
@@ -111,13 +114,25 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 		webseedsource.NewList(spec.URLList),
 		spec.StopAfterDownload,
 		spec.StopAfterMetadata,
+		spec.Sequential,
 		spec.CompleteCmdRun,
+		nil, // logHandler
 	)
 	if err != nil {
 		return
 	}
 	t.rawTrackers = spec.Trackers
+	t.stopAtRatio = spec.StopAtRatio
+	t.stopAtUploadBytes = spec.StopAtUploadBytes
+	t.seedDuration = spec.SeedDuration
 	t.rawWebseedSources = spec.URLList
+	t.paused = spec.Paused
+	if info != nil && len(spec.FilePriorities) == len(info.Files) {
+		t.filePriorities = filePrioritiesFromInts(spec.FilePriorities)
+	}
+	if info != nil && bf != nil {
+		t.partialPieces = partialPiecesFromSpec(spec.PartialPieces, info.NumPieces)
+	}
 	go s.checkTorrent(t)
 	delete(s.availablePorts, spec.Port)
 
@@ -176,6 +191,14 @@ func (s *Session) CompactDatabase(output string) error {
 			AddedAt:           t.torrent.addedAt,
 			StopAfterDownload: t.torrent.stopAfterDownload,
 			StopAfterMetadata: t.torrent.stopAfterMetadata,
+			Sequential:        t.torrent.sequential,
+			Paused:            t.torrent.paused,
+			StopAtRatio:       t.torrent.stopAtRatio,
+			StopAtUploadBytes: t.torrent.stopAtUploadBytes,
+			SeedDuration:      t.torrent.seedDuration,
+		}
+		if t.torrent.filePriorities != nil {
+			spec.FilePriorities = filePrioritiesToInts(t.torrent.filePriorities)
 		}
 		err = res.Write(t.torrent.id, spec)
 		if err != nil {
@@ -0,0 +1,417 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+	"go.etcd.io/bbolt"
+)
+
+// newReloadConfig returns a config for sessions that are reopened on the same database in tmp.
+func newReloadConfig(tmp string) Config {
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.DHTEnabled = false
+	cfg.LSDEnabled = false
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	cfg.Host = "127.0.0.1"
+	return cfg
+}
+
+func TestLoadExistingTorrents(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := newReloadConfig(tmp)
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := addCompletedTorrent(t, s, AddTorrentOptions{})
+	seed.Start()
+	waitStats(t, seed, func(st Stats) bool { return st.Status == Seeding })
+	magnet, err := s.AddURI("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := len(s.ListTorrents()); n != 2 {
+		t.Fatalf("%d torrents are loaded", n)
+	}
+	a := s.GetTorrentsByInfoHash(seed.InfoHash())
+	if len(a) != 1 || a[0].ID() != seed.ID() {
+		t.Fatalf("seed is not loaded: %v", a)
+	}
+	waitStats(t, a[0], func(st Stats) bool {
+		return st.Status == Seeding && st.Pieces.Total > 0 && st.Pieces.Have == st.Pieces.Total
+	})
+	a = s.GetTorrentsByInfoHash(magnet.InfoHash())
+	if len(a) != 1 || a[0].ID() != magnet.ID() {
+		t.Fatalf("magnet is not loaded: %v", a)
+	}
+	if st := a[0].Stats(); st.Status != Stopped {
+		t.Fatalf("magnet is not stopped: %s", st.Status)
+	}
+}
+
+func TestLoadPaused(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := newReloadConfig(tmp)
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, err := s.AddURI("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := s.AddURI("magnet:?xt=urn:btih:123456789abcdef0123456789abcdef012345678", &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused.Pause()
+	resumed.Pause()
+	resumed.Resume()
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.GetTorrent(paused.ID()).Paused() {
+		t.Fatal("torrent is not paused after restart")
+	}
+	if s.GetTorrent(resumed.ID()).Paused() {
+		t.Fatal("torrent is paused after restart")
+	}
+}
+
+func TestLoadMismatchedInfoHash(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := newReloadConfig(tmp)
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor := addCompletedTorrent(t, s, AddTorrentOptions{})
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(torrentsBucket).Bucket([]byte(tor.ID()))
+		return b.Put(boltdbresumer.Keys.InfoHash, make([]byte, 20))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := len(s.ListTorrents()); n != 0 {
+		t.Fatalf("%d torrents are loaded", n)
+	}
+	if len(s.invalidTorrentIDs) != 1 || s.invalidTorrentIDs[0] != tor.ID() {
+		t.Fatalf("invalid torrents: %v", s.invalidTorrentIDs)
+	}
+}
+
+// assertNoRequests connects to tor as a seeder and checks that tor does not request any piece from it.
+func assertNoRequests(t *testing.T, tor *Torrent) {
+	var ext [8]byte
+	var id [20]byte
+	copy(id[:], "-XX0000-seeder......")
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tor.Port()}
+	conn, _, _, _, err := btconn.Dial(addr, &net.Dialer{}, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	bf := bitfield.New(tor.torrent.info.NumPieces)
+	for i := uint32(0); i < bf.Len(); i++ {
+		bf.Set(i)
+	}
+	msg := append([]byte{0, 0, 0, 0, byte(peerprotocol.Bitfield)}, bf.Bytes()...)
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)-4))
+	msg = append(msg, 0, 0, 0, 1, byte(peerprotocol.Unchoke))
+	if _, err = conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	for {
+		var header [4]byte
+		if _, err = io.ReadFull(conn, header[:]); err != nil {
+			// Seeds may disconnect each other. Timeout means no request is sent.
+			return
+		}
+		b := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err = io.ReadFull(conn, b); err != nil {
+			return
+		}
+		if len(b) > 0 && (b[0] == byte(peerprotocol.Interested) || b[0] == byte(peerprotocol.Request)) {
+			t.Fatalf("initial seed sent message %d", b[0])
+		}
+	}
+}
+
+func TestInitialSeeding(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := newReloadConfig(tmp)
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := addCompletedTorrent(t, s, AddTorrentOptions{})
+	seed.Start()
+	select {
+	case <-seed.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not completed")
+	}
+	if st := seed.Stats(); st.Status != Seeding || st.Bytes.Downloaded != 0 {
+		t.Fatalf("torrent is not seeding: status=%s downloaded=%d", st.Status, st.Bytes.Downloaded)
+	}
+	assertNoRequests(t, seed)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Complete bitfield is loaded from resume data. Files are not verified again.
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor := s.GetTorrent(seed.ID())
+	if tor == nil {
+		t.Fatal("torrent is not loaded")
+	}
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not completed")
+	}
+	st := tor.Stats()
+	if st.Status != Seeding {
+		t.Fatalf("torrent is not seeding: %s", st.Status)
+	}
+	if st.Pieces.Checked != 0 {
+		t.Fatalf("%d pieces are verified", st.Pieces.Checked)
+	}
+	assertNoRequests(t, tor)
+}
+
+// servePiece connects to tor as a peer that has only the piece at index and unchokes it.
+// Requested blocks are sent if send returns true for their offsets.
+// The returned function returns the offsets of the requested blocks.
+func servePiece(t *testing.T, tor *Torrent, index uint32, data []byte, send func(begin uint32) bool) (requested func() []uint32, closeConn func()) {
+	select {
+	case <-tor.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	var ext [8]byte
+	var id [20]byte
+	copy(id[:], "-XX0000-pieceseeder.")
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tor.Port()}
+	conn, _, _, _, err := btconn.Dial(addr, &net.Dialer{}, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf := bitfield.New(tor.torrent.info.NumPieces)
+	bf.Set(index)
+	msg := append([]byte{0, 0, 0, 0, byte(peerprotocol.Bitfield)}, bf.Bytes()...)
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)-4))
+	msg = append(msg, 0, 0, 0, 1, byte(peerprotocol.Unchoke))
+	if _, err = conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	var m sync.Mutex
+	var begins []uint32
+	go func() {
+		for {
+			var header [4]byte
+			if _, err := io.ReadFull(conn, header[:]); err != nil {
+				return
+			}
+			b := make([]byte, binary.BigEndian.Uint32(header[:]))
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return
+			}
+			if len(b) != 13 || b[0] != byte(peerprotocol.Request) || binary.BigEndian.Uint32(b[1:5]) != index {
+				continue
+			}
+			begin := binary.BigEndian.Uint32(b[5:9])
+			length := binary.BigEndian.Uint32(b[9:13])
+			m.Lock()
+			begins = append(begins, begin)
+			m.Unlock()
+			if !send(begin) {
+				continue
+			}
+			resp := make([]byte, 13, 13+length)
+			binary.BigEndian.PutUint32(resp, 9+length)
+			resp[4] = byte(peerprotocol.Piece)
+			binary.BigEndian.PutUint32(resp[5:9], index)
+			binary.BigEndian.PutUint32(resp[9:13], begin)
+			resp = append(resp, data[begin:begin+length]...)
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}()
+	requested = func() []uint32 {
+		m.Lock()
+		defer m.Unlock()
+		return append([]uint32(nil), begins...)
+	}
+	return requested, func() { conn.Close() }
+}
+
+func TestPartialPieceResume(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := newReloadConfig(tmp)
+
+	id, data := savePartialPiece(t, cfg, nil)
+	half := uint32(len(data)) / 2
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor := s.GetTorrent(id)
+	if tor == nil {
+		t.Fatal("torrent is not loaded")
+	}
+	requested, closeConn := servePiece(t, tor, 0, data, func(uint32) bool { return true })
+	defer closeConn()
+	waitStats(t, tor, func(st Stats) bool { return st.Pieces.Have == 1 })
+	begins := requested()
+	if len(begins) == 0 {
+		t.Fatal("no blocks are requested")
+	}
+	for _, begin := range begins {
+		if begin < half {
+			t.Fatalf("saved block at offset %d is requested again", begin)
+		}
+	}
+}
+
+func TestPartialPieceCorruptSavedBlocks(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := newReloadConfig(tmp)
+
+	id, data := savePartialPiece(t, cfg, func(b []byte) {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	})
+	half := uint32(len(data)) / 2
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor := s.GetTorrent(id)
+	if tor == nil {
+		t.Fatal("torrent is not loaded")
+	}
+	// The peer sends correct data but the piece fails the hash check because of the corrupt saved blocks.
+	// The piece can only be completed if the peer is not closed and the piece is downloaded again from it.
+	requested, closeConn := servePiece(t, tor, 0, data, func(uint32) bool { return true })
+	defer closeConn()
+	waitStats(t, tor, func(st Stats) bool { return st.Pieces.Have == 1 })
+	var again bool
+	for _, begin := range requested() {
+		if begin < half {
+			again = true
+		}
+	}
+	if !again {
+		t.Fatal("corrupt saved blocks are not requested again")
+	}
+}
+
+// savePartialPiece adds the test torrent to a new session with cfg and serves the first half of the first piece.
+// If corrupt is not nil, it is called with the data that is sent to the session.
+// The session is closed after the blocks are downloaded, so they are saved as a partial piece.
+// It returns the ID of the torrent and the correct data of the first piece.
+func savePartialPiece(t *testing.T, cfg Config, corrupt func([]byte)) (string, []byte) {
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Downloading })
+
+	// Data of the first piece is the beginning of the concatenation of files in metainfo order.
+	info := tor.torrent.info
+	var data []byte
+	for _, fi := range info.Files {
+		b, err2 := os.ReadFile(filepath.Join(torrentDataDir, filepath.FromSlash(fi.Path)))
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		data = append(data, b...)
+	}
+	data = data[:info.PieceLength]
+	half := info.PieceLength / 2
+
+	sent := data
+	if corrupt != nil {
+		sent = make([]byte, len(data))
+		copy(sent, data)
+		corrupt(sent)
+	}
+	// Only the first half of the piece is sent before the session is closed.
+	_, closeConn := servePiece(t, tor, 0, sent, func(begin uint32) bool { return begin < half })
+	waitStats(t, tor, func(st Stats) bool { return st.Bytes.Downloaded >= int64(half) })
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closeConn()
+	return tor.ID(), data
+}
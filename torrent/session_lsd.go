@@ -0,0 +1,51 @@
+package torrent
+
+import (
+	"net"
+
+	"github.com/cenkalti/rain/internal/lsd"
+	"github.com/nictuku/dht"
+)
+
+// startLSD starts Local Service Discovery on IPv4 and IPv6 multicast groups.
+// Failing to listen a multicast group is not fatal because the network may not support it.
+func (s *Session) startLSD() {
+	groups := []struct{ network, addr string }{
+		{"udp4", lsd.Addr4},
+		{"udp6", lsd.Addr6},
+	}
+	for _, g := range groups {
+		l, err := lsd.New(g.network, g.addr, nil, s.config.LSDAnnounceInterval)
+		if err != nil {
+			s.log.Errorf("cannot create LSD for %s: %s", g.network, err)
+			continue
+		}
+		err = l.Start()
+		if err != nil {
+			s.log.Debugf("cannot start LSD for %s: %s", g.network, err)
+			continue
+		}
+		s.lsd = append(s.lsd, l)
+		go s.processLSDPeers(l)
+	}
+}
+
+func (s *Session) processLSDPeers(l *lsd.LSD) {
+	for {
+		select {
+		case pe := <-l.Peers():
+			s.mTorrents.RLock()
+			torrents := s.torrentsByInfoHash[dht.InfoHash(pe.InfoHash[:])]
+			s.mTorrents.RUnlock()
+			for _, t := range torrents {
+				select {
+				case t.torrent.lsdPeersC <- []*net.TCPAddr{pe.Addr}:
+				case <-t.torrent.closeC:
+				default:
+				}
+			}
+		case <-s.closeC:
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// newProxyDialer returns a dialer that connects through the SOCKS5 proxy at rawURL.
+// Connections to the proxy server are made with the forward dialer.
+func newProxyDialer(rawURL string, forward *net.Dialer) (proxy.ContextDialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, errors.New("unsupported proxy scheme: " + u.Scheme)
+	}
+	d, err := proxy.FromURL(u, forward)
+	if err != nil {
+		return nil, err
+	}
+	return d.(proxy.ContextDialer), nil
+}
+
+// timeoutDialer limits the duration of the whole dial, including the SOCKS5 handshake or the uTP connection setup.
+type timeoutDialer struct {
+	proxy.ContextDialer
+	timeout time.Duration
+}
+
+func (d timeoutDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	return d.ContextDialer.DialContext(ctx, network, address)
+}
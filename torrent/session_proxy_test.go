@@ -0,0 +1,203 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socks5Server is a minimal SOCKS5 server that supports CONNECT command without authentication.
+type socks5Server struct {
+	l       net.Listener
+	m       sync.Mutex
+	targets []string
+}
+
+func newSOCKS5Server(t *testing.T) *socks5Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Server{l: l}
+	go s.serve()
+	return s
+}
+
+func (s *socks5Server) Close() { s.l.Close() }
+
+func (s *socks5Server) Targets() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+func (s *socks5Server) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *socks5Server) handle(conn net.Conn) {
+	defer conn.Close()
+	// Greeting: version, number of methods, methods
+	buf := make([]byte, 262)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return
+	}
+	// Request: version, command, reserved, address type, address, port
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	if buf[1] != 1 {
+		_, _ = conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 1: // IPv4 address
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return
+		}
+		host = net.IP(buf[:4]).String()
+	case 3: // Domain name
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[1:1+buf[0]]); err != nil {
+			return
+		}
+		host = string(buf[1 : 1+buf[0]])
+	default:
+		_, _ = conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+	s.m.Lock()
+	s.targets = append(s.targets, target)
+	s.m.Unlock()
+	tconn, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer tconn.Close()
+	if _, err = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+	go func() {
+		_, _ = io.Copy(tconn, conn)
+		tconn.Close()
+	}()
+	_, _ = io.Copy(conn, tconn)
+}
+
+func TestDownloadThroughProxy(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	proxy := newSOCKS5Server(t)
+	defer proxy.Close()
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.ProxyURL = "socks5://" + proxy.l.Addr().String()
+	})
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.Pause()
+	tor.AddPeer(addr)
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Outgoing == 1 })
+	if peers := tor.Peers(); len(peers) != 1 || peers[0].Addr.String() != addr {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+	tor.Resume()
+	assertCompleted(t, tor)
+	if targets := proxy.Targets(); len(targets) == 0 || targets[0] != addr {
+		t.Fatalf("peer is not dialed through proxy: %v", targets)
+	}
+}
+
+func TestTrackerThroughProxy(t *testing.T) {
+	announcedC := make(chan struct{}, 1)
+	trk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case announcedC <- struct{}{}:
+		default:
+		}
+		_, _ = w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer trk.Close()
+	proxy := newSOCKS5Server(t)
+	defer proxy.Close()
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.ProxyURL = "socks5://" + proxy.l.Addr().String()
+	})
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(trk.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Host name must be sent to the proxy without resolving.
+	host := net.JoinHostPort("localhost", port)
+	err = tor.AddTrackers([]string{"http://" + host + "/announce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-announcedC:
+	case <-time.After(timeout):
+		t.Fatal("tracker is not announced")
+	}
+	if targets := proxy.Targets(); len(targets) == 0 || targets[0] != host {
+		t.Fatalf("tracker is not dialed through proxy: %v", targets)
+	}
+}
+
+func TestInvalidProxyURL(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.ProxyURL = "http://127.0.0.1:8080"
+	if _, err := NewSession(cfg); err == nil {
+		t.Fatal("session is created with invalid proxy url")
+	}
+}
@@ -0,0 +1,88 @@
+package torrent
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/rpctypes"
+)
+
+func TestRPCHandlerToken(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) { cfg.RPCToken = "secret" })
+	defer closeSession()
+	h := s.RPCHandler()
+	for token, status := range map[string]int{
+		"":        http.StatusUnauthorized,
+		"invalid": http.StatusUnauthorized,
+		"secret":  http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Fatalf("status for token %q: %d", token, w.Code)
+		}
+	}
+}
+
+func TestRPCHandler(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	h := &rpcHandler{session: s}
+
+	b, err := os.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := rpctypes.AddTorrentRequest{Torrent: base64.StdEncoding.EncodeToString(b)}
+	args.Stopped = true
+	var added rpctypes.AddTorrentResponse
+	if err = h.AddTorrent(&args, &added); err != nil {
+		t.Fatal(err)
+	}
+	const infoHash = "0123456789abcdef0123456789abcdef01234567"
+	uriArgs := rpctypes.AddURIRequest{URI: infoHash}
+	uriArgs.Stopped = true
+	var addedURI rpctypes.AddURIResponse
+	if err = h.AddURI(&uriArgs, &addedURI); err != nil {
+		t.Fatal(err)
+	}
+	if addedURI.Torrent.InfoHash != infoHash {
+		t.Fatalf("invalid info hash: %s", addedURI.Torrent.InfoHash)
+	}
+
+	var list rpctypes.ListTorrentsResponse
+	if err = h.ListTorrents(&rpctypes.ListTorrentsRequest{}, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Torrents) != 2 {
+		t.Fatalf("unexpected torrents: %+v", list.Torrents)
+	}
+
+	var stats rpctypes.GetTorrentStatsResponse
+	if err = h.GetTorrentStats(&rpctypes.GetTorrentStatsRequest{ID: added.Torrent.ID}, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Stats.Status != "Stopped" || stats.Stats.InfoHash != added.Torrent.InfoHash || stats.Stats.Pieces.Total == 0 {
+		t.Fatalf("unexpected stats: %+v", stats.Stats)
+	}
+
+	if err = h.PauseTorrent(&rpctypes.PauseTorrentRequest{ID: added.Torrent.ID}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !s.GetTorrent(added.Torrent.ID).Paused() {
+		t.Fatal("torrent is not paused")
+	}
+	if err = h.ResumeTorrent(&rpctypes.ResumeTorrentRequest{ID: added.Torrent.ID}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.PauseTorrent(&rpctypes.PauseTorrentRequest{ID: "invalid"}, nil); err != errTorrentNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -2,11 +2,13 @@ package torrent
 
 import (
 	"context"
+	"crypto/subtle"
 	"expvar"
 	"net"
 	"net/http"
 	"net/rpc"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/rain/internal/logger"
@@ -14,13 +16,24 @@ import (
 )
 
 type rpcServer struct {
-	rpcServer  *rpc.Server
 	httpServer http.Server
 	log        logger.Logger
 }
 
 func newRPCServer(ses *Session) *rpcServer {
-	h := &rpcHandler{session: ses}
+	return &rpcServer{
+		httpServer: http.Server{
+			Handler: ses.RPCHandler(),
+		},
+		log: logger.NewWithHandler("rpc server", ses.config.LogHandler),
+	}
+}
+
+// RPCHandler returns the HTTP handler that serves JSON-RPC 2.0 requests for controlling the Session.
+// It can be mounted on an existing http.ServeMux when the RPC server in Session is disabled.
+// Requests are authenticated with Config.RPCToken if set.
+func (s *Session) RPCHandler() http.Handler {
+	h := &rpcHandler{session: s}
 	srv := rpc.NewServer()
 	_ = srv.RegisterName("Session", h)
 
@@ -29,13 +42,26 @@ func newRPCServer(ses *Session) *rpcServer {
 	mux.HandleFunc("/move-torrent", h.handleMoveTorrent)
 	mux.Handle("/", jsonrpc2.HTTPHandler(srv))
 
-	return &rpcServer{
-		rpcServer: srv,
-		httpServer: http.Server{
-			Handler: mux,
-		},
-		log: logger.New("rpc server"),
+	if s.config.RPCToken == "" {
+		return mux
+	}
+	return tokenHandler{Handler: mux, token: s.config.RPCToken}
+}
+
+// tokenHandler rejects requests that do not have the bearer token in Authorization header.
+type tokenHandler struct {
+	http.Handler
+	token string
+}
+
+func (h tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
 	}
+	h.Handler.ServeHTTP(w, r)
 }
 
 func (s *rpcServer) Start(host string, port int) error {
@@ -0,0 +1,104 @@
+package torrent
+
+import (
+	"fmt"
+	"time"
+)
+
+// speedLimitCheckInterval is the interval for checking the speed limit schedule. Rules have minute resolution.
+const speedLimitCheckInterval = 10 * time.Second
+
+// speedLimitRange is a parsed SpeedLimitRule. Start and end are offsets from midnight.
+type speedLimitRange struct {
+	rule       SpeedLimitRule
+	start, end time.Duration
+}
+
+func parseSpeedLimitSchedule(rules []SpeedLimitRule) ([]speedLimitRange, error) {
+	ranges := make([]speedLimitRange, 0, len(rules))
+	for i, rule := range rules {
+		start, err := parseClock(rule.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time in speed limit rule #%d: %w", i, err)
+		}
+		end, err := parseClock(rule.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end time in speed limit rule #%d: %w", i, err)
+		}
+		ranges = append(ranges, speedLimitRange{rule: rule, start: start, end: end})
+	}
+	return ranges, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains returns true if t is in the time range of the rule.
+func (r *speedLimitRange) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+	switch {
+	case r.start == r.end:
+		return r.hasDay(day)
+	case r.start < r.end:
+		return offset >= r.start && offset < r.end && r.hasDay(day)
+	case offset >= r.start:
+		return r.hasDay(day)
+	case offset < r.end:
+		// Range has started on the previous day.
+		return r.hasDay((day + 6) % 7)
+	default:
+		return false
+	}
+}
+
+func (r *speedLimitRange) hasDay(day time.Weekday) bool {
+	if len(r.rule.Days) == 0 {
+		return true
+	}
+	for _, d := range r.rule.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// speedLimits returns the download and upload speed limits in KB/s at t.
+func (s *Session) speedLimits(t time.Time) (download, upload int64) {
+	for i := range s.speedLimitSchedule {
+		r := &s.speedLimitSchedule[i]
+		if r.contains(t) {
+			return r.rule.SpeedLimitDownload, r.rule.SpeedLimitUpload
+		}
+	}
+	return s.config.SpeedLimitDownload, s.config.SpeedLimitUpload
+}
+
+// applySpeedLimits changes the rates of global speed limiters to the limits of the schedule at t.
+func (s *Session) applySpeedLimits(t time.Time) {
+	download, upload := s.speedLimits(t)
+	if s.bucketDownload.Rate() != download*1024 || s.bucketUpload.Rate() != upload*1024 {
+		s.log.Infof("setting speed limits to download: %d KB/s, upload: %d KB/s", download, upload)
+	}
+	s.bucketDownload.SetRate(download * 1024)
+	s.bucketUpload.SetRate(upload * 1024)
+}
+
+func (s *Session) runSpeedLimitScheduler() {
+	ticker := time.NewTicker(speedLimitCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.applySpeedLimits(now)
+		case <-s.closeC:
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpeedLimitSchedule(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.SpeedLimitUpload = 100
+		cfg.SpeedLimitSchedule = []SpeedLimitRule{
+			{
+				Days:               []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+				Start:              "09:00",
+				End:                "17:00",
+				SpeedLimitDownload: 1024,
+				SpeedLimitUpload:   512,
+			},
+			{
+				Days:               []time.Weekday{time.Friday},
+				Start:              "22:00",
+				End:                "06:00",
+				SpeedLimitDownload: 10,
+			},
+		}
+	})
+	defer closeSession()
+
+	// 2024-01-01 is a Monday.
+	monday := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		time             time.Time
+		download, upload int64
+	}{
+		{monday.Add(9*time.Hour - time.Second), 0, 100},
+		{monday.Add(9 * time.Hour), 1024, 512},
+		{monday.Add(17*time.Hour - time.Second), 1024, 512},
+		{monday.Add(17 * time.Hour), 0, 100},
+		{monday.AddDate(0, 0, 5).Add(10 * time.Hour), 0, 100},           // Saturday
+		{monday.AddDate(0, 0, 4).Add(22 * time.Hour), 10, 0},            // Friday night
+		{monday.AddDate(0, 0, 5).Add(6*time.Hour - time.Second), 10, 0}, // Saturday morning
+		{monday.AddDate(0, 0, 4).Add(5 * time.Hour), 0, 100},            // Friday morning
+	}
+	for _, c := range cases {
+		s.applySpeedLimits(c.time)
+		if d, u := s.bucketDownload.Rate(), s.bucketUpload.Rate(); d != c.download*1024 || u != c.upload*1024 {
+			t.Errorf("unexpected limits at %s: download=%d upload=%d", c.time, d, u)
+		}
+	}
+}
+
+func TestSpeedLimitScheduleInvalid(t *testing.T) {
+	_, err := parseSpeedLimitSchedule([]SpeedLimitRule{{Start: "9am", End: "17:00"}})
+	if err == nil {
+		t.Fatal("invalid time is parsed")
+	}
+}
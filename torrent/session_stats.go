@@ -18,6 +18,10 @@ type SessionStats struct {
 	Peers int
 	// Number of available ports for new torrents.
 	PortsAvailable int
+	// TCP port of the shared listener. Zero if Config.ListenPort is not set.
+	ListenPortTCP int
+	// UDP port of the uTP socket of the shared listener. Zero if Config.UTPEnabled is not set or the port cannot be bound.
+	ListenPortUDP int
 
 	// Number of rules in blocklist.
 	BlockListRules int
@@ -82,6 +86,8 @@ func (s *Session) Stats() SessionStats {
 		Torrents:       int(s.metrics.Torrents.Value()),
 		Peers:          int(s.metrics.Peers.Count()),
 		PortsAvailable: int(s.metrics.PortsAvailable.Value()),
+		ListenPortTCP:  s.listenPortTCP,
+		ListenPortUDP:  s.listenPortUDP,
 
 		BlockListRules:   int(s.metrics.BlockListRules.Value()),
 		BlockListRecency: time.Duration(s.metrics.BlockListRecency.Value()) * time.Second,
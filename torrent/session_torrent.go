@@ -2,16 +2,19 @@ package torrent
 
 import (
 	"archive/tar"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/tracker"
 	"go.etcd.io/bbolt"
@@ -25,6 +28,12 @@ type Torrent struct {
 // InfoHash is the unique value that represents the files in a torrent.
 type InfoHash [20]byte
 
+// DecodeInfoHash decodes an info hash from 40 characters in hex or 32 characters in base32 encoding.
+// Both encodings are case-insensitive.
+func DecodeInfoHash(s string) (InfoHash, error) {
+	return magnet.DecodeInfoHash(s)
+}
+
 // String encodes info hash in hex as 40 characters.
 func (h InfoHash) String() string {
 	return hex.EncodeToString(h[:])
@@ -60,6 +69,36 @@ func (t *Torrent) Stats() Stats {
 	return t.torrent.Stats()
 }
 
+// Downloaded returns the number of bytes downloaded from peers and webseeds. It is the value announced to trackers.
+// Data of corrupt pieces is counted too. The counter is saved in the session database, so it includes previous runs.
+func (t *Torrent) Downloaded() int64 {
+	return t.torrent.bytesDownloaded.Count()
+}
+
+// Uploaded returns the number of bytes uploaded to peers. It is the value announced to trackers.
+// The counter is saved in the session database, so it includes previous runs.
+func (t *Torrent) Uploaded() int64 {
+	return t.torrent.bytesUploaded.Count()
+}
+
+// Left returns the number of bytes that are not downloaded and verified yet. It is the value announced to trackers.
+// Left returns -1 if the torrent is added with a magnet link and metadata is not downloaded yet.
+func (t *Torrent) Left() int64 {
+	t.torrent.mBitfield.RLock()
+	defer t.torrent.mBitfield.RUnlock()
+	left, ok := t.torrent.bytesLeft()
+	if !ok {
+		return -1
+	}
+	return left
+}
+
+// NotifyStats returns a channel that receives the stats of the torrent at every interval.
+// Only the latest stats are kept if the receiver is slow. The channel is closed when the torrent is removed from the session.
+func (t *Torrent) NotifyStats(interval time.Duration) <-chan Stats {
+	return t.torrent.NotifyStats(interval)
+}
+
 // Magnet returns the magnet link.
 // Returns error if torrent is private.
 func (t *Torrent) Magnet() (string, error) {
@@ -87,6 +126,80 @@ func (t *Torrent) Webseeds() []Webseed {
 	return t.torrent.Webseeds()
 }
 
+// Files returns the list of files in the torrent.
+// Returns nil if torrent has no metadata yet.
+func (t *Torrent) Files() []File {
+	return t.torrent.Files()
+}
+
+// SetFilePriority sets the download priority of the file at index returned from Files().
+// Pieces that contain data only from skipped files are not downloaded.
+// Returns error if torrent has no metadata yet.
+func (t *Torrent) SetFilePriority(index int, prio FilePriority) error {
+	return t.torrent.SetFilePriority(index, prio)
+}
+
+// NewReader returns a new reader for the file at index returned from Files().
+// Read blocks until the requested data is downloaded.
+// Pieces after the read position are downloaded before other pieces, so the file can be consumed while downloading.
+func (t *Torrent) NewReader(fileIndex int) (io.ReadSeekCloser, error) {
+	return t.torrent.NewReader(fileIndex)
+}
+
+// ReadAt reads the data of completed pieces at offset off in torrent, across file boundaries.
+// Offsets are relative to the beginning of the first file, with files in the order they appear in metainfo,
+// including padding files. ErrNotAvailable is returned if the data is not downloaded yet.
+func (t *Torrent) ReadAt(p []byte, off int64) (int, error) {
+	return t.torrent.ReadAt(p, off)
+}
+
+// SetMaxUploadSlots sets the number of peers that are unchoked at the same time.
+// Initial value is taken from Config.UnchokedPeers. Change is applied at next unchoke round.
+func (t *Torrent) SetMaxUploadSlots(n int) error {
+	return t.torrent.SetMaxUploadSlots(n)
+}
+
+// SetMaxDownloadPeers sets the max number of peers that pieces are downloaded from at the same time.
+// Initial value is taken from Config.MaxDownloadPeers. Zero means no limit.
+func (t *Torrent) SetMaxDownloadPeers(n int) error {
+	return t.torrent.SetMaxDownloadPeers(n)
+}
+
+// Pause chokes all peers and stops requesting new pieces while keeping peer connections open.
+// Blocks already requested from peers are still received, so partially downloaded pieces are not lost.
+// Pause status is kept when the torrent is stopped and started again, or when the session is restarted.
+func (t *Torrent) Pause() {
+	t.torrent.Pause()
+}
+
+// Resume starts requesting pieces and unchoking peers again after Pause.
+func (t *Torrent) Resume() {
+	t.torrent.Resume()
+}
+
+// Paused returns true if the torrent is paused.
+func (t *Torrent) Paused() bool {
+	return t.torrent.Paused()
+}
+
+// PieceStates returns the download state of each piece for drawing a piece map. Returns nil if torrent has no metadata yet.
+func (t *Torrent) PieceStates() []PieceState {
+	return t.torrent.PieceStates()
+}
+
+// Availability returns the number of distributed copies of the torrent among connected peers, like 2.3 meaning 2.3 full copies.
+// The integer part is the availability of the rarest piece. Returns zero if torrent has no metadata yet.
+func (t *Torrent) Availability() float64 {
+	return t.torrent.Availability()
+}
+
+// NotifyPieceComplete returns a new channel that receives the index of each piece after it is downloaded and verified.
+// Events are dropped if the channel is not consumed in time. The buffer can hold events for all pieces
+// if the metadata is ready when this method is called. The channel is closed when the torrent is closed.
+func (t *Torrent) NotifyPieceComplete() <-chan int {
+	return t.torrent.NotifyPieceComplete()
+}
+
 // Port returns the TCP port number that the torrent is listening peers.
 func (t *Torrent) Port() int {
 	return t.torrent.port
@@ -101,11 +214,19 @@ func (t *Torrent) NotifyStop() <-chan error {
 
 // NotifyComplete returns a channel for notifying completion.
 // The channel is closed once all torrent pieces are downloaded successfully.
+// If the torrent is complete when it is started, the channel is closed without downloading anything.
+// Files are not verified again if the resume data says the torrent is complete.
 // NotifyComplete must be called after calling Start().
 func (t *Torrent) NotifyComplete() <-chan struct{} {
 	return t.torrent.NotifyComplete()
 }
 
+// NotifyStopped returns a channel that is closed when the torrent is stopped
+// because AddTorrentOptions.StopAtRatio, AddTorrentOptions.StopAtUploadBytes or AddTorrentOptions.SeedDuration is reached.
+func (t *Torrent) NotifyStopped() <-chan struct{} {
+	return t.torrent.NotifyStopped()
+}
+
 // NotifyMetadata returns a channel for notifying completion of metadata download from magnet links.
 // The channel is closed once all metadata pieces are downloaded successfully.
 // NotifyMetadata must be called after calling Start().
@@ -118,26 +239,71 @@ func (t *Torrent) AddPeer(addr string) error {
 	return t.torrent.addPeerString(addr)
 }
 
+// ConnectPeer connects to the peer at addr and blocks until the BitTorrent handshake is completed or failed.
+// Returns nil immediately if the peer is already connected.
+// Concurrent calls for the same address wait for the result of a single connection attempt.
+func (t *Torrent) ConnectPeer(addr *net.TCPAddr) error {
+	return t.torrent.ConnectPeer(addr)
+}
+
+// AddConn adds an already established connection as a peer, e.g. a connection made over a custom transport.
+// BitTorrent handshake is done on the connection as if it is accepted by the listener.
+// The connection is closed if torrent is not running, the peer is rejected or the handshake fails.
+// Returns the reason if the connection is not accepted. Handshake errors are not returned.
+// Connections that do not have an IP address are not checked for duplicates and bans.
+func (t *Torrent) AddConn(conn net.Conn) error {
+	return t.torrent.AddConn(conn)
+}
+
 // AddTracker adds a new tracker to the torrent.
 func (t *Torrent) AddTracker(uri string) error {
+	return t.AddTrackers([]string{uri})
+}
+
+// AddTrackers adds new trackers to the torrent. Each tracker is added in a separate tier.
+// Trackers that are already added to the torrent are skipped.
+// If the torrent is running, new trackers are announced immediately.
+func (t *Torrent) AddTrackers(uris []string) error {
 	var private bool
 	if t.torrent.info != nil {
 		private = t.torrent.info.Private
 	}
-	tr, err := t.torrent.session.trackerManager.Get(uri, t.torrent.session.config.TrackerHTTPTimeout, t.torrent.session.getTrackerUserAgent(private), int64(t.torrent.session.config.TrackerHTTPMaxResponseSize))
-	if err != nil {
-		return err
+	trackers := make(map[string]tracker.Tracker, len(uris))
+	for _, uri := range uris {
+		tr, err := t.torrent.session.trackerManager.Get(uri, t.torrent.session.config.TrackerHTTPTimeout, t.torrent.session.getTrackerUserAgent(private), int64(t.torrent.session.config.TrackerHTTPMaxResponseSize))
+		if err != nil {
+			return err
+		}
+		trackers[uri] = tr
 	}
-	err = t.torrent.session.db.Update(func(tx *bbolt.Tx) error {
+	var added []tracker.Tracker
+	err := t.torrent.session.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(torrentsBucket).Bucket([]byte(t.torrent.id))
 		value := b.Get(boltdbresumer.Keys.Trackers)
-		var trackers [][]string
-		err = json.Unmarshal(value, &trackers)
+		var tiers [][]string
+		err := json.Unmarshal(value, &tiers)
 		if err != nil {
 			return err
 		}
-		trackers = append(trackers, []string{uri})
-		value, err = json.Marshal(trackers)
+		existing := make(map[string]struct{})
+		for _, tier := range tiers {
+			for _, uri := range tier {
+				existing[uri] = struct{}{}
+			}
+		}
+		added = added[:0]
+		for _, uri := range uris {
+			if _, ok := existing[uri]; ok {
+				continue
+			}
+			existing[uri] = struct{}{}
+			tiers = append(tiers, []string{uri})
+			added = append(added, trackers[uri])
+		}
+		if len(added) == 0 {
+			return nil
+		}
+		value, err = json.Marshal(tiers)
 		if err != nil {
 			return err
 		}
@@ -146,7 +312,9 @@ func (t *Torrent) AddTracker(uri string) error {
 	if err != nil {
 		return err
 	}
-	t.torrent.AddTrackers([]tracker.Tracker{tr})
+	if len(added) > 0 {
+		t.torrent.AddTrackers(added)
+	}
 	return nil
 }
 
@@ -172,6 +340,18 @@ func (t *Torrent) Stop() error {
 	return nil
 }
 
+// StopContext stops the torrent like Stop but blocks until the torrent switches into Stopped state.
+// Peers are disconnected, resume data is written to the database and the stop event is sent to trackers that the torrent has announced to before.
+// Stop event announces time out after Config.TrackerStopTimeout.
+// If ctx is done before the torrent is stopped, the error from ctx is returned and the torrent continues stopping in background.
+func (t *Torrent) StopContext(ctx context.Context) error {
+	err := t.torrent.session.resumer.WriteStarted(t.torrent.id, false)
+	if err != nil {
+		return err
+	}
+	return t.torrent.StopContext(ctx)
+}
+
 // Announce the torrent to all trackers and DHT. It does not overrides the minimum interval value sent by the trackers or set in Config.
 func (t *Torrent) Announce() {
 	t.torrent.Announce()
@@ -210,6 +390,10 @@ func (t *Torrent) Move(target string) error {
 		return err
 	}
 	req.Header.Set("Content-Type", mw.FormDataContentType())
+	// Target is expected to be configured with the same RPC token.
+	if token := t.torrent.session.config.RPCToken; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
@@ -269,7 +453,7 @@ func (t *Torrent) generateTar(pw *io.PipeWriter) {
 	defer func() { _ = pw.CloseWithError(err) }()
 
 	tw := tar.NewWriter(pw)
-	root := t.torrent.session.getDataDir(t.torrent.id)
+	root := t.torrent.rootDir()
 	walkFunc := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -0,0 +1,37 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/encryptedstorage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+// Storage is the interface for saving torrent files. See Config.Storage for using a custom implementation.
+type Storage = storage.Storage
+
+// StorageFile is a single file in a Storage.
+type StorageFile = storage.File
+
+// newStorage returns the storage for the torrent with the ID.
+// Files are saved into dir if it is not empty, otherwise into the data dir of the torrent. Custom storages ignore dir.
+func (s *Session) newStorage(id, dir string) (sto Storage, err error) {
+	if dir == "" {
+		dir = s.getDataDir(id)
+	}
+	if s.config.Storage != nil {
+		sto, err = s.config.Storage(id)
+	} else {
+		sto, err = filestorage.New(dir, s.config.FilePermissions, s.filePreallocation())
+	}
+	if err != nil || len(s.config.StorageEncryptionKey) == 0 {
+		return
+	}
+	return encryptedstorage.New(sto, s.config.StorageEncryptionKey)
+}
+
+func (s *Session) filePreallocation() filestorage.Preallocation {
+	if s.config.FullPreallocation {
+		return filestorage.PreallocateFull
+	}
+	return filestorage.PreallocateSparse
+}
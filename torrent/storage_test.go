@@ -0,0 +1,190 @@
+package torrent
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/storage/memstorage"
+)
+
+// countingStorage is an example of a custom Storage implementation.
+// It keeps the files in memory and counts the number of writes.
+type countingStorage struct {
+	*memstorage.MemStorage
+	writes int64
+}
+
+var _ Storage = (*countingStorage)(nil)
+
+func (s *countingStorage) Open(name string, size int64) (StorageFile, bool, error) {
+	f, exists, err := s.MemStorage.Open(name, size)
+	if err != nil {
+		return nil, false, err
+	}
+	return &countingFile{StorageFile: f, writes: &s.writes}, exists, nil
+}
+
+type countingFile struct {
+	StorageFile
+	writes *int64
+}
+
+func (f *countingFile) WriteAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(f.writes, 1)
+	return f.StorageFile.WriteAt(p, off)
+}
+
+func TestCustomStorage(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	storages := make(map[string]*countingStorage)
+	s.config.Storage = func(id string) (Storage, error) {
+		sto := &countingStorage{MemStorage: memstorage.New(0)}
+		storages[id] = sto
+		return sto, nil
+	}
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	sto := storages[tor.ID()]
+	if sto == nil {
+		t.Fatal("custom storage is not used")
+	}
+	if atomic.LoadInt64(&sto.writes) == 0 {
+		t.Fatal("no writes to custom storage")
+	}
+	if sto.Size() != tor.torrent.info.Length {
+		t.Fatalf("storage size is %d, want %d", sto.Size(), tor.torrent.info.Length)
+	}
+}
+
+// failingStorage returns err from the next failures writes.
+type failingStorage struct {
+	*memstorage.MemStorage
+	err      error
+	failures int64
+}
+
+func (s *failingStorage) Open(name string, size int64) (StorageFile, bool, error) {
+	f, exists, err := s.MemStorage.Open(name, size)
+	if err != nil {
+		return nil, false, err
+	}
+	return &failingFile{StorageFile: f, storage: s}, exists, nil
+}
+
+type failingFile struct {
+	StorageFile
+	storage *failingStorage
+}
+
+func (f *failingFile) WriteAt(p []byte, off int64) (int, error) {
+	if atomic.AddInt64(&f.storage.failures, -1) >= 0 {
+		return 0, f.storage.err
+	}
+	return f.StorageFile.WriteAt(p, off)
+}
+
+func addFailingTorrent(t *testing.T, policy DiskErrorPolicy, sto *failingStorage) (*Torrent, func()) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.DiskErrorPolicy = policy
+		cfg.Storage = func(id string) (Storage, error) { return sto, nil }
+	})
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor, closeSession
+}
+
+func TestDiskErrorStop(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	sto := &failingStorage{MemStorage: memstorage.New(0), err: syscall.ENOSPC, failures: 1 << 30}
+	tor, closeSession := addFailingTorrent(t, DiskErrorStop, sto)
+	defer closeSession()
+	errC := tor.NotifyStop()
+	tor.AddPeer(addr)
+	select {
+	case err := <-errC:
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("torrent is not stopped")
+	}
+	if st := tor.Stats(); st.Status != Stopped || !errors.Is(st.Error, syscall.ENOSPC) {
+		t.Fatalf("unexpected stats: status=%s error=%v", st.Status, st.Error)
+	}
+}
+
+func TestDiskErrorPause(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	sto := &failingStorage{MemStorage: memstorage.New(0), err: syscall.ENOSPC, failures: 1 << 30}
+	tor, closeSession := addFailingTorrent(t, DiskErrorPause, sto)
+	defer closeSession()
+	tor.AddPeer(addr)
+	waitStats(t, tor, func(st Stats) bool { return st.Paused })
+	st := tor.Stats()
+	if st.Status != Downloading {
+		t.Fatalf("torrent is not running: %s", st.Status)
+	}
+	if !errors.Is(st.Error, syscall.ENOSPC) {
+		t.Fatalf("unexpected error: %v", st.Error)
+	}
+
+	// Disk is fixed by the operator.
+	atomic.StoreInt64(&sto.failures, 0)
+	tor.Resume()
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	if st = tor.Stats(); st.Error != nil {
+		t.Fatalf("error is not cleared: %v", st.Error)
+	}
+}
+
+func TestDiskErrorTransient(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	sto := &failingStorage{MemStorage: memstorage.New(0), err: &os.PathError{Op: "write", Path: "file", Err: syscall.EINTR}, failures: 2}
+	tor, closeSession := addFailingTorrent(t, DiskErrorStop, sto)
+	defer closeSession()
+	tor.AddPeer(addr)
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	if st := tor.Stats(); st.Error != nil || st.Paused {
+		t.Fatalf("unexpected stats: error=%v paused=%v", st.Error, st.Paused)
+	}
+}
@@ -1,25 +1,27 @@
 package torrent
 
 import (
-	"crypto/rand"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/cenkalti/log"
 	"github.com/cenkalti/rain/internal/acceptor"
 	"github.com/cenkalti/rain/internal/addrlist"
 	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/banlist"
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/blocklist"
 	"github.com/cenkalti/rain/internal/bufferpool"
+	"github.com/cenkalti/rain/internal/datamover"
 	"github.com/cenkalti/rain/internal/externalip"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
 	"github.com/cenkalti/rain/internal/infodownloader"
-	"github.com/cenkalti/rain/internal/urldownloader"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/mse"
@@ -29,11 +31,14 @@ import (
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/piecepicker"
 	"github.com/cenkalti/rain/internal/piecewriter"
+	"github.com/cenkalti/rain/internal/portmapper"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/storage"
 	"github.com/cenkalti/rain/internal/suspendchan"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/unchoker"
+	"github.com/cenkalti/rain/internal/urldownloader"
+	"github.com/cenkalti/rain/internal/utp"
 	"github.com/cenkalti/rain/internal/verifier"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/rcrowley/go-metrics"
@@ -59,7 +64,9 @@ type torrent struct {
 	name string
 
 	// Storage implementation to save the files in torrent.
-	storage storage.Storage
+	// It is replaced when the files are moved to Config.CompletedDataDir, hence protected by mStorage.
+	storage  storage.Storage
+	mStorage sync.RWMutex
 
 	// TCP Port to listen for peer connections.
 	port int
@@ -74,6 +81,9 @@ type torrent struct {
 	// Protects bitfield writing from torrent loop and reading from announcer loop.
 	mBitfield sync.RWMutex
 
+	// Signalled when a piece becomes available for reading. Readers must hold mBitfield.RLock while waiting.
+	pieceCond *sync.Cond
+
 	// Unique peer ID is generated per downloader.
 	peerID [20]byte
 
@@ -82,6 +92,12 @@ type torrent struct {
 
 	piecePicker *piecepicker.PiecePicker
 
+	// Download priorities of files in info. nil means all files have Normal priority.
+	filePriorities []FilePriority
+
+	// Blocks of incomplete pieces that are saved to disk on stop, keyed by piece index.
+	partialPieces map[uint32]*partialPiece
+
 	// Peers are sent to this channel when they are disconnected.
 	peerDisconnectedC chan *peer.Peer
 
@@ -89,7 +105,7 @@ type torrent struct {
 	pieceMessagesC *suspendchan.Chan[peer.PieceMessage]
 
 	// Other messages coming from peers are sent to this channel.
-	messages chan peer.Message
+	messages chan peer.ReceivedMessage
 
 	// We keep connected peers in this map after they complete handshake phase.
 	peers map[*peer.Peer]struct{}
@@ -118,6 +134,10 @@ type torrent struct {
 
 	pieceWriterResultC chan *piecewriter.PieceWriter
 
+	// Piece write that failed while DiskErrorPause policy is set. The write is retried when the torrent is resumed.
+	// Piece messages are suspended until then, so there is no other write running.
+	failedWrite *piecewriter.PieceWriter
+
 	// This channel is closed once all torrent pieces are downloaded and verified.
 	completeC chan struct{}
 
@@ -136,6 +156,9 @@ type torrent struct {
 	// Contains the last error sent to errC.
 	lastError error
 
+	// Channels in this list are closed when the torrent switches into Stopped state.
+	stopWaiters []chan struct{}
+
 	// When Stop() is called, it will close this channel to signal run() function to stop.
 	closeC chan chan struct{}
 
@@ -143,18 +166,37 @@ type torrent struct {
 	doneC chan struct{}
 
 	// These are the channels for sending a message to run() loop.
-	statsCommandC        chan statsRequest        // Stats()
-	trackersCommandC     chan trackersRequest     // Trackers()
-	peersCommandC        chan peersRequest        // Peers()
-	webseedsCommandC     chan webseedsRequest     // Webseeds()
-	startCommandC        chan struct{}            // Start()
-	stopCommandC         chan struct{}            // Stop()
-	announceCommandC     chan struct{}            // Announce()
-	verifyCommandC       chan struct{}            // Verify()
-	notifyErrorCommandC  chan notifyErrorCommand  // NotifyError()
-	notifyListenCommandC chan notifyListenCommand // NotifyListen()
-	addPeersCommandC     chan []*net.TCPAddr      // AddPeers()
-	addTrackersCommandC  chan []tracker.Tracker   // AddTrackers()
+	statsCommandC               chan statsRequest               // Stats()
+	trackersCommandC            chan trackersRequest            // Trackers()
+	peersCommandC               chan peersRequest               // Peers()
+	webseedsCommandC            chan webseedsRequest            // Webseeds()
+	filesCommandC               chan filesRequest               // Files()
+	pieceStatesCommandC         chan pieceStatesRequest         // PieceStates()
+	availabilityCommandC        chan availabilityRequest        // Availability()
+	setFilePriorityCommandC     chan setFilePriorityRequest     // SetFilePriority()
+	prioritizeCommandC          chan piecepicker.Range          // NewReader()
+	setUploadSlotsCommandC      chan int                        // SetMaxUploadSlots()
+	setDownloadPeersCommandC    chan int                        // SetMaxDownloadPeers()
+	pauseCommandC               chan struct{}                   // Pause()
+	resumeCommandC              chan struct{}                   // Resume()
+	startCommandC               chan struct{}                   // Start()
+	stopCommandC                chan struct{}                   // Stop()
+	stopWaitCommandC            chan chan struct{}              // StopContext()
+	announceCommandC            chan struct{}                   // Announce()
+	verifyCommandC              chan struct{}                   // Verify()
+	notifyErrorCommandC         chan notifyErrorCommand         // NotifyError()
+	notifyListenCommandC        chan notifyListenCommand        // NotifyListen()
+	notifyPieceCompleteCommandC chan notifyPieceCompleteCommand // NotifyPieceComplete()
+
+	// Channels returned from NotifyPieceComplete.
+	pieceCompleteCs     []chan int
+	addPeersCommandC    chan []*net.TCPAddr     // AddPeers()
+	connectPeerCommandC chan connectPeerRequest // ConnectPeer()
+	addConnCommandC     chan addConnRequest     // AddConn()
+	addTrackersCommandC chan []tracker.Tracker  // AddTrackers()
+
+	// Callers of ConnectPeer() waiting for the result of the outgoing handshake, keyed by address.
+	connectPeerWaiters map[string][]chan error
 
 	// Trackers send announce responses to this channel.
 	addrsFromTrackers chan []*net.TCPAddr
@@ -162,14 +204,31 @@ type torrent struct {
 	// Keeps a list of peer addresses to connect.
 	addrList *addrlist.AddrList
 
+	// A timer that fires when the earliest failed peer address is due for a retry.
+	addrRetryTimer *time.Timer
+
+	// Indexes of completed pieces that "have" messages are not sent yet. See Config.PeerHaveBatchWindow.
+	pendingHaves []uint32
+	// A message is sent to this channel at the end of the batch window to send the pending "have" messages.
+	haveFlushC chan struct{}
+
 	// New raw connections created by OutgoingHandshaker are sent to here.
 	incomingConnC chan net.Conn
 
+	// Connections handshaked by the session listener are sent to here when Config.ListenPort is set.
+	sharedConnC chan *incominghandshaker.IncomingHandshaker
+	// True while the torrent accepts connections from the session listener.
+	sharedListening bool
+
 	// Keep a set of peer IDs to block duplicate connections.
 	peerIDs map[[20]byte]struct{}
 
 	// Listens for incoming peer connections.
 	acceptor *acceptor.Acceptor
+	// Listens for incoming uTP peer connections on the same port if Config.UTPEnabled is set.
+	utpAcceptor *acceptor.Acceptor
+	// Socket of utpAcceptor. Also used for dialing peers that are not reachable over TCP.
+	utpSocket *utp.Socket
 
 	// Special hash of info hash for encypted connection handshake.
 	sKeyHash [20]byte
@@ -185,6 +244,24 @@ type torrent struct {
 	dhtAnnouncer *announcer.DHTAnnouncer
 	dhtPeersC    chan []*net.TCPAddr
 
+	// Receives peers found in local network.
+	lsdPeersC chan []*net.TCPAddr
+	// True if torrent is registered for Local Service Discovery.
+	lsdAnnouncing bool
+
+	// Maps the listening port on NAT device if enabled in config.
+	portMapper *portmapper.PortMapper
+
+	// Max number of peers that we download pieces from at the same time. Zero means no limit.
+	maxDownloadPeers int
+
+	// True after Pause is called. Peers are choked and no new blocks are requested while paused.
+	// Not reset by Start or Stop. Saved to resume db, so the torrent stays paused after the session is restarted.
+	paused bool
+
+	// Receives a value when a connection slot is freed in session after the limit is reached.
+	connSlotC chan struct{}
+
 	// List of peers in handshake state.
 	incomingHandshakers map[*incominghandshaker.IncomingHandshaker]struct{}
 	outgoingHandshakers map[*outgoinghandshaker.OutgoingHandshaker]struct{}
@@ -199,6 +276,9 @@ type torrent struct {
 	// A ticker that ticks periodically to keep a certain number of peers unchoked.
 	unchokeTicker *time.Ticker
 
+	// A ticker that ticks periodically to cancel block requests that are not fulfilled in time.
+	requestTimeoutTicker *time.Ticker
+
 	// A worker that opens and allocates files on the disk.
 	allocator          *allocator.Allocator
 	allocatorProgressC chan allocator.Progress
@@ -211,6 +291,14 @@ type torrent struct {
 	verifierResultC   chan *verifier.Verifier
 	checkedPieces     uint32
 
+	// A worker that moves the files into Config.CompletedDataDir after download is completed.
+	dataMover        *datamover.DataMover
+	dataMoverResultC chan *datamover.DataMover
+	// Set when the torrent is stopping for moving the files.
+	moveDataOnStop bool
+	// Whether to start the torrent again after the files are moved.
+	startAfterMove bool
+
 	// Metrics
 	downloadSpeed   metrics.Meter
 	uploadSpeed     metrics.Meter
@@ -228,6 +316,9 @@ type torrent struct {
 	// Peers that are sending corrupt data are banned.
 	bannedPeerIPs map[string]struct{}
 
+	// Peers that violate the protocol are banned temporarily.
+	peerBans *banlist.Banlist
+
 	// A signal sent to run() loop when announcers are stopped.
 	announcersStoppedC chan struct{}
 
@@ -257,10 +348,30 @@ type torrent struct {
 	// If true, the torrent is stopped automatically when all metadata pieces are downloaded.
 	stopAfterMetadata bool
 
+	// If true, pieces are downloaded in order.
+	sequential bool
+
+	// Piece picker settings. Initialized from Config and can be overridden by AddTorrentOptions.
+	randomFirstPieces int
+	endgameThreshold  int
+
+	// Seeding is stopped when upload/download ratio, uploaded bytes or seeding duration reach these values. Zero means no limit.
+	stopAtRatio       float64
+	stopAtUploadBytes int64
+	seedDuration      time.Duration
+
+	// This channel is closed when the torrent is stopped by one of the limits above.
+	stoppedAtLimitC chan struct{}
+
 	// True means that completeCmd has run before.
 	completeCmdRun bool
 
+	// Called once in a new goroutine when all pieces are downloaded. Not persisted.
+	onComplete func(*Torrent)
+
 	log logger.Logger
+	// Handler for the messages of torrent and its peers. Nil means the global handler.
+	logHandler log.Handler
 }
 
 // newTorrent2 is a constructor for torrent struct.
@@ -281,7 +392,9 @@ func newTorrent2(
 	ws []*webseedsource.WebseedSource,
 	stopAfterDownload bool,
 	stopAfterMetadata bool,
+	sequential bool,
 	completeCmdRun bool,
+	logHandler log.Handler, // overrides Config.LogHandler if not nil
 ) (*torrent, error) {
 	if len(infoHash) != 20 {
 		return nil, errors.New("invalid infoHash (must be 20 bytes)")
@@ -289,81 +402,115 @@ func newTorrent2(
 	cfg := s.config
 	var ih [20]byte
 	copy(ih[:], infoHash)
+	if logHandler == nil {
+		logHandler = cfg.LogHandler
+	}
+	if info != nil && info.Hash != ih {
+		return nil, fmt.Errorf("info hash of metadata (%x) does not match the torrent info hash (%x)", info.Hash, ih)
+	}
 	t := &torrent{
-		session:                   s,
-		id:                        id,
-		addedAt:                   addedAt,
-		infoHash:                  ih,
-		trackers:                  trackers,
-		fixedPeers:                fixedPeers,
-		name:                      name,
-		storage:                   sto,
-		port:                      port,
-		info:                      info,
-		bitfield:                  bf,
-		log:                       logger.New("torrent " + id),
-		peerDisconnectedC:         make(chan *peer.Peer),
-		messages:                  make(chan peer.Message),
-		pieceMessagesC:            suspendchan.New[peer.PieceMessage](0),
-		peers:                     make(map[*peer.Peer]struct{}),
-		incomingPeers:             make(map[*peer.Peer]struct{}),
-		outgoingPeers:             make(map[*peer.Peer]struct{}),
-		pieceDownloaders:          make(map[*peer.Peer]*piecedownloader.PieceDownloader),
-		pieceDownloadersSnubbed:   make(map[*peer.Peer]*piecedownloader.PieceDownloader),
-		pieceDownloadersChoked:    make(map[*peer.Peer]*piecedownloader.PieceDownloader),
-		peerSnubbedC:              make(chan *peer.Peer),
-		infoDownloaders:           make(map[*peer.Peer]*infodownloader.InfoDownloader),
-		infoDownloadersSnubbed:    make(map[*peer.Peer]*infodownloader.InfoDownloader),
-		pieceWriterResultC:        make(chan *piecewriter.PieceWriter),
-		completeC:                 make(chan struct{}),
-		completeMetadataC:         make(chan struct{}),
-		closeC:                    make(chan chan struct{}),
-		startCommandC:             make(chan struct{}),
-		stopCommandC:              make(chan struct{}),
-		announceCommandC:          make(chan struct{}),
-		verifyCommandC:            make(chan struct{}),
-		statsCommandC:             make(chan statsRequest),
-		trackersCommandC:          make(chan trackersRequest),
-		peersCommandC:             make(chan peersRequest),
-		webseedsCommandC:          make(chan webseedsRequest),
-		notifyErrorCommandC:       make(chan notifyErrorCommand),
-		notifyListenCommandC:      make(chan notifyListenCommand),
-		addPeersCommandC:          make(chan []*net.TCPAddr),
-		addTrackersCommandC:       make(chan []tracker.Tracker),
-		addrsFromTrackers:         make(chan []*net.TCPAddr),
-		peerIDs:                   make(map[[20]byte]struct{}),
-		incomingConnC:             make(chan net.Conn),
-		sKeyHash:                  mse.HashSKey(ih[:]),
-		infoDownloaderResultC:     make(chan *infodownloader.InfoDownloader),
-		incomingHandshakers:       make(map[*incominghandshaker.IncomingHandshaker]struct{}),
-		outgoingHandshakers:       make(map[*outgoinghandshaker.OutgoingHandshaker]struct{}),
-		incomingHandshakerResultC: make(chan *incominghandshaker.IncomingHandshaker),
-		outgoingHandshakerResultC: make(chan *outgoinghandshaker.OutgoingHandshaker),
-		allocatorProgressC:        make(chan allocator.Progress),
-		allocatorResultC:          make(chan *allocator.Allocator),
-		verifierProgressC:         make(chan verifier.Progress),
-		verifierResultC:           make(chan *verifier.Verifier),
-		connectedPeerIPs:          make(map[string]struct{}),
-		bannedPeerIPs:             make(map[string]struct{}),
-		announcersStoppedC:        make(chan struct{}),
-		dhtPeersC:                 make(chan []*net.TCPAddr, 1),
-		externalIP:                externalip.FirstExternalIP(),
-		downloadSpeed:             metrics.NilMeter{},
-		uploadSpeed:               metrics.NilMeter{},
-		bytesDownloaded:           metrics.NewCounter(),
-		bytesUploaded:             metrics.NewCounter(),
-		bytesWasted:               metrics.NewCounter(),
-		seededFor:                 metrics.NewCounter(),
-		ramNotifyC:                make(chan *peer.Peer),
-		webseedClient:             &s.webseedClient,
-		webseedSources:            ws,
-		webseedPieceResultC:       suspendchan.New[*urldownloader.PieceResult](0),
-		webseedRetryC:             make(chan *webseedsource.WebseedSource),
-		doneC:                     make(chan struct{}),
-		stopAfterDownload:         stopAfterDownload,
-		stopAfterMetadata:         stopAfterMetadata,
-		completeCmdRun:            completeCmdRun,
+		session:                     s,
+		id:                          id,
+		addedAt:                     addedAt,
+		infoHash:                    ih,
+		trackers:                    trackers,
+		fixedPeers:                  fixedPeers,
+		name:                        name,
+		storage:                     sto,
+		port:                        port,
+		info:                        info,
+		bitfield:                    bf,
+		log:                         logger.NewWithHandler("torrent "+id, logHandler),
+		logHandler:                  logHandler,
+		peerDisconnectedC:           make(chan *peer.Peer),
+		messages:                    make(chan peer.ReceivedMessage),
+		pieceMessagesC:              suspendchan.New[peer.PieceMessage](0),
+		peers:                       make(map[*peer.Peer]struct{}),
+		incomingPeers:               make(map[*peer.Peer]struct{}),
+		outgoingPeers:               make(map[*peer.Peer]struct{}),
+		pieceDownloaders:            make(map[*peer.Peer]*piecedownloader.PieceDownloader),
+		pieceDownloadersSnubbed:     make(map[*peer.Peer]*piecedownloader.PieceDownloader),
+		pieceDownloadersChoked:      make(map[*peer.Peer]*piecedownloader.PieceDownloader),
+		partialPieces:               make(map[uint32]*partialPiece),
+		peerSnubbedC:                make(chan *peer.Peer),
+		infoDownloaders:             make(map[*peer.Peer]*infodownloader.InfoDownloader),
+		infoDownloadersSnubbed:      make(map[*peer.Peer]*infodownloader.InfoDownloader),
+		pieceWriterResultC:          make(chan *piecewriter.PieceWriter),
+		completeC:                   make(chan struct{}),
+		stoppedAtLimitC:             make(chan struct{}),
+		completeMetadataC:           make(chan struct{}),
+		closeC:                      make(chan chan struct{}),
+		startCommandC:               make(chan struct{}),
+		stopCommandC:                make(chan struct{}),
+		stopWaitCommandC:            make(chan chan struct{}),
+		announceCommandC:            make(chan struct{}),
+		verifyCommandC:              make(chan struct{}),
+		statsCommandC:               make(chan statsRequest),
+		trackersCommandC:            make(chan trackersRequest),
+		peersCommandC:               make(chan peersRequest),
+		webseedsCommandC:            make(chan webseedsRequest),
+		filesCommandC:               make(chan filesRequest),
+		pieceStatesCommandC:         make(chan pieceStatesRequest),
+		availabilityCommandC:        make(chan availabilityRequest),
+		notifyPieceCompleteCommandC: make(chan notifyPieceCompleteCommand),
+		setFilePriorityCommandC:     make(chan setFilePriorityRequest),
+		prioritizeCommandC:          make(chan piecepicker.Range),
+		setUploadSlotsCommandC:      make(chan int),
+		setDownloadPeersCommandC:    make(chan int),
+		pauseCommandC:               make(chan struct{}),
+		resumeCommandC:              make(chan struct{}),
+		maxDownloadPeers:            s.config.MaxDownloadPeers,
+		notifyErrorCommandC:         make(chan notifyErrorCommand),
+		notifyListenCommandC:        make(chan notifyListenCommand),
+		addPeersCommandC:            make(chan []*net.TCPAddr),
+		connectPeerCommandC:         make(chan connectPeerRequest),
+		addConnCommandC:             make(chan addConnRequest),
+		connectPeerWaiters:          make(map[string][]chan error),
+		addTrackersCommandC:         make(chan []tracker.Tracker),
+		addrsFromTrackers:           make(chan []*net.TCPAddr),
+		haveFlushC:                  make(chan struct{}),
+		peerIDs:                     make(map[[20]byte]struct{}),
+		incomingConnC:               make(chan net.Conn),
+		sharedConnC:                 make(chan *incominghandshaker.IncomingHandshaker),
+		sKeyHash:                    mse.HashSKey(ih[:]),
+		infoDownloaderResultC:       make(chan *infodownloader.InfoDownloader),
+		incomingHandshakers:         make(map[*incominghandshaker.IncomingHandshaker]struct{}),
+		outgoingHandshakers:         make(map[*outgoinghandshaker.OutgoingHandshaker]struct{}),
+		incomingHandshakerResultC:   make(chan *incominghandshaker.IncomingHandshaker),
+		outgoingHandshakerResultC:   make(chan *outgoinghandshaker.OutgoingHandshaker),
+		allocatorProgressC:          make(chan allocator.Progress),
+		allocatorResultC:            make(chan *allocator.Allocator),
+		verifierProgressC:           make(chan verifier.Progress),
+		verifierResultC:             make(chan *verifier.Verifier),
+		dataMoverResultC:            make(chan *datamover.DataMover),
+		connectedPeerIPs:            make(map[string]struct{}),
+		bannedPeerIPs:               make(map[string]struct{}),
+		peerBans:                    banlist.New(s.config.PeerBanDuration, s.config.PeerMaxBanDuration),
+		announcersStoppedC:          make(chan struct{}),
+		dhtPeersC:                   make(chan []*net.TCPAddr, 1),
+		lsdPeersC:                   make(chan []*net.TCPAddr, 1),
+		connSlotC:                   make(chan struct{}, 1),
+		externalIP:                  externalip.FirstExternalIP(),
+		downloadSpeed:               metrics.NilMeter{},
+		uploadSpeed:                 metrics.NilMeter{},
+		bytesDownloaded:             metrics.NewCounter(),
+		bytesUploaded:               metrics.NewCounter(),
+		bytesWasted:                 metrics.NewCounter(),
+		seededFor:                   metrics.NewCounter(),
+		ramNotifyC:                  make(chan *peer.Peer),
+		webseedClient:               &s.webseedClient,
+		webseedSources:              ws,
+		webseedPieceResultC:         suspendchan.New[*urldownloader.PieceResult](0),
+		webseedRetryC:               make(chan *webseedsource.WebseedSource),
+		doneC:                       make(chan struct{}),
+		stopAfterDownload:           stopAfterDownload,
+		stopAfterMetadata:           stopAfterMetadata,
+		sequential:                  sequential,
+		randomFirstPieces:           cfg.RandomFirstPieces,
+		endgameThreshold:            cfg.EndgameThreshold,
+		completeCmdRun:              completeCmdRun,
 	}
+	t.pieceCond = sync.NewCond(t.mBitfield.RLocker())
 	if len(t.webseedSources) > s.config.WebseedMaxSources {
 		t.webseedSources = t.webseedSources[:10]
 	}
@@ -375,25 +522,21 @@ func newTorrent2(
 	if cfg.BlocklistEnabledForOutgoingConnections {
 		blocklistForOutgoingConns = s.blocklist
 	}
-	t.addrList = addrlist.New(cfg.MaxPeerAddresses, blocklistForOutgoingConns, port, &t.externalIP)
+	t.addrList = addrlist.New(cfg.MaxPeerAddresses, blocklistForOutgoingConns, port, &t.externalIP, cfg.PeerConnectMaxRetries, cfg.PeerConnectRetryBackoff)
 	if t.info != nil {
 		t.piecePool = bufferpool.New(int(t.info.PieceLength))
 	}
-	n := t.copyPeerIDPrefix()
-	_, err := rand.Read(t.peerID[n:])
-	if err != nil {
-		return nil, err
-	}
+	t.peerID = peer.GenerateID(t.peerIDPrefix())
 	t.unchoker = unchoker.New(cfg.UnchokedPeers, cfg.OptimisticUnchokedPeers)
 	go t.run()
 	return t, nil
 }
 
-func (t *torrent) copyPeerIDPrefix() int {
+func (t *torrent) peerIDPrefix() string {
 	if t.info != nil && t.info.Private {
-		return copy(t.peerID[:], t.session.config.PrivatePeerIDPrefix)
+		return t.session.config.PrivatePeerIDPrefix
 	}
-	return copy(t.peerID[:], publicPeerIDPrefix)
+	return publicPeerIDPrefix
 }
 
 func (t *torrent) getPeersForUnchoker() []unchoker.Peer {
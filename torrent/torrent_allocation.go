@@ -16,7 +16,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 	t.allocator = nil
 
 	if al.Error != nil {
-		t.stop(fmt.Errorf("file allocation error: %s", al.Error))
+		t.stop(fmt.Errorf("file allocation error: %w", al.Error))
 		return
 	}
 
@@ -33,7 +33,10 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		t.stop(fmt.Errorf("torrent has zero pieces"))
 		return
 	}
+	t.mBitfield.Lock()
 	t.pieces = pieces
+	t.mBitfield.Unlock()
+	t.pieceCond.Broadcast()
 
 	for pe := range t.peers {
 		pe.GenerateAndSendAllowedFastMessages(t.session.config.AllowedFastSet, t.info.NumPieces, t.infoHash, t.pieces)
@@ -43,6 +46,11 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		panic("piece picker exists")
 	}
 	t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+	t.piecePicker.SetSequential(t.sequential)
+	t.piecePicker.SetRandomFirst(t.randomFirstPieces)
+	t.piecePicker.SetEndgameThreshold(t.endgameThreshold)
+	t.piecePicker.SetMaxActivePieces(t.session.config.MaxActivePieces)
+	t.updateSkippedPieces()
 
 	for pe := range t.peers {
 		pe.Bitfield = bitfield.New(t.info.NumPieces)
@@ -50,11 +58,10 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 
 	// If we already have bitfield from resume db, skip verification and start downloading.
 	if t.bitfield != nil && !al.HasMissing {
-		for i := uint32(0); i < t.bitfield.Len(); i++ {
-			t.pieces[i].Done = t.bitfield.Test(i)
+		for i, ok := t.bitfield.NextSet(0); ok; i, ok = t.bitfield.NextSet(i + 1) {
+			t.setPieceDone(i)
 		}
-		if t.checkCompletion() && t.stopAfterDownload {
-			t.stopAndSetStoppedOnComplete()
+		if t.stopIfCompleted() {
 			return
 		}
 		t.processQueuedMessages()
@@ -70,6 +77,7 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 		t.mBitfield.Lock()
 		t.bitfield = bitfield.New(t.info.NumPieces)
 		t.mBitfield.Unlock()
+		t.pieceCond.Broadcast()
 		t.processQueuedMessages()
 		t.addFixedPeers()
 		t.startAcceptor()
@@ -1,15 +1,19 @@
 package torrent
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"math"
+	"net"
 
+	"github.com/cenkalti/rain/internal/externalip"
 	"github.com/cenkalti/rain/internal/tracker"
 )
 
 func (t *torrent) handleNewTrackers(trackers []tracker.Tracker) {
 	t.trackers = append(t.trackers, trackers...)
 	status := t.status()
-	if status != Stopping && status != Stopped {
+	if status != Stopping && status != Stopped && status != Moving {
 		for _, tr := range trackers {
 			t.startNewAnnouncer(tr)
 		}
@@ -23,15 +27,45 @@ func (t *torrent) announcerFields() tracker.Torrent {
 		Port:            t.port,
 		BytesDownloaded: t.bytesDownloaded.Count(),
 		BytesUploaded:   t.bytesUploaded.Count(),
+		IPv6:            t.announceIPv6(),
+		Key:             t.session.trackerKey,
 	}
-	// t.bytesComplete() uses t.bitfied for calculation.
+	if t.portMapper != nil {
+		if _, port := t.portMapper.ExternalAddr(); port != 0 {
+			tr.Port = port
+		}
+	}
+	// t.bytesLeft() uses t.bitfied for calculation.
 	t.mBitfield.RLock()
-	if t.bitfield == nil {
+	left, ok := t.bytesLeft()
+	t.mBitfield.RUnlock()
+	if !ok {
 		// Some trackers don't send any peer address if don't tell we have missing bytes.
-		tr.BytesLeft = math.MaxUint32
-	} else {
-		tr.BytesLeft = t.info.Length - t.bytesComplete()
+		left = math.MaxUint32
 	}
-	t.mBitfield.RUnlock()
+	tr.BytesLeft = left
 	return tr
 }
+
+// announceIPv6 returns the IPv6 address that is sent to trackers, or nil if the torrent does not listen on IPv6.
+func (t *torrent) announceIPv6() net.IP {
+	ip := net.ParseIP(t.session.config.Host)
+	if ip == nil || ip.To4() != nil {
+		return nil
+	}
+	if ip.IsUnspecified() {
+		return externalip.FirstExternalIPv6()
+	}
+	return ip
+}
+
+// generateTrackerKey returns a random key that is sent in announce requests of all torrents in session.
+// Trackers use the key to identify the client when its IP address changes.
+func generateTrackerKey() uint32 {
+	var b [4]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		panic("cannot read random bytes for tracker key: " + err.Error())
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
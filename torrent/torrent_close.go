@@ -20,13 +20,22 @@ func (t *torrent) close() {
 		t.stoppedEventAnnouncer.Close()
 	}
 
+	// Maybe we are in "Moving" state. Files that are not moved yet are moved on next start.
+	t.stopDataMover()
+
 	t.downloadSpeed.Stop()
 	t.uploadSpeed.Stop()
+
+	// Wake up readers that are waiting for pieces.
+	t.wakeReaders()
+
+	t.closePieceCompleteChannels()
 }
 
 func (t *torrent) closePeer(pe *peer.Peer) {
 	pe.Close()
-	if pd, ok := t.pieceDownloaders[pe]; ok {
+	pd, downloading := t.pieceDownloaders[pe]
+	if downloading {
 		t.closePieceDownloader(pd)
 	}
 	if id, ok := t.infoDownloaders[pe]; ok {
@@ -37,13 +46,18 @@ func (t *torrent) closePeer(pe *peer.Peer) {
 	delete(t.outgoingPeers, pe)
 	delete(t.peerIDs, pe.ID)
 	delete(t.connectedPeerIPs, pe.Conn.IP())
+	t.session.connLimiter.Release()
 	if t.piecePicker != nil {
 		t.piecePicker.HandleDisconnect(pe)
 	}
 	t.unchoker.HandleDisconnect(pe)
-	t.pexDropPeer(pe.Addr())
+	t.pexDropPeer(pe.RemoteAddr())
 	t.dialAddresses()
 	t.session.metrics.Peers.Dec(1)
+	if downloading && t.session.config.MaxActivePieces > 0 {
+		// A slot for an active piece may be freed. Start a downloader for other peers waiting for it.
+		t.startPieceDownloaders()
+	}
 }
 
 func (t *torrent) closeWebseedDownloader(src *webseedsource.WebseedSource) {
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"context"
 	"errors"
 	"net"
 	"time"
@@ -28,6 +29,27 @@ func (t *torrent) Stop() {
 	}
 }
 
+// StopContext stops the torrent and waits until the stopped event is announced to trackers.
+// Returns the error from ctx if it is done before the torrent switches into Stopped state.
+func (t *torrent) StopContext(ctx context.Context) error {
+	doneC := make(chan struct{})
+	select {
+	case t.stopWaitCommandC <- doneC:
+	case <-t.closeC:
+		return errClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-doneC:
+		return nil
+	case <-t.closeC:
+		return errClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Announce torrent to trackers and DHT manually.
 func (t *torrent) Announce() {
 	select {
@@ -55,6 +77,10 @@ func (t *torrent) NotifyComplete() <-chan struct{} {
 	return t.completeC
 }
 
+func (t *torrent) NotifyStopped() <-chan struct{} {
+	return t.stoppedAtLimitC
+}
+
 func (t *torrent) NotifyMetadata() <-chan struct{} {
 	return t.completeMetadataC
 }
@@ -117,8 +143,9 @@ func (t *torrent) getTieredTrackers() [][]string {
 	var trackers [][]string
 	for _, tr := range t.trackers {
 		if tier, ok := tr.(*tracker.Tier); ok {
-			urls := make([]string, len(tier.Trackers))
-			for i, tt := range tier.Trackers {
+			tierTrackers := tier.Trackers()
+			urls := make([]string, len(tierTrackers))
+			for i, tt := range tierTrackers {
 				urls[i] = tt.URL()
 			}
 			trackers = append(trackers, urls)
@@ -148,6 +175,40 @@ func (t *torrent) Stats() Stats {
 	return stats
 }
 
+// NotifyStats returns a channel that receives a snapshot of torrent stats at every interval.
+// If the receiver is slow, older snapshots are dropped so the channel always holds the latest one.
+// The channel is closed when the torrent is closed.
+func (t *torrent) NotifyStats(interval time.Duration) <-chan Stats {
+	ch := make(chan Stats, 1)
+	go t.notifyStats(interval, ch)
+	return ch
+}
+
+func (t *torrent) notifyStats(interval time.Duration, ch chan Stats) {
+	defer close(ch)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stats := t.Stats()
+			select {
+			case <-t.closeC:
+				return
+			default:
+			}
+			// Drop the previous snapshot if it is not received yet.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- stats
+		case <-t.closeC:
+			return
+		}
+	}
+}
+
 func (t *torrent) AddPeers(peers []*net.TCPAddr) {
 	select {
 	case t.addPeersCommandC <- peers:
@@ -192,6 +253,7 @@ type Tracker struct {
 	Status       TrackerStatus
 	Leechers     int
 	Seeders      int
+	Peers        int // Number of peer addresses in the last announce response
 	Error        *AnnounceError
 	Warning      string
 	LastAnnounce time.Time
@@ -234,6 +296,8 @@ type Peer struct {
 	EncryptedStream    bool
 	DownloadSpeed      int
 	UploadSpeed        int
+	// Total bytes received in messages of unknown type that are discarded.
+	DiscardedBytes int64
 }
 
 // PeerSource indicates that how the peer is found.
@@ -250,6 +314,8 @@ const (
 	SourceIncoming
 	// SourceManual indicates that the peer is added manually via AddPeer method.
 	SourceManual
+	// SourceLSD indicates that the peer is found in local network with Local Service Discovery.
+	SourceLSD
 )
 
 type peersRequest struct {
@@ -4,41 +4,133 @@ import (
 	"net"
 
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
+	"github.com/cenkalti/rain/internal/peerconn"
+	"github.com/cenkalti/rain/internal/peersource"
 )
 
-func (t *torrent) handleNewConnection(conn net.Conn) {
+type addConnRequest struct {
+	Conn     net.Conn
+	Response chan error
+}
+
+// AddConn starts the incoming handshake on conn. It does not wait for the handshake to complete.
+// Returns the reason if the connection is rejected.
+func (t *torrent) AddConn(conn net.Conn) error {
+	req := addConnRequest{Conn: conn, Response: make(chan error, 1)}
+	select {
+	case t.addConnCommandC <- req:
+	case <-t.closeC:
+		conn.Close()
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+func (t *torrent) handleAddConn(req addConnRequest) {
+	if status := t.status(); status == Stopped || status == Stopping || status == Moving {
+		req.Conn.Close()
+		req.Response <- errNotRunning
+		return
+	}
+	req.Response <- t.handleNewConnection(req.Conn)
+}
+
+// remoteIP returns the IP address of a connection made over TCP or uTP. It returns nil for other transports.
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// handleNewConnection starts the incoming handshake on conn.
+// If the connection is rejected, it is closed and the reason is returned.
+func (t *torrent) handleNewConnection(conn net.Conn) error {
 	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept {
 		t.log.Debugln("peer limit reached, rejecting peer", conn.RemoteAddr().String())
 		conn.Close()
-		return
+		return errPeerLimitReached
 	}
-	ip := conn.RemoteAddr().(*net.TCPAddr).IP
-	ipstr := ip.String()
-	if t.session.config.BlocklistEnabledForIncomingConnections && t.session.blocklist != nil && t.session.blocklist.Blocked(ip) {
+	ip := remoteIP(conn.RemoteAddr())
+	if ip != nil && t.session.config.BlocklistEnabledForIncomingConnections && t.session.blocklist != nil && t.session.blocklist.Blocked(ip) {
 		t.log.Debugln("peer is blocked:", conn.RemoteAddr().String())
 		conn.Close()
-		return
+		return errPeerBlocked
 	}
-	if _, ok := t.connectedPeerIPs[ipstr]; ok {
-		t.log.Debugln("received duplicate connection from same IP: ", ipstr)
-		conn.Close()
-		return
+	// Connections over other transports do not have an IP address, so they are not checked for duplicates and bans.
+	ipstr := peerconn.Host(conn.RemoteAddr())
+	if ip != nil {
+		if _, ok := t.connectedPeerIPs[ipstr]; ok {
+			t.log.Debugln("received duplicate connection from same IP: ", ipstr)
+			conn.Close()
+			return errPeerIPConnected
+		}
+		if _, ok := t.bannedPeerIPs[ipstr]; ok || t.peerBans.Banned(ipstr) {
+			t.log.Debugln("connection attempt from banned IP: ", ipstr)
+			conn.Close()
+			return errPeerBanned
+		}
 	}
-	if _, ok := t.bannedPeerIPs[ipstr]; ok {
-		t.log.Debugln("connection attempt from banned IP: ", ipstr)
+	if !t.session.connLimiter.Acquire(nil) {
+		t.log.Debugln("session peer limit reached, rejecting peer", conn.RemoteAddr().String())
 		conn.Close()
-		return
+		return errPeerLimitReached
 	}
 	h := incominghandshaker.New(conn)
 	t.incomingHandshakers[h] = struct{}{}
-	t.connectedPeerIPs[ipstr] = struct{}{}
+	if ip != nil {
+		t.connectedPeerIPs[ipstr] = struct{}{}
+	}
+	allowEncryption, forceEncryption := t.session.config.incomingEncryption()
+	getSKey := t.getSKey
+	if !allowEncryption {
+		getSKey = nil
+	}
 	go h.Run(
-		t.peerID,
-		t.getSKey,
+		t.getPeerID,
+		getSKey,
 		t.checkInfoHash,
 		t.incomingHandshakerResultC,
 		t.session.config.PeerHandshakeTimeout,
 		t.session.extensions,
-		t.session.config.ForceIncomingEncryption,
+		forceEncryption,
 	)
+	return nil
+}
+
+// handleSharedConnection runs the peer of a connection accepted and handshaked by the session listener.
+// Session peer limit is already acquired for the connection.
+func (t *torrent) handleSharedConnection(h *incominghandshaker.IncomingHandshaker) {
+	ipstr := peerconn.Host(h.Conn.RemoteAddr())
+	reject := func(msg string) {
+		t.log.Debugln(msg, h.Conn.RemoteAddr().String())
+		h.Conn.Close()
+		t.session.connLimiter.Release()
+	}
+	if !t.sharedListening {
+		reject("torrent is not accepting connections, rejecting peer")
+		return
+	}
+	if len(t.incomingHandshakers)+len(t.incomingPeers) >= t.session.config.MaxPeerAccept {
+		reject("peer limit reached, rejecting peer")
+		return
+	}
+	if _, ok := t.connectedPeerIPs[ipstr]; ok {
+		reject("received duplicate connection from same IP:")
+		return
+	}
+	if _, ok := t.bannedPeerIPs[ipstr]; ok || t.peerBans.Banned(ipstr) {
+		reject("connection attempt from banned IP:")
+		return
+	}
+	t.connectedPeerIPs[ipstr] = struct{}{}
+	_ = t.startPeer(h.Conn, peersource.Incoming, t.incomingPeers, h.PeerID, h.Extensions, h.Cipher)
 }
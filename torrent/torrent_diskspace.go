@@ -0,0 +1,50 @@
+package torrent
+
+import (
+	"path/filepath"
+
+	"github.com/cenkalti/rain/internal/diskspace"
+)
+
+// checkDiskSpace returns DiskSpaceError if the free space in storage directory is less than the space needed for the files.
+// Space that is already allocated for existing files is not needed again, so a partially downloaded torrent can be resumed.
+// Skipped files are not counted.
+// Errors that prevent the check are logged and ignored.
+func (t *torrent) checkDiskSpace() error {
+	if t.session.config.IgnoreDiskCheck {
+		return nil
+	}
+	dir := t.storage.RootDir()
+	if dir == "" {
+		return nil
+	}
+	var required int64
+	for i, f := range t.info.Files {
+		if f.Padding || t.filePriority(i) == Skip {
+			continue
+		}
+		n, err := diskspace.Allocated(filepath.Join(dir, filepath.Clean(f.Path)))
+		if err != nil {
+			t.log.Warningln("cannot check disk space:", err)
+			return nil
+		}
+		if n < f.Length {
+			required += f.Length - n
+		}
+	}
+	if required == 0 {
+		return nil
+	}
+	available, err := diskspace.Free(dir)
+	if err == diskspace.ErrUnsupported {
+		return nil
+	}
+	if err != nil {
+		t.log.Warningln("cannot check disk space:", err)
+		return nil
+	}
+	if available < required {
+		return &DiskSpaceError{Required: required, Available: available}
+	}
+	return nil
+}
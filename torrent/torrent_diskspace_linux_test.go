@@ -0,0 +1,91 @@
+package torrent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountTmpfs mounts a 1 MB tmpfs on a temporary directory. The test is skipped if mounting is not permitted.
+func mountTmpfs(t *testing.T) string {
+	dir := t.TempDir()
+	err := unix.Mount("tmpfs", dir, "tmpfs", 0, "size=1m")
+	if err != nil {
+		t.Skip("cannot mount tmpfs:", err)
+	}
+	t.Cleanup(func() { _ = unix.Unmount(dir, 0) })
+	return dir
+}
+
+func addTorrentOnTmpfs(t *testing.T, ignoreDiskCheck bool) (*Torrent, func()) {
+	dir := mountTmpfs(t)
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.DataDir = dir
+		cfg.IgnoreDiskCheck = ignoreDiskCheck
+	})
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tor, closeSession
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	tor, closeSession := addTorrentOnTmpfs(t, false)
+	defer closeSession()
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Torrent may be stopped before NotifyStop is called, so the error is checked in stats.
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Stopped })
+	err = tor.Stats().Error
+	var dse *DiskSpaceError
+	if !errors.As(err, &dse) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dse.Required != tor.torrent.info.Length {
+		t.Fatalf("required space is %d, want %d", dse.Required, tor.torrent.info.Length)
+	}
+	if dse.Available > 1<<20 {
+		t.Fatalf("invalid available space: %d", dse.Available)
+	}
+}
+
+func TestDiskSpaceCheckIgnored(t *testing.T) {
+	tor, closeSession := addTorrentOnTmpfs(t, true)
+	defer closeSession()
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Downloading })
+}
+
+func TestDiskSpaceCheckSkippedFile(t *testing.T) {
+	tor, closeSession := addTorrentOnTmpfs(t, false)
+	defer closeSession()
+	// Other files fit in the tmpfs.
+	for i, f := range tor.Files() {
+		if filepath.Base(f.Path) != "zero.bin" {
+			continue
+		}
+		err := tor.SetFilePriority(i, Skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Downloading })
+}
@@ -0,0 +1,218 @@
+package torrent
+
+import (
+	"errors"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+var errInvalidFileIndex = errors.New("invalid file index")
+
+// FilePriority determines whether a file in torrent is downloaded or not.
+type FilePriority int
+
+const (
+	// Normal priority files are downloaded.
+	Normal FilePriority = iota
+	// Skip excludes the file from downloading.
+	// Pieces that are shared with a wanted file are still downloaded.
+	Skip
+)
+
+// File is a file in torrent. Padding files are not included.
+type File struct {
+	// Path of the file relative to the data directory of torrent.
+	Path string
+	// Length of the file in bytes.
+	Length int64
+	// Download priority of the file.
+	Priority FilePriority
+	// Range of piece indexes that contains the data of the file.
+	// PieceBegin is inclusive, PieceEnd is exclusive.
+	// First and last pieces may also contain data of neighbour files.
+	PieceBegin uint32
+	PieceEnd   uint32
+}
+
+type filesRequest struct {
+	Response chan []File
+}
+
+type setFilePriorityRequest struct {
+	Index    int
+	Priority FilePriority
+	Response chan error
+}
+
+// Files returns the files in the torrent. Returns nil if torrent has no metadata yet.
+func (t *torrent) Files() []File {
+	var files []File
+	req := filesRequest{Response: make(chan []File, 1)}
+	select {
+	case t.filesCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case files = <-req.Response:
+	case <-t.closeC:
+	}
+	return files
+}
+
+// SetFilePriority sets the priority of the file at index. Index is the position of file in the slice returned from Files().
+func (t *torrent) SetFilePriority(index int, prio FilePriority) error {
+	req := setFilePriorityRequest{Index: index, Priority: prio, Response: make(chan error, 1)}
+	select {
+	case t.setFilePriorityCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+func (t *torrent) getFiles() []File {
+	if t.info == nil {
+		return nil
+	}
+	files := make([]File, 0, len(t.info.Files))
+	var offset int64
+	for i, f := range t.info.Files {
+		begin, end := filePieceRange(t.info, offset, f.Length)
+		offset += f.Length
+		if f.Padding {
+			continue
+		}
+		files = append(files, File{
+			Path:       f.Path,
+			Length:     f.Length,
+			Priority:   t.filePriority(i),
+			PieceBegin: begin,
+			PieceEnd:   end,
+		})
+	}
+	return files
+}
+
+func (t *torrent) filePriority(i int) FilePriority {
+	if t.filePriorities == nil {
+		return Normal
+	}
+	return t.filePriorities[i]
+}
+
+func (t *torrent) handleSetFilePriority(index int, prio FilePriority) error {
+	if t.info == nil {
+		return errors.New("torrent metadata not ready")
+	}
+	if prio != Normal && prio != Skip {
+		return errors.New("invalid file priority")
+	}
+	i := infoFileIndex(t.info, index)
+	if i < 0 {
+		return errInvalidFileIndex
+	}
+	if t.filePriority(i) == prio {
+		return nil
+	}
+	priorities := make([]FilePriority, len(t.info.Files))
+	copy(priorities, t.filePriorities)
+	priorities[i] = prio
+	err := t.session.resumer.WriteFilePriorities(t.id, filePrioritiesToInts(priorities))
+	if err != nil {
+		return err
+	}
+	t.filePriorities = priorities
+	t.updateSkippedPieces()
+	for pe := range t.peers {
+		t.updateInterestedState(pe)
+	}
+	t.startPieceDownloaders()
+	return nil
+}
+
+// updateSkippedPieces marks the pieces in piece picker that contain data only from skipped files.
+func (t *torrent) updateSkippedPieces() {
+	if t.piecePicker == nil {
+		return
+	}
+	skipped := skippedPieces(t.info, t.filePriorities)
+	for i := range t.pieces {
+		t.piecePicker.SetSkipped(uint32(i), skipped[i])
+	}
+}
+
+func (t *torrent) pieceSkipped(i uint32) bool {
+	return t.piecePicker != nil && t.piecePicker.Skipped(i)
+}
+
+// skippedPieces returns a slice for each piece in torrent.
+// A piece is skipped if all of the files that it contains are skipped. Padding files are not taken into account.
+func skippedPieces(info *metainfo.Info, priorities []FilePriority) []bool {
+	skipped := make([]bool, info.NumPieces)
+	if priorities == nil {
+		return skipped
+	}
+	for i := range skipped {
+		skipped[i] = true
+	}
+	var offset int64
+	for i, f := range info.Files {
+		begin, end := filePieceRange(info, offset, f.Length)
+		offset += f.Length
+		if f.Padding || priorities[i] == Skip {
+			continue
+		}
+		for j := begin; j < end; j++ {
+			skipped[j] = false
+		}
+	}
+	return skipped
+}
+
+// filePieceRange returns the range of pieces that contain the file data at offset with length.
+func filePieceRange(info *metainfo.Info, offset, length int64) (begin, end uint32) {
+	begin = uint32(offset / int64(info.PieceLength))
+	if length == 0 {
+		return begin, begin
+	}
+	end = uint32((offset + length + int64(info.PieceLength) - 1) / int64(info.PieceLength))
+	return begin, end
+}
+
+// infoFileIndex converts index of the file returned from Files() to the index in info.Files.
+func infoFileIndex(info *metainfo.Info, index int) int {
+	if index < 0 {
+		return -1
+	}
+	for i, f := range info.Files {
+		if f.Padding {
+			continue
+		}
+		if index == 0 {
+			return i
+		}
+		index--
+	}
+	return -1
+}
+
+func filePrioritiesToInts(priorities []FilePriority) []int {
+	ret := make([]int, len(priorities))
+	for i, p := range priorities {
+		ret[i] = int(p)
+	}
+	return ret
+}
+
+func filePrioritiesFromInts(values []int) []FilePriority {
+	ret := make([]FilePriority, len(values))
+	for i, v := range values {
+		ret[i] = FilePriority(v)
+	}
+	return ret
+}
@@ -0,0 +1,23 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkippedPieces(t *testing.T) {
+	info := &metainfo.Info{
+		PieceLength: 4,
+		NumPieces:   5,
+		Files: []metainfo.File{
+			{Path: "a", Length: 10},
+			{Path: "b", Length: 10},
+		},
+	}
+	assert.Equal(t, []bool{false, false, false, false, false}, skippedPieces(info, nil))
+	assert.Equal(t, []bool{false, false, false, true, true}, skippedPieces(info, []FilePriority{Normal, Skip}))
+	assert.Equal(t, []bool{true, true, false, false, false}, skippedPieces(info, []FilePriority{Skip, Normal}))
+	assert.Equal(t, []bool{true, true, true, true, true}, skippedPieces(info, []FilePriority{Skip, Skip}))
+}
@@ -1,10 +1,9 @@
 package torrent
 
 import (
-	"net"
-
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/cenkalti/rain/internal/peerconn"
 	"github.com/cenkalti/rain/internal/peersource"
 )
 
@@ -15,6 +14,10 @@ func (t *torrent) getSKey(sKeyHash [20]byte) []byte {
 	return nil
 }
 
+func (t *torrent) getPeerID(infoHash [20]byte) [20]byte {
+	return t.peerID
+}
+
 func (t *torrent) checkInfoHash(infoHash [20]byte) bool {
 	return infoHash == t.infoHash
 }
@@ -22,18 +25,29 @@ func (t *torrent) checkInfoHash(infoHash [20]byte) bool {
 func (t *torrent) handleIncomingHandshakeDone(ih *incominghandshaker.IncomingHandshaker) {
 	delete(t.incomingHandshakers, ih)
 	if ih.Error != nil {
-		delete(t.connectedPeerIPs, ih.Conn.RemoteAddr().(*net.TCPAddr).IP.String())
+		ih.Conn.Close()
+		delete(t.connectedPeerIPs, peerconn.Host(ih.Conn.RemoteAddr()))
+		t.session.connLimiter.Release()
 		return
 	}
-	t.startPeer(ih.Conn, peersource.Incoming, t.incomingPeers, ih.PeerID, ih.Extensions, ih.Cipher)
+	_ = t.startPeer(ih.Conn, peersource.Incoming, t.incomingPeers, ih.PeerID, ih.Extensions, ih.Cipher)
 }
 
 func (t *torrent) handleOutgoingHandshakeDone(oh *outgoinghandshaker.OutgoingHandshaker) {
 	delete(t.outgoingHandshakers, oh)
+	t.session.halfOpen.Release()
 	if oh.Error != nil {
+		t.notifyConnectPeerWaiters(oh.Addr, oh.Error)
 		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		t.session.connLimiter.Release()
+		if _, ok := t.addrList.Failed(oh.Addr, oh.Source); ok {
+			t.scheduleAddrRetry()
+		}
 		t.dialAddresses()
 		return
 	}
-	t.startPeer(oh.Conn, oh.Source, t.outgoingPeers, oh.PeerID, oh.Extensions, oh.Cipher)
+	t.addrList.Connected(oh.Addr)
+	// Waiters are notified after the peer is accepted, so ConnectPeer does not return nil for a rejected peer.
+	err := t.startPeer(oh.Conn, oh.Source, t.outgoingPeers, oh.PeerID, oh.Extensions, oh.Cipher)
+	t.notifyConnectPeerWaiters(oh.Addr, err)
 }
@@ -0,0 +1,30 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/cenkalti/rain/internal/infodownloader"
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+func TestInfoDownloadMetadataSizeLimit(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.MaxMetadataSize = 10 << 20
+	newPeer := func(size int) *peer.Peer {
+		return &peer.Peer{ExtensionHandshake: &peerprotocol.ExtensionHandshakeMessage{
+			M:            map[string]uint8{peerprotocol.ExtensionKeyMetadata: peerprotocol.ExtensionIDMetadata},
+			MetadataSize: size,
+		}}
+	}
+	tor := &torrent{
+		session:         &Session{config: cfg},
+		log:             logger.New("test"),
+		peers:           map[*peer.Peer]struct{}{newPeer(1 << 30): {}},
+		infoDownloaders: make(map[*peer.Peer]*infodownloader.InfoDownloader),
+	}
+	if id := tor.nextInfoDownload(); id != nil {
+		t.Fatalf("info download is started with metadata size: %d", len(id.Bytes))
+	}
+}
@@ -3,6 +3,7 @@ package torrent
 import (
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/cachedpiece"
@@ -22,14 +23,14 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 	if t.pieces == nil || t.bitfield == nil {
 		pe.Logger().Error("piece received but we don't have info")
 		t.bytesWasted.Inc(l)
-		t.closePeer(pe)
+		t.banPeer(pe)
 		msg.Buffer.Release()
 		return
 	}
 	if msg.Index >= uint32(len(t.pieces)) {
 		pe.Logger().Errorln("invalid piece index:", msg.Index)
 		t.bytesWasted.Inc(l)
-		t.closePeer(pe)
+		t.banPeer(pe)
 		msg.Buffer.Release()
 		return
 	}
@@ -40,53 +41,62 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 	if !ok {
 		t.bytesWasted.Inc(l)
 		msg.Buffer.Release()
+		t.countUnsolicitedBlock(pe)
 		return
 	}
 	if pd.Piece.Index != msg.Index {
 		t.bytesWasted.Inc(l)
 		msg.Buffer.Release()
+		t.countUnsolicitedBlock(pe)
 		return
 	}
 	piece := pd.Piece
 	err := pd.GotBlock(msg.Begin, msg.Buffer.Data)
 	switch err {
 	case piecedownloader.ErrBlockInvalid:
-		pe.Logger().Errorln("received invalid piece index:", msg.Index, "begin:", msg.Begin, "length:", len(msg.Buffer.Data))
+		pe.Logger().Errorln("received invalid block:", msg)
 		t.bytesWasted.Inc(l)
-		t.closePeer(pe)
+		t.banPeer(pe)
 		msg.Buffer.Release()
 		return
 	case piecedownloader.ErrBlockDuplicate:
 		if pe.FastEnabled {
-			pe.Logger().Warningf("received duplicate block index:", msg.Index, "begin:", msg.Begin, "length:", len(msg.Buffer.Data))
+			pe.Logger().Warningln("received duplicate block:", msg)
 		} else {
 			// If peer does not support fast extension, we cancel all pending requests on choke message.
 			// After an unchoke we request them again. Some clients appears to be sending the same block
 			// if we request it twice.
-			pe.Logger().Debugf("received duplicate block index:", msg.Index, "begin:", msg.Begin, "length:", len(msg.Buffer.Data))
+			pe.Logger().Debugln("received duplicate block:", msg)
 		}
 		t.bytesWasted.Inc(l)
 		msg.Buffer.Release()
 		return
 	case piecedownloader.ErrBlockNotRequested:
 		if pe.FastEnabled {
-			pe.Logger().Warningf("received not requested block index:", msg.Index, "begin:", msg.Begin, "length:", len(msg.Buffer.Data))
+			pe.Logger().Warningln("received not requested block:", msg)
 		} else {
 			// If peer does not support fast extension, we cancel all pending requests on choke message.
 			// That's why we think that we have received an unrequested block.
-			pe.Logger().Debugf("received not requested block index:", msg.Index, "begin:", msg.Begin, "length:", len(msg.Buffer.Data))
+			pe.Logger().Debugln("received not requested block:", msg)
+		}
+		if !t.countUnsolicitedBlock(pe) {
+			msg.Buffer.Release()
+			return
 		}
 	case nil:
 	default:
 		pe.Logger().Error(err)
-		t.closePeer(pe)
+		t.banPeer(pe)
 		msg.Buffer.Release()
 		return
 	}
 	msg.Buffer.Release()
+	if pe.Snubbed() {
+		t.handlePeerUnsnubbed(pe, pd)
+	}
 	if !pd.Done() {
 		pe := pd.Peer.(*peer.Peer)
-		if pd.AllowedFast || !pe.PeerChoking {
+		if t.canRequestBlocks(pe, pd.AllowedFast) {
 			pd.RequestBlocks(t.maxAllowedRequests(pe))
 			pe.ResetSnubTimer()
 		}
@@ -109,10 +119,11 @@ func (t *torrent) handlePieceMessage(pm peer.PieceMessage) {
 	t.webseedPieceResultC.Suspend()
 
 	pw := piecewriter.New(piece, pe, pd.Buffer)
+	pw.Restored = pd.Restored
 	go pw.Run(t.pieceWriterResultC, t.doneC, t.session.metrics.WritesPerSecond, t.session.metrics.SpeedWrite, t.session.semWrite)
 }
 
-func (t *torrent) handlePeerMessage(pm peer.Message) {
+func (t *torrent) handlePeerMessage(pm peer.ReceivedMessage) {
 	pe := pm.Peer
 	switch msg := pm.Message.(type) {
 	case peerprotocol.HaveMessage:
@@ -123,12 +134,15 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		}
 		if msg.Index >= t.info.NumPieces {
 			pe.Logger().Errorln("unexpected piece index:", msg.Index)
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 		// pe.Logger().Debug("Peer ", pe.String(), " has piece #", pi.Index)
 		if t.piecePicker != nil {
 			t.piecePicker.HandleHave(pe, msg.Index)
+		} else {
+			// Availability is still tracked while seeding for serving the rarest pieces first.
+			pe.Bitfield.Set(msg.Index)
 		}
 		t.updateInterestedState(pe)
 		t.startPieceDownloaderFor(pe)
@@ -145,16 +159,16 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		bf, err := bitfield.NewBytes(msg.Data, t.info.NumPieces)
 		if err != nil {
 			pe.Logger().Errorf("%s [len(bitfield)=%d] [numPieces=%d]", err, len(msg.Data), t.info.NumPieces)
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 		pe.Logger().Debugln("Received bitfield:", bf.Hex())
 		if t.piecePicker != nil {
-			for i := uint32(0); i < bf.Len(); i++ {
-				if bf.Test(i) {
-					t.piecePicker.HandleHave(pe, i)
-				}
+			for i, ok := bf.NextSet(0); ok; i, ok = bf.NextSet(i + 1) {
+				t.piecePicker.HandleHave(pe, i)
 			}
+		} else {
+			pe.Bitfield = pe.Bitfield.Or(bf)
 		}
 		t.updateInterestedState(pe)
 		t.startPieceDownloaderFor(pe)
@@ -167,6 +181,8 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			for _, pi := range t.pieces {
 				t.piecePicker.HandleHave(pe, pi.Index)
 			}
+		} else {
+			pe.Bitfield.SetRange(0, t.info.NumPieces)
 		}
 		t.updateInterestedState(pe)
 		t.startPieceDownloaderFor(pe)
@@ -178,7 +194,7 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		}
 		if msg.Index >= t.info.NumPieces {
 			pe.Logger().Errorln("invalid allowed fast piece index:", msg.Index)
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 		pe.Logger().Debug("Peer ", pe.String(), " has allowed fast for piece #", msg.Index)
@@ -196,8 +212,10 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			break
 		}
 		delete(t.pieceDownloadersChoked, pd.Peer.(*peer.Peer))
-		pd.RequestBlocks(t.maxAllowedRequests(pe))
-		pe.ResetSnubTimer()
+		if !t.paused {
+			pd.RequestBlocks(t.maxAllowedRequests(pe))
+			pe.ResetSnubTimer()
+		}
 		if t.piecePicker != nil {
 			t.piecePicker.HandleUnchoke(pe, pd.Piece.Index)
 		}
@@ -220,23 +238,25 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		t.startPieceDownloaders()
 	case peerprotocol.InterestedMessage:
 		pe.PeerInterested = true
-		t.unchoker.FastUnchoke(pe)
+		if !t.paused {
+			t.unchoker.FastUnchoke(pe)
+		}
 	case peerprotocol.NotInterestedMessage:
 		pe.PeerInterested = false
 	case peerprotocol.RequestMessage:
 		if t.pieces == nil || t.bitfield == nil {
 			pe.Logger().Error("request received but we don't have info")
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 		if msg.Index >= t.info.NumPieces {
 			pe.Logger().Errorln("invalid request index:", msg.Index)
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
-		if msg.Begin+msg.Length > t.pieces[msg.Index].Length {
+		if pieceLength := t.pieces[msg.Index].Length; msg.Begin > pieceLength || msg.Length > pieceLength-msg.Begin {
 			pe.Logger().Errorln("invalid request length:", msg.Length)
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 		pi := &t.pieces[msg.Index]
@@ -247,26 +267,26 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		}
 		if pe.ClientChoking {
 			if pe.FastEnabled {
-				if pe.SentAllowedFast.Has(pi) {
-					pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
+				if !t.paused && pe.SentAllowedFast.Has(pi) {
+					pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID), t.pieceAvailability(msg.Index))
 				} else {
 					m := peerprotocol.RejectMessage{RequestMessage: msg}
 					pe.SendMessage(m)
 				}
 			}
 		} else {
-			pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
+			pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID), t.pieceAvailability(msg.Index))
 		}
 	case peerprotocol.RejectMessage:
 		if t.pieces == nil || t.bitfield == nil {
 			pe.Logger().Error("reject received but we don't have info")
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 
 		if msg.Index >= t.info.NumPieces {
 			pe.Logger().Errorln("invalid reject index:", msg.Index)
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 		pd, ok := t.pieceDownloaders[pe]
@@ -278,14 +298,14 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		}
 		ok = pd.Rejected(msg.Begin, msg.Length)
 		if !ok {
-			pe.Logger().Errorln("invalid reject index:", msg.Index, "begin:", msg.Begin, "length:", msg.Length)
-			t.closePeer(pe)
+			pe.Logger().Errorln("invalid reject:", msg)
+			t.banPeer(pe)
 			break
 		}
 	case peerprotocol.CancelMessage:
 		if t.pieces == nil || t.bitfield == nil {
 			pe.Logger().Error("cancel received but we don't have info")
-			t.closePeer(pe)
+			t.banPeer(pe)
 			break
 		}
 
@@ -302,14 +322,16 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			}})
 		}
 	case peerprotocol.PortMessage:
-		if t.session.dht != nil {
-			t.session.dht.AddNode(fmt.Sprintf("%s:%d", pe.IP(), msg.Port))
+		// DHT must not be used for private torrents (BEP 27).
+		if t.session.dht != nil && msg.Port != 0 && (t.info == nil || !t.info.Private) {
+			t.session.dht.AddNode(net.JoinHostPort(pe.IP(), strconv.Itoa(int(msg.Port))))
 		}
 	case peerwriter.BlockUploaded:
 		l := int64(msg.Length)
 		t.uploadSpeed.Mark(l)
 		t.bytesUploaded.Inc(l)
 		t.session.metrics.SpeedUpload.Mark(l)
+		t.checkSeedLimits()
 	case peerprotocol.ExtensionHandshakeMessage:
 		pe.Logger().Debugln("extension handshake received:", msg)
 		if pe.ExtensionHandshake != nil {
@@ -337,6 +359,10 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		if !t.session.config.PEXEnabled {
 			break
 		}
+		if t.info != nil && t.info.Private {
+			pe.Logger().Debugln("ignoring pex message for private torrent")
+			break
+		}
 		addrs, err := tracker.DecodePeersCompact([]byte(msg.Added))
 		if err != nil {
 			t.log.Error(err)
@@ -349,6 +375,9 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			break
 		}
 		t.handleNewPeers(addrs, peersource.PEX)
+	case peerprotocol.ExtensionMessage:
+		// Messages of extensions registered with peerprotocol.RegisterExtension are handled by peer.Handler implementations.
+		pe.Logger().Debugln("ignoring message of registered extension:", msg.ExtendedMessageID)
 	default:
 		panic(fmt.Sprintf("unhandled peer message type: %T", msg))
 	}
@@ -360,10 +389,10 @@ func (t *torrent) updateInterestedState(pe *peer.Peer) {
 	}
 	interested := false
 	if !t.completed {
-		for i := uint32(0); i < t.bitfield.Len(); i++ {
-			weHave := t.bitfield.Test(i)
-			peerHave := pe.Bitfield.Test(i)
-			if !weHave && peerHave {
+		// Pieces that the peer has and we don't.
+		missing := pe.Bitfield.AndNot(t.bitfield)
+		for i, ok := missing.NextSet(0); ok; i, ok = missing.NextSet(i + 1) {
+			if !t.pieceSkipped(i) {
 				interested = true
 				break
 			}
@@ -382,3 +411,16 @@ func (t *torrent) updateInterestedState(pe *peer.Peer) {
 		return
 	}
 }
+
+// countUnsolicitedBlock must be called when a block is received without a matching request.
+// Returns false if the peer is banned for sending too many of them.
+func (t *torrent) countUnsolicitedBlock(pe *peer.Peer) bool {
+	pe.UnsolicitedBlocks++
+	limit := t.session.config.PeerMaxUnsolicitedBlocks
+	if limit > 0 && pe.UnsolicitedBlocks > limit {
+		pe.Logger().Errorln("peer has sent too many blocks that are not requested:", pe.UnsolicitedBlocks)
+		t.banPeer(pe)
+		return false
+	}
+	return true
+}
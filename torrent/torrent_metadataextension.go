@@ -91,7 +91,10 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 			t.stop(errors.New("private torrent from magnet"))
 			break
 		}
+		// Info is read with the bitfield lock from other goroutines.
+		t.mBitfield.Lock()
 		t.info = info
+		t.mBitfield.Unlock()
 		t.piecePool = bufferpool.New(int(info.PieceLength))
 		err = t.session.resumer.WriteInfo(t.id, t.info.Bytes)
 		if err != nil {
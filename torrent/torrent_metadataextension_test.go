@@ -0,0 +1,45 @@
+package torrent
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStopAfterMetadata(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	seed := addCompletedTorrent(t, s1, AddTorrentOptions{})
+	seed.Start()
+	var port int
+	select {
+	case port = <-seed.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("seeder is not listening")
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	tor, err := s.AddURI(torrentMagnetLink+"&x.pe="+addr, &AddTorrentOptions{StopAfterMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyMetadata():
+	case <-time.After(timeout):
+		t.Fatal("metadata is not downloaded")
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Stopped })
+	files := tor.Files()
+	if len(files) == 0 {
+		t.Fatal("no files in metadata")
+	}
+	if st := tor.Stats(); st.Bytes.Downloaded != 0 || st.Pieces.Have != 0 {
+		t.Fatalf("data is downloaded: %+v", st.Bytes)
+	}
+	if st := seed.Stats(); st.Bytes.Uploaded != 0 {
+		t.Fatalf("seeder uploaded %d bytes", st.Bytes.Uploaded)
+	}
+}
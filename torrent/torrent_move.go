@@ -0,0 +1,100 @@
+package torrent
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/cenkalti/rain/internal/datamover"
+)
+
+// dataMoveNeeded returns true if the files of a completed torrent must be moved into Config.CompletedDataDir.
+func (t *torrent) dataMoveNeeded() bool {
+	if t.session.config.CompletedDataDir == "" || t.session.config.Storage != nil {
+		return false
+	}
+	dest, err := filepath.Abs(t.session.getCompletedDataDir(t.id))
+	if err != nil {
+		return false
+	}
+	return t.rootDir() != dest
+}
+
+// stopAndMoveData stops the torrent and moves the files to Config.CompletedDataDir after the files are closed.
+// The torrent is started again from new location when the move is done, unless it is configured to stop after download.
+func (t *torrent) stopAndMoveData() {
+	if t.stopAfterDownload {
+		err := t.session.resumer.HandleStopAfterDownload(t.id)
+		if err != nil {
+			t.log.Errorf("cannot write status to resume db: %s", err)
+		}
+	}
+	t.stop(nil)
+	t.moveDataOnStop = true
+	t.startAfterMove = !t.stopAfterDownload
+}
+
+func (t *torrent) startDataMover() {
+	if t.dataMover != nil {
+		panic("data mover exists")
+	}
+	files := make([]string, 0, len(t.info.Files))
+	for _, f := range t.info.Files {
+		if !f.Padding {
+			files = append(files, f.Path)
+		}
+	}
+	t.log.Info("moving files to completed data dir")
+	t.dataMover = datamover.New(t.rootDir(), t.session.getCompletedDataDir(t.id))
+	go t.dataMover.Run(files, t.session.config.FilePermissions, t.dataMoverResultC)
+}
+
+func (t *torrent) stopDataMover() {
+	t.log.Debugln("stopping data mover")
+	if t.dataMover != nil {
+		t.dataMover.Close()
+		t.dataMover = nil
+	}
+}
+
+func (t *torrent) handleDataMoveDone(m *datamover.DataMover) {
+	if t.dataMover != m {
+		panic("invalid data mover")
+	}
+	t.dataMover = nil
+
+	if m.Error != nil {
+		// Files that are moved before the error are found again when the move is retried on next start.
+		t.lastError = fmt.Errorf("cannot move files: %w", m.Error)
+		t.log.Error(t.lastError)
+		return
+	}
+	sto, err := t.session.newStorage(t.id, m.Dest)
+	if err != nil {
+		t.lastError = err
+		t.log.Error(err)
+		return
+	}
+	err = t.session.resumer.WriteDest(t.id, m.Dest)
+	if err != nil {
+		t.lastError = err
+		t.log.Error(err)
+		return
+	}
+	t.mStorage.Lock()
+	t.storage = sto
+	t.mStorage.Unlock()
+	t.log.Info("files are moved to ", m.Dest)
+
+	t.runCompleteCmd()
+	if t.startAfterMove {
+		t.start()
+	}
+}
+
+// rootDir returns the directory that files are saved into.
+// It is safe to call from other goroutines.
+func (t *torrent) rootDir() string {
+	t.mStorage.RLock()
+	defer t.mStorage.RUnlock()
+	return t.storage.RootDir()
+}
@@ -0,0 +1,121 @@
+package torrent
+
+import (
+	"sort"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/piecedownloader"
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+)
+
+// partialPiece contains the blocks of an incomplete piece that are written to disk.
+type partialPiece struct {
+	blockSize uint32
+	// Bits are in the order of blocks returned from piece.CalculateBlocks.
+	blocks *bitfield.Bitfield
+}
+
+// savePartialPieces writes the downloaded blocks of incomplete pieces to disk before the torrent is stopped,
+// so they are not requested again on next start.
+// Blocks are kept in memory until all blocks of the piece are downloaded, so this is only done on stop.
+func (t *torrent) savePartialPieces() {
+	if t.pieces == nil || t.bitfield == nil {
+		return
+	}
+	blockSize := t.requestBlockSize()
+	for _, pd := range t.pieceDownloaders {
+		pi := pd.Piece
+		if pi.Done || pi.Writing {
+			continue
+		}
+		blocks := pi.CalculateBlocks(blockSize)
+		pp, ok := t.partialPieces[pi.Index]
+		if !ok || pp.blockSize != blockSize || pp.blocks.Len() != uint32(len(blocks)) {
+			pp = &partialPiece{blockSize: blockSize, blocks: bitfield.New(uint32(len(blocks)))}
+		}
+		for i, blk := range blocks {
+			if pp.blocks.Test(uint32(i)) || !pd.Downloaded(blk.Begin) {
+				continue
+			}
+			_, err := pi.Data.WriteAt(pd.Buffer.Data[blk.Begin:blk.Begin+blk.Length], int64(blk.Begin))
+			if err != nil {
+				t.log.Errorf("cannot save downloaded blocks of piece #%d: %s", pi.Index, err)
+				break
+			}
+			pp.blocks.Set(uint32(i))
+		}
+		if pp.blocks.Count() > 0 {
+			t.partialPieces[pi.Index] = pp
+		}
+	}
+	specs := make([]boltdbresumer.PartialPiece, 0, len(t.partialPieces))
+	for i, pp := range t.partialPieces {
+		if t.bitfield.Test(i) {
+			delete(t.partialPieces, i)
+			continue
+		}
+		specs = append(specs, boltdbresumer.PartialPiece{Index: i, BlockSize: pp.blockSize, Blocks: pp.blocks.Bytes()})
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Index < specs[j].Index })
+	err := t.session.resumer.WritePartialPieces(t.id, specs)
+	if err != nil {
+		t.log.Errorf("cannot write partial pieces to resume db: %s", err)
+	}
+}
+
+// loadPartialPiece reads the blocks of the piece that are saved on previous stop into the buffer of the piece downloader.
+// Read blocks are not requested from the peer.
+func (t *torrent) loadPartialPiece(pd *piecedownloader.PieceDownloader) {
+	pi := pd.Piece
+	pp, ok := t.partialPieces[pi.Index]
+	if !ok {
+		return
+	}
+	blockSize := t.requestBlockSize()
+	blocks := pi.CalculateBlocks(blockSize)
+	if pp.blockSize != blockSize || bitfield.NumBytes(uint32(len(blocks))) != len(pp.blocks.Bytes()) {
+		// Request block size is changed since the blocks are saved.
+		delete(t.partialPieces, pi.Index)
+		return
+	}
+	pp.blocks, _ = bitfield.NewBytes(pp.blocks.Bytes(), uint32(len(blocks)))
+	saved := make([]uint32, 0, len(blocks))
+	for i, blk := range blocks {
+		if !pp.blocks.Test(uint32(i)) {
+			continue
+		}
+		_, err := pi.Data.ReadAt(pd.Buffer.Data[blk.Begin:blk.Begin+blk.Length], int64(blk.Begin))
+		if err != nil {
+			t.log.Errorf("cannot read saved blocks of piece #%d: %s", pi.Index, err)
+			delete(t.partialPieces, pi.Index)
+			return
+		}
+		saved = append(saved, blk.Begin)
+	}
+	// At least one block is requested from the peer,
+	// so the piece is hash checked and written when the last block is received as any other piece.
+	if len(saved) == len(blocks) {
+		saved = saved[:len(saved)-1]
+	}
+	for _, begin := range saved {
+		pd.SetDownloaded(begin)
+	}
+	t.log.Debugf("loaded %d saved blocks of piece #%d", len(saved), pi.Index)
+}
+
+func partialPiecesFromSpec(specs []boltdbresumer.PartialPiece, numPieces uint32) map[uint32]*partialPiece {
+	ret := make(map[uint32]*partialPiece, len(specs))
+	for _, s := range specs {
+		if s.Index >= numPieces || s.BlockSize == 0 {
+			continue
+		}
+		b := make([]byte, len(s.Blocks))
+		copy(b, s.Blocks)
+		bf, err := bitfield.NewBytes(b, uint32(len(b))*8)
+		if err != nil {
+			continue
+		}
+		ret[s.Index] = &partialPiece{blockSize: s.BlockSize, blocks: bf}
+	}
+	return ret
+}
@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/peer"
+)
+
+// Pause chokes all peers and stops requesting new blocks while keeping peer connections open.
+// Blocks that are already requested are still accepted, so partially downloaded pieces are not lost.
+// Webseed downloads that are already running are not interrupted but no new ones are started.
+func (t *torrent) Pause() {
+	select {
+	case t.pauseCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+}
+
+// Resume undoes the effect of Pause.
+func (t *torrent) Resume() {
+	select {
+	case t.resumeCommandC <- struct{}{}:
+	case <-t.closeC:
+	}
+}
+
+// Paused returns true if the torrent is paused with Pause.
+func (t *torrent) Paused() bool {
+	return t.Stats().Paused
+}
+
+func (t *torrent) handlePause() {
+	if t.paused {
+		return
+	}
+	t.writePaused(true)
+	t.pause()
+}
+
+// pause is called directly when the torrent is paused because of an error.
+// Pause status is not saved to resume db in that case, so the torrent is not paused after restart.
+func (t *torrent) pause() {
+	t.log.Info("pausing torrent")
+	t.paused = true
+	t.unchoker.ChokeAll(t.getPeersForUnchoker())
+	for pe := range t.pieceDownloaders {
+		// Pending requests may not be completed while paused. Peer must not be marked as snubbed.
+		pe.StopSnubTimer()
+	}
+}
+
+func (t *torrent) handleResume() {
+	if !t.paused {
+		return
+	}
+	t.log.Info("resuming torrent")
+	t.paused = false
+	t.writePaused(false)
+	if t.failedWrite != nil {
+		t.retryFailedWrite()
+	}
+	for pe, pd := range t.pieceDownloaders {
+		if t.canRequestBlocks(pe, pd.AllowedFast) {
+			pd.RequestBlocks(t.maxAllowedRequests(pe))
+			pe.ResetSnubTimer()
+		}
+	}
+	t.startPieceDownloaders()
+	t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+}
+
+func (t *torrent) writePaused(value bool) {
+	err := t.session.resumer.WritePaused(t.id, value)
+	if err != nil {
+		t.log.Errorf("cannot write pause status to resume db: %s", err)
+	}
+}
+
+// canRequestBlocks returns true if new block requests can be sent to the peer.
+func (t *torrent) canRequestBlocks(pe *peer.Peer, allowedFast bool) bool {
+	return !t.paused && (allowedFast || !pe.PeerChoking)
+}
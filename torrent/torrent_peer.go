@@ -2,15 +2,19 @@ package torrent
 
 import (
 	"context"
+	"errors"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/peersource"
+	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/resolver"
 )
 
@@ -23,6 +27,17 @@ func (t *torrent) setNeedMorePeers(val bool) {
 	}
 }
 
+// updateNumWant lowers the number of peers requested from trackers when there are enough peers to dial.
+func (t *torrent) updateNumWant() {
+	n := t.session.config.TrackerNumWant
+	if !t.completed {
+		n = t.session.config.MaxPeerDial - len(t.outgoingPeers) - len(t.outgoingHandshakers) - t.addrList.Len()
+	}
+	for _, an := range t.announcers {
+		an.SetNumWant(n)
+	}
+}
+
 func (t *torrent) addPeerString(addr string) error {
 	hoststr, portstr, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -67,7 +82,7 @@ func (t *torrent) resolveAndAddPeer(host string, port int) {
 func (t *torrent) handleNewPeers(addrs []*net.TCPAddr, source peersource.Source) {
 	t.log.Debugf("received %d peers from %s", len(addrs), source)
 	t.setNeedMorePeers(false)
-	if status := t.status(); status == Stopped || status == Stopping {
+	if status := t.status(); status == Stopped || status == Stopping || status == Moving {
 		return
 	}
 	if !t.completed {
@@ -88,6 +103,7 @@ func (t *torrent) filterBannedIPs(a []*net.TCPAddr) []*net.TCPAddr {
 }
 
 func (t *torrent) dialAddresses() {
+	defer t.updateNumWant()
 	if t.completed {
 		return
 	}
@@ -95,31 +111,193 @@ func (t *torrent) dialAddresses() {
 		return len(t.outgoingPeers) + len(t.outgoingHandshakers)
 	}
 	for peersConnected() < t.session.config.MaxPeerDial {
+		// Slot is acquired before popping the address so it is not lost when the session limit is reached.
+		// Torrent is notified via connSlotC when a slot is freed.
+		if !t.session.connLimiter.Acquire(t.connSlotC) {
+			t.log.Debugln("session peer limit reached")
+			return
+		}
+		if !t.session.halfOpen.Acquire(t.connSlotC) {
+			t.log.Debugln("session half-open connection limit reached")
+			t.session.connLimiter.Release()
+			return
+		}
+		release := func() {
+			t.session.halfOpen.Release()
+			t.session.connLimiter.Release()
+		}
 		addr, src := t.addrList.Pop()
 		if addr == nil {
+			release()
 			t.setNeedMorePeers(true)
 			return
 		}
 		ip := addr.IP.String()
 		if _, ok := t.connectedPeerIPs[ip]; ok {
+			release()
+			continue
+		}
+		if t.peerBans.Banned(ip) {
+			release()
 			continue
 		}
-		h := outgoinghandshaker.New(addr, src)
-		t.outgoingHandshakers[h] = struct{}{}
-		t.connectedPeerIPs[ip] = struct{}{}
-		go h.Run(
-			t.session.config.PeerConnectTimeout,
-			t.session.config.PeerHandshakeTimeout,
-			t.peerID,
-			t.infoHash,
-			t.outgoingHandshakerResultC,
-			t.session.extensions,
-			t.session.config.DisableOutgoingEncryption,
-			t.session.config.ForceOutgoingEncryption,
-		)
+		t.dial(addr, src)
+	}
+}
+
+// dial starts an outgoing handshaker for addr. Caller must acquire a slot from both connLimiter and halfOpen before.
+func (t *torrent) dial(addr *net.TCPAddr, src peersource.Source) {
+	h := outgoinghandshaker.New(addr, src)
+	t.outgoingHandshakers[h] = struct{}{}
+	t.connectedPeerIPs[addr.IP.String()] = struct{}{}
+	disableEncryption, forceEncryption := t.session.config.outgoingEncryption()
+	go h.Run(
+		t.peerDialer(),
+		t.session.config.PeerHandshakeTimeout,
+		t.peerID,
+		t.infoHash,
+		t.outgoingHandshakerResultC,
+		t.session.extensions,
+		disableEncryption,
+		forceEncryption,
+	)
+}
+
+// peerDialer returns the dialer for outgoing peer connections.
+// If the torrent is listening on uTP, peers that cannot be connected over TCP are connected over uTP from the listening socket.
+// uTP is not used if a proxy is set because UDP traffic cannot be sent through the proxy.
+func (t *torrent) peerDialer() btconn.Dialer {
+	socket := t.utpSocket
+	if t.sharedListening {
+		socket = t.session.utpSocket
+	}
+	if socket == nil || t.session.config.ProxyURL != "" {
+		return t.session.peerDialer
+	}
+	return btconn.FallbackDialer{
+		Primary:  t.session.peerDialer,
+		Fallback: timeoutDialer{ContextDialer: socket, timeout: t.session.config.PeerConnectTimeout},
+	}
+}
+
+// scheduleAddrRetry sets the retry timer to the time of the earliest retry in address list.
+// Retries that are already due are not scheduled, they are dialed when a connection slot is freed.
+func (t *torrent) scheduleAddrRetry() {
+	next, ok := t.addrList.NextRetry()
+	if !ok {
+		return
+	}
+	delay := time.Until(next)
+	if delay <= 0 {
+		return
+	}
+	if !t.addrRetryTimer.Stop() {
+		select {
+		case <-t.addrRetryTimer.C:
+		default:
+		}
+	}
+	t.addrRetryTimer.Reset(delay)
+}
+
+func (t *torrent) handleAddrRetry() {
+	if status := t.status(); status == Stopped || status == Stopping || status == Moving {
+		return
+	}
+	t.dialAddresses()
+	t.scheduleAddrRetry()
+}
+
+type connectPeerRequest struct {
+	Addr     *net.TCPAddr
+	Response chan error
+}
+
+var (
+	errNotRunning          = errors.New("torrent is not running")
+	errPeerBanned          = errors.New("peer is banned")
+	errPeerBlocked         = errors.New("peer is blocked")
+	errPeerIPConnected     = errors.New("another peer with same IP is already connected")
+	errPeerIDConnected     = errors.New("another peer with same ID is already connected")
+	errPeerLimitReached    = errors.New("peer limit reached")
+	errHalfOpenLimit       = errors.New("half-open connection limit reached")
+	errHandshakerCancelled = errors.New("handshake is cancelled")
+)
+
+// ConnectPeer connects to the peer at addr and blocks until the handshake is completed or failed.
+// If the peer at addr is already connected, returns nil without making a new connection.
+// If there is a connection attempt in progress to addr, waits for its result instead of dialing again.
+func (t *torrent) ConnectPeer(addr *net.TCPAddr) error {
+	req := connectPeerRequest{Addr: addr, Response: make(chan error, 1)}
+	select {
+	case t.connectPeerCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
 	}
 }
 
+func (t *torrent) handleConnectPeer(req connectPeerRequest) {
+	if status := t.status(); status == Stopped || status == Stopping || status == Moving {
+		req.Response <- errNotRunning
+		return
+	}
+	key := req.Addr.String()
+	for pe := range t.peers {
+		if pe.String() == key {
+			req.Response <- nil
+			return
+		}
+	}
+	if _, ok := t.connectPeerWaiters[key]; !ok {
+		for oh := range t.outgoingHandshakers {
+			if oh.Addr.String() == key {
+				// Handshaker is started by dialAddresses.
+				t.connectPeerWaiters[key] = nil
+				break
+			}
+		}
+	}
+	if _, ok := t.connectPeerWaiters[key]; ok {
+		t.connectPeerWaiters[key] = append(t.connectPeerWaiters[key], req.Response)
+		return
+	}
+	ip := req.Addr.IP.String()
+	if _, ok := t.connectedPeerIPs[ip]; ok {
+		req.Response <- errPeerIPConnected
+		return
+	}
+	if _, ok := t.bannedPeerIPs[ip]; ok || t.peerBans.Banned(ip) {
+		req.Response <- errPeerBanned
+		return
+	}
+	if !t.session.connLimiter.Acquire(t.connSlotC) {
+		req.Response <- errPeerLimitReached
+		return
+	}
+	if !t.session.halfOpen.Acquire(t.connSlotC) {
+		t.session.connLimiter.Release()
+		req.Response <- errHalfOpenLimit
+		return
+	}
+	t.connectPeerWaiters[key] = []chan error{req.Response}
+	t.dial(req.Addr, peersource.Manual)
+}
+
+// notifyConnectPeerWaiters sends the handshake result to the callers of ConnectPeer waiting for addr.
+func (t *torrent) notifyConnectPeerWaiters(addr *net.TCPAddr, err error) {
+	key := addr.String()
+	for _, ch := range t.connectPeerWaiters[key] {
+		ch <- err
+	}
+	delete(t.connectPeerWaiters, key)
+}
+
 func (t *torrent) startPeer(
 	conn net.Conn,
 	source peersource.Source,
@@ -127,20 +305,30 @@ func (t *torrent) startPeer(
 	peerID [20]byte,
 	extensions [8]byte,
 	cipher mse.CryptoMethod,
-) {
-	addr := conn.RemoteAddr().(*net.TCPAddr)
+) error {
+	addr := conn.RemoteAddr()
 	t.pexAddPeer(addr)
 	_, ok := t.peerIDs[peerID]
 	if ok {
 		t.log.Debugf("peer with same id already connected. addr: %s id: %s", addr, peerID)
 		conn.Close()
 		t.pexDropPeer(addr)
+		t.session.connLimiter.Release()
 		t.dialAddresses()
-		return
+		return errPeerIDConnected
 	}
 	t.peerIDs[peerID] = struct{}{}
 
-	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.session.bucketDownload, t.session.bucketUpload)
+	pe := peer.New(conn, source, peerID, extensions, cipher, t.session.config.PieceReadTimeout, t.session.config.PeerWriteTimeout, t.session.config.RequestTimeout, t.session.config.MaxRequestsIn, t.session.config.PeerMaxUnknownMessages, t.session.bucketDownload, t.session.bucketUpload, nil, t.logHandler)
+	err := pe.SetNoDelay(t.session.config.PeerNoDelay)
+	if err != nil {
+		t.log.Debugln("cannot set no delay option on peer connection:", err)
+	}
+	if t.session.config.PeerMessageQueueDropHave {
+		pe.SetMessageQueue(t.session.config.PeerMessageQueueSize, peer.QueueDropHave)
+	} else {
+		pe.SetMessageQueue(t.session.config.PeerMessageQueueSize, peer.QueueBlock)
+	}
 	t.peers[pe] = struct{}{}
 	peers[pe] = struct{}{}
 	if t.info != nil {
@@ -148,44 +336,50 @@ func (t *torrent) startPeer(
 	}
 	go pe.Run(t.messages, t.pieceMessagesC.SendC(), t.peerSnubbedC, t.peerDisconnectedC)
 	t.session.metrics.Peers.Inc(1)
-	t.sendFirstMessage(pe)
-	t.recentlySeen.Add(pe.Addr())
+	err = t.sendFirstMessage(pe)
+	if err != nil {
+		pe.Logger().Errorln("cannot send first message:", err)
+		t.closePeer(pe)
+		return err
+	}
+	if addr, ok := pe.RemoteTCPAddr(); ok {
+		t.recentlySeen.Add(addr)
+	}
+	return nil
 }
 
-func (t *torrent) sendFirstMessage(p *peer.Peer) {
-	bf := t.bitfield
-	switch {
-	case p.FastEnabled && bf != nil && bf.All():
-		msg := peerprotocol.HaveAllMessage{}
-		p.SendMessage(msg)
-	case p.FastEnabled && (bf == nil || bf.Count() == 0):
-		msg := peerprotocol.HaveNoneMessage{}
-		p.SendMessage(msg)
-	case bf != nil:
-		bitfieldData := make([]byte, len(bf.Bytes()))
-		copy(bitfieldData, bf.Bytes())
-		msg := peerprotocol.BitfieldMessage{Data: bitfieldData}
-		p.SendMessage(&msg)
+func (t *torrent) sendFirstMessage(p *peer.Peer) error {
+	err := p.SendBitfield(t.bitfield)
+	if err != nil {
+		return err
 	}
 	var metadataSize uint32
 	if t.info != nil {
 		metadataSize = uint32(len(t.info.Bytes))
 	}
 	if p.ExtensionsEnabled {
-		extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.session.config.MaxRequestsIn)
+		var yourIP net.IP
+		if addr, ok := p.RemoteTCPAddr(); ok {
+			yourIP = addr.IP
+		}
+		extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), yourIP, t.session.config.MaxRequestsIn)
+		if t.info != nil && t.info.Private {
+			// Peer exchange is not allowed for private torrents (BEP 27).
+			delete(extHandshakeMsg.M, peerprotocol.ExtensionKeyPEX)
+		}
 		msg := peerprotocol.ExtensionMessage{
 			ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
 			Payload:           extHandshakeMsg,
 		}
 		p.SendMessage(msg)
 	}
-	if p.DHTEnabled {
-		msg := peerprotocol.PortMessage{Port: t.session.config.DHTPort}
-		p.SendMessage(msg)
+	if t.session.dht != nil && (t.info == nil || !t.info.Private) {
+		p.SendPort(t.session.config.DHTPort)
 	}
 	if p.FastEnabled && t.pieces != nil {
 		p.GenerateAndSendAllowedFastMessages(t.session.config.AllowedFastSet, t.info.NumPieces, t.infoHash, t.pieces)
 	}
+	return nil
 }
 
 func (t *torrent) getClientVersion() string {
@@ -199,29 +393,65 @@ func (t *torrent) getClientVersion() string {
 func (t *torrent) processQueuedMessages() {
 	for pe := range t.peers {
 		for _, msg := range pe.Messages {
-			pm := peer.Message{Peer: pe, Message: msg}
+			pm := peer.ReceivedMessage{Peer: pe, Message: msg}
 			t.handlePeerMessage(pm)
 		}
 		pe.Messages = nil
 	}
 }
 
+// cancelTimedOutRequests cancels the block requests that are pending longer than Config.BlockRequestTimeout.
+// Peers that have timed out requests are marked as snubbed, so their pieces are picked by other peers.
+// Canceled blocks are not requested from the same peer again unless it starts sending blocks.
+func (t *torrent) cancelTimedOutRequests(now time.Time) {
+	if t.session.config.BlockRequestTimeout <= 0 {
+		return
+	}
+	for pe, pd := range t.pieceDownloaders {
+		if !t.canRequestBlocks(pe, pd.AllowedFast) {
+			continue
+		}
+		n := pd.CancelTimedOut(now, t.session.config.BlockRequestTimeout)
+		if n > 0 {
+			pe.Logger().Debugf("canceled %d timed out requests for piece #%d", n, pd.Piece.Index)
+			t.handlePeerSnubbed(pe)
+		}
+	}
+}
+
 func (t *torrent) handlePeerSnubbed(pe *peer.Peer) {
 	// Mark slow peer as snubbed to skip that peer in piece picker
 	if pd, ok := t.pieceDownloaders[pe]; ok {
-		// Snub timer is already stopped on choke message but may fire anyway.
-		if pe.PeerChoking {
+		// Snub timer is already stopped on choke message and pause but may fire anyway.
+		if pe.PeerChoking || t.paused {
 			return
 		}
-		pe.Snubbed = true
+		pe.SetSnubbed(true)
 		t.pieceDownloadersSnubbed[pe] = pd
 		if t.piecePicker != nil {
 			t.piecePicker.HandleSnubbed(pe, pd.Piece.Index)
 		}
 		t.startPieceDownloaders()
 	} else if id, ok := t.infoDownloaders[pe]; ok {
-		pe.Snubbed = true
+		pe.SetSnubbed(true)
 		t.infoDownloadersSnubbed[pe] = id
 		t.startInfoDownloaders()
 	}
 }
+
+// banPeer closes the connection to the peer that has violated the protocol and bans its IP temporarily.
+func (t *torrent) banPeer(pe *peer.Peer) {
+	d := t.peerBans.Ban(pe.IP())
+	pe.Logger().Debugln("banning peer for", d)
+	t.closePeer(pe)
+}
+
+// handlePeerUnsnubbed is called when a snubbed peer sends a block of the piece that is being downloaded.
+func (t *torrent) handlePeerUnsnubbed(pe *peer.Peer, pd *piecedownloader.PieceDownloader) {
+	pe.SetSnubbed(false)
+	delete(t.pieceDownloadersSnubbed, pe)
+	pd.Unsnubbed()
+	if t.piecePicker != nil {
+		t.piecePicker.HandleUnsnubbed(pe, pd.Piece.Index)
+	}
+}
@@ -0,0 +1,902 @@
+package torrent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/btconn"
+	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peerconn"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/tracker"
+	"github.com/cenkalti/rain/internal/utp"
+)
+
+// stallingPeer accepts a BitTorrent connection, announces that it has all pieces and never sends the requested blocks.
+type stallingPeer struct {
+	l        net.Listener
+	requestC chan peerprotocol.RequestMessage
+	cancelC  chan peerprotocol.CancelMessage
+}
+
+func newStallingPeer(t *testing.T, infoHash [20]byte, numPieces uint32) *stallingPeer {
+	// Torrent connects to one peer per IP. Use a different address than the seeder.
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &stallingPeer{
+		l:        l,
+		requestC: make(chan peerprotocol.RequestMessage, 1000),
+		cancelC:  make(chan peerprotocol.CancelMessage, 1000),
+	}
+	t.Cleanup(func() { l.Close() })
+	go p.run(infoHash, numPieces)
+	return p
+}
+
+func (p *stallingPeer) Addr() string {
+	return p.l.Addr().String()
+}
+
+func (p *stallingPeer) run(infoHash [20]byte, numPieces uint32) {
+	conn, err := p.l.Accept()
+	if err != nil {
+		return
+	}
+	var ext [8]byte
+	var id [20]byte
+	copy(id[:], "-XX0000-stallingpeer")
+	conn, _, _, _, _, err = btconn.Accept(conn, timeout, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext, func([20]byte) [20]byte { return id })
+	if err != nil {
+		conn.Close()
+		return
+	}
+	pc := peerconn.New(conn, logger.New("stalling peer"), time.Minute, 0, 1000, 0, nil, nil)
+	go pc.Run()
+	defer pc.Close()
+	bf := bitfield.New(numPieces)
+	bf.SetRange(0, numPieces)
+	pc.SendMessage(&peerprotocol.BitfieldMessage{Data: bf.Bytes()})
+	pc.SendMessage(peerprotocol.UnchokeMessage{})
+	for msg := range pc.Messages() {
+		switch msg := msg.(type) {
+		case peerprotocol.RequestMessage:
+			p.requestC <- msg
+		case peerprotocol.CancelMessage:
+			p.cancelC <- msg
+		}
+	}
+}
+
+func TestBlockRequestTimeout(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.BlockRequestTimeout = time.Second
+		cfg.RequestTimeout = time.Hour
+		cfg.DisableOutgoingEncryption = true
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := newStallingPeer(t, tor.torrent.infoHash, tor.torrent.info.NumPieces)
+	tor.AddPeer(sp.Addr())
+
+	var req peerprotocol.RequestMessage
+	select {
+	case req = <-sp.requestC:
+	case <-time.After(timeout):
+		t.Fatal("block is not requested")
+	}
+	select {
+	case msg := <-sp.cancelC:
+		if msg.Index != req.Index {
+			t.Fatalf("unexpected cancel: %s", msg)
+		}
+	case <-time.After(timeout):
+		t.Fatal("timed out request is not canceled")
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Downloads.Snubbed == 1 })
+
+	// Stalled piece must be downloaded from the other peer.
+	addr, closeSeeder := seeder(t, true)
+	defer closeSeeder()
+	tor.AddPeer(addr)
+	assertCompleted(t, tor)
+}
+
+func TestSnubbedPeer(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.RequestTimeout = time.Second
+		cfg.BlockRequestTimeout = 0
+		cfg.DisableOutgoingEncryption = true
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := newStallingPeer(t, tor.torrent.infoHash, tor.torrent.info.NumPieces)
+	tor.AddPeer(sp.Addr())
+
+	select {
+	case <-sp.requestC:
+	case <-time.After(timeout):
+		t.Fatal("block is not requested")
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Downloads.Snubbed == 1 })
+	if peers := tor.Peers(); len(peers) != 1 || !peers[0].Snubbed {
+		t.Fatalf("peer is not snubbed: %+v", peers)
+	}
+}
+
+func TestConnectPeer(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.DisableOutgoingEncryption = true
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var accepted int32
+	go func() {
+		var ext [8]byte
+		var id [20]byte
+		copy(id[:], "-XX0000-connectpeer.")
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			// Delay handshake so all calls below are made while the connection attempt is in progress.
+			time.Sleep(100 * time.Millisecond)
+			conn, _, _, _, _, err = btconn.Accept(conn, timeout, nil, false, func(ih [20]byte) bool { return ih == tor.torrent.infoHash }, ext, func([20]byte) [20]byte { return id })
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	errC := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errC <- tor.ConnectPeer(addr) }()
+	}
+	for i := 0; i < 2; i++ {
+		if err = <-errC; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tor.ConnectPeer(addr); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Fatalf("unexpected number of connections: %d", n)
+	}
+	if st := tor.Stats(); st.Peers.Outgoing != 1 {
+		t.Fatalf("unexpected number of outgoing peers: %d", st.Peers.Outgoing)
+	}
+
+	l.Close()
+	if err = tor.ConnectPeer(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 3), Port: addr.Port}); err == nil {
+		t.Fatal("connection to closed port is succeeded")
+	}
+}
+
+// listenPeer accepts BitTorrent connections on ip with the peer id and keeps them open until the test ends.
+func listenPeer(t *testing.T, ip string, infoHash [20]byte, peerID string) *net.TCPAddr {
+	l, err := net.Listen("tcp", ip+":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ext [8]byte
+	var id [20]byte
+	copy(id[:], peerID)
+	doneC := make(chan struct{})
+	t.Cleanup(func() {
+		l.Close()
+		<-doneC
+	})
+	go func() {
+		defer close(doneC)
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn, _, _, _, _, err = btconn.Accept(conn, timeout, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext, func([20]byte) [20]byte { return id })
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr)
+}
+
+func TestConnectPeerDuplicateID(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.DisableOutgoingEncryption = true
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "-XX0000-duplicateid."
+	if err = tor.ConnectPeer(listenPeer(t, "127.0.0.2", tor.torrent.infoHash, id)); err != nil {
+		t.Fatal(err)
+	}
+	// Handshake succeeds but the peer is rejected because another peer with the same id is connected.
+	if err = tor.ConnectPeer(listenPeer(t, "127.0.0.3", tor.torrent.infoHash, id)); err != errPeerIDConnected {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st := tor.Stats(); st.Peers.Outgoing != 1 {
+		t.Fatalf("unexpected number of outgoing peers: %d", st.Peers.Outgoing)
+	}
+}
+
+func TestBanPeerOnProtocolError(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	dial := func() (net.Conn, error) {
+		var ext [8]byte
+		var id [20]byte
+		copy(id[:], "-XX0000-misbehaving.")
+		conn, _, _, _, err := btconn.Dial(addr, &net.Dialer{Timeout: timeout}, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+		return conn, err
+	}
+
+	conn, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 1 })
+
+	// Request a block larger than allowed.
+	msg := make([]byte, 17)
+	binary.BigEndian.PutUint32(msg[0:4], 13)
+	msg[4] = byte(peerprotocol.Request)
+	binary.BigEndian.PutUint32(msg[13:17], 1<<20)
+	if _, err = conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err = io.Copy(io.Discard, conn); err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 0 })
+
+	conn2, err := dial()
+	if err == nil {
+		conn2.Close()
+		t.Fatal("banned peer is connected again")
+	}
+}
+
+func TestBanPeerOnUnsolicitedBlocks(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.PeerMaxUnsolicitedBlocks = 3
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	var ext [8]byte
+	var id [20]byte
+	copy(id[:], "-XX0000-unsolicited.")
+	conn, _, _, _, err := btconn.Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, &net.Dialer{Timeout: timeout}, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 1 })
+
+	// Send blocks that are never requested. Each block has 1 byte of data.
+	sendBlock := func(begin uint32) {
+		msg := make([]byte, 14)
+		binary.BigEndian.PutUint32(msg[0:4], 10)
+		msg[4] = byte(peerprotocol.Piece)
+		binary.BigEndian.PutUint32(msg[9:13], begin)
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint32(0); i < 3; i++ {
+		sendBlock(i)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Bytes.Wasted == 3 })
+	if st := tor.Stats(); st.Peers.Incoming != 1 {
+		t.Fatal("peer is disconnected before limit")
+	}
+
+	sendBlock(3)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err = io.Copy(io.Discard, conn); err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 0 && st.Bytes.Wasted == 4 })
+}
+
+// pexPeer accepts a BitTorrent connection and sends the PEX message after the extension handshake is completed.
+type pexPeer struct {
+	l          net.Listener
+	added      []*net.TCPAddr
+	handshakeC chan peerprotocol.ExtensionHandshakeMessage
+}
+
+func newPEXPeer(t *testing.T, infoHash [20]byte, added ...*net.TCPAddr) *pexPeer {
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &pexPeer{
+		l:          l,
+		added:      added,
+		handshakeC: make(chan peerprotocol.ExtensionHandshakeMessage, 1),
+	}
+	t.Cleanup(func() { l.Close() })
+	go p.run(infoHash)
+	return p
+}
+
+func (p *pexPeer) Addr() string {
+	return p.l.Addr().String()
+}
+
+func (p *pexPeer) run(infoHash [20]byte) {
+	conn, err := p.l.Accept()
+	if err != nil {
+		return
+	}
+	var ext [8]byte
+	ext[5] |= 0x10 // BEP 10 Extension Protocol
+	var id [20]byte
+	copy(id[:], "-XX0000-pexpeer00000")
+	conn, _, _, _, _, err = btconn.Accept(conn, timeout, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext, func([20]byte) [20]byte { return id })
+	if err != nil {
+		conn.Close()
+		return
+	}
+	pc := peerconn.New(conn, logger.New("pex peer"), time.Minute, 0, 1000, 0, nil, nil)
+	go pc.Run()
+	defer pc.Close()
+	pc.SendMessage(peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+		Payload:           peerprotocol.NewExtensionHandshake(0, "pex peer", nil, 250),
+	})
+	var added []byte
+	for _, addr := range p.added {
+		b, _ := tracker.NewCompactPeer(addr).MarshalBinary()
+		added = append(added, b...)
+	}
+	for msg := range pc.Messages() {
+		if msg, ok := msg.(peerprotocol.ExtensionHandshakeMessage); ok {
+			p.handshakeC <- msg
+			// Sent regardless of the extensions supported by the torrent.
+			pc.SendMessage(peerprotocol.ExtensionMessage{
+				ExtendedMessageID: peerprotocol.ExtensionIDPEX,
+				Payload:           peerprotocol.ExtensionPEXMessage{Added: string(added)},
+			})
+		}
+	}
+}
+
+// newTestTorrentBytes returns a torrent file of the test data with private flag.
+func newTestTorrentBytes(t *testing.T, private bool) []byte {
+	info, err := metainfo.NewInfoBytes("", []string{filepath.Join(torrentDataDir, torrentName)}, private, 32<<10, "", logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := metainfo.NewBytes(info, nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPrivateTorrent(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run("private="+strconv.FormatBool(private), func(t *testing.T) {
+			s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+				cfg.PEXEnabled = true
+				cfg.DHTEnabled = true
+				cfg.DHTPort = freePort(t)
+				cfg.DHTBootstrapNodes = nil
+				// Addresses received from PEX stay in the list.
+				cfg.MaxPeerDial = 1
+				cfg.DisableOutgoingEncryption = true
+			})
+			defer closeSession()
+			tor, err := s.AddTorrent(bytes.NewReader(newTestTorrentBytes(t, private)), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pp := newPEXPeer(t, tor.torrent.infoHash, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 3), Port: 5000})
+			tor.AddPeer(pp.Addr())
+
+			var msg peerprotocol.ExtensionHandshakeMessage
+			select {
+			case msg = <-pp.handshakeC:
+			case <-time.After(timeout):
+				t.Fatal("extension handshake is not received")
+			}
+			_, pexAdvertised := msg.M[peerprotocol.ExtensionKeyPEX]
+			if pexAdvertised == private {
+				t.Fatalf("ut_pex is advertised: %v", pexAdvertised)
+			}
+			if private {
+				time.Sleep(500 * time.Millisecond)
+				if st := tor.Stats(); st.Addresses.PEX != 0 {
+					t.Fatalf("addresses are added from pex: %d", st.Addresses.PEX)
+				}
+			} else {
+				waitStats(t, tor, func(st Stats) bool { return st.Addresses.PEX == 1 })
+			}
+			// Run loop is synchronized with the Stats call above.
+			if registered := tor.torrent.dhtAnnouncer != nil; registered == private {
+				t.Fatalf("dht announcer is started: %v", registered)
+			}
+		})
+	}
+}
+
+func TestEncryptionPolicy(t *testing.T) {
+	cases := []struct {
+		policy          EncryptionPolicy
+		plaintextPeerOK bool
+	}{
+		{EncryptionPrefer, true},
+		{EncryptionRequire, false},
+		{EncryptionDisabled, true},
+	}
+	for _, c := range cases {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+				cfg.Encryption = c.policy
+			})
+			defer closeSession()
+			f, err := os.Open(torrentFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			tor, err := s.AddTorrent(f, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var port int
+			select {
+			case port = <-tor.torrent.NotifyListen():
+			case <-time.After(timeout):
+				t.Fatal("torrent is not listening")
+			}
+			var ext [8]byte
+			var id [20]byte
+			copy(id[:], "-XX0000-plaintext...")
+
+			// Plaintext-only peer does not accept encrypted handshakes.
+			l, err := net.Listen("tcp", "127.0.0.2:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go func() {
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					_, _, _, _, _, err = btconn.Accept(conn, timeout, nil, false, func(ih [20]byte) bool { return ih == tor.torrent.infoHash }, ext, func([20]byte) [20]byte { return id })
+					if err != nil {
+						conn.Close()
+						continue
+					}
+					defer conn.Close()
+				}
+			}()
+			err = tor.ConnectPeer(l.Addr().(*net.TCPAddr))
+			if c.plaintextPeerOK && err != nil {
+				t.Fatalf("cannot connect to plaintext peer: %s", err)
+			}
+			if !c.plaintextPeerOK && err == nil {
+				t.Fatal("connected to plaintext peer")
+			}
+
+			addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+			conn, _, _, _, err := btconn.Dial(addr, &net.Dialer{Timeout: timeout}, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+			if err == nil {
+				conn.Close()
+			}
+			if c.plaintextPeerOK && err != nil {
+				t.Fatalf("plaintext peer is not accepted: %s", err)
+			}
+			if !c.plaintextPeerOK && err == nil {
+				t.Fatal("plaintext peer is accepted")
+			}
+
+			if c.policy == EncryptionDisabled {
+				waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 0 })
+				conn, _, _, _, err = btconn.Dial(addr, &net.Dialer{Timeout: timeout}, timeout, true, true, ext, tor.torrent.infoHash, id, nil)
+				if err == nil {
+					conn.Close()
+					t.Fatal("encrypted peer is accepted")
+				}
+			}
+		})
+	}
+}
+
+func TestHalfOpenLimit(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.MaxHalfOpenConns = 2
+		cfg.DisableOutgoingEncryption = true
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Peers accept the connection but do not reply the handshake until it is closed.
+	connC := make(chan net.Conn, 10)
+	for i := 0; i < 6; i++ {
+		l, err := net.Listen("tcp", net.JoinHostPort(net.IPv4(127, 0, 0, byte(2+i)).String(), "0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				connC <- conn
+			}
+		}()
+		if err = tor.AddPeer(l.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	accept := func() net.Conn {
+		select {
+		case conn := <-connC:
+			return conn
+		case <-time.After(timeout):
+			t.Fatal("peer is not dialed")
+			return nil
+		}
+	}
+	conn1 := accept()
+	conn2 := accept()
+	defer conn2.Close()
+	select {
+	case conn := <-connC:
+		conn.Close()
+		t.Fatal("more than 2 connections are in progress")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if n := s.halfOpen.Len(); n != 2 {
+		t.Fatalf("unexpected number of half-open connections: %d", n)
+	}
+
+	// Failed handshake releases the slot for the next address.
+	conn1.Close()
+	accept().Close()
+}
+
+func TestAddConn(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.MaxPeerAccept = 2
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addConn := func(peerID string) {
+		c1, c2 := net.Pipe()
+		t.Cleanup(func() { c2.Close() })
+		if err = tor.AddConn(c1); err != nil {
+			t.Fatal(err)
+		}
+		_ = c2.SetDeadline(time.Now().Add(timeout))
+		// Pipe is not buffered, so peer id is sent after reading the handshake of the torrent.
+		hs := append([]byte{19}, "BitTorrent protocol"...)
+		hs = append(hs, make([]byte, 8)...)
+		hs = append(hs, tor.torrent.infoHash[:]...)
+		if _, err = c2.Write(hs); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, 68)
+		if _, err = io.ReadFull(c2, reply); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(reply[28:48], tor.torrent.infoHash[:]) {
+			t.Fatalf("unexpected info hash in reply: %x", reply[28:48])
+		}
+		if _, err = c2.Write([]byte(peerID)); err != nil {
+			t.Fatal(err)
+		}
+		go func() { _, _ = io.Copy(io.Discard, c2) }()
+	}
+
+	addConn("-XX0000-pipepeer1...")
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 1 })
+	peers := tor.Peers()
+	if len(peers) != 1 || peers[0].Source != SourceIncoming || peers[0].Addr.String() != "pipe" {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+
+	// Connections without an IP address are not rejected as duplicates.
+	addConn("-XX0000-pipepeer2...")
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 2 })
+
+	// Rejection reason is returned.
+	c5, c6 := net.Pipe()
+	defer c6.Close()
+	if err = tor.AddConn(c5); err != errPeerLimitReached {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = tor.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	c3, c4 := net.Pipe()
+	defer c4.Close()
+	if err = tor.AddConn(c3); err != errNotRunning {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUTPIncoming(t *testing.T) {
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.UTPEnabled = true
+	})
+	defer closeSession()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int
+	select {
+	case port = <-tor.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+
+	socket, err := utp.Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	var ext [8]byte
+	var id [20]byte
+	copy(id[:], "-XX0000-utppeer.....")
+	// uTP listener uses the same port number as the TCP listener.
+	conn, _, _, _, err := btconn.Dial(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, socket, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() { _, _ = io.Copy(io.Discard, conn) }()
+
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == 1 })
+	peers := tor.Peers()
+	if len(peers) != 1 || peers[0].Addr.String() != socket.Addr().String() {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+	if _, ok := peers[0].Addr.(*net.UDPAddr); !ok {
+		t.Fatalf("peer address is not udp: %T", peers[0].Addr)
+	}
+}
+
+func TestUTPOutgoing(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	seed := addCompletedTorrent(t, s1, AddTorrentOptions{})
+	seed.Start()
+
+	// Seeder is reachable over uTP only.
+	socket, err := utp.Listen("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	go func() {
+		for {
+			conn, err := socket.Accept()
+			if err != nil {
+				return
+			}
+			_ = seed.AddConn(conn)
+		}
+	}()
+
+	s2, closeSession2 := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.UTPEnabled = true
+	})
+	defer closeSession2()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s2.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	err = tor.AddPeer(socket.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCompleted(t, tor)
+}
+
+func TestUnchokeInterval(t *testing.T) {
+	const numPeers = 10
+	const slots = 6
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.UnchokedPeers = slots
+		cfg.OptimisticUnchokedPeers = 0
+		cfg.UnchokeInterval = 20 * time.Millisecond
+	})
+	defer closeSession()
+	tor := addCompletedTorrent(t, s, AddTorrentOptions{})
+	tor.Start()
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Seeding })
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tor.Port()}
+
+	var ext [8]byte
+	var id [20]byte
+	for i := 0; i < numPeers; i++ {
+		// Peers dial from different IPs to pass the duplicate IP check.
+		copy(id[:], fmt.Sprintf("-XX0000-peer%08d", i))
+		dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, byte(10+i))}}
+		conn, _, _, _, err := btconn.Dial(addr, dialer, timeout, false, false, ext, tor.torrent.infoHash, id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte{0, 0, 0, 1, byte(peerprotocol.Interested)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _, _ = io.Copy(io.Discard, conn) }()
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Incoming == numPeers })
+
+	// All peers have the same speed, so the peers unchoked at each round change in random order.
+	// The default interval would not rotate them in the duration of the test.
+	unchoked := func() map[string]struct{} {
+		m := make(map[string]struct{})
+		for _, pe := range tor.Peers() {
+			if !pe.ClientChoking {
+				m[pe.Addr.String()] = struct{}{}
+			}
+		}
+		return m
+	}
+	var first map[string]struct{}
+	deadline := time.Now().Add(timeout)
+	for {
+		m := unchoked()
+		if first == nil && len(m) == slots {
+			first = m
+		}
+		if len(m) > slots {
+			t.Fatalf("%d peers are unchoked, slots: %d", len(m), slots)
+		}
+		if first != nil && len(m) == slots {
+			for a := range m {
+				if _, ok := first[a]; !ok {
+					return
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unchoked peers did not change")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
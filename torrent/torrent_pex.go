@@ -2,7 +2,12 @@ package torrent
 
 import "net"
 
-func (t *torrent) pexAddPeer(addr *net.TCPAddr) {
+// pexAddPeer adds the address to PEX lists of peers. Addresses of connections that are not made over TCP are ignored.
+func (t *torrent) pexAddPeer(a net.Addr) {
+	addr, ok := a.(*net.TCPAddr)
+	if !ok {
+		return
+	}
 	for pe := range t.peers {
 		if pe.PEX != nil {
 			pe.PEX.Add(addr)
@@ -10,7 +15,11 @@ func (t *torrent) pexAddPeer(addr *net.TCPAddr) {
 	}
 }
 
-func (t *torrent) pexDropPeer(addr *net.TCPAddr) {
+func (t *torrent) pexDropPeer(a net.Addr) {
+	addr, ok := a.(*net.TCPAddr)
+	if !ok {
+		return
+	}
 	for pe := range t.peers {
 		if pe.PEX != nil {
 			pe.PEX.Drop(addr)
@@ -1,10 +1,6 @@
 package torrent
 
-import (
-	"time"
-
-	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
-)
+import "time"
 
 func (t *torrent) writeBitfield() error {
 	err := t.session.resumer.WriteBitfield(t.id, t.bitfield.Bytes())
@@ -14,6 +10,15 @@ func (t *torrent) writeBitfield() error {
 	return err
 }
 
+// setPieceDone marks the piece as downloaded and updates the counters in piece picker.
+func (t *torrent) setPieceDone(i uint32) {
+	if t.piecePicker != nil {
+		t.piecePicker.HandleDone(i)
+		return
+	}
+	t.pieces[i].Done = true
+}
+
 func (t *torrent) checkCompletion() bool {
 	if t.completed {
 		return true
@@ -23,10 +28,7 @@ func (t *torrent) checkCompletion() bool {
 	}
 	t.completed = true
 	close(t.completeC)
-	for h := range t.outgoingHandshakers {
-		h.Close()
-	}
-	t.outgoingHandshakers = make(map[*outgoinghandshaker.OutgoingHandshaker]struct{})
+	t.stopOutgoingHandshakers()
 	for _, src := range t.webseedSources {
 		t.closeWebseedDownloader(src)
 	}
@@ -42,6 +44,18 @@ func (t *torrent) checkCompletion() bool {
 	}
 	t.piecePicker = nil
 	t.updateSeedDuration(time.Now())
+	// If files are going to be moved, the command is run after the move.
+	if !t.dataMoveNeeded() {
+		t.runCompleteCmd()
+	}
+	return true
+}
+
+func (t *torrent) runCompleteCmd() {
+	if t.onComplete != nil {
+		go t.onComplete(&Torrent{torrent: t})
+		t.onComplete = nil
+	}
 	if !t.completeCmdRun && len(t.session.config.OnCompleteCmd) > 0 {
 		go t.session.runOnCompleteCmd(t)
 		t.completeCmdRun = true
@@ -50,5 +64,61 @@ func (t *torrent) checkCompletion() bool {
 			t.stop(err)
 		}
 	}
-	return true
+}
+
+// pieceAvailability returns the number of connected peers that have the piece.
+func (t *torrent) pieceAvailability(i uint32) int {
+	if t.piecePicker != nil {
+		return t.piecePicker.Availability(i)
+	}
+	var n int
+	for pe := range t.peers {
+		if pe.Bitfield != nil && pe.Bitfield.Test(i) {
+			n++
+		}
+	}
+	return n
+}
+
+type availabilityRequest struct {
+	Response chan float64
+}
+
+// Availability returns the number of distributed copies of the torrent among connected peers.
+// Returns zero if torrent has no metadata yet.
+func (t *torrent) Availability() float64 {
+	var n float64
+	req := availabilityRequest{Response: make(chan float64, 1)}
+	select {
+	case t.availabilityCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case n = <-req.Response:
+	case <-t.closeC:
+	}
+	return n
+}
+
+// getAvailability returns the minimum availability of pieces plus the fraction of pieces that are more available than the minimum.
+// For example, 2.25 means every piece is available at 2 peers and a quarter of the pieces is available at more peers.
+func (t *torrent) getAvailability() float64 {
+	if t.info == nil || t.info.NumPieces == 0 {
+		return 0
+	}
+	counts := make([]int, t.info.NumPieces)
+	minCount := -1
+	for i := range counts {
+		counts[i] = t.pieceAvailability(uint32(i))
+		if minCount == -1 || counts[i] < minCount {
+			minCount = counts[i]
+		}
+	}
+	var above int
+	for _, n := range counts {
+		if n > minCount {
+			above++
+		}
+	}
+	return float64(minCount) + float64(above)/float64(len(counts))
 }
@@ -0,0 +1,61 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peer"
+)
+
+func TestPieceAvailability(t *testing.T) {
+	newPeer := func(pieces ...uint32) *peer.Peer {
+		bf := bitfield.New(4)
+		for _, i := range pieces {
+			bf.Set(i)
+		}
+		return &peer.Peer{Bitfield: bf}
+	}
+	tor := &torrent{peers: map[*peer.Peer]struct{}{
+		newPeer(0, 1, 2): {},
+		newPeer(0, 2):    {},
+		newPeer(0):       {},
+	}}
+	for i, expected := range []int{3, 1, 2, 0} {
+		if n := tor.pieceAvailability(uint32(i)); n != expected {
+			t.Errorf("availability of piece #%d is %d, expected %d", i, n, expected)
+		}
+	}
+}
+
+func TestAvailability(t *testing.T) {
+	newPeer := func(pieces ...uint32) *peer.Peer {
+		bf := bitfield.New(4)
+		for _, i := range pieces {
+			bf.Set(i)
+		}
+		return &peer.Peer{Bitfield: bf}
+	}
+	tor := &torrent{
+		info: &metainfo.Info{NumPieces: 4},
+		peers: map[*peer.Peer]struct{}{
+			newPeer(0, 1, 2): {},
+			newPeer(0, 2):    {},
+			newPeer(0):       {},
+		},
+	}
+	// Piece #3 is not available.
+	if a := tor.getAvailability(); a != 0.75 {
+		t.Errorf("unexpected availability: %v", a)
+	}
+	tor.peers[newPeer(0, 1, 2, 3)] = struct{}{}
+	tor.peers[newPeer(1, 3)] = struct{}{}
+	// Availabilities of pieces are 4, 3, 3, 2.
+	if a := tor.getAvailability(); a != 2.75 {
+		t.Errorf("unexpected availability: %v", a)
+	}
+	tor.info = nil
+	if a := tor.getAvailability(); a != 0 {
+		t.Errorf("unexpected availability without metadata: %v", a)
+	}
+}
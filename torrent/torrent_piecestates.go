@@ -0,0 +1,112 @@
+package torrent
+
+// PieceState is the download state of a single piece.
+type PieceState int
+
+// States of a piece returned from Torrent.PieceStates.
+const (
+	PieceMissing PieceState = iota
+	PieceDownloading
+	PieceComplete
+)
+
+func (s PieceState) String() string {
+	switch s {
+	case PieceMissing:
+		return "Missing"
+	case PieceDownloading:
+		return "Downloading"
+	case PieceComplete:
+		return "Complete"
+	default:
+		panic("unknown piece state")
+	}
+}
+
+// Size of the channel returned from NotifyPieceComplete when the number of pieces is not known yet.
+const pieceCompleteBufferSize = 1024
+
+type pieceStatesRequest struct {
+	Response chan []PieceState
+}
+
+type notifyPieceCompleteCommand struct {
+	pieceCC chan chan int
+}
+
+// PieceStates returns the state of each piece in the torrent. Returns nil if torrent has no metadata yet.
+func (t *torrent) PieceStates() []PieceState {
+	var states []PieceState
+	req := pieceStatesRequest{Response: make(chan []PieceState, 1)}
+	select {
+	case t.pieceStatesCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case states = <-req.Response:
+	case <-t.closeC:
+	}
+	return states
+}
+
+func (t *torrent) getPieceStates() []PieceState {
+	if t.info == nil {
+		return nil
+	}
+	states := make([]PieceState, t.info.NumPieces)
+	for i := range t.pieces {
+		if t.pieces[i].Writing {
+			states[i] = PieceDownloading
+		}
+	}
+	for _, pd := range t.pieceDownloaders {
+		states[pd.Piece.Index] = PieceDownloading
+	}
+	if t.bitfield != nil {
+		for i := range states {
+			if t.bitfield.Test(uint32(i)) {
+				states[i] = PieceComplete
+			}
+		}
+	}
+	return states
+}
+
+// NotifyPieceComplete returns a new channel that receives piece indexes. Sends to the channel never block the torrent.
+func (t *torrent) NotifyPieceComplete() <-chan int {
+	cmd := notifyPieceCompleteCommand{pieceCC: make(chan chan int, 1)}
+	select {
+	case t.notifyPieceCompleteCommandC <- cmd:
+		return <-cmd.pieceCC
+	case <-t.closeC:
+		ch := make(chan int)
+		close(ch)
+		return ch
+	}
+}
+
+func (t *torrent) handleNotifyPieceComplete(cmd notifyPieceCompleteCommand) {
+	size := pieceCompleteBufferSize
+	if t.info != nil {
+		size = int(t.info.NumPieces)
+	}
+	ch := make(chan int, size)
+	t.pieceCompleteCs = append(t.pieceCompleteCs, ch)
+	cmd.pieceCC <- ch
+}
+
+func (t *torrent) notifyPieceComplete(index uint32) {
+	for _, ch := range t.pieceCompleteCs {
+		select {
+		case ch <- int(index):
+		default:
+		}
+	}
+}
+
+func (t *torrent) closePieceCompleteChannels() {
+	for _, ch := range t.pieceCompleteCs {
+		close(ch)
+	}
+	t.pieceCompleteCs = nil
+}
@@ -0,0 +1,56 @@
+package torrent
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNotifyPieceComplete(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := tor.PieceStates()
+	if len(states) == 0 {
+		t.Fatal("no piece states")
+	}
+	for i, st := range states {
+		if st != PieceMissing {
+			t.Fatalf("piece #%d is %s before download", i, st)
+		}
+	}
+	pieceC := tor.NotifyPieceComplete()
+	if err = tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+	assertCompleted(t, tor)
+
+	seen := make(map[int]int)
+	for len(pieceC) > 0 {
+		seen[<-pieceC]++
+	}
+	if len(seen) != len(states) {
+		t.Fatalf("received %d pieces, expected %d", len(seen), len(states))
+	}
+	for i := range states {
+		if seen[i] != 1 {
+			t.Fatalf("piece #%d is received %d times", i, seen[i])
+		}
+	}
+	for i, st := range tor.PieceStates() {
+		if st != PieceComplete {
+			t.Fatalf("piece #%d is %s after download", i, st)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package torrent
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/piecepicker"
+)
+
+// Number of pieces to prioritize after the current read position.
+const readerReadaheadPieces = 4
+
+var errReaderClosed = errors.New("reader is closed")
+
+// ErrNotAvailable is returned from Torrent.ReadAt when the pieces containing the data are not downloaded yet.
+var ErrNotAvailable = errors.New("data is not available yet")
+
+// fileReader reads the data of a file in torrent.
+// Reads block until the pieces containing the data are downloaded.
+type fileReader struct {
+	t      *torrent
+	offset int64 // offset of the file in torrent
+	length int64 // length of the file
+	pos    int64 // current position in file
+
+	closeC    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReader returns a new reader for reading the file at index returned from Files().
+// Read calls block until the data is downloaded. Pieces at the read position are downloaded before other pieces.
+func (t *torrent) NewReader(fileIndex int) (io.ReadSeekCloser, error) {
+	files := t.Files()
+	if files == nil {
+		return nil, errors.New("torrent metadata not ready")
+	}
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return nil, errInvalidFileIndex
+	}
+	i := infoFileIndex(t.info, fileIndex)
+	var offset int64
+	for _, f := range t.info.Files[:i] {
+		offset += f.Length
+	}
+	return &fileReader{
+		t:      t,
+		offset: offset,
+		length: files[fileIndex].Length,
+		closeC: make(chan struct{}),
+	}, nil
+}
+
+// Read implements io.Reader interface.
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.pos >= r.length {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.length-r.pos {
+		p = p[:r.length-r.pos]
+	}
+	pieceLength := int64(r.t.info.PieceLength)
+	off := r.offset + r.pos
+	index := uint32(off / pieceLength)
+	begin := off % pieceLength
+	if int64(len(p)) > pieceLength-begin {
+		p = p[:pieceLength-begin]
+	}
+	r.prioritize()
+	data, err := r.waitPiece(index)
+	if err != nil {
+		return 0, err
+	}
+	n, err := data.ReadAt(p, begin)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker interface.
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.length + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = pos
+	if r.pos < r.length {
+		r.prioritize()
+	}
+	return r.pos, nil
+}
+
+// Close the reader. Unblocks the pending Read call.
+func (r *fileReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closeC)
+		r.t.wakeReaders()
+	})
+	return nil
+}
+
+// prioritize the pieces after the current position.
+func (r *fileReader) prioritize() {
+	begin, end := filePieceRange(r.t.info, r.offset+r.pos, r.length-r.pos)
+	if end > begin+readerReadaheadPieces {
+		end = begin + readerReadaheadPieces
+	}
+	select {
+	case r.t.prioritizeCommandC <- piecepicker.Range{Begin: begin, End: end}:
+	case <-r.closeC:
+	case <-r.t.closeC:
+	}
+}
+
+func (r *fileReader) closed() error {
+	select {
+	case <-r.closeC:
+		return errReaderClosed
+	case <-r.t.closeC:
+		return errClosed
+	default:
+		return nil
+	}
+}
+
+// waitPiece blocks until the piece at index is downloaded and returns the data of the piece.
+func (r *fileReader) waitPiece(index uint32) (io.ReaderAt, error) {
+	t := r.t
+	t.mBitfield.RLock()
+	defer t.mBitfield.RUnlock()
+	for t.bitfield == nil || t.pieces == nil || !t.bitfield.Test(index) {
+		if err := r.closed(); err != nil {
+			return nil, err
+		}
+		t.pieceCond.Wait()
+	}
+	return t.pieces[index].Data, nil
+}
+
+// wakeReaders wakes up the readers waiting for pieces so they can check their closed status.
+func (t *torrent) wakeReaders() {
+	// Acquiring the lock makes sure that waiting readers are not between the status check and Wait call.
+	t.mBitfield.Lock()
+	t.mBitfield.Unlock() // nolint: staticcheck
+	t.pieceCond.Broadcast()
+}
+
+func (t *torrent) handlePrioritize(r piecepicker.Range) {
+	if t.piecePicker == nil {
+		return
+	}
+	t.piecePicker.SetPriority(r)
+	t.startPieceDownloaders()
+}
+
+// ReadAt reads the torrent data at offset off, as if the files were concatenated in the order they appear in metainfo.
+// Reads may span multiple pieces and files. It does not wait for the data to be downloaded.
+// ErrNotAvailable is returned when a piece containing the data is not downloaded yet,
+// along with the number of bytes read from the pieces before it.
+func (t *torrent) ReadAt(p []byte, off int64) (int, error) {
+	var length int64
+	var pieceLength int64
+	t.mBitfield.RLock()
+	if t.info != nil {
+		length = t.info.Length
+		pieceLength = int64(t.info.PieceLength)
+	}
+	t.mBitfield.RUnlock()
+	if pieceLength == 0 {
+		return 0, errors.New("torrent metadata not ready")
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	var n int
+	for n < len(p) {
+		if off >= length {
+			return n, io.EOF
+		}
+		index := uint32(off / pieceLength)
+		begin := off % pieceLength
+		b := p[n:]
+		if int64(len(b)) > pieceLength-begin {
+			b = b[:pieceLength-begin]
+		}
+		if int64(len(b)) > length-off {
+			b = b[:length-off]
+		}
+		t.mBitfield.RLock()
+		if t.bitfield == nil || t.pieces == nil || !t.bitfield.Test(index) {
+			t.mBitfield.RUnlock()
+			return n, ErrNotAvailable
+		}
+		data := t.pieces[index].Data
+		t.mBitfield.RUnlock()
+		m, err := data.ReadAt(b, begin)
+		n += m
+		off += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
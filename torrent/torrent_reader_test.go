@@ -0,0 +1,127 @@
+package torrent
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := tor.Files()
+	if len(files) == 0 {
+		t.Fatal("no files")
+	}
+
+	type result struct {
+		index int
+		data  []byte
+		err   error
+	}
+	resultC := make(chan result, len(files))
+	for i := range files {
+		r, err := tor.NewReader(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		go func(i int, r io.Reader) {
+			b, err := io.ReadAll(r)
+			resultC <- result{index: i, data: b, err: err}
+		}(i, r)
+	}
+
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range files {
+		select {
+		case res := <-resultC:
+			if res.err != nil {
+				t.Fatal(res.err)
+			}
+			expected, err := os.ReadFile(filepath.Join(torrentDataDir, files[res.index].Path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, res.data) {
+				t.Fatalf("invalid data read from file: %s", files[res.index].Path)
+			}
+		case <-time.After(timeout):
+			t.Fatal("read did not finish")
+		}
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tor := addCompletedTorrent(t, s, AddTorrentOptions{})
+
+	var b [200]byte
+	if _, err := tor.ReadAt(b[:], 0); err != ErrNotAvailable {
+		t.Fatalf("unexpected error before verification: %v", err)
+	}
+	tor.Start()
+	waitStats(t, tor, func(stats Stats) bool { return stats.Status == Seeding })
+
+	// Expected data is the concatenation of files in metainfo order.
+	var all []byte
+	var boundary int64
+	for i, f := range tor.torrent.info.Files {
+		data, err := os.ReadFile(filepath.Join(torrentDataDir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, data...)
+		if i == 0 {
+			boundary = int64(len(all))
+		}
+	}
+	if int64(len(all)) != tor.torrent.info.Length {
+		t.Fatalf("invalid test data length: %d", len(all))
+	}
+
+	off := boundary - 100
+	n, err := tor.ReadAt(b[:], off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) || !bytes.Equal(b[:], all[off:off+int64(len(b))]) {
+		t.Fatalf("invalid data read across file boundary at %d", off)
+	}
+
+	buf := make([]byte, len(all))
+	n, err = tor.ReadAt(buf, 0)
+	if err != nil || n != len(all) || !bytes.Equal(buf, all) {
+		t.Fatalf("cannot read whole torrent: n=%d err=%v", n, err)
+	}
+
+	n, err = tor.ReadAt(b[:], int64(len(all))-10)
+	if err != io.EOF || n != 10 || !bytes.Equal(b[:n], all[len(all)-10:]) {
+		t.Fatalf("unexpected read at end: n=%d err=%v", n, err)
+	}
+}
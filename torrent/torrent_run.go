@@ -11,9 +11,16 @@ func (t *torrent) run() {
 	t.seedDurationTicker = time.NewTicker(time.Second)
 	defer t.seedDurationTicker.Stop()
 
-	t.unchokeTicker = time.NewTicker(10 * time.Second)
+	t.unchokeTicker = time.NewTicker(t.session.config.UnchokeInterval)
 	defer t.unchokeTicker.Stop()
 
+	t.requestTimeoutTicker = time.NewTicker(time.Second)
+	defer t.requestTimeoutTicker.Stop()
+
+	t.addrRetryTimer = time.NewTimer(time.Hour)
+	t.addrRetryTimer.Stop()
+	defer t.addrRetryTimer.Stop()
+
 	for {
 		select {
 		case <-t.closeC:
@@ -24,6 +31,8 @@ func (t *torrent) run() {
 			t.start()
 		case <-t.stopCommandC:
 			t.stop(nil)
+		case doneC := <-t.stopWaitCommandC:
+			t.handleStopWait(doneC)
 		case <-t.announceCommandC:
 			t.setNeedMorePeers(true)
 		case <-t.verifyCommandC:
@@ -42,6 +51,27 @@ func (t *torrent) run() {
 			req.Response <- t.getPeers()
 		case req := <-t.webseedsCommandC:
 			req.Response <- t.getWebseeds()
+		case req := <-t.filesCommandC:
+			req.Response <- t.getFiles()
+		case req := <-t.pieceStatesCommandC:
+			req.Response <- t.getPieceStates()
+		case req := <-t.availabilityCommandC:
+			req.Response <- t.getAvailability()
+		case cmd := <-t.notifyPieceCompleteCommandC:
+			t.handleNotifyPieceComplete(cmd)
+		case req := <-t.setFilePriorityCommandC:
+			req.Response <- t.handleSetFilePriority(req.Index, req.Priority)
+		case n := <-t.setUploadSlotsCommandC:
+			t.unchoker.SetNumUnchoked(n)
+		case n := <-t.setDownloadPeersCommandC:
+			t.maxDownloadPeers = n
+			t.startPieceDownloaders()
+		case <-t.pauseCommandC:
+			t.handlePause()
+		case <-t.resumeCommandC:
+			t.handleResume()
+		case r := <-t.prioritizeCommandC:
+			t.handlePrioritize(r)
 		case p := <-t.allocatorProgressC:
 			t.bytesAllocated = p.AllocatedSize
 		case al := <-t.allocatorResultC:
@@ -50,18 +80,34 @@ func (t *torrent) run() {
 			t.checkedPieces = p.Checked
 		case ve := <-t.verifierResultC:
 			t.handleVerificationDone(ve)
+		case m := <-t.dataMoverResultC:
+			t.handleDataMoveDone(m)
 		case data := <-t.ramNotifyC:
 			t.startSinglePieceDownloader(data)
 		case addrs := <-t.addrsFromTrackers:
 			t.handleNewPeers(addrs, peersource.Tracker)
 		case addrs := <-t.addPeersCommandC:
 			t.handleNewPeers(addrs, peersource.Manual)
+		case req := <-t.connectPeerCommandC:
+			t.handleConnectPeer(req)
+		case req := <-t.addConnCommandC:
+			t.handleAddConn(req)
 		case addrs := <-t.dhtPeersC:
 			t.handleNewPeers(addrs, peersource.DHT)
+		case addrs := <-t.lsdPeersC:
+			t.handleNewPeers(addrs, peersource.LSD)
+		case <-t.connSlotC:
+			t.dialAddresses()
+		case <-t.addrRetryTimer.C:
+			t.handleAddrRetry()
+		case <-t.haveFlushC:
+			t.flushHaves()
 		case trackers := <-t.addTrackersCommandC:
 			t.handleNewTrackers(trackers)
 		case conn := <-t.incomingConnC:
-			t.handleNewConnection(conn)
+			_ = t.handleNewConnection(conn)
+		case h := <-t.sharedConnC:
+			t.handleSharedConnection(h)
 		case res := <-t.webseedPieceResultC.ReceiveC():
 			t.handleWebseedPieceResult(res)
 		case src := <-t.webseedRetryC:
@@ -70,16 +116,25 @@ func (t *torrent) run() {
 			t.handlePieceWriteDone(pw)
 		case now := <-t.seedDurationTicker.C:
 			t.updateSeedDuration(now)
+			t.checkSeedLimits()
 		case pe := <-t.peerSnubbedC:
 			t.handlePeerSnubbed(pe)
 		case <-t.unchokeTicker.C:
-			t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+			if !t.paused {
+				t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+			}
+		case now := <-t.requestTimeoutTicker.C:
+			t.cancelTimedOutRequests(now)
 		case ih := <-t.incomingHandshakerResultC:
 			t.handleIncomingHandshakeDone(ih)
 		case oh := <-t.outgoingHandshakerResultC:
 			t.handleOutgoingHandshakeDone(oh)
 		case pe := <-t.peerDisconnectedC:
-			t.closePeer(pe)
+			if pe.Err() != nil {
+				t.banPeer(pe)
+			} else {
+				t.closePeer(pe)
+			}
 		case pm := <-t.pieceMessagesC.ReceiveC():
 			t.handlePieceMessage(pm)
 		case pm := <-t.messages:
@@ -0,0 +1,38 @@
+package torrent
+
+import "errors"
+
+var errNegativeLimit = errors.New("limit cannot be negative")
+
+// SetMaxUploadSlots sets the number of peers that are unchoked at the same time.
+// Optimistic unchokes are not included. Change is applied at next unchoke round.
+func (t *torrent) SetMaxUploadSlots(n int) error {
+	if n < 0 {
+		return errNegativeLimit
+	}
+	select {
+	case t.setUploadSlotsCommandC <- n:
+		return nil
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+// SetMaxDownloadPeers sets the max number of peers that pieces are downloaded from at the same time.
+// Zero means no limit. Running downloads are not stopped when the limit is lowered.
+func (t *torrent) SetMaxDownloadPeers(n int) error {
+	if n < 0 {
+		return errNegativeLimit
+	}
+	select {
+	case t.setDownloadPeersCommandC <- n:
+		return nil
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+// downloadPeersFull returns true if a new piece download cannot be started because of the download peers limit.
+func (t *torrent) downloadPeersFull() bool {
+	return t.maxDownloadPeers > 0 && len(t.pieceDownloaders) >= t.maxDownloadPeers
+}
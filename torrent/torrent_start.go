@@ -7,8 +7,10 @@ import (
 	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/announcer"
 	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/piece"
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/piecepicker"
+	"github.com/cenkalti/rain/internal/portmapper"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/urldownloader"
 	"github.com/cenkalti/rain/internal/verifier"
@@ -22,6 +24,20 @@ func (t *torrent) start() {
 		return
 	}
 
+	// Files are being moved. Torrent is started after the move is done.
+	if t.dataMover != nil {
+		t.startAfterMove = true
+		return
+	}
+
+	// Files of a torrent completed before are not moved yet, maybe because of an error or a crash during the move.
+	// Move them before opening the files, otherwise missing files would be created again at the old location.
+	if t.bitfield != nil && t.bitfield.All() && t.dataMoveNeeded() {
+		t.startAfterMove = true
+		t.startDataMover()
+		return
+	}
+
 	// Stop announcing Stopped event if in "Stopping" state.
 	if t.stoppedEventAnnouncer != nil {
 		t.stoppedEventAnnouncer.Close()
@@ -64,13 +80,17 @@ func (t *torrent) startVerifier() {
 		panic("zero length pieces")
 	}
 	t.verifier = verifier.New()
-	go t.verifier.Run(t.pieces, t.verifierProgressC, t.verifierResultC)
+	go t.verifier.Run(t.pieces, int(t.session.config.ParallelVerifications), t.verifierProgressC, t.verifierResultC)
 }
 
 func (t *torrent) startAllocator() {
 	if t.allocator != nil {
 		panic("allocator exists")
 	}
+	if err := t.checkDiskSpace(); err != nil {
+		t.stop(err)
+		return
+	}
 	t.allocator = allocator.New()
 	go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
 }
@@ -91,6 +111,12 @@ func (t *torrent) startAnnouncers() {
 		t.dhtAnnouncer = announcer.NewDHTAnnouncer()
 		go t.dhtAnnouncer.Run(t.announceDHT, t.session.config.DHTAnnounceInterval, t.session.config.DHTMinAnnounceInterval, t.log)
 	}
+	if !t.lsdAnnouncing && len(t.session.lsd) > 0 && (t.info == nil || !t.info.Private) {
+		for _, l := range t.session.lsd {
+			l.Add(t.infoHash, t.port)
+		}
+		t.lsdAnnouncing = true
+	}
 }
 
 func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
@@ -108,11 +134,19 @@ func (t *torrent) startNewAnnouncer(tr tracker.Tracker) {
 }
 
 func (t *torrent) startAcceptor() {
+	if t.session.config.ListenPort != 0 {
+		if !t.sharedListening {
+			t.sharedListening = true
+			t.portMapper = t.session.portMapper
+			t.portC <- t.port
+		}
+		return
+	}
 	if t.acceptor != nil {
 		return
 	}
 	ip := net.ParseIP(t.session.config.Host)
-	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: ip, Port: t.port})
+	listener, err := acceptor.Listen(ip, t.port)
 	if err != nil {
 		t.log.Warningf("cannot listen port %d: %s", t.port, err)
 	} else {
@@ -121,6 +155,21 @@ func (t *torrent) startAcceptor() {
 		t.portC <- t.port
 		t.acceptor = acceptor.New(listener, t.incomingConnC, t.log)
 		go t.acceptor.Run()
+		if t.session.config.UTPEnabled {
+			socket, err := acceptor.ListenUTP(ip, t.port)
+			if err != nil {
+				t.log.Warningf("cannot listen utp port %d: %s", t.port, err)
+			} else {
+				t.log.Info("Listening peers on utp://" + socket.Addr().String())
+				t.utpSocket = socket
+				t.utpAcceptor = acceptor.New(socket, t.incomingConnC, t.log)
+				go t.utpAcceptor.Run()
+			}
+		}
+		if t.session.config.PortMappingEnabled {
+			t.portMapper = portmapper.New(t.port, t.session.config.PortMappingLifetime, t.log)
+			t.portMapper.Start()
+		}
 	}
 }
 
@@ -141,7 +190,7 @@ func (t *torrent) startInfoDownloaders() {
 }
 
 func (t *torrent) startPieceDownloaders() {
-	if t.status() != Downloading {
+	if t.status() != Downloading || t.paused {
 		return
 	}
 	for _, src := range t.webseedSources {
@@ -163,7 +212,7 @@ func (t *torrent) startPieceDownloaderForWebseed(src *webseedsource.WebseedSourc
 	if t.webseedActiveDownloads >= t.session.config.WebseedMaxDownloads {
 		return false
 	}
-	if t.status() != Downloading {
+	if t.status() != Downloading || t.paused {
 		return false
 	}
 	sp := t.piecePicker.PickWebseed(src)
@@ -198,6 +247,9 @@ func (t *torrent) startPieceDownloaderFor(pe *peer.Peer) {
 	if t.status() != Downloading {
 		return
 	}
+	if t.paused || t.downloadPeersFull() {
+		return
+	}
 	if t.session.ram == nil {
 		t.startSinglePieceDownloader(pe)
 		return
@@ -218,22 +270,35 @@ func (t *torrent) startSinglePieceDownloader(pe *peer.Peer) {
 	if t.status() != Downloading {
 		return
 	}
+	if t.paused || t.downloadPeersFull() {
+		return
+	}
 	pi, allowedFast := t.piecePicker.PickFor(pe)
 	if pi == nil {
 		return
 	}
-	pd := piecedownloader.New(pi, pe, allowedFast, t.piecePool.Get(int(pi.Length)))
+	pd := piecedownloader.New(pi, pe, allowedFast, t.piecePool.Get(int(pi.Length)), t.requestBlockSize())
 	if _, ok := t.pieceDownloaders[pe]; ok {
 		panic("peer already has a piece downloader")
 	}
 	t.log.Debugf("requesting piece #%d from peer %s", pi.Index, pe.IP())
 	t.pieceDownloaders[pe] = pd
 	pe.Downloading = true
+	t.loadPartialPiece(pd)
 	pd.RequestBlocks(t.maxAllowedRequests(pe))
 	pe.ResetSnubTimer()
 	started = true
 }
 
+// requestBlockSize returns the size of blocks requested from peers.
+func (t *torrent) requestBlockSize() uint32 {
+	size := t.session.config.RequestBlockSize
+	if t.info.PieceLength%size != 0 {
+		return piece.BlockSize
+	}
+	return size
+}
+
 func (t *torrent) maxAllowedRequests(pe *peer.Peer) int {
 	ret := t.session.config.DefaultRequestsOut
 	if pe.ExtensionHandshake != nil && pe.ExtensionHandshake.RequestQueue > 0 {
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"net"
 	"time"
 
 	"github.com/cenkalti/rain/internal/mse"
@@ -14,8 +15,13 @@ type Stats struct {
 	InfoHash InfoHash
 	// Listening port number.
 	Port int
+	// Address of the listening port mapped on NAT device.
+	// Nil if port mapping is disabled or has not succeeded yet.
+	ExternalAddr *net.TCPAddr
 	// Status of the torrent.
 	Status Status
+	// True if the torrent is paused with Torrent.Pause.
+	Paused bool
 	// Contains the error message if torrent is stopped unexpectedly.
 	Error  error
 	Pieces struct {
@@ -74,6 +80,8 @@ type Stats struct {
 		DHT int
 		// Peers found via peer exchange.
 		PEX int
+		// Peers found in local network.
+		LSD int
 	}
 	Downloads struct {
 		// Number of active piece downloads.
@@ -102,6 +110,7 @@ type Stats struct {
 	// Length of a single piece.
 	PieceLength uint32
 	// Duration while the torrent is in Seeding status.
+	// Paused time is not included unless Config.SeedDurationCountsPaused is set.
 	SeededFor time.Duration
 	// Speed is calculated as 1-minute moving average.
 	Speed struct {
@@ -120,12 +129,19 @@ func (t *torrent) stats() Stats {
 	var s Stats
 	s.InfoHash = t.infoHash
 	s.Port = t.port
+	if t.portMapper != nil {
+		if ip, port := t.portMapper.ExternalAddr(); port != 0 {
+			s.ExternalAddr = &net.TCPAddr{IP: ip, Port: port}
+		}
+	}
 	s.Status = t.status()
+	s.Paused = t.paused
 	s.Error = t.lastError
 	s.Addresses.Total = t.addrList.Len()
 	s.Addresses.Tracker = t.addrList.LenSource(peersource.Tracker)
 	s.Addresses.DHT = t.addrList.LenSource(peersource.DHT)
 	s.Addresses.PEX = t.addrList.LenSource(peersource.PEX)
+	s.Addresses.LSD = t.addrList.LenSource(peersource.LSD)
 	s.Handshakes.Incoming = len(t.incomingHandshakers)
 	s.Handshakes.Outgoing = len(t.outgoingHandshakers)
 	s.Handshakes.Total = len(t.incomingHandshakers) + len(t.outgoingHandshakers)
@@ -202,6 +218,15 @@ func (t *torrent) avaliablePieceCount() uint32 {
 	return t.piecePicker.Available()
 }
 
+// bytesLeft returns the number of bytes that are not verified yet. It returns false if metadata is not downloaded yet.
+// Caller must hold mBitfield read lock.
+func (t *torrent) bytesLeft() (int64, bool) {
+	if t.info == nil {
+		return 0, false
+	}
+	return t.info.Length - t.bytesComplete(), true
+}
+
 func (t *torrent) bytesComplete() int64 {
 	if t.bitfield == nil || len(t.pieces) == 0 {
 		return 0
@@ -223,6 +248,7 @@ func (t *torrent) getTrackers() []Tracker {
 			Status:       TrackerStatus(st.Status),
 			Seeders:      st.Seeders,
 			Leechers:     st.Leechers,
+			Peers:        st.Peers,
 			Warning:      st.Warning,
 			LastAnnounce: st.LastAnnounce,
 			NextAnnounce: st.NextAnnounce,
@@ -249,13 +275,15 @@ func (t *torrent) getPeers() []Peer {
 			source = SourceIncoming
 		case peersource.Manual:
 			source = SourceManual
+		case peersource.LSD:
+			source = SourceLSD
 		default:
 			panic("unhandled peer source")
 		}
 		p := Peer{
 			ID:                 pe.ID,
 			Client:             pe.Client(),
-			Addr:               pe.Addr(),
+			Addr:               pe.RemoteAddr(),
 			ConnectedAt:        pe.ConnectedAt,
 			Downloading:        pe.Downloading,
 			ClientInterested:   pe.ClientInterested,
@@ -263,12 +291,13 @@ func (t *torrent) getPeers() []Peer {
 			PeerInterested:     pe.PeerInterested,
 			PeerChoking:        pe.PeerChoking,
 			OptimisticUnchoked: pe.OptimisticUnchoked,
-			Snubbed:            pe.Snubbed,
+			Snubbed:            pe.Snubbed(),
 			EncryptedHandshake: pe.EncryptionCipher != 0,
 			EncryptedStream:    pe.EncryptionCipher == mse.RC4,
 			Source:             source,
 			DownloadSpeed:      pe.DownloadSpeed(),
 			UploadSpeed:        pe.UploadSpeed(),
+			DiscardedBytes:     pe.DiscardedBytes(),
 		}
 		peers = append(peers, p)
 	}
@@ -289,7 +318,7 @@ func (t *torrent) getWebseeds() []Webseed {
 }
 
 func (t *torrent) updateSeedDuration(now time.Time) {
-	if t.status() != Seeding {
+	if t.status() != Seeding || (t.paused && !t.session.config.SeedDurationCountsPaused) {
 		t.seedDurationUpdatedAt = time.Time{}
 		return
 	}
@@ -1,9 +1,13 @@
 package torrent
 
 import (
+	"time"
+
 	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/cachedpiece"
 	"github.com/cenkalti/rain/internal/handshaker/incominghandshaker"
 	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/cenkalti/rain/internal/peerconn"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/rcrowley/go-metrics"
 )
@@ -13,14 +17,50 @@ func (t *torrent) handleStopped() {
 	t.errC <- t.lastError
 	t.errC = nil
 	t.portC = nil
-	if t.doVerify {
+	for _, doneC := range t.stopWaiters {
+		close(doneC)
+	}
+	t.stopWaiters = nil
+	if t.moveDataOnStop {
+		t.moveDataOnStop = false
+		t.startDataMover()
+	} else if t.doVerify {
+		t.mBitfield.Lock()
 		t.bitfield = nil
+		t.mBitfield.Unlock()
 		t.start()
 	} else {
 		t.log.Info("torrent has stopped")
 	}
 }
 
+func (t *torrent) handleStopWait(doneC chan struct{}) {
+	if s := t.status(); s == Stopped || s == Moving {
+		t.startAfterMove = false
+		close(doneC)
+		return
+	}
+	t.stopWaiters = append(t.stopWaiters, doneC)
+	t.stop(nil)
+}
+
+// stopIfCompleted checks the completion after files are opened.
+// Returns true if the torrent is stopped for moving the files or because of the stop after download option.
+func (t *torrent) stopIfCompleted() bool {
+	if !t.checkCompletion() {
+		return false
+	}
+	if t.dataMoveNeeded() {
+		t.stopAndMoveData()
+		return true
+	}
+	if t.stopAfterDownload {
+		t.stopAndSetStoppedOnComplete()
+		return true
+	}
+	return false
+}
+
 func (t *torrent) stopAndSetStoppedOnComplete() {
 	err := t.session.resumer.HandleStopAfterDownload(t.id)
 	if err != nil {
@@ -29,6 +69,45 @@ func (t *torrent) stopAndSetStoppedOnComplete() {
 	t.stop(nil)
 }
 
+// checkSeedLimits stops the torrent if the upload ratio, uploaded bytes or seed duration limit is reached while seeding.
+func (t *torrent) checkSeedLimits() {
+	if t.status() != Seeding {
+		return
+	}
+	if !t.seedLimitReached() {
+		return
+	}
+	t.log.Info("seed limit is reached")
+	err := t.session.resumer.HandleStopAtLimit(t.id)
+	if err != nil {
+		t.log.Errorf("cannot write status to resume db: %s", err)
+	}
+	t.stopAtRatio = 0
+	t.stopAtUploadBytes = 0
+	t.seedDuration = 0
+	select {
+	case <-t.stoppedAtLimitC:
+	default:
+		close(t.stoppedAtLimitC)
+	}
+	t.stop(nil)
+}
+
+func (t *torrent) seedLimitReached() bool {
+	if t.seedDuration > 0 && time.Duration(t.seededFor.Count()) >= t.seedDuration {
+		return true
+	}
+	uploaded := t.bytesUploaded.Count()
+	if t.stopAtUploadBytes > 0 && uploaded >= t.stopAtUploadBytes {
+		return true
+	}
+	downloaded := t.bytesDownloaded.Count()
+	if t.stopAtRatio > 0 && downloaded > 0 && float64(uploaded)/float64(downloaded) >= t.stopAtRatio {
+		return true
+	}
+	return false
+}
+
 func (t *torrent) stopAndSetStoppedOnMetadata() {
 	err := t.session.resumer.HandleStopAfterMetadata(t.id)
 	if err != nil {
@@ -38,8 +117,11 @@ func (t *torrent) stopAndSetStoppedOnMetadata() {
 }
 
 func (t *torrent) stop(err error) {
+	// Keep the torrent stopped after files are moved.
+	t.startAfterMove = false
+
 	s := t.status()
-	if s == Stopping || s == Stopped {
+	if s == Stopping || s == Stopped || s == Moving {
 		return
 	}
 
@@ -50,10 +132,15 @@ func (t *torrent) stop(err error) {
 	}
 
 	t.stopAcceptor()
+	// Must be done before closing peers because piece downloaders are closed with peers.
+	t.savePartialPieces()
 	t.stopPeers()
 	t.stopPiecedownloaders()
 	t.stopInfoDownloaders()
 	t.stopWebseedDownloads()
+	if t.failedWrite != nil {
+		t.dropFailedWrite()
+	}
 
 	if t.bitfield != nil {
 		_ = t.writeBitfield()
@@ -68,6 +155,8 @@ func (t *torrent) stop(err error) {
 
 	// Closing data is necessary to cancel ongoing IO operations on files.
 	t.closeData()
+	// Files may be modified while the torrent is stopped.
+	cachedpiece.Invalidate(t.session.pieceCache, t.peerID)
 	// Data must be closed before closing Allocator.
 	t.stopAllocator()
 	// Data must be closed before closing Verifier.
@@ -130,7 +219,13 @@ func (t *torrent) stopOutgoingHandshakers() {
 	t.log.Debugln("stopping outgoing handshakers")
 	for oh := range t.outgoingHandshakers {
 		oh.Close()
+		t.notifyConnectPeerWaiters(oh.Addr, errHandshakerCancelled)
+		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		t.session.halfOpen.Release()
+		t.session.connLimiter.Release()
 	}
+	t.session.connLimiter.Remove(t.connSlotC)
+	t.session.halfOpen.Remove(t.connSlotC)
 	t.outgoingHandshakers = make(map[*outgoinghandshaker.OutgoingHandshaker]struct{})
 }
 
@@ -138,6 +233,8 @@ func (t *torrent) stopIncomingHandshakers() {
 	t.log.Debugln("stopping incoming handshakers")
 	for ih := range t.incomingHandshakers {
 		ih.Close()
+		delete(t.connectedPeerIPs, peerconn.Host(ih.Conn.RemoteAddr()))
+		t.session.connLimiter.Release()
 	}
 	t.incomingHandshakers = make(map[*incominghandshaker.IncomingHandshaker]struct{})
 }
@@ -151,7 +248,9 @@ func (t *torrent) closeData() {
 		}
 	}
 	t.files = nil
+	t.mBitfield.Lock()
 	t.pieces = nil
+	t.mBitfield.Unlock()
 	t.piecePicker = nil
 	t.bytesAllocated = 0
 	t.checkedPieces = 0
@@ -167,6 +266,12 @@ func (t *torrent) stopPeriodicalAnnouncers() {
 		t.dhtAnnouncer.Close()
 		t.dhtAnnouncer = nil
 	}
+	if t.lsdAnnouncing {
+		for _, l := range t.session.lsd {
+			l.Remove(t.infoHash)
+		}
+		t.lsdAnnouncing = false
+	}
 }
 
 func (t *torrent) stopAcceptor() {
@@ -175,6 +280,16 @@ func (t *torrent) stopAcceptor() {
 		t.acceptor.Close()
 	}
 	t.acceptor = nil
+	if t.utpAcceptor != nil {
+		t.utpAcceptor.Close()
+	}
+	t.utpAcceptor = nil
+	t.utpSocket = nil
+	t.sharedListening = false
+	// Field is not cleared because announcers may still be reading it for sending Stopped event.
+	if t.portMapper != nil && t.portMapper != t.session.portMapper {
+		t.portMapper.Close()
+	}
 }
 
 func (t *torrent) stopPeers() {
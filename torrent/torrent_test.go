@@ -1,16 +1,26 @@
 package torrent
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/cenkalti/log"
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerconn/peerwriter"
+	"github.com/cenkalti/rain/internal/storage/memstorage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	fhttp "github.com/chihaya/chihaya/frontend/http"
 	"github.com/chihaya/chihaya/middleware"
@@ -33,14 +43,23 @@ func init() {
 }
 
 func newTestSession(t *testing.T) (*Session, func()) {
+	return newTestSessionWithConfig(t, nil)
+}
+
+// newTestSessionWithConfig returns a test session. Config is modified with fn before the session is created.
+func newTestSessionWithConfig(t *testing.T, fn func(cfg *Config)) (*Session, func()) {
 	tmp, closeTmp := tempdir(t)
 	cfg := DefaultConfig
 	cfg.Database = filepath.Join(tmp, "session.db")
 	cfg.DataDir = tmp
 	cfg.DHTEnabled = false
+	cfg.LSDEnabled = false
 	cfg.PEXEnabled = false
 	cfg.RPCEnabled = false
 	cfg.Host = "127.0.0.1"
+	if fn != nil {
+		fn(&cfg)
+	}
 	s, err := NewSession(cfg)
 	if err != nil {
 		t.Fatal(err)
@@ -60,12 +79,17 @@ func CopyDir(src, dst string) error {
 }
 
 func seeder(t *testing.T, clearTrackers bool) (addr string, c func()) {
+	return seederWithConfig(t, clearTrackers, nil)
+}
+
+// seederWithConfig starts a seeder in a new session. Config is modified with fn before the session is created.
+func seederWithConfig(t *testing.T, clearTrackers bool, fn func(cfg *Config)) (addr string, c func()) {
 	f, err := os.Open(torrentFile)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer f.Close()
-	s, closeSession := newTestSession(t)
+	s, closeSession := newTestSessionWithConfig(t, fn)
 	opt := &AddTorrentOptions{Stopped: true}
 	tor, err := s.AddTorrent(f, opt)
 	if err != nil {
@@ -93,7 +117,8 @@ func seeder(t *testing.T, clearTrackers bool) (addr string, c func()) {
 	case <-time.After(timeout):
 		t.Fatal("seeder is not ready")
 	}
-	return "127.0.0.1:" + strconv.Itoa(port), func() {
+	ip := net.ParseIP(s.config.Host)
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), func() {
 		closeSession()
 	}
 }
@@ -149,6 +174,697 @@ func TestDownloadTorrent(t *testing.T) {
 	assertCompleted(t, tor)
 }
 
+func TestNotifyStats(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statsC := tor.NotifyStats(10 * time.Millisecond)
+	tor.Start()
+	tor.AddPeer(addr)
+
+	var have uint32
+	timeoutC := time.After(timeout)
+	for done := false; !done; {
+		select {
+		case stats := <-statsC:
+			if stats.Pieces.Have < have {
+				t.Fatalf("completed piece count decreased from %d to %d", have, stats.Pieces.Have)
+			}
+			have = stats.Pieces.Have
+		case <-tor.NotifyComplete():
+			done = true
+		case err := <-tor.NotifyStop():
+			t.Fatal(err)
+		case <-timeoutC:
+			t.Fatal("download did not finish")
+		}
+	}
+	stats := tor.Stats()
+	if stats.Pieces.Have != stats.Pieces.Total {
+		t.Fatalf("have %d pieces, want %d", stats.Pieces.Have, stats.Pieces.Total)
+	}
+	if stats.Bytes.Downloaded == 0 {
+		t.Fatal("downloaded bytes is zero")
+	}
+
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-statsC:
+		for ok {
+			_, ok = <-statsC
+		}
+	case <-time.After(timeout):
+		t.Fatal("stats channel is not closed")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.Pause()
+	if !tor.Paused() {
+		t.Fatal("torrent is not paused")
+	}
+	tor.Start()
+	tor.AddPeer(addr)
+
+	// Wait until the peer is connected and make sure nothing is downloaded while paused.
+	waitStats(t, tor, func(stats Stats) bool { return stats.Peers.Total > 0 })
+	time.Sleep(500 * time.Millisecond)
+	stats := tor.Stats()
+	if stats.Pieces.Have != 0 || stats.Bytes.Downloaded != 0 {
+		t.Fatalf("downloaded %d pieces while paused", stats.Pieces.Have)
+	}
+
+	// Pause again after some pieces are downloaded.
+	tor.Resume()
+	waitStats(t, tor, func(stats Stats) bool { return stats.Pieces.Have > 0 })
+	tor.Pause()
+	// Pending requests complete in short time after pause.
+	time.Sleep(500 * time.Millisecond)
+	have := tor.Stats().Pieces.Have
+	time.Sleep(500 * time.Millisecond)
+	stats = tor.Stats()
+	if stats.Pieces.Have != have && stats.Pieces.Have != stats.Pieces.Total {
+		t.Fatalf("downloaded new pieces while paused: %d -> %d", have, stats.Pieces.Have)
+	}
+	if stats.Peers.Total == 0 {
+		t.Fatal("peer is disconnected on pause")
+	}
+
+	tor.Resume()
+	if tor.Paused() {
+		t.Fatal("torrent is paused after resume")
+	}
+	assertCompleted(t, tor)
+}
+
+func waitStats(t *testing.T, tor *Torrent, cond func(Stats) bool) {
+	timeoutC := time.After(timeout)
+	statsC := tor.NotifyStats(10 * time.Millisecond)
+	for {
+		select {
+		case stats := <-statsC:
+			if cond(stats) {
+				return
+			}
+		case <-timeoutC:
+			t.Fatal("timeout waiting for torrent stats")
+		}
+	}
+}
+
+func TestStopContextAnnouncesStopped(t *testing.T) {
+	var mu sync.Mutex
+	events := make([]string, 0)
+	startedC := make(chan struct{}, 1)
+	trk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := r.URL.Query().Get("event")
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		if event == "started" {
+			select {
+			case startedC <- struct{}{}:
+			default:
+			}
+		}
+		_, _ = w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer trk.Close()
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.AddTracker(trk.URL + "/announce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-startedC:
+	case <-time.After(timeout):
+		t.Fatal("started event is not announced")
+	}
+	// Wait for the response to be processed so the tracker is included in stop announce.
+	for tor.Trackers()[0].Status != Working {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = tor.StopContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	last := events[len(events)-1]
+	mu.Unlock()
+	if last != "stopped" {
+		t.Fatalf("last event is %q, want stopped", last)
+	}
+	if st := tor.Stats().Status; st != Stopped {
+		t.Fatalf("torrent status is %s after stop", st)
+	}
+}
+
+func TestAddTrackersWhileRunning(t *testing.T) {
+	announcedC := make(chan struct{}, 1)
+	trk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case announcedC <- struct{}{}:
+		default:
+		}
+		_, _ = w.Write([]byte("d8:intervali1800e5:peers6:\x7f\x00\x00\x01\x1a\xe1e"))
+	}))
+	defer trk.Close()
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := trk.URL + "/announce"
+	err = tor.AddTrackers([]string{uri, uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-announcedC:
+	case <-time.After(timeout):
+		t.Fatal("new tracker is not announced")
+	}
+	for tor.Trackers()[0].Status != Working {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Adding the same tracker again is no-op.
+	err = tor.AddTrackers([]string{uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trackers := tor.Trackers()
+	if len(trackers) != 1 {
+		t.Fatalf("unexpected trackers: %+v", trackers)
+	}
+	if tr := trackers[0]; tr.URL != uri || tr.Peers != 1 || tr.LastAnnounce.IsZero() || tr.Error != nil {
+		t.Fatalf("unexpected tracker status: %+v", tr)
+	}
+}
+
+func TestTrackerTiers(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("d14:failure reason5:errore"))
+	}))
+	defer bad.Close()
+	announcedC := make(chan struct{}, 1)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case announcedC <- struct{}{}:
+		default:
+		}
+		_, _ = w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer good.Close()
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = s.parseTrackers([][]string{{bad.URL + "/announce"}, {good.URL + "/announce"}}, false)
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-announcedC:
+	case <-time.After(timeout):
+		t.Fatal("second tier is not announced")
+	}
+	for {
+		trackers := tor.Trackers()
+		if trackers[0].Status == NotWorking && trackers[1].Status == Working {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTrackerPeers6(t *testing.T) {
+	addr4, cl := seeder(t, true)
+	defer cl()
+	addr6, cl6 := seederWithConfig(t, true, func(cfg *Config) { cfg.Host = "::1" })
+	defer cl6()
+
+	compact := func(addr string) []byte {
+		a, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := a.IP.To4()
+		if ip == nil {
+			ip = a.IP.To16()
+		}
+		return append(append([]byte(nil), ip...), byte(a.Port>>8), byte(a.Port))
+	}
+	peers := compact(addr4)
+	peers6 := compact(addr6)
+	trk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		b.WriteString("d8:intervali1800e")
+		b.WriteString("5:peers" + strconv.Itoa(len(peers)) + ":")
+		b.Write(peers)
+		b.WriteString("6:peers6" + strconv.Itoa(len(peers6)) + ":")
+		b.Write(peers6)
+		b.WriteString("e")
+		_, _ = w.Write(b.Bytes())
+	}))
+	defer trk.Close()
+
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = s.parseTrackers([][]string{{trk.URL + "/announce"}}, false)
+	// Keep the connections open until peers are checked. Download closes the connections on completion.
+	tor.Pause()
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Outgoing == 2 })
+	connected := make(map[string]bool)
+	for _, pe := range tor.Peers() {
+		connected[pe.Addr.String()] = true
+	}
+	if !connected[addr4] || !connected[addr6] {
+		t.Fatalf("peers are not connected: %v", connected)
+	}
+	tor.Resume()
+	assertCompleted(t, tor)
+}
+
+func TestStopAtSeedLimits(t *testing.T) {
+	cases := []struct {
+		name       string
+		opt        AddTorrentOptions
+		downloaded int64
+	}{
+		{"ratio", AddTorrentOptions{StopAtRatio: 2}, 1000},
+		{"ratio skipped without download", AddTorrentOptions{StopAtRatio: 2, StopAtUploadBytes: 2000}, 0},
+		{"upload bytes", AddTorrentOptions{StopAtUploadBytes: 2000}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, closeSession := newTestSession(t)
+			defer closeSession()
+			tor := addCompletedTorrent(t, s, tc.opt)
+			tor.torrent.bytesDownloaded.Inc(tc.downloaded)
+			tor.Start()
+			waitStats(t, tor, func(stats Stats) bool { return stats.Status == Seeding })
+
+			upload := func(n uint32) {
+				tor.torrent.messages <- peer.ReceivedMessage{Message: peerwriter.BlockUploaded{Length: n}}
+			}
+			upload(1500)
+			select {
+			case <-tor.NotifyStopped():
+				t.Fatal("stopped before reaching the limit")
+			case <-time.After(100 * time.Millisecond):
+			}
+			upload(500)
+			select {
+			case <-tor.NotifyStopped():
+			case <-time.After(timeout):
+				t.Fatal("torrent is not stopped at limit")
+			}
+			waitStats(t, tor, func(stats Stats) bool { return stats.Status == Stopped })
+
+			// Limits are cleared after stop so the torrent can be seeded again.
+			tor.Start()
+			waitStats(t, tor, func(stats Stats) bool { return stats.Status == Seeding })
+			upload(10000)
+			time.Sleep(100 * time.Millisecond)
+			if st := tor.Stats().Status; st != Seeding {
+				t.Fatalf("torrent is stopped twice, status: %s", st)
+			}
+		})
+	}
+}
+
+func TestStopAtSeedDuration(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tor := addCompletedTorrent(t, s, AddTorrentOptions{SeedDuration: time.Second})
+	tor.Start()
+	waitStats(t, tor, func(stats Stats) bool { return stats.Status == Seeding })
+	completedAt := time.Now()
+
+	// Paused time is not counted as seeding time by default.
+	tor.Pause()
+	time.Sleep(time.Second)
+	tor.Resume()
+
+	select {
+	case <-tor.NotifyStopped():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not stopped after seed duration")
+	}
+	if elapsed := time.Since(completedAt); elapsed < 2*time.Second {
+		t.Fatalf("torrent is stopped %s after completion", elapsed)
+	}
+	waitStats(t, tor, func(stats Stats) bool { return stats.Status == Stopped })
+}
+
+type recordingLogHandler struct {
+	m       sync.Mutex
+	loggers map[string]int
+}
+
+func newRecordingLogHandler() *recordingLogHandler {
+	return &recordingLogHandler{loggers: make(map[string]int)}
+}
+
+func (h *recordingLogHandler) SetFormatter(log.Formatter) {}
+func (h *recordingLogHandler) SetLevel(log.Level)         {}
+func (h *recordingLogHandler) Close() error               { return nil }
+func (h *recordingLogHandler) Handle(rec *log.Record) {
+	h.m.Lock()
+	h.loggers[rec.LoggerName]++
+	h.m.Unlock()
+}
+
+func (h *recordingLogHandler) count(name string) int {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.loggers[name]
+}
+
+func TestLogHandler(t *testing.T) {
+	sessionHandler := newRecordingLogHandler()
+	torrentHandler := newRecordingLogHandler()
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.LogHandler = sessionHandler
+	})
+	defer closeSession()
+	tor1 := addCompletedTorrent(t, s, AddTorrentOptions{})
+	tor2 := addCompletedTorrent(t, s, AddTorrentOptions{LogHandler: torrentHandler})
+	tor1.Start()
+	tor2.Start()
+	waitStats(t, tor1, func(stats Stats) bool { return stats.Status == Seeding })
+	waitStats(t, tor2, func(stats Stats) bool { return stats.Status == Seeding })
+
+	if sessionHandler.count("session") == 0 {
+		t.Error("no session message in session handler")
+	}
+	if sessionHandler.count("torrent "+tor1.ID()) == 0 {
+		t.Error("no torrent message in session handler")
+	}
+	if torrentHandler.count("torrent "+tor2.ID()) == 0 {
+		t.Error("no torrent message in torrent handler")
+	}
+	if sessionHandler.count("torrent "+tor2.ID()) != 0 {
+		t.Error("torrent message is sent to session handler")
+	}
+}
+
+// addCompletedTorrent adds the test torrent in stopped state with all of its data already in place.
+func addCompletedTorrent(t *testing.T, s *Session, opt AddTorrentOptions) *Torrent {
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	opt.Stopped = true
+	tor, err := s.AddTorrent(f, &opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(s.config.DataDir, tor.ID()), os.ModeDir|s.config.FilePermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(s.config.DataDir, tor.ID(), torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	return tor
+}
+
+func TestIncomingConnection(t *testing.T) {
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	seed := addCompletedTorrent(t, s1, AddTorrentOptions{})
+	seed.Start()
+	var port int
+	select {
+	case port = <-seed.torrent.NotifyListen():
+	case <-time.After(timeout):
+		t.Fatal("seeder is not listening")
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tor, err := s2.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the connection open until peers are checked. Download closes the connection on completion.
+	tor.Pause()
+	tor.AddPeer("127.0.0.1:" + strconv.Itoa(port))
+
+	waitStats(t, seed, func(st Stats) bool { return st.Peers.Incoming == 1 })
+	waitStats(t, tor, func(st Stats) bool { return st.Peers.Outgoing == 1 })
+	if peers := seed.Peers(); len(peers) != 1 || peers[0].Source != SourceIncoming {
+		t.Fatalf("unexpected peers of seeder: %+v", peers)
+	}
+	if peers := tor.Peers(); len(peers) != 1 || peers[0].Source != SourceManual {
+		t.Fatalf("unexpected peers of leecher: %+v", peers)
+	}
+	tor.Resume()
+	assertCompleted(t, tor)
+}
+
+func TestMoveOnCompletion(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	s.config.CompletedDataDir = filepath.Join(s.config.DataDir, "complete")
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tor, err := s.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.AddPeer(addr)
+	select {
+	case <-tor.NotifyComplete():
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	waitStats(t, tor, func(st Stats) bool { return st.Status == Seeding })
+
+	dest := filepath.Join(s.config.CompletedDataDir, tor.ID())
+	if dir := tor.torrent.rootDir(); dir != dest {
+		t.Fatalf("torrent is seeding from %s", dir)
+	}
+	cmd := exec.Command("diff", "-rq", filepath.Join(torrentDataDir, torrentName), filepath.Join(dest, torrentName))
+	if err = cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID(), torrentName)); !os.IsNotExist(err) {
+		t.Fatal("files are not removed from data dir")
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Dest != dest {
+		t.Fatalf("invalid dest in resume db: %q", spec.Dest)
+	}
+
+	// Download from the moved files.
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor2, err := s2.AddTorrent(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor2.AddPeer("127.0.0.1:" + strconv.Itoa(tor.torrent.port))
+	assertCompleted(t, tor2)
+}
+
+func TestDownloadMemStorage(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sto := memstorage.New(tor.torrent.info.Length)
+	tor.torrent.storage = sto
+	tor.Start()
+	tor.AddPeer(addr)
+
+	select {
+	case <-tor.NotifyComplete():
+	case err = <-tor.NotifyStop():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+	for _, fi := range tor.torrent.info.Files {
+		if fi.Padding {
+			continue
+		}
+		expected, err := os.ReadFile(filepath.Join(torrentDataDir, fi.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mf, exists, err := sto.Open(fi.Path, fi.Length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatalf("file does not exist in storage: %s", fi.Path)
+		}
+		data := make([]byte, fi.Length)
+		_, err = mf.ReadAt(data, 0)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("invalid data in file: %s", fi.Path)
+		}
+	}
+}
+
+func TestMemStorageFull(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	opt := &AddTorrentOptions{Stopped: true}
+	tor, err := s.AddTorrent(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.storage = memstorage.New(tor.torrent.info.Length - 1)
+	tor.torrent.trackers = nil
+	tor.Start()
+
+	waitStats(t, tor, func(stats Stats) bool { return stats.Status == Stopped })
+	if err = tor.Stats().Error; !errors.Is(err, memstorage.ErrStorageFull) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func startHTTPTracker(t *testing.T) (stop func()) {
 	responseConfig := middleware.ResponseConfig{
 		AnnounceInterval: time.Minute,
@@ -244,3 +960,132 @@ func assertCompleted(t *testing.T, tor *Torrent) {
 		t.Fatal(err)
 	}
 }
+
+func TestDownloadedUploadedLeft(t *testing.T) {
+	addr, cl := seeder(t, true)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tor := addCompletedTorrent(t, s, AddTorrentOptions{})
+	if tor.Left() != tor.torrent.info.Length {
+		t.Fatalf("left is %d before verification, want %d", tor.Left(), tor.torrent.info.Length)
+	}
+
+	// Corrupt a single piece in the middle of the file of zeros.
+	f, err := os.OpenFile(filepath.Join(s.config.DataDir, tor.ID(), torrentName, "data", "zero.bin"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte{0xff}, 5<<20)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.Start()
+	waitStats(t, tor, func(stats Stats) bool { return stats.Status == Downloading })
+
+	var completed int64
+	tor.torrent.mBitfield.RLock()
+	for i := range tor.torrent.pieces {
+		if tor.torrent.bitfield.Test(uint32(i)) {
+			completed += int64(tor.torrent.pieces[i].Length)
+		}
+	}
+	tor.torrent.mBitfield.RUnlock()
+	if completed == tor.torrent.info.Length || completed == 0 {
+		t.Fatalf("unexpected completed bytes: %d", completed)
+	}
+	if left := tor.Left(); left != tor.torrent.info.Length-completed {
+		t.Fatalf("left is %d, want %d", left, tor.torrent.info.Length-completed)
+	}
+	if tor.Downloaded() != 0 || tor.Uploaded() != 0 {
+		t.Fatalf("unexpected counters: downloaded=%d uploaded=%d", tor.Downloaded(), tor.Uploaded())
+	}
+
+	tor.AddPeer(addr)
+	assertCompleted(t, tor)
+	if tor.Left() != 0 {
+		t.Fatalf("left is %d after completion", tor.Left())
+	}
+	if d := tor.Downloaded(); d < tor.torrent.info.Length-completed || d > tor.torrent.info.Length {
+		t.Fatalf("invalid downloaded bytes: %d", d)
+	}
+	if tr := tor.torrent.announcerFields(); tr.BytesLeft != tor.Left() || tr.BytesDownloaded != tor.Downloaded() || tr.BytesUploaded != tor.Uploaded() {
+		t.Fatalf("announced values differ: %+v", tr)
+	}
+}
+
+func TestLeftMagnet(t *testing.T) {
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.Left() != -1 {
+		t.Fatalf("left is %d without metadata", tor.Left())
+	}
+}
+
+func TestAnnounceUserAgentAndKey(t *testing.T) {
+	type announce struct {
+		userAgent, key, event string
+	}
+	announceC := make(chan announce, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		announceC <- announce{userAgent: r.UserAgent(), key: q.Get("key"), event: q.Get("event")}
+		_, _ = w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer srv.Close()
+	s, closeSession := newTestSessionWithConfig(t, func(cfg *Config) {
+		cfg.TrackerHTTPPublicUserAgent = "test-agent/1.0"
+	})
+	defer closeSession()
+
+	var announces []announce
+	waitAnnounce := func() {
+		select {
+		case a := <-announceC:
+			announces = append(announces, a)
+		case <-time.After(timeout):
+			t.Fatal("no announce")
+		}
+	}
+	for _, uri := range []string{torrentMagnetLink, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"} {
+		tor, err := s.AddURI(uri+"&tr="+srv.URL+"/announce", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitAnnounce()
+		// Stopped event is sent only to trackers that responded to the started event.
+		for deadline := time.Now().Add(timeout); ; time.Sleep(10 * time.Millisecond) {
+			if trs := tor.Trackers(); len(trs) == 1 && trs[0].Status == Working {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("tracker is not working")
+			}
+		}
+		err = tor.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitAnnounce()
+	}
+	key := announces[0].key
+	if len(key) != 8 {
+		t.Fatalf("invalid key: %q", key)
+	}
+	for _, a := range announces {
+		if a.userAgent != "test-agent/1.0" {
+			t.Fatalf("invalid user agent: %q", a.userAgent)
+		}
+		if a.key != key {
+			t.Fatalf("key changed from %q to %q in %q event", key, a.key, a.event)
+		}
+	}
+	if announces[1].event != "stopped" {
+		t.Fatalf("unexpected event: %q", announces[1].event)
+	}
+}
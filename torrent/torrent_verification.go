@@ -8,10 +8,16 @@ import (
 )
 
 func (t *torrent) handleVerifyCommand() {
+	if t.status() == Moving {
+		t.log.Warning("cannot verify while files are being moved")
+		return
+	}
 	t.log.Info("verifying")
 	t.doVerify = true
 	if t.status() == Stopped {
+		t.mBitfield.Lock()
 		t.bitfield = nil
+		t.mBitfield.Unlock()
 		t.start()
 	} else {
 		t.stop(nil)
@@ -33,6 +39,7 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	t.mBitfield.Lock()
 	t.bitfield = ve.Bitfield
 	t.mBitfield.Unlock()
+	t.pieceCond.Broadcast()
 
 	// Save the bitfield to resume db.
 	err := t.writeBitfield()
@@ -41,14 +48,12 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 		return
 	}
 
-	var haveMessages []peerprotocol.HaveMessage
+	var haves []uint32
 
 	// Mark downloaded pieces.
-	for i := uint32(0); i < t.bitfield.Len(); i++ {
-		if t.bitfield.Test(i) {
-			t.pieces[i].Done = true
-			haveMessages = append(haveMessages, peerprotocol.HaveMessage{Index: i})
-		}
+	for i, ok := t.bitfield.NextSet(0); ok; i, ok = t.bitfield.NextSet(i + 1) {
+		t.setPieceDone(i)
+		haves = append(haves, i)
 	}
 
 	// We may detect missing pieces after verification. Then, status must be set from Seeding to Downloading.
@@ -68,14 +73,17 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 
 	// Tell connected peers that pieces we have.
 	for pe := range t.peers {
-		for _, msg := range haveMessages {
-			pe.SendMessage(msg)
+		if len(haves) > t.session.config.PeerHaveBatchThreshold {
+			pe.SendHaves(haves)
+		} else {
+			for _, i := range haves {
+				pe.SendMessage(peerprotocol.HaveMessage{Index: i})
+			}
 		}
 		t.updateInterestedState(pe)
 	}
 
-	if t.checkCompletion() && t.stopAfterDownload {
-		t.stopAndSetStoppedOnComplete()
+	if t.stopIfCompleted() {
 		return
 	}
 	t.processQueuedMessages()
@@ -3,6 +3,7 @@ package torrent
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/peerprotocol"
@@ -11,6 +12,14 @@ import (
 )
 
 func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
+	if pw.HashOK && pw.Error != nil && t.pauseOnWriteError() {
+		t.log.Errorln("cannot write piece, pausing torrent:", pw.Error)
+		t.lastError = pw.Error
+		t.failedWrite = pw
+		t.pause()
+		return
+	}
+
 	pw.Piece.Writing = false
 
 	t.pieceMessagesC.Resume()
@@ -18,8 +27,18 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 
 	pw.Buffer.Release()
 
+	// Saved blocks are either written with the piece or corrupt.
+	delete(t.partialPieces, pw.Piece.Index)
+
 	if !pw.HashOK {
 		t.bytesWasted.Inc(int64(len(pw.Buffer.Data)))
+		if pw.Restored {
+			// Corrupt data may be in the blocks saved from other peers, so the source is not banned.
+			// Saved blocks are discarded above and the piece is downloaded again.
+			t.log.Debugf("piece #%d with saved blocks is corrupt", pw.Piece.Index)
+			t.startPieceDownloaders()
+			return
+		}
 		switch src := pw.Source.(type) {
 		case *peer.Peer:
 			t.log.Debugln("received corrupt piece from peer", src.String())
@@ -39,13 +58,15 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 		return
 	}
 
-	pw.Piece.Done = true
+	t.setPieceDone(pw.Piece.Index)
 	if t.bitfield.Test(pw.Piece.Index) {
 		panic(fmt.Sprintf("already have the piece #%d", pw.Piece.Index))
 	}
 	t.mBitfield.Lock()
 	t.bitfield.Set(pw.Piece.Index)
 	t.mBitfield.Unlock()
+	t.pieceCond.Broadcast()
+	t.notifyPieceComplete(pw.Piece.Index)
 
 	if t.piecePicker != nil {
 		_, ok := pw.Source.(*urldownloader.URLDownloader)
@@ -64,18 +85,17 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 			pd2.CancelPending()
 			t.startPieceDownloaderFor(pe)
 		}
+		// Idle peers may be waiting for a slot if the number of active pieces is limited.
+		if t.session.config.MaxActivePieces > 0 {
+			t.startPieceDownloaders()
+		}
 	}
 
-	// Tell everyone that we have this piece
 	for pe := range t.peers {
 		t.updateInterestedState(pe)
-		if pe.Bitfield.Test(pw.Piece.Index) {
-			// Skip peers having the piece to save bandwidth
-			continue
-		}
-		msg := peerprotocol.HaveMessage{Index: pw.Piece.Index}
-		pe.SendMessage(msg)
 	}
+	// Tell everyone that we have this piece
+	t.sendHave(pw.Piece.Index)
 
 	completed := t.checkCompletion()
 	if completed {
@@ -83,8 +103,92 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 		err := t.writeBitfield()
 		if err != nil {
 			t.stop(err)
+		} else if t.dataMoveNeeded() {
+			t.stopAndMoveData()
 		} else if t.stopAfterDownload {
 			t.stopAndSetStoppedOnComplete()
 		}
 	}
 }
+
+// sendHave sends a "have" message for the piece to connected peers.
+// If Config.PeerHaveBatchWindow is set, messages are sent later together with the other pieces completed in the window.
+func (t *torrent) sendHave(index uint32) {
+	window := t.session.config.PeerHaveBatchWindow
+	if window <= 0 {
+		for pe := range t.peers {
+			if pe.Bitfield.Test(index) {
+				// Skip peers having the piece to save bandwidth
+				continue
+			}
+			pe.SendMessage(peerprotocol.HaveMessage{Index: index})
+		}
+		return
+	}
+	t.pendingHaves = append(t.pendingHaves, index)
+	if len(t.pendingHaves) == 1 {
+		go t.notifyHaveFlush(window)
+	}
+}
+
+func (t *torrent) notifyHaveFlush(delay time.Duration) {
+	select {
+	case <-time.After(delay):
+		select {
+		case t.haveFlushC <- struct{}{}:
+		case <-t.closeC:
+		}
+	case <-t.closeC:
+	}
+}
+
+// flushHaves sends "have" messages for the pieces completed in the batch window.
+// If there are more than Config.PeerHaveBatchThreshold messages for a peer, they are written to the connection at once.
+func (t *torrent) flushHaves() {
+	pending := t.pendingHaves
+	t.pendingHaves = nil
+	for pe := range t.peers {
+		indexes := make([]uint32, 0, len(pending))
+		for _, i := range pending {
+			// Skip peers having the piece to save bandwidth
+			if !pe.Bitfield.Test(i) {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) > t.session.config.PeerHaveBatchThreshold {
+			pe.SendHaves(indexes)
+			continue
+		}
+		for _, i := range indexes {
+			pe.SendMessage(peerprotocol.HaveMessage{Index: i})
+		}
+	}
+}
+
+// pauseOnWriteError returns true if the torrent must be paused, instead of stopped, after a piece cannot be written.
+// Writes fail after the torrent is stopped because files are closed. These errors are ignored as before.
+func (t *torrent) pauseOnWriteError() bool {
+	if t.session.config.DiskErrorPolicy != DiskErrorPause {
+		return false
+	}
+	status := t.status()
+	return status != Stopped && status != Stopping && status != Moving
+}
+
+// retryFailedWrite writes the piece that is kept after a write error again.
+func (t *torrent) retryFailedWrite() {
+	pw := t.failedWrite
+	t.failedWrite = nil
+	t.lastError = nil
+	go pw.Run(t.pieceWriterResultC, t.doneC, t.session.metrics.WritesPerSecond, t.session.metrics.SpeedWrite, t.session.semWrite)
+}
+
+// dropFailedWrite discards the piece that is kept after a write error. The piece is downloaded again.
+func (t *torrent) dropFailedWrite() {
+	pw := t.failedWrite
+	t.failedWrite = nil
+	pw.Piece.Writing = false
+	pw.Buffer.Release()
+	t.pieceMessagesC.Resume()
+	t.webseedPieceResultC.Resume()
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+)
+
+type writeCounter struct {
+	net.Conn
+	writes int32
+}
+
+func (c *writeCounter) Write(b []byte) (int, error) {
+	atomic.AddInt32(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func TestHaveBatch(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	wc := &writeCounter{Conn: c1}
+	var id [20]byte
+	var ext [8]byte
+	pe := peer.New(wc, peersource.Manual, id, ext, 0, time.Minute, 0, time.Minute, 10, 0, nil, nil, nil, nil)
+	go pe.Run(nil, nil, nil, nil)
+	defer pe.Close()
+	pe.Bitfield = bitfield.New(10)
+	pe.Bitfield.Set(2)
+
+	cfg := DefaultConfig
+	cfg.PeerHaveBatchWindow = time.Hour
+	cfg.PeerHaveBatchThreshold = 4
+	closeC := make(chan chan struct{})
+	defer close(closeC)
+	tor := &torrent{
+		session:    &Session{config: cfg},
+		peers:      map[*peer.Peer]struct{}{pe: {}},
+		haveFlushC: make(chan struct{}),
+		closeC:     closeC,
+	}
+
+	// flush sends the pending haves and reads them from the remote side of connection.
+	// Returns the number of writes done for them.
+	flush := func(expected ...uint32) int32 {
+		before := atomic.LoadInt32(&wc.writes)
+		tor.flushHaves()
+		_ = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for _, index := range expected {
+			var b [9]byte
+			if _, err := io.ReadFull(c2, b[:]); err != nil {
+				t.Fatal(err)
+			}
+			if b[4] != byte(peerprotocol.Have) || binary.BigEndian.Uint32(b[5:]) != index {
+				t.Fatalf("unexpected message: %v", b)
+			}
+		}
+		return atomic.LoadInt32(&wc.writes) - before
+	}
+
+	// Messages for pieces that the peer has are not sent. Remaining count is not over the threshold.
+	for i := uint32(0); i < 5; i++ {
+		tor.sendHave(i)
+	}
+	if len(tor.pendingHaves) != 5 {
+		t.Fatalf("unexpected pending haves: %v", tor.pendingHaves)
+	}
+	if n := flush(0, 1, 3, 4); n != 4 {
+		t.Fatalf("unexpected number of writes: %d", n)
+	}
+
+	// Messages are coalesced into a single write.
+	for i := uint32(5); i < 10; i++ {
+		tor.sendHave(i)
+	}
+	if n := flush(5, 6, 7, 8, 9); n != 1 {
+		t.Fatalf("unexpected number of writes: %d", n)
+	}
+	if len(tor.pendingHaves) != 0 {
+		t.Fatalf("unexpected pending haves: %v", tor.pendingHaves)
+	}
+}